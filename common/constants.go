@@ -205,6 +205,11 @@ var (
 	SearchRateLimitEnable         = true
 	SearchRateLimitNum            = 10
 	SearchRateLimitDuration int64 = 60
+
+	// Per-user count_tokens rate limit, separate from the model request rate limit
+	CountTokensRateLimitEnable         = true
+	CountTokensRateLimitNum            = 60
+	CountTokensRateLimitDuration int64 = 60
 )
 
 var RateLimitKeyExpirationDuration = 20 * time.Minute
@@ -219,6 +224,7 @@ const (
 	TokenStatusDisabled  = 2 // also don't use 0
 	TokenStatusExpired   = 3
 	TokenStatusExhausted = 4
+	TokenStatusSuspended = 5 // 退款扣回后用户余额为负，余额恢复后自动启用
 )
 
 const (
@@ -245,4 +251,8 @@ const (
 	TopUpStatusSuccess = "success"
 	TopUpStatusFailed  = "failed"
 	TopUpStatusExpired = "expired"
+	// 以下状态由退款、争议产生，订单此前已到账
+	TopUpStatusPartiallyRefunded = "partially_refunded"
+	TopUpStatusRefunded          = "refunded"
+	TopUpStatusDisputed          = "disputed"
 )
@@ -30,6 +30,22 @@ func GetDiskCacheDir() string {
 	return filepath.Join(cachePath, diskCacheDir)
 }
 
+// 文件接口（/v1/files）持久化目录名，与临时缓存目录分开，避免被过期清理
+const fileStoreDir = "new-api-files"
+
+// GetFileStoreDir 获取文件接口的本地存储目录
+// customPath 为空时与磁盘缓存共用同一根目录
+func GetFileStoreDir(customPath string) string {
+	if customPath != "" {
+		return customPath
+	}
+	cachePath := GetDiskCachePath()
+	if cachePath == "" {
+		cachePath = os.TempDir()
+	}
+	return filepath.Join(cachePath, fileStoreDir)
+}
+
 // EnsureDiskCacheDir 确保缓存目录存在
 func EnsureDiskCacheDir() error {
 	dir := GetDiskCacheDir()
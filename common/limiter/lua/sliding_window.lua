@@ -0,0 +1,24 @@
+-- 滑动窗口计数器（前后两个固定窗口加权）
+-- KEYS[1]: 当前窗口计数键
+-- KEYS[2]: 上一窗口计数键
+-- ARGV[1]: 本次计入的数量
+-- ARGV[2]: 上限
+-- ARGV[3]: 上一窗口的权重 (0~1)
+-- ARGV[4]: 计数键过期时间（秒）
+
+local amount = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local weight = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+local previous = tonumber(redis.call('GET', KEYS[2]) or '0')
+local used = math.max(current, 0) + math.floor(math.max(previous, 0) * weight)
+
+if used + amount > limit then
+    return {0, used}
+end
+
+redis.call('INCRBY', KEYS[1], amount)
+redis.call('EXPIRE', KEYS[1], ttl)
+return {1, used}
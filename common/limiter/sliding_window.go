@@ -0,0 +1,134 @@
+package limiter
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//go:embed lua/sliding_window.lua
+var slidingWindowScript string
+
+// SlidingWindowCounter 滑动窗口计数器：用量 = 本窗口计数 + 上一窗口计数 × 上一窗口仍在滑动窗口内的比例
+type SlidingWindowCounter interface {
+	// Acquire 在 used+amount 不超过 limit 时计入 amount，返回计入前的用量与本次计入的窗口键
+	Acquire(ctx context.Context, key string, limit, amount int64) (ok bool, used int64, bucket string, err error)
+	// Add 向 Acquire 返回的窗口键追加 delta（可为负），不做上限检查
+	Add(ctx context.Context, bucket string, delta int64) error
+}
+
+// slidingWindowBuckets 返回当前与上一窗口的计数键，以及上一窗口的权重
+func slidingWindowBuckets(key string, window time.Duration, now time.Time) (string, string, float64) {
+	size := window.Milliseconds()
+	index := now.UnixMilli() / size
+	elapsed := float64(now.UnixMilli()-index*size) / float64(size)
+	return fmt.Sprintf("%s:%d", key, index), fmt.Sprintf("%s:%d", key, index-1), 1 - elapsed
+}
+
+type RedisSlidingWindow struct {
+	client *redis.Client
+	window time.Duration
+	script *redis.Script
+}
+
+func NewRedisSlidingWindow(r *redis.Client, window time.Duration) *RedisSlidingWindow {
+	return &RedisSlidingWindow{
+		client: r,
+		window: window,
+		script: redis.NewScript(slidingWindowScript),
+	}
+}
+
+func (w *RedisSlidingWindow) Acquire(ctx context.Context, key string, limit, amount int64) (bool, int64, string, error) {
+	current, previous, weight := slidingWindowBuckets(key, w.window, time.Now())
+	result, err := w.script.Run(ctx, w.client, []string{current, previous},
+		amount, limit, strconv.FormatFloat(weight, 'f', 4, 64), int64(2*w.window/time.Second)).Int64Slice()
+	if err != nil {
+		return false, 0, "", fmt.Errorf("sliding window acquire failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, "", fmt.Errorf("sliding window acquire failed: unexpected result %v", result)
+	}
+	return result[0] == 1, result[1], current, nil
+}
+
+func (w *RedisSlidingWindow) Add(ctx context.Context, bucket string, delta int64) error {
+	pipe := w.client.TxPipeline()
+	pipe.IncrBy(ctx, bucket, delta)
+	pipe.Expire(ctx, bucket, 2*w.window)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+type slidingWindowEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+// MemorySlidingWindow 进程内实现，未启用 Redis 时使用
+type MemorySlidingWindow struct {
+	mu        sync.Mutex
+	window    time.Duration
+	values    map[string]*slidingWindowEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemorySlidingWindow(window time.Duration) *MemorySlidingWindow {
+	return &MemorySlidingWindow{
+		window: window,
+		values: make(map[string]*slidingWindowEntry),
+		now:    time.Now,
+	}
+}
+
+func (w *MemorySlidingWindow) get(key string, now time.Time) int64 {
+	entry, ok := w.values[key]
+	if !ok || now.After(entry.expireAt) || entry.value < 0 {
+		return 0
+	}
+	return entry.value
+}
+
+func (w *MemorySlidingWindow) add(key string, delta int64, now time.Time) {
+	if now.Sub(w.lastSweep) > w.window {
+		for k, entry := range w.values {
+			if now.After(entry.expireAt) {
+				delete(w.values, k)
+			}
+		}
+		w.lastSweep = now
+	}
+	entry, ok := w.values[key]
+	if !ok || now.After(entry.expireAt) {
+		entry = &slidingWindowEntry{}
+		w.values[key] = entry
+	}
+	entry.value += delta
+	entry.expireAt = now.Add(2 * w.window)
+}
+
+func (w *MemorySlidingWindow) Acquire(_ context.Context, key string, limit, amount int64) (bool, int64, string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	current, previous, weight := slidingWindowBuckets(key, w.window, now)
+	used := w.get(current, now) + int64(float64(w.get(previous, now))*weight)
+	if used+amount > limit {
+		return false, used, current, nil
+	}
+	w.add(current, amount, now)
+	return true, used, current, nil
+}
+
+func (w *MemorySlidingWindow) Add(_ context.Context, bucket string, delta int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.add(bucket, delta, w.now())
+	return nil
+}
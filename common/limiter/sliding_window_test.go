@@ -0,0 +1,44 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemorySlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(6000, 0) // 窗口起点
+	counter := NewMemorySlidingWindow(time.Minute)
+	counter.now = func() time.Time { return now }
+
+	ok, used, bucket, err := counter.Acquire(ctx, "k", 100, 80)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Zero(t, used)
+
+	ok, used, _, _ = counter.Acquire(ctx, "k", 100, 30)
+	require.False(t, ok)
+	require.EqualValues(t, 80, used)
+
+	// 结算修正后释放额度
+	require.NoError(t, counter.Add(ctx, bucket, -50))
+	ok, _, _, _ = counter.Acquire(ctx, "k", 100, 30)
+	require.True(t, ok)
+
+	// 进入下一窗口 15 秒：上一窗口 60 × 0.75 = 45
+	now = now.Add(75 * time.Second)
+	ok, used, _, _ = counter.Acquire(ctx, "k", 100, 60)
+	require.False(t, ok)
+	require.EqualValues(t, 45, used)
+	ok, _, _, _ = counter.Acquire(ctx, "k", 100, 55)
+	require.True(t, ok)
+
+	// 两个窗口之后全部过期
+	now = now.Add(2 * time.Minute)
+	ok, used, _, _ = counter.Acquire(ctx, "k", 100, 100)
+	require.True(t, ok)
+	require.Zero(t, used)
+}
@@ -0,0 +1,207 @@
+package common
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 信封加密的密文格式：enc:v1:<主密钥 ID>:<被主密钥加密的数据密钥>:<被数据密钥加密的明文>
+const secretEnvelopePrefix = "enc:v1:"
+
+const secretMasterKeySize = 32
+
+var (
+	secretMasterKeys      map[string][]byte
+	secretCurrentMasterID string
+)
+
+var ErrSecretMasterKeyMissing = errors.New("secret master key not configured")
+
+// InitSecretEncryption 从 SECRET_ENCRYPTION_KEYS 或 SECRET_ENCRYPTION_KEY_FILE 读取主密钥。
+// 格式为 id:base64(32 字节)，多个主密钥以逗号或换行分隔，第一个用于加密，其余仅用于解密以便轮换。
+// 未配置时不加密，已加密的数据无法解密
+func InitSecretEncryption() error {
+	raw := os.Getenv("SECRET_ENCRYPTION_KEYS")
+	if path := os.Getenv("SECRET_ENCRYPTION_KEY_FILE"); raw == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read secret encryption key file: %w", err)
+		}
+		raw = string(data)
+	}
+	return SetSecretMasterKeys(raw)
+}
+
+// SetSecretMasterKeys 解析主密钥列表，raw 为空时关闭加密
+func SetSecretMasterKeys(raw string) error {
+	keys := make(map[string][]byte)
+	currentID := ""
+	for _, line := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(line, ":")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" {
+			return errors.New("secret encryption key must be in id:base64 format")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != secretMasterKeySize {
+			return fmt.Errorf("secret encryption key %s must be %d bytes encoded in base64", id, secretMasterKeySize)
+		}
+		if _, exists := keys[id]; exists {
+			return fmt.Errorf("duplicate secret encryption key id: %s", id)
+		}
+		keys[id] = key
+		if currentID == "" {
+			currentID = id
+		}
+	}
+	secretMasterKeys = keys
+	secretCurrentMasterID = currentID
+	return nil
+}
+
+// SecretEncryptionEnabled 是否配置了用于加密的主密钥
+func SecretEncryptionEnabled() bool {
+	return secretCurrentMasterID != ""
+}
+
+// SecretCurrentMasterKeyID 返回当前用于加密的主密钥 ID
+func SecretCurrentMasterKeyID() string {
+	return secretCurrentMasterID
+}
+
+// IsEncryptedSecret 是否为信封加密后的密文
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretEnvelopePrefix)
+}
+
+// SecretMasterKeyID 返回密文使用的主密钥 ID，明文返回空字符串
+func SecretMasterKeyID(value string) string {
+	if !IsEncryptedSecret(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, secretEnvelopePrefix), ":")
+	return id
+}
+
+// SecretNeedsReencryption 明文或使用旧主密钥加密的值需要用当前主密钥重新加密
+func SecretNeedsReencryption(value string) bool {
+	if value == "" || !SecretEncryptionEnabled() {
+		return false
+	}
+	return SecretMasterKeyID(value) != secretCurrentMasterID
+}
+
+// EncryptSecret 使用随机数据密钥加密明文，再用当前主密钥加密数据密钥。
+// 未配置主密钥、值为空或已是密文时原样返回
+func EncryptSecret(plaintext string) (string, error) {
+	if plaintext == "" || !SecretEncryptionEnabled() || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	dataKey := make([]byte, secretMasterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealSecret(secretMasterKeys[secretCurrentMasterID], dataKey)
+	if err != nil {
+		return "", err
+	}
+	payload, err := sealSecret(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return secretEnvelopePrefix + secretCurrentMasterID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(payload), nil
+}
+
+// DecryptSecret 解密 EncryptSecret 生成的密文，明文原样返回
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(value, secretEnvelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("invalid encrypted secret")
+	}
+	masterKey, ok := secretMasterKeys[parts[0]]
+	if !ok {
+		if !SecretEncryptionEnabled() {
+			return "", ErrSecretMasterKeyMissing
+		}
+		return "", fmt.Errorf("secret master key %s not configured", parts[0])
+	}
+	wrappedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+	payload, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+	dataKey, err := openSecret(masterKey, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openSecret(dataKey, payload)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// ReencryptSecret 用当前主密钥重新加密，不需要重新加密时原样返回
+func ReencryptSecret(value string) (string, error) {
+	if !SecretNeedsReencryption(value) {
+		return value, nil
+	}
+	plaintext, err := DecryptSecret(value)
+	if err != nil {
+		return "", err
+	}
+	return EncryptSecret(plaintext)
+}
+
+func sealSecret(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func openSecret(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newSecretGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted secret")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secret")
+	}
+	return plaintext, nil
+}
+
+func newSecretGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
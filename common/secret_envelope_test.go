@@ -0,0 +1,69 @@
+package common
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testSecretMasterKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), secretMasterKeySize)))
+}
+
+func TestSecretEnvelope_RoundTripAndRotation(t *testing.T) {
+	t.Cleanup(func() { _ = SetSecretMasterKeys("") })
+
+	plain, err := EncryptSecret("sk-test")
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", plain, "encryption disabled keeps plaintext")
+
+	require.NoError(t, SetSecretMasterKeys("k1:"+testSecretMasterKey('a')))
+	encrypted, err := EncryptSecret("sk-test")
+	require.NoError(t, err)
+	require.True(t, IsEncryptedSecret(encrypted))
+	require.Equal(t, "k1", SecretMasterKeyID(encrypted))
+	require.NotContains(t, encrypted, "sk-test")
+
+	again, err := EncryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, encrypted, again, "already encrypted values are not wrapped twice")
+
+	decrypted, err := DecryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", decrypted)
+
+	// 新主密钥放在第一位，旧主密钥仍可解密
+	require.NoError(t, SetSecretMasterKeys("k2:"+testSecretMasterKey('b')+",k1:"+testSecretMasterKey('a')))
+	require.True(t, SecretNeedsReencryption(encrypted))
+	rotated, err := ReencryptSecret(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, "k2", SecretMasterKeyID(rotated))
+	require.False(t, SecretNeedsReencryption(rotated))
+	decrypted, err = DecryptSecret(rotated)
+	require.NoError(t, err)
+	require.Equal(t, "sk-test", decrypted)
+
+	require.NoError(t, SetSecretMasterKeys("k2:"+testSecretMasterKey('b')))
+	_, err = DecryptSecret(encrypted)
+	require.Error(t, err, "retired master key can no longer decrypt")
+}
+
+func TestSecretEnvelope_InvalidInput(t *testing.T) {
+	t.Cleanup(func() { _ = SetSecretMasterKeys("") })
+
+	require.Error(t, SetSecretMasterKeys("k1:short"))
+	require.Error(t, SetSecretMasterKeys(testSecretMasterKey('a')))
+	require.Error(t, SetSecretMasterKeys("k1:"+testSecretMasterKey('a')+",k1:"+testSecretMasterKey('b')))
+
+	require.NoError(t, SetSecretMasterKeys("k1:"+testSecretMasterKey('a')))
+	encrypted, err := EncryptSecret("secret")
+	require.NoError(t, err)
+	_, err = DecryptSecret(encrypted[:len(encrypted)-4] + "AAAA")
+	require.Error(t, err)
+
+	require.NoError(t, SetSecretMasterKeys(""))
+	_, err = DecryptSecret(encrypted)
+	require.ErrorIs(t, err, ErrSecretMasterKeyMissing)
+}
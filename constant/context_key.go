@@ -19,6 +19,14 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
+	ContextKeyTokenPIIRedaction      ContextKey = "token_pii_redaction"
+	ContextKeyTokenContextTruncation ContextKey = "token_context_truncation"
+	ContextKeyTokenOrganizationId    ContextKey = "token_organization_id"
+	ContextKeyTokenBudgetPeriod      ContextKey = "token_budget_period"
+	ContextKeyTokenBudgetQuota       ContextKey = "token_budget_quota"
+	ContextKeyTokenTpmLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenRpmLimit          ContextKey = "token_rpm_limit"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -66,4 +74,26 @@ const (
 	// ContextKeyLanguage stores the user's language preference for i18n
 	ContextKeyLanguage ContextKey = "language"
 	ContextKeyIsStream ContextKey = "is_stream"
+
+	// ContextKeyBatchId marks a request executed by the batch worker; it is only set internally and enables batch discount billing
+	ContextKeyBatchId ContextKey = "batch_id"
+
+	// ContextKeyResponseCacheKey is the response cache key of a cacheable request whose response should be stored after success
+	ContextKeyResponseCacheKey ContextKey = "response_cache_key"
+	// ContextKeyResponseCacheHit marks a request served from the response cache; billing applies the cache hit price ratio
+	ContextKeyResponseCacheHit ContextKey = "response_cache_hit"
+	// ContextKeyResponseUsage stores the settled usage of a cacheable request so it can be saved with the cached response
+	ContextKeyResponseUsage ContextKey = "response_usage"
+	// ContextKeyOutputModeration stores the output moderation writer of the request; its hits are recorded in the consume log
+	ContextKeyOutputModeration ContextKey = "output_moderation"
+	// ContextKeyPIIRehydrate stores the writer that restores redacted PII placeholders in the response
+	ContextKeyPIIRehydrate ContextKey = "pii_rehydrate"
+	// ContextKeyModelFallback stores the fallback chain state when the request targets a virtual model
+	ContextKeyModelFallback ContextKey = "model_fallback"
+	// ContextKeyContextOverflow records how a prompt exceeding the model context window was handled
+	ContextKeyContextOverflow ContextKey = "context_overflow"
+	// ContextKeyCircuitBreakerProbe is the circuit breaker key whose half-open probe lease is held by the request
+	ContextKeyCircuitBreakerProbe ContextKey = "circuit_breaker_probe"
+	// ContextKeyCircuitBreakerSkip marks a request sent without acquiring the circuit breaker; its outcome is not recorded
+	ContextKeyCircuitBreakerSkip ContextKey = "circuit_breaker_skip"
 )
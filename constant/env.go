@@ -17,6 +17,8 @@ var GenerateDefaultToken bool
 var ErrorLogEnabled bool
 var TaskQueryLimit int
 var TaskTimeoutMinutes int
+var MetricsEnabled bool
+var MetricsToken string
 
 // temporary variable for sora patch, will be removed in future
 var TaskPricePatches []string
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/batch_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const batchCompletionWindow = "24h"
+
+// batchEndpointFormats 支持批处理的端点及其对应的转发格式
+var batchEndpointFormats = map[string]types.RelayFormat{
+	"/v1/chat/completions": types.RelayFormatOpenAI,
+	"/v1/completions":      types.RelayFormatOpenAI,
+	"/v1/embeddings":       types.RelayFormatEmbedding,
+	"/v1/responses":        types.RelayFormatOpenAIResponses,
+	"/v1/moderations":      types.RelayFormatOpenAI,
+}
+
+func toOpenAIBatch(batch *model.Batch) dto.OpenAIBatch {
+	out := dto.OpenAIBatch{
+		Id:               batch.BatchId,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		CreatedAt:        batch.CreatedAt,
+		RequestCounts: dto.OpenAIBatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.OutputFileId != "" {
+		out.OutputFileId = common.GetPointer(batch.OutputFileId)
+	}
+	if batch.ErrorFileId != "" {
+		out.ErrorFileId = common.GetPointer(batch.ErrorFileId)
+	}
+	if batch.Errors != "" {
+		var errs []dto.OpenAIBatchError
+		if err := common.UnmarshalJsonStr(batch.Errors, &errs); err == nil {
+			out.Errors = &dto.OpenAIBatchErrors{Object: "list", Data: errs}
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &out.Metadata)
+	}
+	optionalTimestamps := []struct {
+		value int64
+		dst   **int64
+	}{
+		{batch.InProgressAt, &out.InProgressAt},
+		{batch.ExpiresAt, &out.ExpiresAt},
+		{batch.FinalizingAt, &out.FinalizingAt},
+		{batch.CompletedAt, &out.CompletedAt},
+		{batch.FailedAt, &out.FailedAt},
+		{batch.ExpiredAt, &out.ExpiredAt},
+		{batch.CancellingAt, &out.CancellingAt},
+		{batch.CancelledAt, &out.CancelledAt},
+	}
+	for _, ts := range optionalTimestamps {
+		if ts.value > 0 {
+			*ts.dst = common.GetPointer(ts.value)
+		}
+	}
+	return out
+}
+
+func getUserBatchOrAbort(c *gin.Context) *model.Batch {
+	batch, err := model.GetUserBatchByBatchId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		fileApiError(c, http.StatusNotFound, "batch_not_found", fmt.Sprintf("No such Batch object: %s", c.Param("id")))
+		return nil
+	}
+	return batch
+}
+
+func CreateBatch(c *gin.Context) {
+	if !batch_setting.GetSetting().Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	var req dto.OpenAIBatchRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if _, ok := batchEndpointFormats[req.Endpoint]; !ok {
+		fileApiError(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("Unsupported endpoint: %q", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		fileApiError(c, http.StatusBadRequest, "invalid_completion_window", fmt.Sprintf("Invalid completion_window: %q, only %q is supported", req.CompletionWindow, batchCompletionWindow))
+		return
+	}
+	userId := c.GetInt("id")
+	inputFile, err := model.GetUserFileByFileId(userId, req.InputFileId)
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", fmt.Sprintf("No such File object: %s", req.InputFileId))
+		return
+	}
+	if inputFile.Purpose != "batch" {
+		fileApiError(c, http.StatusBadRequest, "invalid_input_file", "input file must be uploaded with purpose \"batch\"")
+		return
+	}
+
+	now := common.GetTimestamp()
+	batch := &model.Batch{
+		BatchId:          "batch_" + common.GetRandomString(24),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		Endpoint:         req.Endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		ClientIp:         c.ClientIP(),
+		CreatedAt:        now,
+		ExpiresAt:        now + int64((24 * time.Hour).Seconds()),
+	}
+	if len(req.Metadata) > 0 {
+		metadata, err := common.Marshal(req.Metadata)
+		if err != nil {
+			fileApiError(c, http.StatusBadRequest, "invalid_metadata", err.Error())
+			return
+		}
+		batch.Metadata = string(metadata)
+	}
+	if err := batch.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func ListBatches(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	batches, hasMore, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	list := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		list.Data = append(list.Data, toOpenAIBatch(batch))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
+
+func CancelBatch(c *gin.Context) {
+	batch := getUserBatchOrAbort(c)
+	if batch == nil {
+		return
+	}
+	now := common.GetTimestamp()
+	fromStatus := batch.Status
+	switch fromStatus {
+	case model.BatchStatusValidating:
+		// 尚未开始执行，直接取消
+		batch.Status = model.BatchStatusCancelled
+		batch.CancellingAt = now
+		batch.CancelledAt = now
+	case model.BatchStatusInProgress:
+		// 由后台执行器停止分发剩余请求并写出部分结果
+		batch.Status = model.BatchStatusCancelling
+		batch.CancellingAt = now
+	default:
+		fileApiError(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("Cannot cancel a batch with status %q", fromStatus))
+		return
+	}
+	won, err := batch.UpdateWithStatus(fromStatus)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !won {
+		fileApiError(c, http.StatusConflict, "batch_not_cancellable", "Batch status changed, please retry")
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIBatch(batch))
+}
@@ -0,0 +1,438 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/filestore"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/batch_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	batchProgressInterval = 5 * time.Second
+	batchOutputPurpose    = "batch_output"
+)
+
+var (
+	batchWorkerOnce    sync.Once
+	runningBatches     sync.Map
+	runningBatchCount  atomic.Int32
+	batchRelayEngine   *gin.Engine
+	batchRelayEngineMu sync.Once
+)
+
+// batchRequestKey 通过请求上下文把批次 ID 传给内部引擎，外部请求无法伪造
+type batchRequestKey struct{}
+
+// StartBatchWorker 启动批处理后台执行器，仅在主节点运行
+func StartBatchWorker() {
+	batchWorkerOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		if err := model.FailInterruptedBatches(`[{"code":"batch_interrupted","message":"batch was interrupted by a server restart"}]`); err != nil {
+			common.SysError("failed to recover interrupted batches: " + err.Error())
+		}
+		go func() {
+			common.SysLog("batch worker started")
+			for {
+				time.Sleep(time.Duration(batch_setting.GetPollIntervalSeconds()) * time.Second)
+				if !batch_setting.GetSetting().Enabled {
+					continue
+				}
+				dispatchPendingBatches()
+			}
+		}()
+	})
+}
+
+func dispatchPendingBatches() {
+	free := batch_setting.GetMaxRunningBatches() - int(runningBatchCount.Load())
+	if free <= 0 {
+		return
+	}
+	// 多取一些以跳过正在执行的批次
+	for _, batch := range model.GetPendingBatches(free + int(runningBatchCount.Load())) {
+		if free <= 0 {
+			return
+		}
+		if _, loaded := runningBatches.LoadOrStore(batch.Id, struct{}{}); loaded {
+			continue
+		}
+		free--
+		runningBatchCount.Add(1)
+		go func(batch *model.Batch) {
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("batch %s panic: %v", batch.BatchId, r))
+				}
+				runningBatches.Delete(batch.Id)
+				runningBatchCount.Add(-1)
+			}()
+			runBatch(batch)
+		}(batch)
+	}
+}
+
+// getBatchRelayEngine 内部转发引擎，复用与 /v1 相同的鉴权、渠道分发与 Relay 流程
+func getBatchRelayEngine() *gin.Engine {
+	batchRelayEngineMu.Do(func() {
+		engine := gin.New()
+		engine.Use(middleware.RequestId())
+		engine.Use(middleware.BodyStorageCleanup())
+		engine.Use(func(c *gin.Context) {
+			if batchId, ok := c.Request.Context().Value(batchRequestKey{}).(string); ok {
+				common.SetContextKey(c, constant.ContextKeyBatchId, batchId)
+			}
+			c.Next()
+		})
+		engine.Use(middleware.RouteTag("relay"))
+		engine.Use(middleware.TokenAuth(), middleware.Distribute())
+		for endpoint, format := range batchEndpointFormats {
+			relayFormat := format
+			engine.POST(endpoint, func(c *gin.Context) {
+				Relay(c, relayFormat)
+			})
+		}
+		batchRelayEngine = engine
+	})
+	return batchRelayEngine
+}
+
+func batchLineError(line int, code string, message string) dto.OpenAIBatchError {
+	return dto.OpenAIBatchError{Code: code, Message: message, Line: common.GetPointer(line)}
+}
+
+// parseBatchInput 解析并校验输入文件，返回的错误列表非空时批次直接失败
+func parseBatchInput(batch *model.Batch, content []byte) ([]*dto.OpenAIBatchInputLine, []dto.OpenAIBatchError) {
+	var lines []*dto.OpenAIBatchInputLine
+	var errs []dto.OpenAIBatchError
+	customIds := make(map[string]bool)
+	maxLines := batch_setting.GetSetting().MaxRequestsPerBatch
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if len(errs) >= 100 {
+			break
+		}
+		var line dto.OpenAIBatchInputLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			errs = append(errs, batchLineError(lineNo, "invalid_json_line", "This line is not parseable as valid JSON."))
+			continue
+		}
+		if line.CustomId == "" {
+			errs = append(errs, batchLineError(lineNo, "missing_required_parameter", "custom_id is required."))
+			continue
+		}
+		if customIds[line.CustomId] {
+			errs = append(errs, batchLineError(lineNo, "duplicate_custom_id", fmt.Sprintf("The custom_id %q is duplicated.", line.CustomId)))
+			continue
+		}
+		customIds[line.CustomId] = true
+		if line.Method != http.MethodPost {
+			errs = append(errs, batchLineError(lineNo, "invalid_method", "Only POST is supported."))
+			continue
+		}
+		if line.Url != batch.Endpoint {
+			errs = append(errs, batchLineError(lineNo, "mismatched_endpoint", fmt.Sprintf("The url %q does not match the batch endpoint %q.", line.Url, batch.Endpoint)))
+			continue
+		}
+		var body map[string]any
+		if err := common.Unmarshal(line.Body, &body); err != nil || body == nil {
+			errs = append(errs, batchLineError(lineNo, "invalid_request", "body must be a JSON object."))
+			continue
+		}
+		if stream, _ := body["stream"].(bool); stream {
+			errs = append(errs, batchLineError(lineNo, "invalid_request", "Streaming is not supported in batch requests."))
+			continue
+		}
+		lines = append(lines, &line)
+		if maxLines > 0 && len(lines) > maxLines {
+			errs = append(errs, dto.OpenAIBatchError{Code: "too_many_requests", Message: fmt.Sprintf("The input file exceeds the maximum of %d requests.", maxLines)})
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, dto.OpenAIBatchError{Code: "invalid_file", Message: err.Error()})
+	}
+	if len(errs) == 0 && len(lines) == 0 {
+		errs = append(errs, dto.OpenAIBatchError{Code: "empty_file", Message: "The input file contains no requests."})
+	}
+	return lines, errs
+}
+
+func failBatch(batch *model.Batch, errs []dto.OpenAIBatchError) {
+	fromStatus := batch.Status
+	data, _ := common.Marshal(errs)
+	batch.Status = model.BatchStatusFailed
+	batch.FailedAt = common.GetTimestamp()
+	batch.Errors = string(data)
+	if _, err := batch.UpdateWithStatus(fromStatus); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+	}
+}
+
+func runBatch(batch *model.Batch) {
+	ctx := context.Background()
+	if common.GetTimestamp() > batch.ExpiresAt {
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = common.GetTimestamp()
+		_, _ = batch.UpdateWithStatus(model.BatchStatusValidating)
+		return
+	}
+
+	inputFile, err := model.GetUserFileByFileId(batch.UserId, batch.InputFileId)
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: "invalid_input_file", Message: "The input file no longer exists."}})
+		return
+	}
+	content, err := service.ReadStoredFile(ctx, inputFile)
+	if err != nil {
+		common.SysError(fmt.Sprintf("batch %s failed to read input file: %s", batch.BatchId, err.Error()))
+		failBatch(batch, []dto.OpenAIBatchError{{Code: "invalid_input_file", Message: "Failed to read the input file."}})
+		return
+	}
+	lines, errs := parseBatchInput(batch, content)
+	if len(errs) > 0 {
+		failBatch(batch, errs)
+		return
+	}
+	token, err := model.GetTokenById(batch.TokenId)
+	if err != nil {
+		failBatch(batch, []dto.OpenAIBatchError{{Code: "invalid_token", Message: "The token used to create this batch no longer exists."}})
+		return
+	}
+
+	batch.Status = model.BatchStatusInProgress
+	batch.InProgressAt = common.GetTimestamp()
+	batch.TotalCount = len(lines)
+	if won, err := batch.UpdateWithStatus(model.BatchStatusValidating); err != nil || !won {
+		// 已被取消或更新失败
+		return
+	}
+
+	results := make([]*dto.OpenAIBatchOutputLine, len(lines))
+	var completed, failed atomic.Int32
+	var stopped atomic.Bool
+	done := make(chan struct{})
+	var progressWg sync.WaitGroup
+
+	// 定期同步进度并检测取消/过期；收尾前等待其退出，避免与 finalizeBatch 并发写 batch
+	progressWg.Add(1)
+	go func() {
+		defer progressWg.Done()
+		ticker := time.NewTicker(batchProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				batch.CompletedCount = int(completed.Load())
+				batch.FailedCount = int(failed.Load())
+				if err := batch.UpdateProgress(); err != nil {
+					common.SysError(fmt.Sprintf("failed to update batch %s progress: %s", batch.BatchId, err.Error()))
+				}
+				if status, err := model.GetBatchStatus(batch.Id); err == nil && status != model.BatchStatusInProgress {
+					stopped.Store(true)
+				}
+				if common.GetTimestamp() > batch.ExpiresAt {
+					stopped.Store(true)
+				}
+			}
+		}
+	}()
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < batch_setting.GetWorkerConcurrency(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				result := executeBatchLine(ctx, batch, token.Key, lines[idx])
+				results[idx] = result
+				if result.Error == nil && result.Response.StatusCode/100 == 2 {
+					completed.Add(1)
+				} else {
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+	for idx := range lines {
+		if stopped.Load() {
+			break
+		}
+		jobs <- idx
+	}
+	close(jobs)
+	wg.Wait()
+	close(done)
+	progressWg.Wait()
+
+	finalizeBatch(ctx, batch, lines, results, int(completed.Load()), int(failed.Load()))
+}
+
+func executeBatchLine(ctx context.Context, batch *model.Batch, tokenKey string, line *dto.OpenAIBatchInputLine) *dto.OpenAIBatchOutputLine {
+	result := &dto.OpenAIBatchOutputLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	req := httptest.NewRequest(http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	req = req.WithContext(context.WithValue(ctx, batchRequestKey{}, batch.BatchId))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+tokenKey)
+	if batch.ClientIp != "" {
+		req.RemoteAddr = net.JoinHostPort(batch.ClientIp, "0")
+	}
+	recorder := httptest.NewRecorder()
+	getBatchRelayEngine().ServeHTTP(recorder, req)
+
+	body := recorder.Body.Bytes()
+	if len(body) == 0 || !common.IsJsonObject(string(body)) {
+		body, _ = common.Marshal(string(body))
+	}
+	result.Response = &dto.OpenAIBatchOutputResponse{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       body,
+	}
+	return result
+}
+
+// finalizeBatch 写出输出/错误文件并更新批次终态
+func finalizeBatch(ctx context.Context, batch *model.Batch, lines []*dto.OpenAIBatchInputLine, results []*dto.OpenAIBatchOutputLine, completed int, failed int) {
+	status, err := model.GetBatchStatus(batch.Id)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to load batch %s status: %s", batch.BatchId, err.Error()))
+		return
+	}
+	now := common.GetTimestamp()
+	expired := status == model.BatchStatusInProgress && now > batch.ExpiresAt
+
+	batch.Status = model.BatchStatusFinalizing
+	batch.FinalizingAt = now
+	batch.CompletedCount = completed
+	batch.FailedCount = failed
+	if won, err := batch.UpdateWithStatus(status); err != nil || !won {
+		return
+	}
+
+	var output, errorOutput bytes.Buffer
+	for idx, result := range results {
+		if result == nil {
+			// 因取消或过期未执行的请求
+			code, message := "batch_cancelled", "This request was not executed because the batch was cancelled."
+			if expired {
+				code, message = "batch_expired", "This request could not be executed before the completion window expired."
+			}
+			result = &dto.OpenAIBatchOutputLine{
+				Id:       "batch_req_" + common.GetRandomString(24),
+				CustomId: lines[idx].CustomId,
+				Error:    &dto.OpenAIBatchError{Code: code, Message: message},
+			}
+		}
+		data, _ := common.Marshal(result)
+		if result.Error == nil && result.Response.StatusCode/100 == 2 {
+			output.Write(data)
+			output.WriteByte('\n')
+		} else {
+			errorOutput.Write(data)
+			errorOutput.WriteByte('\n')
+		}
+	}
+
+	var finalErrs []dto.OpenAIBatchError
+	if output.Len() > 0 {
+		file, err := storeBatchOutputFile(ctx, batch, batch.BatchId+"_output.jsonl", output.Bytes())
+		if err != nil {
+			finalErrs = append(finalErrs, dto.OpenAIBatchError{Code: "output_write_failed", Message: "Failed to store the output file."})
+			common.SysError(fmt.Sprintf("batch %s failed to store output file: %s", batch.BatchId, err.Error()))
+		} else {
+			batch.OutputFileId = file.FileId
+		}
+	}
+	if errorOutput.Len() > 0 {
+		file, err := storeBatchOutputFile(ctx, batch, batch.BatchId+"_error.jsonl", errorOutput.Bytes())
+		if err != nil {
+			finalErrs = append(finalErrs, dto.OpenAIBatchError{Code: "output_write_failed", Message: "Failed to store the error file."})
+			common.SysError(fmt.Sprintf("batch %s failed to store error file: %s", batch.BatchId, err.Error()))
+		} else {
+			batch.ErrorFileId = file.FileId
+		}
+	}
+	if len(finalErrs) > 0 {
+		data, _ := common.Marshal(finalErrs)
+		batch.Errors = string(data)
+	}
+
+	now = common.GetTimestamp()
+	switch {
+	case status == model.BatchStatusCancelling:
+		batch.Status = model.BatchStatusCancelled
+		batch.CancelledAt = now
+	case expired:
+		batch.Status = model.BatchStatusExpired
+		batch.ExpiredAt = now
+	default:
+		batch.Status = model.BatchStatusCompleted
+		batch.CompletedAt = now
+	}
+	if _, err := batch.UpdateWithStatus(model.BatchStatusFinalizing); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.BatchId, err.Error()))
+	}
+}
+
+func storeBatchOutputFile(ctx context.Context, batch *model.Batch, filename string, content []byte) (*model.File, error) {
+	store, err := filestore.Current()
+	if err != nil {
+		return nil, err
+	}
+	fileId := service.NewGatewayFileId()
+	storageKey := filestore.ObjectKey(batch.UserId, fileId)
+	written, err := store.Put(ctx, storageKey, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+	file := &model.File{
+		FileId:      fileId,
+		UserId:      batch.UserId,
+		TokenId:     batch.TokenId,
+		Filename:    filename,
+		Purpose:     batchOutputPurpose,
+		ContentType: "application/jsonl",
+		Bytes:       written,
+		Status:      model.FileStatusProcessed,
+		StorageType: store.Type(),
+		StorageKey:  storageKey,
+	}
+	if err := file.Insert(); err != nil {
+		_ = store.Delete(ctx, storageKey)
+		return nil, err
+	}
+	return file, nil
+}
@@ -167,8 +167,12 @@ func GetResponseBody(method, url string, channel *model.Channel, headers http.He
 }
 
 func updateChannelCloseAIBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := fmt.Sprintf("%s/dashboard/billing/credit_grants", channel.GetBaseURL())
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 
 	if err != nil {
 		return 0, err
@@ -183,8 +187,12 @@ func updateChannelCloseAIBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelOpenAISBBalance(channel *model.Channel) (float64, error) {
-	url := fmt.Sprintf("https://api.openai-sb.com/sb-api/user/status?api_key=%s", channel.Key)
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
+	url := fmt.Sprintf("https://api.openai-sb.com/sb-api/user/status?api_key=%s", key)
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -205,9 +213,13 @@ func updateChannelOpenAISBBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelAIProxyBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://aiproxy.io/api/report/getUserOverview"
 	headers := http.Header{}
-	headers.Add("Api-Key", channel.Key)
+	headers.Add("Api-Key", key)
 	body, err := GetResponseBody("GET", url, channel, headers)
 	if err != nil {
 		return 0, err
@@ -225,8 +237,12 @@ func updateChannelAIProxyBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelAPI2GPTBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://api.api2gpt.com/dashboard/billing/credit_grants"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 
 	if err != nil {
 		return 0, err
@@ -241,8 +257,12 @@ func updateChannelAPI2GPTBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://api.siliconflow.cn/v1/user/info"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -263,8 +283,12 @@ func updateChannelSiliconFlowBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://api.deepseek.com/user/balance"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -292,8 +316,12 @@ func updateChannelDeepSeekBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://api.aigc2d.com/dashboard/billing/credit_grants"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -307,8 +335,12 @@ func updateChannelAIGC2DBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://openrouter.ai/api/v1/credits"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -323,8 +355,12 @@ func updateChannelOpenRouterBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	url := "https://api.moonshot.cn/v1/users/me/balance"
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -357,6 +393,10 @@ func updateChannelMoonshotBalance(channel *model.Channel) (float64, error) {
 }
 
 func updateChannelBalance(channel *model.Channel) (float64, error) {
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		return 0, err
+	}
 	baseURL := constant.ChannelBaseURLs[channel.Type]
 	if channel.GetBaseURL() == "" {
 		channel.BaseURL = &baseURL
@@ -391,7 +431,7 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 	}
 	url := fmt.Sprintf("%s/v1/dashboard/billing/subscription", baseURL)
 
-	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err := GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -407,7 +447,7 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 		startDate = now.AddDate(0, 0, -100).Format("2006-01-02")
 	}
 	url = fmt.Sprintf("%s/v1/dashboard/billing/usage?start_date=%s&end_date=%s", baseURL, startDate, endDate)
-	body, err = GetResponseBody("GET", url, channel, GetAuthHeader(channel.Key))
+	body, err = GetResponseBody("GET", url, channel, GetAuthHeader(key))
 	if err != nil {
 		return 0, err
 	}
@@ -160,7 +160,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string,
 	group, _ := model.GetUserGroup(1, false)
 	c.Set("group", group)
 
-	newAPIError := middleware.SetupContextForSelectedChannel(c, channel, testModel)
+	newAPIError := middleware.SetupContextForChannelTest(c, channel, testModel)
 	if newAPIError != nil {
 		return testResult{
 			context:     c,
@@ -13,10 +13,12 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/circuitbreaker"
 	relaychannel "github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/gemini"
 	"github.com/QuantumNous/new-api/relay/channel/ollama"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -402,12 +404,18 @@ func GetChannelKey(c *gin.Context) {
 	// 记录操作日志
 	model.RecordLog(userId, model.LogTypeSystem, fmt.Sprintf("查看渠道密钥信息 (渠道ID: %d)", channelId))
 
+	key, err := channel.GetPlainKey()
+	if err != nil {
+		common.ApiError(c, fmt.Errorf("解密渠道密钥失败: %v", err))
+		return
+	}
+
 	// 返回渠道密钥
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "获取成功",
 		"data": map[string]interface{}{
-			"key": channel.Key,
+			"key": key,
 		},
 	})
 }
@@ -879,11 +887,16 @@ func UpdateChannel(c *gin.Context) {
 				var newKeys []string
 				var existingKeys []string
 
+				originKey, err := originChannel.GetPlainKey()
+				if err != nil {
+					common.ApiError(c, err)
+					return
+				}
 				// 解析现有密钥
-				if strings.HasPrefix(strings.TrimSpace(originChannel.Key), "[") {
+				if strings.HasPrefix(strings.TrimSpace(originKey), "[") {
 					// JSON数组格式
 					var arr []json.RawMessage
-					if err := json.Unmarshal([]byte(strings.TrimSpace(originChannel.Key)), &arr); err == nil {
+					if err := json.Unmarshal([]byte(strings.TrimSpace(originKey)), &arr); err == nil {
 						existingKeys = make([]string, len(arr))
 						for i, v := range arr {
 							existingKeys[i] = string(v)
@@ -891,7 +904,7 @@ func UpdateChannel(c *gin.Context) {
 					}
 				} else {
 					// 换行分隔格式
-					existingKeys = strings.Split(strings.Trim(originChannel.Key, "\n"), "\n")
+					existingKeys = strings.Split(strings.Trim(originKey, "\n"), "\n")
 				}
 
 				// 处理 Vertex AI 的特殊情况
@@ -1741,7 +1754,7 @@ func OllamaPullModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	err = ollama.PullOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1810,7 +1823,7 @@ func OllamaPullModelStream(c *gin.Context) {
 	c.Header("Connection", "keep-alive")
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 
 	// 创建进度回调函数
 	progressCallback := func(progress ollama.OllamaPullResponse) {
@@ -1886,7 +1899,7 @@ func OllamaDeleteModel(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	err = ollama.DeleteOllamaModel(baseURL, key, req.ModelName)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -1935,7 +1948,7 @@ func OllamaVersion(c *gin.Context) {
 		baseURL = channel.GetBaseURL()
 	}
 
-	key := strings.Split(channel.Key, "\n")[0]
+	key := channel.GetFirstKey()
 	version, err := ollama.FetchOllamaVersion(baseURL, key)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -1952,3 +1965,55 @@ func OllamaVersion(c *gin.Context) {
 		},
 	})
 }
+
+// GetChannelSelectionWeights 查看分组/模型下各渠道的静态权重与自适应有效权重
+func GetChannelSelectionWeights(c *gin.Context) {
+	group := c.Query("group")
+	modelName := c.Query("model")
+	if group == "" || modelName == "" {
+		common.ApiErrorMsg(c, "group and model are required")
+		return
+	}
+	if !common.MemoryCacheEnabled {
+		common.ApiErrorMsg(c, "channel selection weights require memory cache to be enabled")
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"group":    group,
+		"model":    modelName,
+		"adaptive": operation_setting.IsAdaptiveChannelGroup(group),
+		"channels": model.GetChannelSelectionWeights(group, modelName),
+	})
+}
+
+// GetChannelCircuitBreakers 列出所有处于熔断或半开状态的渠道/密钥
+func GetChannelCircuitBreakers(c *gin.Context) {
+	now := common.GetTimestamp()
+	states := circuitbreaker.List()
+	items := make([]gin.H, 0, len(states))
+	for _, state := range states {
+		items = append(items, gin.H{
+			"key":        state.Key,
+			"status":     state.Status(now),
+			"trips":      state.Trips,
+			"opened_at":  state.OpenedAt,
+			"open_until": state.OpenUntil,
+			"reason":     state.Reason,
+		})
+	}
+	common.ApiSuccess(c, gin.H{
+		"enabled": circuitbreaker.Enabled(),
+		"items":   items,
+	})
+}
+
+// ResetChannelCircuitBreaker 手动关闭熔断器，key 为渠道 ID 或 "渠道ID:密钥序号"
+func ResetChannelCircuitBreaker(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		common.ApiErrorMsg(c, "key is required")
+		return
+	}
+	circuitbreaker.Reset(key)
+	common.ApiSuccess(c, nil)
+}
@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportConfigBundle 导出渠道、模型元数据、预填组与配置项，密钥只导出为环境变量引用
+func ExportConfigBundle(c *gin.Context) {
+	format := c.DefaultQuery("format", model.ConfigBundleFormatYAML)
+	if format != model.ConfigBundleFormatYAML && format != model.ConfigBundleFormatJSON {
+		common.ApiErrorMsg(c, "不支持的格式："+format)
+		return
+	}
+	bundle, err := model.ExportConfigBundle()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	data, err := model.MarshalConfigBundle(bundle, format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	contentType := "application/yaml"
+	if format == model.ConfigBundleFormatJSON {
+		contentType = "application/json"
+	}
+	c.Header("Content-Disposition", "attachment; filename=\"config_bundle."+format+"\"")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+func parseConfigBundleRequest(c *gin.Context) (*model.ConfigBundle, model.ConfigApplyOptions, bool) {
+	opts := model.ConfigApplyOptions{Audit: optionAuditFromContext(c)}
+	opts.Prune, _ = strconv.ParseBool(c.Query("prune"))
+	data, err := c.GetRawData()
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, opts, false
+	}
+	bundle, err := model.ParseConfigBundle(data)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, opts, false
+	}
+	return bundle, opts, true
+}
+
+// PlanConfigBundle 返回应用配置包会产生的修改，不写入数据
+func PlanConfigBundle(c *gin.Context) {
+	bundle, opts, ok := parseConfigBundleRequest(c)
+	if !ok {
+		return
+	}
+	plan, err := model.PlanConfigBundle(bundle, opts)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, plan)
+}
+
+// ApplyConfigBundle 在一个事务中应用配置包，重复应用同一配置包不会产生修改
+func ApplyConfigBundle(c *gin.Context) {
+	bundle, opts, ok := parseConfigBundleRequest(c)
+	if !ok {
+		return
+	}
+	plan, err := model.ApplyConfigBundle(bundle, opts)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog("config bundle applied by user " + strconv.Itoa(c.GetInt("id")) +
+		", changes: " + strconv.Itoa(len(plan.Items)))
+	common.ApiSuccess(c, plan)
+}
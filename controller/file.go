@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/filestore"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/file_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var supportedFilePurposes = map[string]bool{
+	"assistants": true,
+	"batch":      true,
+	"fine-tune":  true,
+	"vision":     true,
+	"user_data":  true,
+	"evals":      true,
+}
+
+func fileApiError(c *gin.Context, status int, code string, message string) {
+	c.JSON(status, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func toOpenAIFile(file *model.File) dto.OpenAIFile {
+	out := dto.OpenAIFile{
+		Id:        file.FileId,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+	if file.ExpiresAt > 0 {
+		out.ExpiresAt = common.GetPointer(file.ExpiresAt)
+	}
+	return out
+}
+
+func getUserFileOrAbort(c *gin.Context) *model.File {
+	file, err := model.GetUserFileByFileId(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		fileApiError(c, http.StatusNotFound, "file_not_found", fmt.Sprintf("No such File object: %s", c.Param("id")))
+		return nil
+	}
+	return file
+}
+
+func UploadFile(c *gin.Context) {
+	setting := file_setting.GetSetting()
+	if !setting.Enabled {
+		RelayNotImplemented(c)
+		return
+	}
+	purpose := c.PostForm("purpose")
+	if !supportedFilePurposes[purpose] {
+		fileApiError(c, http.StatusBadRequest, "invalid_purpose", fmt.Sprintf("Invalid purpose: %q", purpose))
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "missing_file", "file is required")
+		return
+	}
+	if header.Size > file_setting.GetMaxFileSizeBytes() {
+		fileApiError(c, http.StatusRequestEntityTooLarge, "file_too_large", fmt.Sprintf("File exceeds the maximum size of %d MB", setting.MaxFileSizeMB))
+		return
+	}
+
+	userId := c.GetInt("id")
+	count, used, err := model.GetUserFileUsage(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if setting.UserMaxFiles > 0 && count >= int64(setting.UserMaxFiles) {
+		fileApiError(c, http.StatusForbidden, "file_count_exceeded", fmt.Sprintf("File count limit reached (%d)", setting.UserMaxFiles))
+		return
+	}
+	if limit := file_setting.GetUserStorageLimitBytes(); limit > 0 && used+header.Size > limit {
+		fileApiError(c, http.StatusForbidden, "storage_quota_exceeded", fmt.Sprintf("Storage limit of %d MB exceeded", setting.UserStorageLimitMB))
+		return
+	}
+
+	store, err := filestore.Current()
+	if err != nil {
+		logger.LogError(c, "file store unavailable: "+err.Error())
+		fileApiError(c, http.StatusInternalServerError, "storage_unavailable", "File storage is not available")
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		fileApiError(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer src.Close()
+
+	fileId := service.NewGatewayFileId()
+	storageKey := filestore.ObjectKey(userId, fileId)
+	written, err := store.Put(c.Request.Context(), storageKey, io.LimitReader(src, header.Size), header.Size)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to store file %s: %s", fileId, err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "storage_error", "Failed to store file")
+		return
+	}
+
+	file := &model.File{
+		FileId:      fileId,
+		UserId:      userId,
+		TokenId:     c.GetInt("token_id"),
+		Filename:    header.Filename,
+		Purpose:     purpose,
+		ContentType: header.Header.Get("Content-Type"),
+		Bytes:       written,
+		Status:      model.FileStatusProcessed,
+		StorageType: store.Type(),
+		StorageKey:  storageKey,
+	}
+	if err := file.InsertWithLimit(int64(setting.UserMaxFiles), file_setting.GetUserStorageLimitBytes()); err != nil {
+		_ = store.Delete(c.Request.Context(), storageKey)
+		switch {
+		case errors.Is(err, model.ErrFileCountExceeded):
+			fileApiError(c, http.StatusForbidden, "file_count_exceeded", fmt.Sprintf("File count limit reached (%d)", setting.UserMaxFiles))
+		case errors.Is(err, model.ErrFileStorageExceeded):
+			fileApiError(c, http.StatusForbidden, "storage_quota_exceeded", fmt.Sprintf("Storage limit of %d MB exceeded", setting.UserStorageLimitMB))
+		default:
+			common.ApiError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func ListFiles(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10000"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, hasMore, err := model.GetUserFiles(c.GetInt("id"), c.Query("purpose"), c.Query("after"), limit)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	list := dto.OpenAIFileList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIFile, 0, len(files)),
+		HasMore: hasMore,
+	}
+	for _, file := range files {
+		list.Data = append(list.Data, toOpenAIFile(file))
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = list.Data[0].Id
+		list.LastId = list.Data[len(list.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func RetrieveFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	c.JSON(http.StatusOK, toOpenAIFile(file))
+}
+
+func RetrieveFileContent(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	reader, err := service.OpenStoredFile(c.Request.Context(), file)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to open file %s: %s", file.FileId, err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "storage_error", "Failed to read file")
+		return
+	}
+	defer reader.Close()
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, file.Bytes, contentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", file.Filename),
+	})
+}
+
+func DeleteFile(c *gin.Context) {
+	file := getUserFileOrAbort(c)
+	if file == nil {
+		return
+	}
+	if err := service.DeleteStoredFile(c.Request.Context(), file); err != nil {
+		logger.LogError(c, fmt.Sprintf("failed to delete file %s: %s", file.FileId, err.Error()))
+		fileApiError(c, http.StatusInternalServerError, "storage_error", "Failed to delete file")
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleted{
+		Id:      file.FileId,
+		Object:  "file",
+		Deleted: true,
+	})
+}
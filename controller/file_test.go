@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/file_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func setupFileControllerTest(t *testing.T) {
+	t.Helper()
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.User{}, &model.Channel{}, &model.File{}, &model.FileUpstream{}))
+	require.NoError(t, db.Create(&model.User{Id: 1, Username: "file_user", Password: "password", AffCode: "file_aff"}).Error)
+
+	setting := file_setting.GetSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.StorageType = file_setting.StorageTypeLocal
+	setting.LocalPath = t.TempDir()
+	setting.UserMaxFiles = 0
+	setting.UserStorageLimitMB = 0
+}
+
+func uploadFileForTest(t *testing.T, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	require.NoError(t, writer.WriteField("purpose", "user_data"))
+	part, err := writer.CreateFormFile("file", "notes.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/files", body)
+	ctx.Request.Header.Set("Content-Type", writer.FormDataContentType())
+	ctx.Set("id", 1)
+	UploadFile(ctx)
+	return recorder
+}
+
+func TestFileUploadListAndDelete(t *testing.T) {
+	setupFileControllerTest(t)
+
+	recorder := uploadFileForTest(t, "hello")
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var uploaded dto.OpenAIFile
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &uploaded))
+	require.EqualValues(t, 5, uploaded.Bytes)
+	require.Equal(t, "user_data", uploaded.Purpose)
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodGet, "/v1/files", nil, 1)
+	ListFiles(ctx)
+	var list dto.OpenAIFileList
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	require.Equal(t, uploaded.Id, list.Data[0].Id)
+
+	file, err := model.GetUserFileByFileId(1, uploaded.Id)
+	require.NoError(t, err)
+	content, err := service.ReadStoredFile(ctx.Request.Context(), file)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(content))
+
+	ctx, recorder = newAuthenticatedContext(t, http.MethodDelete, "/v1/files/"+uploaded.Id, nil, 1)
+	ctx.Params = gin.Params{{Key: "id", Value: uploaded.Id}}
+	DeleteFile(ctx)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	_, err = model.GetUserFileByFileId(1, uploaded.Id)
+	require.Error(t, err)
+	_, err = service.ReadStoredFile(ctx.Request.Context(), file)
+	require.Error(t, err)
+}
+
+func TestFileUploadQuota(t *testing.T) {
+	setupFileControllerTest(t)
+	setting := file_setting.GetSetting()
+	setting.UserMaxFiles = 1
+
+	require.Equal(t, http.StatusOK, uploadFileForTest(t, "first").Code)
+	recorder := uploadFileForTest(t, "second")
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "file_count_exceeded")
+
+	// 写入时按用户加锁校验，绕过预检查的并发上传同样会被拒绝
+	err := (&model.File{FileId: "file-extra", UserId: 1, Bytes: 1}).InsertWithLimit(1, 0)
+	require.ErrorIs(t, err, model.ErrFileCountExceeded)
+	err = (&model.File{FileId: "file-large", UserId: 1, Bytes: 10}).InsertWithLimit(0, 12)
+	require.ErrorIs(t, err, model.ErrFileStorageExceeded)
+	require.NoError(t, (&model.File{FileId: "file-small", UserId: 1, Bytes: 7}).InsertWithLimit(0, 12))
+}
+
+func TestFileDeleteUsesUploadKey(t *testing.T) {
+	setupFileControllerTest(t)
+	service.InitHttpClient()
+
+	var authorization string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	baseURL := upstream.URL
+	channel := &model.Channel{
+		Id:          7,
+		Name:        "multi-key",
+		Key:         "sk-first\nsk-second",
+		BaseURL:     &baseURL,
+		Status:      common.ChannelStatusEnabled,
+		ChannelInfo: model.ChannelInfo{IsMultiKey: true, MultiKeySize: 2},
+	}
+	require.NoError(t, model.DB.Create(channel).Error)
+
+	recorder := uploadFileForTest(t, "hello")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var uploaded dto.OpenAIFile
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &uploaded))
+	require.NoError(t, model.SaveFileUpstream(uploaded.Id, channel.Id, 1, "file-upstream"))
+
+	ctx, recorder := newAuthenticatedContext(t, http.MethodDelete, "/v1/files/"+uploaded.Id, nil, 1)
+	ctx.Params = gin.Params{{Key: "id", Value: uploaded.Id}}
+	DeleteFile(ctx)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "Bearer sk-second", authorization)
+}
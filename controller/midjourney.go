@@ -93,7 +93,13 @@ func UpdateMidjourneyTaskBulk() {
 			// 使用带有超时的 context 创建新的请求
 			req = req.WithContext(ctx)
 			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("mj-api-secret", midjourneyChannel.Key)
+			key, err := midjourneyChannel.GetPlainKey()
+			if err != nil {
+				cancel()
+				logger.LogError(ctx, fmt.Sprintf("Get Task decrypt key error: %v", err))
+				continue
+			}
+			req.Header.Set("mj-api-secret", key)
 			resp, err := service.GetHttpClient().Do(req)
 			if err != nil {
 				logger.LogError(ctx, fmt.Sprintf("Get Task Do req error: %v", err))
@@ -198,6 +198,16 @@ func ListModels(c *gin.Context, modelType int) {
 				})
 			}
 		}
+		// 虚拟模型只要回退链中有可用的模型就展示
+		for _, virtualModel := range operation_setting.GetVirtualModels(models) {
+			userOpenAiModels = append(userOpenAiModels, dto.OpenAIModels{
+				Id:                     virtualModel.Name,
+				Object:                 "model",
+				Created:                1626777600,
+				OwnedBy:                "custom",
+				SupportedEndpointTypes: model.GetModelSupportEndpointTypes(virtualModel.Steps[0].Model),
+			})
+		}
 	}
 
 	switch modelType {
@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maskedOptionValue = "******"
+
+func optionAuditFromContext(c *gin.Context) model.OptionAudit {
+	return model.OptionAudit{
+		ActorId:   c.GetInt("id"),
+		ActorName: c.GetString("username"),
+		Ip:        c.ClientIP(),
+		Source:    model.OptionRevisionSourceUpdate,
+	}
+}
+
+func maskOptionValue(key string, value string) string {
+	if value == "" || !model.IsSensitiveOptionKey(key) {
+		return value
+	}
+	return maskedOptionValue
+}
+
+// maskOptionRevisionChanges 密钥类配置只展示是否变化，不返回取值
+func maskOptionRevisionChanges(changes []model.OptionRevisionChange) []model.OptionRevisionChange {
+	for i := range changes {
+		if !model.IsSensitiveOptionKey(changes[i].Key) {
+			continue
+		}
+		changes[i].FromValue = maskOptionValue(changes[i].Key, changes[i].FromValue)
+		changes[i].ToValue = maskOptionValue(changes[i].Key, changes[i].ToValue)
+		changes[i].Fields = nil
+	}
+	return changes
+}
+
+// optionRevisionScope 读取 key 或 module 过滤条件，module 必须是已注册的配置模块
+func optionRevisionScope(key string, module string) (string, string, error) {
+	if key != "" && module != "" {
+		return "", "", errors.New("key 与 module 不能同时指定")
+	}
+	if module != "" && config.GlobalConfig.Get(module) == nil {
+		return "", "", errors.New("未知配置模块：" + module)
+	}
+	return key, module, nil
+}
+
+func GetOptionRevisions(c *gin.Context) {
+	key, module, err := optionRevisionScope(c.Query("key"), c.Query("module"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	revisions, total, err := model.GetOptionRevisions(key, module, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	for _, revision := range revisions {
+		revision.OldValue = maskOptionValue(revision.Key, revision.OldValue)
+		revision.NewValue = maskOptionValue(revision.Key, revision.NewValue)
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(revisions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func DiffOptionRevisions(c *gin.Context) {
+	from, err := strconv.Atoi(c.Query("from"))
+	if err != nil || from < 0 {
+		common.ApiErrorMsg(c, "无效的起始修订号")
+		return
+	}
+	to, err := strconv.Atoi(c.Query("to"))
+	if err != nil || to < 0 {
+		common.ApiErrorMsg(c, "无效的目标修订号")
+		return
+	}
+	key, module, err := optionRevisionScope(c.Query("key"), c.Query("module"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	changes, err := model.DiffOptionRevisions(from, to, key, module)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, maskOptionRevisionChanges(changes))
+}
+
+type OptionRollbackRequest struct {
+	RevisionId int    `json:"revision_id"`
+	Key        string `json:"key"`
+	Module     string `json:"module"`
+}
+
+// RollbackOptions 把单个配置项、某个配置模块或全部配置恢复到指定修订写入后的状态
+func RollbackOptions(c *gin.Context) {
+	var req OptionRollbackRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil || req.RevisionId <= 0 {
+		common.ApiErrorMsg(c, "无效的参数")
+		return
+	}
+	key, module, err := optionRevisionScope(req.Key, req.Module)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	changes, err := model.RollbackOptions(req.RevisionId, key, module, optionAuditFromContext(c))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.SysLog("options rolled back to revision " + strconv.Itoa(req.RevisionId) + " by user " + strconv.Itoa(c.GetInt("id")) +
+		", changed keys: " + strconv.Itoa(len(changes)))
+	common.ApiSuccess(c, maskOptionRevisionChanges(changes))
+}
+
+// GetOptionRevisionNodes 返回数据库中最新的配置修订号与各节点已应用的修订号，用于确认配置是否已同步到所有节点
+func GetOptionRevisionNodes(c *gin.Context) {
+	latest, err := model.GetLatestOptionRevisionId()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	nodes, err := model.GetNodeConfigRevisions()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"latest_revision":  latest,
+		"applied_revision": model.GetAppliedOptionRevision(),
+		"nodes":            nodes,
+	})
+}
@@ -0,0 +1,450 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireOrganizationRole 校验当前用户在路径参数 :id 指定组织中的角色不低于 role
+func requireOrganizationRole(c *gin.Context, role string) (*model.Organization, *model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的组织 ID")
+		return nil, nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	if !member.HasRole(role) {
+		common.ApiError(c, model.ErrOrganizationNoPermission)
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+func validateOrganizationName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > 64 {
+		return "", errors.New("组织名称长度必须在 1-64 之间")
+	}
+	return name, nil
+}
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	name, err := validateOrganizationName(req.Name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org := &model.Organization{Name: name}
+	if err := model.CreateOrganization(org, c.GetInt("id")); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Role = model.OrganizationRoleOwner
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	org, member, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	org.Role = member.Role
+	common.ApiSuccess(c, org)
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	name, err := validateOrganizationName(req.Name)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org.Name = name
+	if err := org.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	if err := model.DeleteOrganization(org.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+type organizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit *int   `json:"quota_limit"` // 不传时保持不变，0 表示不限制
+}
+
+// canAssignOrganizationRole 仅 owner 可以任命或调整 admin
+func canAssignOrganizationRole(operator *model.OrganizationMember, role string) bool {
+	if !model.IsValidOrganizationRole(role) {
+		return false
+	}
+	if role == model.OrganizationRoleAdmin {
+		return operator.Role == model.OrganizationRoleOwner
+	}
+	return operator.HasRole(model.OrganizationRoleAdmin)
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, operator, ok := requireOrganizationRole(c, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if !canAssignOrganizationRole(operator, req.Role) {
+		common.ApiError(c, model.ErrOrganizationNoPermission)
+		return
+	}
+	if req.QuotaLimit != nil && *req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员额度上限不能为负数")
+		return
+	}
+	userId := req.UserId
+	if userId == 0 && req.Username != "" {
+		id, err := model.GetUserIdByUsername(strings.TrimSpace(req.Username))
+		if err != nil {
+			common.ApiErrorMsg(c, "用户不存在")
+			return
+		}
+		userId = id
+	}
+	if _, err := model.GetUserById(userId, false); err != nil {
+		common.ApiErrorMsg(c, "用户不存在")
+		return
+	}
+	member := &model.OrganizationMember{
+		OrganizationId: org.Id,
+		UserId:         userId,
+		Role:           req.Role,
+	}
+	if req.QuotaLimit != nil {
+		member.QuotaLimit = *req.QuotaLimit
+	}
+	if err := model.AddOrganizationMember(member); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, operator, ok := requireOrganizationRole(c, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	var req organizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	member, err := model.GetOrganizationMember(org.Id, req.UserId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "不能修改组织所有者")
+		return
+	}
+	if member.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner {
+		common.ApiError(c, model.ErrOrganizationNoPermission)
+		return
+	}
+	if req.Role != "" {
+		if !canAssignOrganizationRole(operator, req.Role) {
+			common.ApiError(c, model.ErrOrganizationNoPermission)
+			return
+		}
+		member.Role = req.Role
+	}
+	if req.QuotaLimit != nil {
+		if *req.QuotaLimit < 0 {
+			common.ApiErrorMsg(c, "成员额度上限不能为负数")
+			return
+		}
+		member.QuotaLimit = *req.QuotaLimit
+	}
+	if err := member.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// RemoveOrganizationMember 管理员移除成员，或成员自行退出
+func RemoveOrganizationMember(c *gin.Context) {
+	org, operator, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的用户 ID")
+		return
+	}
+	member, err := model.GetOrganizationMember(org.Id, userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if member.Role == model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "组织所有者不能被移除")
+		return
+	}
+	if userId != operator.UserId {
+		if !operator.HasRole(model.OrganizationRoleAdmin) ||
+			(member.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner) {
+			common.ApiError(c, model.ErrOrganizationNoPermission)
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(org.Id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// FundOrganization 成员从个人钱包向组织钱包转入额度
+func FundOrganization(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleMember)
+	if !ok {
+		return
+	}
+	var req struct {
+		Quota int `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	userId := c.GetInt("id")
+	if err := model.TransferUserQuotaToOrganization(userId, org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, fmt.Sprintf("向组织 %s 转入额度 %s", org.Name, logger.LogQuota(req.Quota)))
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationTokens(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	tokens, total, err := model.GetOrganizationTokens(org.Id, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(buildMaskedTokenResponses(tokens))
+	common.ApiSuccess(c, pageInfo)
+}
+
+// DisableOrganizationToken 组织管理员禁用成员的组织令牌
+func DisableOrganizationToken(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleAdmin)
+	if !ok {
+		return
+	}
+	tokenId, err := strconv.Atoi(c.Param("token_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "无效的令牌 ID")
+		return
+	}
+	token, err := model.GetTokenById(tokenId)
+	if err != nil || token.OrganizationId != org.Id {
+		common.ApiErrorMsg(c, "令牌不存在")
+		return
+	}
+	token.Status = common.TokenStatusDisabled
+	if err := token.SelectUpdate(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationLogs(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	username := c.Query("username")
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	logs, total, err := model.GetOrganizationLogs(org.Id, logType, startTimestamp, endTimestamp, modelName, username, tokenName, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func GetOrganizationLogsStat(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	username := c.Query("username")
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	stat, err := model.SumUsedQuota(logType, startTimestamp, endTimestamp, modelName, username, tokenName, 0, "", org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, stat)
+}
+
+func GetOrganizationQuotaDates(c *gin.Context) {
+	org, _, ok := requireOrganizationRole(c, model.OrganizationRoleViewer)
+	if !ok {
+		return
+	}
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	// 与个人数据看板一致，时间跨度不超过 1 个月
+	if endTimestamp-startTimestamp > 2592000 {
+		common.ApiErrorMsg(c, "时间跨度不能超过 1 个月")
+		return
+	}
+	dates, err := model.GetQuotaDataByOrganization(org.Id, startTimestamp, endTimestamp)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, dates)
+}
+
+func AdminGetAllOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// AdminUpdateOrganization 管理员调整组织余额（quota 为增量，可为负）或启用/禁用组织
+func AdminUpdateOrganization(c *gin.Context) {
+	var req struct {
+		Id     int `json:"id"`
+		Quota  int `json:"quota"`
+		Status int `json:"status"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	org, err := model.GetOrganizationById(req.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Status == model.OrganizationStatusEnabled || req.Status == model.OrganizationStatusDisabled {
+		org.Status = req.Status
+		if err := org.Update(); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	if req.Quota != 0 {
+		if err := model.IncreaseOrganizationQuota(org.Id, req.Quota); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		model.RecordLog(org.OwnerId, model.LogTypeManage, fmt.Sprintf("管理员调整组织 %s 额度 %s", org.Name, logger.LogQuota(req.Quota)))
+	}
+	common.ApiSuccess(c, nil)
+}
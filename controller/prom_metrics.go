@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPrometheusMetrics 以 Prometheus/OpenMetrics 格式输出指标；设置 METRICS_TOKEN 时校验 Bearer token
+func GetPrometheusMetrics(c *gin.Context) {
+	if constant.MetricsToken != "" {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(constant.MetricsToken)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+	}
+	prommetrics.Handler().ServeHTTP(c.Writer, c.Request)
+}
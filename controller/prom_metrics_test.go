@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func servePrometheusMetricsForTest(authorization string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		ctx.Request.Header.Set("Authorization", authorization)
+	}
+	GetPrometheusMetrics(ctx)
+	return recorder
+}
+
+func TestGetPrometheusMetrics(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Task{}))
+
+	savedEnabled, savedToken := constant.MetricsEnabled, constant.MetricsToken
+	t.Cleanup(func() {
+		constant.MetricsEnabled, constant.MetricsToken = savedEnabled, savedToken
+	})
+	constant.MetricsEnabled = true
+	constant.MetricsToken = "metrics-secret"
+
+	recorder := servePrometheusMetricsForTest("")
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+	require.Equal(t, http.StatusUnauthorized, servePrometheusMetricsForTest("Bearer wrong").Code)
+
+	// 进入渠道循环前被拒绝的请求同样计入指标
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	common.SetContextKey(ctx, constant.ContextKeyOriginalModel, "metrics-test-model")
+	observeRelayRejected(ctx, nil, types.NewError(errors.New("bad request"), types.ErrorCodeInvalidRequest))
+
+	recorder = servePrometheusMetricsForTest("Bearer metrics-secret")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `new_api_relay_rejected_total{group="default",model="metrics-test-model",reason="invalid_request"} 1`)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -23,6 +24,7 @@ import (
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
@@ -65,6 +67,19 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 	return err
 }
 
+func dispatchRelay(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, info)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, info)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, info)
+	default:
+		return relayHandler(c, info)
+	}
+}
+
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	requestId := c.GetString(common.RequestIdKey)
@@ -74,6 +89,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	var (
 		newAPIError *types.NewAPIError
 		ws          *websocket.Conn
+		relayInfo   *relaycommon.RelayInfo
+		// dispatched 请求是否进入了渠道选择，之前的失败计为被拒绝的请求
+		dispatched bool
 	)
 
 	if relayFormat == types.RelayFormatOpenAIRealtime {
@@ -88,6 +106,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	defer func() {
 		if newAPIError != nil {
+			if !dispatched {
+				observeRelayRejected(c, relayInfo, newAPIError)
+			}
 			logger.LogError(c, fmt.Sprintf("relay error: %s", newAPIError.Error()))
 			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
 			switch relayFormat {
@@ -117,7 +138,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
-	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
+	relayInfo, err = relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
@@ -148,8 +169,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
+	tokens, meta, newAPIError = admitContextWindow(c, relayInfo, request, tokens, meta)
+	if newAPIError != nil {
+		return
+	}
+
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	var cachedResponse *service.ResponseCacheEntry
+	cacheKey, cacheable := service.ResponseCacheKey(c, relayInfo, request)
+	if cacheable {
+		cachedResponse = lookupResponseCache(c, relayInfo, cacheKey)
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithStatusCode(http.StatusBadRequest))
@@ -174,10 +206,39 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			if relayInfo.Billing != nil {
 				relayInfo.Billing.Refund(c)
 			}
+			service.ReleaseTPM(relayInfo)
 			service.ChargeViolationFeeIfNeeded(c, relayInfo, newAPIError)
 		}
 	}()
 
+	if cachedResponse != nil {
+		replayCachedResponse(c, relayInfo, cachedResponse)
+		return
+	}
+
+	// 缓存命中不消耗上游 TPM，因此在缓存回放之后再准入
+	newAPIError = service.AcquireTPM(relayInfo, tokens)
+	if newAPIError != nil {
+		return
+	}
+	var captureWriter *service.ResponseCaptureWriter
+	if cacheable {
+		captureWriter = service.NewResponseCaptureWriter(c.Writer)
+		c.Writer = captureWriter
+	}
+	// 占位符只为客户端还原，缓存保存的是客户端收到的内容
+	rehydrateWriter := service.NewPIIRehydrateWriter(c, relayInfo)
+	if rehydrateWriter != nil {
+		c.Writer = rehydrateWriter
+		defer rehydrateWriter.Finish()
+	}
+	// 输出审核在占位符还原之前，审核模型看到的是脱敏后的内容
+	moderationWriter := service.NewOutputModerationWriter(c, relayInfo)
+	if moderationWriter != nil {
+		c.Writer = moderationWriter
+		defer moderationWriter.Finish()
+	}
+
 	retryParam := &service.RetryParam{
 		Ctx:        c,
 		TokenGroup: relayInfo.TokenGroup,
@@ -186,12 +247,16 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 	relayInfo.RetryIndex = 0
 	relayInfo.LastError = nil
+	dispatched = true
 
 	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
 		relayInfo.RetryIndex = retryParam.GetRetry()
 		channel, channelErr := getChannel(c, relayInfo, retryParam)
 		if channelErr != nil {
 			logger.LogError(c, channelErr.Error())
+			if switchModelFallback(c, relayInfo, retryParam, channelErr, tokens, meta) {
+				continue
+			}
 			newAPIError = channelErr
 			break
 		}
@@ -208,29 +273,46 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			break
 		}
 		c.Request.Body = io.NopCloser(bodyStorage)
+		if captureWriter != nil {
+			captureWriter.Reset()
+		}
+		if moderationWriter != nil {
+			moderationWriter.Reset()
+		}
+		if rehydrateWriter != nil {
+			rehydrateWriter.Reset()
+		}
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if hedgeDelay, ok := hedgeDelayFor(c, relayInfo, relayFormat); ok {
+			channel, newAPIError = relayWithHedge(c, relayInfo, relayFormat, channel, bodyStorage, hedgeDelay)
+		} else {
+			newAPIError = dispatchRelay(c, relayInfo, relayFormat)
 		}
 
 		if newAPIError == nil {
 			relayInfo.LastError = nil
+			service.RecordCircuitBreakerSuccess(c, channel.Id)
+			// 审核写入器包在还原写入器外层，先写出审核暂存的内容再还原占位符
+			if moderationWriter != nil {
+				moderationWriter.Finish()
+			}
+			if rehydrateWriter != nil {
+				rehydrateWriter.Finish()
+			}
+			service.SaveCachedResponse(c, relayInfo, captureWriter)
 			return
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
 		relayInfo.LastError = newAPIError
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+		recordChannelFailure(c, channel, newAPIError)
 
-		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) || retryParam.GetRetry() >= common.RetryTimes {
+			// 当前模型的重试用尽后，虚拟模型按回退链换下一个模型
+			if switchModelFallback(c, relayInfo, retryParam, newAPIError, tokens, meta) {
+				continue
+			}
 			break
 		}
 	}
@@ -247,6 +329,16 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	}
 }
 
+// observeRelayRejected 记录选择渠道之前被拒绝的请求，此时可能还没有生成 RelayInfo
+func observeRelayRejected(c *gin.Context, relayInfo *relaycommon.RelayInfo, newAPIError *types.NewAPIError) {
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if relayInfo != nil {
+		modelName, group = relayInfo.OriginModelName, relayInfo.UsingGroup
+	}
+	prommetrics.ObserveRelayRejected(modelName, group, newAPIError.GetErrorCode())
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -254,6 +346,17 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// recordChannelFailure 记录渠道失败：熔断器、自动禁用与性能指标
+func recordChannelFailure(c *gin.Context, channel *model.Channel, newAPIError *types.NewAPIError) {
+	channelError := *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan())
+	if service.RecordCircuitBreakerFailure(c, channel.Id, newAPIError) {
+		// 由熔断器处理，不再永久禁用渠道
+		channelError.AutoBan = false
+	}
+	processChannelError(c, channelError, newAPIError)
+	perfmetrics.RecordChannelFailure(channel.Id, newAPIError)
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
@@ -321,6 +424,159 @@ func getChannel(c *gin.Context, info *relaycommon.RelayInfo, retryParam *service
 	return channel, nil
 }
 
+// admitContextWindow 预估输入超出模型上下文窗口时，改用配置的长上下文模型、按令牌设置截断或直接拒绝，
+// 避免预扣费并重试后才在上游失败
+func admitContextWindow(c *gin.Context, relayInfo *relaycommon.RelayInfo, request dto.Request, tokens int, meta *types.TokenCountMeta) (int, *types.TokenCountMeta, *types.NewAPIError) {
+	if meta == nil {
+		return tokens, meta, nil
+	}
+	originModel := relayInfo.OriginModelName
+	limit, excess := service.ContextWindowExcess(originModel, tokens, meta.MaxTokens)
+	if excess == 0 {
+		return tokens, meta, nil
+	}
+	overflow := &service.ContextOverflow{
+		FromModel:     originModel,
+		PromptTokens:  tokens,
+		ContextLength: limit.ContextLength,
+	}
+
+	if longModel := limit.LongContextModel; longModel != "" && longModel != originModel && tokenAllowsModel(c, longModel) {
+		if _, longExcess := service.ContextWindowExcess(longModel, tokens, meta.MaxTokens); longExcess == 0 {
+			channel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+				Ctx:        c,
+				TokenGroup: relayInfo.TokenGroup,
+				ModelName:  longModel,
+				Retry:      common.GetPointer(0),
+			})
+			if err == nil && channel != nil && middleware.SetupContextForSelectedChannel(c, channel, longModel) == nil {
+				relayInfo.OriginModelName = longModel
+				overflow.Action = service.ContextOverflowActionReroute
+				service.SetContextOverflow(c, overflow)
+				logger.LogInfo(c, fmt.Sprintf("预估输入 %d tokens 超出模型 %s 的上下文长度 %d，改用 %s", tokens, originModel, limit.ContextLength, longModel))
+				return tokens, meta, nil
+			}
+		}
+	}
+
+	// 回退链中配置了超出上下文长度时回退的模型，在预扣费前直接切换，不必等上游拒绝
+	rejectErr := service.NewContextLengthExceededError(fmt.Errorf("预估输入 %d tokens 超出模型 %s 的上下文长度 %d", tokens, originModel, limit.ContextLength))
+	if fallback := service.GetModelFallback(c); fallback != nil {
+		fallbackModel, ok := fallback.NextMatching(rejectErr, func(modelName string) bool {
+			_, fallbackExcess := service.ContextWindowExcess(modelName, tokens, meta.MaxTokens)
+			return fallbackExcess == 0
+		})
+		if ok {
+			relayInfo.OriginModelName = fallbackModel
+			overflow.Action = service.ContextOverflowActionReroute
+			service.SetContextOverflow(c, overflow)
+			logger.LogInfo(c, fmt.Sprintf("模型回退：%s 预估输入 %d tokens 超出 %s 的上下文长度 %d，切换到 %s", fallback.VirtualModel, tokens, originModel, limit.ContextLength, fallbackModel))
+			return tokens, meta, nil
+		}
+	}
+
+	if service.ContextTruncationEnabled(c) {
+		if removed, ok := service.TruncateMiddleOut(request, excess, originModel); ok {
+			newMeta := request.GetTokenCountMeta()
+			newTokens, err := service.EstimateRequestToken(c, newMeta, relayInfo)
+			if err == nil {
+				if _, newExcess := service.ContextWindowExcess(originModel, newTokens, newMeta.MaxTokens); newExcess == 0 {
+					if err = replaceRequestBody(c, request); err == nil {
+						overflow.Action = service.ContextOverflowActionTruncate
+						overflow.RemovedMessages = removed
+						service.SetContextOverflow(c, overflow)
+						logger.LogInfo(c, fmt.Sprintf("预估输入 %d tokens 超出模型 %s 的上下文长度 %d，已删除中间 %d 条消息", tokens, originModel, limit.ContextLength, removed))
+						return newTokens, newMeta, nil
+					}
+				}
+			}
+		}
+	}
+
+	return tokens, meta, rejectErr
+}
+
+// tokenAllowsModel 令牌开启模型限制时检查模型是否在允许列表中
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	tokenModelLimit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	_, ok = tokenModelLimit[ratio_setting.FormatMatchingModelName(modelName)]
+	return ok
+}
+
+// replaceRequestBody 截断后的请求同时写回请求体，透传模式与重试读取的也是截断后的内容
+func replaceRequestBody(c *gin.Context, request dto.Request) error {
+	data, err := common.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return common.ReplaceBodyStorage(c, data)
+}
+
+// switchModelFallback 虚拟模型当前的实际模型失败且满足回退条件时切换到下一个模型，重新计价后从头重试
+func switchModelFallback(c *gin.Context, relayInfo *relaycommon.RelayInfo, retryParam *service.RetryParam, apiErr *types.NewAPIError, tokens int, meta *types.TokenCountMeta) bool {
+	fallback := service.GetModelFallback(c)
+	if fallback == nil {
+		return false
+	}
+	previousModel := relayInfo.OriginModelName
+	nextModel, ok := fallback.Next(apiErr)
+	for ok {
+		relayInfo.OriginModelName = nextModel
+		priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+		if err != nil {
+			logger.LogWarn(c, fmt.Sprintf("模型回退跳过 %s：%s", nextModel, err.Error()))
+			nextModel, ok = fallback.Skip(string(types.ErrorCodeModelPriceError))
+			continue
+		}
+		reserveErr := reserveModelFallback(c, relayInfo, priceData, tokens)
+		if reserveErr == nil {
+			break
+		}
+		logger.LogWarn(c, fmt.Sprintf("模型回退跳过 %s：%s", nextModel, reserveErr.Error()))
+		nextModel, ok = fallback.Skip(string(reserveErr.GetErrorCode()))
+	}
+	if !ok {
+		// 恢复原模型的价格信息，结算与退款按原模型进行
+		relayInfo.OriginModelName = previousModel
+		_, _ = helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+		return false
+	}
+	logger.LogInfo(c, fmt.Sprintf("模型回退：%s 由 %s 切换到 %s", fallback.VirtualModel, previousModel, nextModel))
+	retryParam.ModelName = nextModel
+	retryParam.SetRetry(0)
+	retryParam.ResetRetryNextTry()
+	common.SetContextKey(c, constant.ContextKeyAutoGroupIndex, 0)
+	common.SetContextKey(c, constant.ContextKeyAutoGroupRetryIndex, 0)
+	return true
+}
+
+// reserveModelFallback 按回退模型的价格补足预扣费（含令牌周期预算与组织额度），并按新模型重新计入 TPM；
+// 额度或限流不满足时返回错误，不切换到该模型
+func reserveModelFallback(c *gin.Context, relayInfo *relaycommon.RelayInfo, priceData types.PriceData, tokens int) *types.NewAPIError {
+	if !priceData.FreeModel {
+		if relayInfo.Billing == nil {
+			if apiErr := service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo); apiErr != nil {
+				return apiErr
+			}
+		} else if err := relayInfo.Billing.Reserve(priceData.QuotaToPreConsume); err != nil {
+			var apiErr *types.NewAPIError
+			if errors.As(err, &apiErr) {
+				return apiErr
+			}
+			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+		}
+	}
+	// TPM 含按模型计数的维度，撤销原模型的计数后按新模型重新准入
+	service.ReleaseTPM(relayInfo)
+	return service.AcquireTPM(relayInfo, tokens)
+}
+
 func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) bool {
 	if openaiErr == nil {
 		return false
@@ -548,14 +804,18 @@ func RelayTask(c *gin.Context) {
 
 		result, taskErr = relay.RelayTaskSubmit(c, relayInfo)
 		if taskErr == nil {
+			service.RecordCircuitBreakerSuccess(c, channel.Id)
 			break
 		}
 
 		if !taskErr.LocalError {
-			processChannelError(c,
-				*types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey,
-					common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()),
-				types.NewOpenAIError(taskErr.Error, types.ErrorCodeBadResponseStatusCode, taskErr.StatusCode))
+			channelError := *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey,
+				common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan())
+			channelErr := types.NewOpenAIError(taskErr.Error, types.ErrorCodeBadResponseStatusCode, taskErr.StatusCode)
+			if service.RecordCircuitBreakerFailure(c, channel.Id, channelErr) {
+				channelError.AutoBan = false
+			}
+			processChannelError(c, channelError, channelErr)
 		}
 
 		if !shouldRetryTaskRelay(c, channel.Id, taskErr, common.RetryTimes-retryParam.GetRetry()) {
@@ -581,6 +841,7 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
 		task.PrivateData.TokenId = relayInfo.TokenId
+		task.PrivateData.OrganizationId = relayInfo.OrganizationId
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
 			ModelPrice:      relayInfo.PriceData.ModelPrice,
 			GroupRatio:      relayInfo.PriceData.GroupRatioInfo.GroupRatio,
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+type fallbackBillingForTest struct {
+	reserved   int
+	reserveErr error
+}
+
+func (b *fallbackBillingForTest) Settle(int) error         { return nil }
+func (b *fallbackBillingForTest) Refund(*gin.Context)      {}
+func (b *fallbackBillingForTest) NeedsRefund() bool        { return false }
+func (b *fallbackBillingForTest) GetPreConsumedQuota() int { return b.reserved }
+func (b *fallbackBillingForTest) Reserve(targetQuota int) error {
+	if b.reserveErr != nil {
+		return b.reserveErr
+	}
+	b.reserved = max(b.reserved, targetQuota)
+	return nil
+}
+
+func TestReserveModelFallback(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	billing := &fallbackBillingForTest{reserved: 100}
+	info := &relaycommon.RelayInfo{Billing: billing}
+	require.Nil(t, reserveModelFallback(ctx, info, types.PriceData{QuotaToPreConsume: 300}, 10))
+	require.Equal(t, 300, billing.reserved)
+
+	// 免费模型不需要补足预扣费
+	require.Nil(t, reserveModelFallback(ctx, info, types.PriceData{FreeModel: true, QuotaToPreConsume: 900}, 10))
+	require.Equal(t, 300, billing.reserved)
+
+	// 额度不足时不切换到价格更高的模型
+	billing.reserveErr = types.NewErrorWithStatusCode(errors.New("quota"), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden)
+	apiErr := reserveModelFallback(ctx, info, types.PriceData{QuotaToPreConsume: 900}, 10)
+	require.NotNil(t, apiErr)
+	require.Equal(t, types.ErrorCodeInsufficientUserQuota, apiErr.GetErrorCode())
+}
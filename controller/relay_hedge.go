@@ -0,0 +1,362 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeMaxPickAttempts 选取对冲渠道时避开首个渠道的最大尝试次数
+const hedgeMaxPickAttempts = 3
+
+// hedgeWriter 对冲尝试的响应写入器：首次写入前只缓存状态码与响应头，
+// 首个写入的尝试胜出并透传到客户端，落败尝试的写入被丢弃
+type hedgeWriter struct {
+	gin.ResponseWriter
+	hedge   *relaycommon.HedgeInfo
+	attempt int
+
+	mu     sync.Mutex
+	header http.Header
+	status int
+	won    bool
+	lost   bool
+}
+
+func newHedgeWriter(w gin.ResponseWriter, hedge *relaycommon.HedgeInfo, attempt int) *hedgeWriter {
+	return &hedgeWriter{
+		ResponseWriter: w,
+		hedge:          hedge,
+		attempt:        attempt,
+		header:         make(http.Header),
+	}
+}
+
+// claim 首次写入时争夺响应权，胜出后把缓存的响应头写入真实响应
+func (w *hedgeWriter) claim() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.won || w.lost {
+		return w.won
+	}
+	if !w.hedge.Claim(w.attempt) {
+		w.lost = true
+		return false
+	}
+	w.won = true
+	dst := w.ResponseWriter.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	return true
+}
+
+func (w *hedgeWriter) hasWon() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.won
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.hasWon() {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.hasWon() {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.mu.Lock()
+		w.status = code
+		w.mu.Unlock()
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.claim() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.claim() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if !w.claim() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.hasWon() {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.hasWon() {
+		return w.ResponseWriter.Status()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.hasWon() {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	if w.hasWon() {
+		return w.ResponseWriter.Written()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lost
+}
+
+// hedgeAttempt 一次对冲尝试，在独立的 gin.Context 与 RelayInfo 上执行
+type hedgeAttempt struct {
+	id       int
+	c        *gin.Context
+	info     *relaycommon.RelayInfo
+	channel  *model.Channel
+	cancel   context.CancelFunc
+	canceled bool
+	err      *types.NewAPIError
+}
+
+// hedgeDelayFor 判断本次请求是否启用对冲，仅首次尝试的文本类请求参与
+func hedgeDelayFor(c *gin.Context, info *relaycommon.RelayInfo, relayFormat types.RelayFormat) (time.Duration, bool) {
+	if info.RetryIndex != 0 {
+		return 0, false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return 0, false
+	}
+	switch relayFormat {
+	case types.RelayFormatOpenAI:
+		if info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+			return 0, false
+		}
+	case types.RelayFormatOpenAIResponses:
+		if info.RelayMode != relayconstant.RelayModeResponses {
+			return 0, false
+		}
+	case types.RelayFormatClaude:
+	case types.RelayFormatGemini:
+		if strings.Contains(c.Request.URL.Path, "embed") {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	return operation_setting.GetHedgeDelay(info.UsingGroup)
+}
+
+// newHedgeAttempt 复制请求上下文，使用独立的请求体与可取消的请求 context
+func newHedgeAttempt(c *gin.Context, info *relaycommon.RelayInfo, hedge *relaycommon.HedgeInfo, id int, body []byte) (*hedgeAttempt, error) {
+	storage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	attemptCtx := c.Copy()
+	attemptCtx.Set(common.KeyBodyStorage, storage)
+	attemptCtx.Request = c.Request.WithContext(ctx)
+	attemptCtx.Request.Body = io.NopCloser(storage)
+	attemptCtx.Writer = newHedgeWriter(c.Writer, hedge, id)
+	if id != 1 {
+		// 对冲尝试会另选渠道，不继承主请求持有的探测名额
+		common.SetContextKey(attemptCtx, constant.ContextKeyCircuitBreakerProbe, "")
+	}
+	return &hedgeAttempt{
+		id:     id,
+		c:      attemptCtx,
+		info:   info.CloneForHedge(hedge, id),
+		cancel: cancel,
+	}, nil
+}
+
+func (a *hedgeAttempt) run(relayFormat types.RelayFormat, finished chan<- *hedgeAttempt) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.LogError(a.c, fmt.Sprintf("hedge attempt panic: %v", r))
+				a.err = types.NewError(fmt.Errorf("hedge attempt panic: %v", r), types.ErrorCodeDoRequestFailed)
+			}
+			finished <- a
+		}()
+		a.err = dispatchRelay(a.c, a.info, relayFormat)
+	}()
+}
+
+// pickHedgeChannel 选取与首个渠道不同的对冲渠道，没有可用渠道时返回 nil
+func pickHedgeChannel(c *gin.Context, info *relaycommon.RelayInfo, primaryId int) *model.Channel {
+	for i := 0; i < hedgeMaxPickAttempts; i++ {
+		channel, _, err := service.CacheGetRandomSatisfiedChannel(&service.RetryParam{
+			Ctx:        c,
+			TokenGroup: info.TokenGroup,
+			ModelName:  info.OriginModelName,
+			Retry:      common.GetPointer(0),
+		})
+		if err != nil || channel == nil {
+			return nil
+		}
+		if channel.Id != primaryId {
+			return channel
+		}
+	}
+	return nil
+}
+
+// relayWithHedge 在首个渠道超过等待时间仍未返回首字节时，向第二个渠道发送同一请求，
+// 先写入响应的一方胜出，另一方被取消且不结算。返回决定最终结果的渠道与错误
+func relayWithHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel, bodyStorage common.BodyStorage, delay time.Duration) (*model.Channel, *types.NewAPIError) {
+	body, err := bodyStorage.Bytes()
+	if err != nil {
+		return channel, dispatchRelay(c, relayInfo, relayFormat)
+	}
+	hedge := relaycommon.NewHedgeInfo()
+	primary, err := newHedgeAttempt(c, relayInfo, hedge, 1, body)
+	if err != nil {
+		return channel, dispatchRelay(c, relayInfo, relayFormat)
+	}
+	primary.channel = channel
+	hedge.AddChannel(channel.Id)
+
+	finished := make(chan *hedgeAttempt, 2)
+	attempts := []*hedgeAttempt{primary}
+	primary.run(relayFormat, finished)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	decided := hedge.Decided()
+	var order []*hedgeAttempt
+
+	select {
+	case a := <-finished:
+		pending--
+		order = append(order, a)
+	case <-decided:
+	case <-timer.C:
+		if secondary := startHedgeAttempt(c, relayInfo, relayFormat, hedge, channel.Id, body, delay, finished); secondary != nil {
+			attempts = append(attempts, secondary)
+			pending++
+		}
+	}
+
+	for pending > 0 {
+		select {
+		case <-decided:
+			decided = nil
+			winner := hedge.Winner()
+			for _, a := range attempts {
+				if a.id != winner {
+					a.canceled = true
+					a.cancel()
+				}
+			}
+		case a := <-finished:
+			pending--
+			order = append(order, a)
+		}
+	}
+	return finishHedge(c, relayInfo, hedge, attempts, order)
+}
+
+func startHedgeAttempt(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, hedge *relaycommon.HedgeInfo, primaryId int, body []byte, delay time.Duration, finished chan<- *hedgeAttempt) *hedgeAttempt {
+	attempt, err := newHedgeAttempt(c, relayInfo, hedge, 2, body)
+	if err != nil {
+		logger.LogError(c, "failed to create hedge attempt: "+err.Error())
+		return nil
+	}
+	channel := pickHedgeChannel(attempt.c, relayInfo, primaryId)
+	if channel == nil {
+		attempt.cancel()
+		common.CleanupBodyStorage(attempt.c)
+		return nil
+	}
+	if apiErr := middleware.SetupContextForSelectedChannel(attempt.c, channel, relayInfo.OriginModelName); apiErr != nil {
+		logger.LogError(c, fmt.Sprintf("failed to setup hedge channel #%d: %s", channel.Id, apiErr.Error()))
+		attempt.cancel()
+		common.CleanupBodyStorage(attempt.c)
+		return nil
+	}
+	attempt.channel = channel
+	addUsedChannel(attempt.c, channel.Id)
+	hedge.AddChannel(channel.Id)
+	logger.LogInfo(c, fmt.Sprintf("channel #%d no first byte after %v, hedging to channel #%d", primaryId, delay, channel.Id))
+	attempt.run(relayFormat, finished)
+	return attempt
+}
+
+// finishHedge 选出最终结果并把其上下文写回原请求：有胜者取胜者，否则取最后结束的尝试；
+// 其余非主动取消的失败尝试在此记录渠道错误
+func finishHedge(c *gin.Context, relayInfo *relaycommon.RelayInfo, hedge *relaycommon.HedgeInfo, attempts []*hedgeAttempt, order []*hedgeAttempt) (*model.Channel, *types.NewAPIError) {
+	final := order[len(order)-1]
+	if winner := hedge.Winner(); winner != 0 {
+		for _, a := range attempts {
+			if a.id == winner {
+				final = a
+			}
+		}
+	}
+	for _, a := range attempts {
+		a.cancel()
+		if a != final && a.err != nil && !a.canceled {
+			recordChannelFailure(a.c, a.channel, a.err)
+		}
+		if a != final {
+			service.ReleaseCircuitBreaker(a.c)
+		}
+		common.CleanupBodyStorage(a.c)
+	}
+	for k, v := range final.c.Keys {
+		if k == common.KeyBodyStorage {
+			continue
+		}
+		c.Set(k, v)
+	}
+	if len(attempts) > 1 && final == attempts[0] {
+		addUsedChannel(c, attempts[1].channel.Id)
+	}
+	*relayInfo = *final.info
+	return final.channel, final.err
+}
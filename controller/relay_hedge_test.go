@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHedgeWriterFirstWriterWins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	hedge := relaycommon.NewHedgeInfo()
+	primary := newHedgeWriter(c.Writer, hedge, 1)
+	secondary := newHedgeWriter(c.Writer, hedge, 2)
+
+	primary.Header().Set("X-Attempt", "primary")
+	primary.WriteHeader(http.StatusAccepted)
+	secondary.Header().Set("Content-Type", "text/event-stream")
+	secondary.WriteHeader(http.StatusOK)
+	require.Zero(t, hedge.Winner())
+	require.False(t, recorder.Flushed)
+
+	_, err := secondary.WriteString("data: hello\n\n")
+	require.NoError(t, err)
+	secondary.Flush()
+	n, err := primary.Write([]byte("ignored"))
+	require.NoError(t, err)
+	require.Equal(t, len("ignored"), n)
+
+	require.Equal(t, 2, hedge.Winner())
+	select {
+	case <-hedge.Decided():
+	default:
+		t.Fatal("hedge should be decided after first write")
+	}
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	require.Empty(t, recorder.Header().Get("X-Attempt"))
+	require.Equal(t, "data: hello\n\n", recorder.Body.String())
+	require.True(t, primary.Written())
+}
+
+func TestRelayInfoIsHedgeLoser(t *testing.T) {
+	hedge := relaycommon.NewHedgeInfo()
+	base := &relaycommon.RelayInfo{
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{LastMessagesType: relaycommon.LastMessageTypeNone},
+	}
+	first := base.CloneForHedge(hedge, 1)
+	second := base.CloneForHedge(hedge, 2)
+	require.NotSame(t, first.ClaudeConvertInfo, second.ClaudeConvertInfo)
+	require.False(t, first.IsHedgeLoser())
+	require.False(t, second.IsHedgeLoser())
+
+	require.True(t, hedge.Claim(1))
+	require.False(t, hedge.Claim(2))
+	require.False(t, first.IsHedgeLoser())
+	require.True(t, second.IsHedgeLoser())
+	require.False(t, base.IsHedgeLoser())
+}
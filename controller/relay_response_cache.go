@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lookupResponseCache 查询响应缓存：命中时返回缓存内容；未命中时记录缓存键，请求成功后写入缓存
+func lookupResponseCache(c *gin.Context, relayInfo *relaycommon.RelayInfo, cacheKey string) *service.ResponseCacheEntry {
+	if entry, ok := service.GetCachedResponse(cacheKey); ok && entry.Stream == relayInfo.IsStream {
+		common.SetContextKey(c, constant.ContextKeyResponseCacheHit, true)
+		return entry
+	}
+	common.SetContextKey(c, constant.ContextKeyResponseCacheKey, cacheKey)
+	return nil
+}
+
+// replayCachedResponse 向客户端重放缓存的响应，并按缓存价格比例结算、记录消费日志
+func replayCachedResponse(c *gin.Context, relayInfo *relaycommon.RelayInfo, entry *service.ResponseCacheEntry) {
+	// 缓存命中不经过任何渠道
+	relayInfo.ChannelMeta = &relaycommon.ChannelMeta{
+		UpstreamModelName: relayInfo.OriginModelName,
+	}
+	relayInfo.SetFirstResponseTime()
+
+	if entry.Stream {
+		helper.SetEventStreamHeaders(c)
+	} else if entry.ContentType != "" {
+		c.Writer.Header().Set("Content-Type", entry.ContentType)
+	}
+	c.Writer.Header().Set("X-Response-Cache", "HIT")
+	c.Writer.WriteHeader(http.StatusOK)
+	_, _ = c.Writer.WriteString(entry.Body)
+	c.Writer.Flush()
+
+	usage := entry.Usage
+	service.PostTextConsumeQuota(c, relayInfo, &usage, []string{"响应缓存命中"})
+}
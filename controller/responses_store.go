@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+func getUserStoredResponseOrAbort(c *gin.Context) *model.StoredResponse {
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		RelayNotImplemented(c)
+		return nil
+	}
+	stored, err := model.GetUserStoredResponse(c.GetInt("id"), c.Param("id"))
+	if err != nil {
+		fileApiError(c, http.StatusNotFound, "response_not_found", fmt.Sprintf("Response with id '%s' not found.", c.Param("id")))
+		return nil
+	}
+	return stored
+}
+
+func RetrieveResponse(c *gin.Context) {
+	stored := getUserStoredResponseOrAbort(c)
+	if stored == nil {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", stored.Response)
+}
+
+func DeleteResponse(c *gin.Context) {
+	stored := getUserStoredResponseOrAbort(c)
+	if stored == nil {
+		return
+	}
+	if err := model.DeleteStoredResponse(stored); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIResponsesDeleted{
+		Id:      stored.ResponseId,
+		Object:  "response.deleted",
+		Deleted: true,
+	})
+}
+
+// ListResponseInputItems 返回本轮请求的输入项，默认按倒序排列（与 OpenAI 一致）
+func ListResponseInputItems(c *gin.Context) {
+	stored := getUserStoredResponseOrAbort(c)
+	if stored == nil {
+		return
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(stored.InputItems, &items); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if c.DefaultQuery("order", "desc") != "asc" {
+		slices.Reverse(items)
+	}
+	if after := c.Query("after"); after != "" {
+		for i, item := range items {
+			if gjson.GetBytes(item, "id").String() == after {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	list := dto.OpenAIResponsesInputItemList{
+		Object:  "list",
+		Data:    items,
+		HasMore: len(items) > limit,
+	}
+	if list.HasMore {
+		list.Data = items[:limit]
+	}
+	if list.Data == nil {
+		list.Data = []json.RawMessage{}
+	}
+	if len(list.Data) > 0 {
+		list.FirstId = gjson.GetBytes(list.Data[0], "id").String()
+		list.LastId = gjson.GetBytes(list.Data[len(list.Data)-1], "id").String()
+	}
+	c.JSON(http.StatusOK, list)
+}
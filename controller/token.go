@@ -175,6 +175,10 @@ func AddToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if token.BudgetQuota < 0 || token.RpmLimit < 0 || token.TpmLimit < 0 {
+		common.ApiErrorMsg(c, "令牌预算与速率限制不能为负数")
+		return
+	}
 	// 非无限额度时，检查额度值是否超出有效范围
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
@@ -201,6 +205,18 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	// 组织令牌仅限 member 及以上角色创建
+	if token.OrganizationId > 0 {
+		member, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt("id"))
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if !member.HasRole(model.OrganizationRoleMember) {
+			common.ApiError(c, model.ErrOrganizationNoPermission)
+			return
+		}
+	}
 	key, err := common.GenerateKey()
 	if err != nil {
 		common.ApiErrorI18n(c, i18n.MsgTokenGenerateFailed)
@@ -221,6 +237,14 @@ func AddToken(c *gin.Context) {
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
 		CrossGroupRetry:    token.CrossGroupRetry,
+		ResponseCache:      token.ResponseCache,
+		PIIRedaction:       token.PIIRedaction,
+		ContextTruncation:  model.NormalizeTokenContextTruncation(token.ContextTruncation),
+		OrganizationId:     token.OrganizationId,
+		BudgetPeriod:       model.NormalizeTokenBudgetPeriod(token.BudgetPeriod),
+		BudgetQuota:        token.BudgetQuota,
+		RpmLimit:           token.RpmLimit,
+		TpmLimit:           token.TpmLimit,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -260,6 +284,10 @@ func UpdateToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if token.BudgetQuota < 0 || token.RpmLimit < 0 || token.TpmLimit < 0 {
+		common.ApiErrorMsg(c, "令牌预算与速率限制不能为负数")
+		return
+	}
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
 			common.ApiErrorI18n(c, i18n.MsgTokenQuotaNegative)
@@ -285,6 +313,12 @@ func UpdateToken(c *gin.Context) {
 			common.ApiErrorI18n(c, i18n.MsgTokenExhaustedCannotEable)
 			return
 		}
+		if cleanToken.Status == common.TokenStatusSuspended {
+			if quota, err := model.GetUserQuota(userId, true); err == nil && quota < 0 {
+				common.ApiErrorI18n(c, i18n.MsgTokenSuspendedCannotEnable)
+				return
+			}
+		}
 	}
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
@@ -299,6 +333,13 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.ResponseCache = token.ResponseCache
+		cleanToken.PIIRedaction = token.PIIRedaction
+		cleanToken.ContextTruncation = model.NormalizeTokenContextTruncation(token.ContextTruncation)
+		cleanToken.BudgetPeriod = model.NormalizeTokenBudgetPeriod(token.BudgetPeriod)
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.RpmLimit = token.RpmLimit
+		cleanToken.TpmLimit = token.TpmLimit
 	}
 	err = cleanToken.Update()
 	if err != nil {
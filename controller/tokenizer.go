@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/filestore"
+	tokenizerpkg "github.com/QuantumNous/new-api/pkg/tokenizer"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTokenizerFileBytes tokenizer.json 上传大小限制
+const maxTokenizerFileBytes = 64 << 20
+
+func reloadCustomTokenizers(c *gin.Context) {
+	if err := service.ReloadCustomTokenizers(false); err != nil {
+		logger.LogError(c, "failed to reload custom tokenizers: "+err.Error())
+	}
+}
+
+// GetTokenizers 返回内置规则与管理员上传的分词器
+func GetTokenizers(c *gin.Context) {
+	custom, err := model.GetAllCustomTokenizers()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, gin.H{
+		"builtin": service.BuiltinTokenizerRules(),
+		"custom":  custom,
+	})
+}
+
+// UploadTokenizer 上传 HuggingFace tokenizer.json，解析成功后才保存
+func UploadTokenizer(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("name"))
+	pattern := strings.TrimSpace(c.PostForm("model_pattern"))
+	if name == "" || pattern == "" {
+		common.ApiErrorMsg(c, "name 与 model_pattern 不能为空")
+		return
+	}
+	if _, err := regexp.Compile(pattern); err != nil {
+		common.ApiErrorMsg(c, "model_pattern 不是合法的正则表达式: "+err.Error())
+		return
+	}
+	priority, _ := strconv.Atoi(c.DefaultPostForm("priority", "0"))
+	header, err := c.FormFile("file")
+	if err != nil {
+		common.ApiErrorMsg(c, "缺少 tokenizer.json 文件")
+		return
+	}
+	if header.Size > maxTokenizerFileBytes {
+		common.ApiErrorMsg(c, fmt.Sprintf("文件大小不能超过 %d MB", maxTokenizerFileBytes>>20))
+		return
+	}
+	src, err := header.Open()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxTokenizerFileBytes))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := tokenizerpkg.LoadHuggingFace(bytes.NewReader(data)); err != nil {
+		common.ApiErrorMsg(c, err.Error())
+		return
+	}
+
+	store, err := filestore.Current()
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	storageKey := fmt.Sprintf("tokenizers/%s.json", common.GetUUID())
+	written, err := store.Put(c.Request.Context(), storageKey, bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	record := &model.CustomTokenizer{
+		Name:         name,
+		ModelPattern: pattern,
+		Priority:     priority,
+		Enabled:      c.DefaultPostForm("enabled", "true") == "true",
+		StorageType:  store.Type(),
+		StorageKey:   storageKey,
+		Bytes:        written,
+	}
+	if err := record.Insert(); err != nil {
+		_ = store.Delete(c.Request.Context(), storageKey)
+		common.ApiError(c, err)
+		return
+	}
+	reloadCustomTokenizers(c)
+	common.ApiSuccess(c, record)
+}
+
+type updateTokenizerRequest struct {
+	ModelPattern string `json:"model_pattern"`
+	Priority     int    `json:"priority"`
+	Enabled      bool   `json:"enabled"`
+}
+
+func UpdateTokenizer(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	record, err := model.GetCustomTokenizerById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var req updateTokenizerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if _, err := regexp.Compile(req.ModelPattern); err != nil || req.ModelPattern == "" {
+		common.ApiErrorMsg(c, "model_pattern 不是合法的正则表达式")
+		return
+	}
+	record.ModelPattern = req.ModelPattern
+	record.Priority = req.Priority
+	record.Enabled = req.Enabled
+	if err := record.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	reloadCustomTokenizers(c)
+	common.ApiSuccess(c, record)
+}
+
+func DeleteTokenizer(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	record, err := model.GetCustomTokenizerById(id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := record.Delete(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if store, err := filestore.ByType(record.StorageType); err == nil {
+		if err := store.Delete(c.Request.Context(), record.StorageKey); err != nil {
+			logger.LogWarn(c, fmt.Sprintf("failed to delete tokenizer file %s: %v", record.StorageKey, err))
+		}
+	}
+	reloadCustomTokenizers(c)
+	common.ApiSuccess(c, nil)
+}
+
+type countTokenizerTokensRequest struct {
+	Model string `json:"model"`
+	Text  string `json:"text"`
+}
+
+// CountTokenizerTokens 使用当前注册表为模型选择的分词器计算文本 token 数，用于核对配置
+func CountTokenizerTokens(c *gin.Context) {
+	var req countTokenizerTokensRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	t := service.ResolveTokenizer(req.Model)
+	common.ApiSuccess(c, gin.H{
+		"tokenizer": t.Name(),
+		"tokens":    t.Count(req.Text),
+	})
+}
+
+// GetTokenizerAccuracy 返回本节点各模型预估输入 token 数与上游实际用量的误差
+func GetTokenizerAccuracy(c *gin.Context) {
+	common.ApiSuccess(c, service.GetTokenizerAccuracy())
+}
+
+func ResetTokenizerAccuracy(c *gin.Context) {
+	service.ResetTokenizerAccuracy()
+	common.ApiSuccess(c, nil)
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -379,17 +380,18 @@ func EpayNotify(c *gin.Context) {
 				logger.LogInfo(c.Request.Context(), fmt.Sprintf("易支付 实际支付方式与订单不同 trade_no=%s order_payment_method=%s actual_type=%s client_ip=%s", verifyInfo.ServiceTradeNo, topUp.PaymentMethod, verifyInfo.Type, c.ClientIP()))
 				topUp.PaymentMethod = verifyInfo.Type
 			}
+			//user, _ := model.GetUserById(topUp.UserId, false)
+			//user.Quota += topUp.Amount * 500000
+			dAmount := decimal.NewFromInt(int64(topUp.Amount))
+			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
 			topUp.Status = common.TopUpStatusSuccess
+			topUp.CreditedQuota = int64(quotaToAdd)
 			err := topUp.Update()
 			if err != nil {
 				logger.LogError(c.Request.Context(), fmt.Sprintf("易支付 更新充值订单失败 trade_no=%s user_id=%d client_ip=%s error=%q topup=%q", topUp.TradeNo, topUp.UserId, c.ClientIP(), err.Error(), common.GetJsonString(topUp)))
 				return
 			}
-			//user, _ := model.GetUserById(topUp.UserId, false)
-			//user.Quota += topUp.Amount * 500000
-			dAmount := decimal.NewFromInt(int64(topUp.Amount))
-			dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
-			quotaToAdd := int(dAmount.Mul(dQuotaPerUnit).IntPart())
 			err = model.IncreaseUserQuota(topUp.UserId, quotaToAdd, true)
 			if err != nil {
 				logger.LogError(c.Request.Context(), fmt.Sprintf("易支付 更新用户额度失败 trade_no=%s user_id=%d client_ip=%s quota_to_add=%d error=%q topup=%q", topUp.TradeNo, topUp.UserId, c.ClientIP(), quotaToAdd, err.Error(), common.GetJsonString(topUp)))
@@ -501,3 +503,61 @@ func AdminCompleteTopUp(c *gin.Context) {
 	}
 	common.ApiSuccess(c, nil)
 }
+
+type AdminRefundTopupRequest struct {
+	TradeNo string `json:"trade_no"`
+	// Money 退款金额，与订单支付金额同单位，为 0 时退还剩余全部金额
+	Money  float64 `json:"money"`
+	Reason string  `json:"reason"`
+}
+
+// AdminRefundTopUp 管理员对已到账订单登记全部或部分退款，并按比例扣回用户额度
+func AdminRefundTopUp(c *gin.Context) {
+	var req AdminRefundTopupRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.TradeNo == "" || req.Money < 0 {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+
+	LockOrder(req.TradeNo)
+	defer UnlockOrder(req.TradeNo)
+
+	refund, err := model.RefundTopUp(model.TopUpRefundParams{
+		TradeNo:    req.TradeNo,
+		Type:       model.TopUpRefundTypeRefund,
+		Source:     model.TopUpRefundSourceAdmin,
+		Money:      req.Money,
+		Reason:     req.Reason,
+		OperatorId: c.GetInt("id"),
+		CallerIp:   c.ClientIP(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrTopUpNotFound):
+			common.ApiErrorMsg(c, "充值订单不存在")
+		case errors.Is(err, model.ErrTopUpStatusInvalid):
+			common.ApiErrorMsg(c, "订单未到账或处于争议中，无法退款")
+		case errors.Is(err, model.ErrTopUpRefundProcessed):
+			common.ApiErrorMsg(c, "订单已全部退款")
+		default:
+			common.ApiError(c, err)
+		}
+		return
+	}
+	common.ApiSuccess(c, refund)
+}
+
+// GetTopUpRefunds 返回订单的退款与争议记录
+func GetTopUpRefunds(c *gin.Context) {
+	tradeNo := c.Query("trade_no")
+	if tradeNo == "" {
+		common.ApiErrorMsg(c, "未提供订单号")
+		return
+	}
+	refunds, err := model.GetTopUpRefunds(tradeNo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, refunds)
+}
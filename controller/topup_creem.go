@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"github.com/thanhpk/randstr"
 )
 
@@ -259,6 +260,18 @@ func CreemWebhook(c *gin.Context) {
 
 	logger.LogInfo(c.Request.Context(), fmt.Sprintf("Creem webhook 验签成功 path=%q client_ip=%s", c.Request.RequestURI, c.ClientIP()))
 
+	// 退款与争议事件的 object 结构与支付事件不同，单独解析
+	var envelope struct {
+		EventType string `json:"eventType"`
+	}
+	if err := json.Unmarshal(bodyBytes, &envelope); err == nil {
+		switch envelope.EventType {
+		case "refund.created", "dispute.created":
+			handleCreemRefundEvent(c, bodyBytes)
+			return
+		}
+	}
+
 	// 重新设置body供后续的ShouldBindJSON使用
 	c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
 
@@ -347,7 +360,7 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 		logger.LogWarn(c.Request.Context(), fmt.Sprintf("Creem 回调客户姓名为空 trade_no=%s creem_order_id=%s", referenceId, event.Object.Order.Id))
 	}
 
-	err := model.RechargeCreem(referenceId, customerEmail, customerName, c.ClientIP())
+	err := model.RechargeCreem(referenceId, customerEmail, customerName, event.Object.Order.Id, c.ClientIP())
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Creem 充值处理失败 trade_no=%s creem_order_id=%s client_ip=%s error=%q", referenceId, event.Object.Order.Id, c.ClientIP(), err.Error()))
 		c.AbortWithStatus(http.StatusInternalServerError)
@@ -358,6 +371,117 @@ func handleCheckoutCompleted(c *gin.Context, event *CreemWebhookEvent) {
 	c.Status(http.StatusOK)
 }
 
+// CreemRefundWebhookEvent refund.created 与 dispute.created 事件，只解析处理所需的字段
+type CreemRefundWebhookEvent struct {
+	Id        string `json:"id"`
+	EventType string `json:"eventType"`
+	Object    struct {
+		Id           string         `json:"id"`
+		Status       string         `json:"status"`
+		RefundAmount int            `json:"refund_amount"`
+		Reason       string         `json:"reason"`
+		Order        creemObjectRef `json:"order"`
+		Checkout     creemObjectRef `json:"checkout"`
+	} `json:"object"`
+}
+
+// creemObjectRef 兼容展开的对象与只包含 ID 的字符串
+type creemObjectRef struct {
+	Id         string `json:"id"`
+	Amount     int    `json:"amount"`
+	AmountPaid int    `json:"amount_paid"`
+	RequestId  string `json:"request_id"`
+}
+
+func (r *creemObjectRef) UnmarshalJSON(data []byte) error {
+	var id string
+	if err := json.Unmarshal(data, &id); err == nil {
+		r.Id = id
+		return nil
+	}
+	type plain creemObjectRef
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// 处理退款与争议事件，按退款金额占支付金额的比例扣回额度，争议扣回全部额度
+func handleCreemRefundEvent(c *gin.Context, body []byte) {
+	ctx := c.Request.Context()
+	var event CreemRefundWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Creem 退款事件解析失败 client_ip=%s error=%q body=%q", c.ClientIP(), err.Error(), string(body)))
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+
+	var topUp *model.TopUp
+	if event.Object.Checkout.RequestId != "" {
+		topUp = model.GetTopUpByTradeNo(event.Object.Checkout.RequestId)
+	}
+	if topUp == nil {
+		topUp = model.GetTopUpByPaymentId(model.PaymentProviderCreem, event.Object.Order.Id)
+	}
+	if topUp == nil || topUp.PaymentProvider != model.PaymentProviderCreem {
+		logger.LogInfo(ctx, fmt.Sprintf("Creem 退款或争议未找到对应充值订单，忽略处理 event_type=%s event_id=%s request_id=%s order_id=%s", event.EventType, event.Id, event.Object.Checkout.RequestId, event.Object.Order.Id))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	externalId := event.Object.Id
+	if externalId == "" {
+		externalId = event.Id
+	}
+	params := model.TopUpRefundParams{
+		TradeNo:         topUp.TradeNo,
+		PaymentProvider: model.PaymentProviderCreem,
+		Source:          model.PaymentProviderCreem,
+		ExternalId:      externalId,
+		Reason:          event.Object.Reason,
+		CallerIp:        c.ClientIP(),
+	}
+	if event.EventType == "dispute.created" {
+		params.Type = model.TopUpRefundTypeDispute
+	} else {
+		if event.Object.Status != "" && event.Object.Status != "succeeded" {
+			logger.LogInfo(ctx, fmt.Sprintf("Creem 退款未成功，忽略处理 trade_no=%s refund_id=%s status=%s", topUp.TradeNo, event.Object.Id, event.Object.Status))
+			c.Status(http.StatusOK)
+			return
+		}
+		paid := event.Object.Order.AmountPaid
+		if paid <= 0 {
+			paid = event.Object.Order.Amount
+		}
+		if event.Object.RefundAmount <= 0 || paid <= 0 {
+			logger.LogWarn(ctx, fmt.Sprintf("Creem 退款金额异常，忽略处理 trade_no=%s refund_id=%s refund_amount=%d amount_paid=%d", topUp.TradeNo, event.Object.Id, event.Object.RefundAmount, paid))
+			c.Status(http.StatusOK)
+			return
+		}
+		params.Type = model.TopUpRefundTypeRefund
+		params.Money = decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromInt(int64(event.Object.RefundAmount))).Div(decimal.NewFromInt(int64(paid))).InexactFloat64()
+	}
+
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+	refund, err := model.RefundTopUp(params)
+	if errors.Is(err, model.ErrTopUpRefundProcessed) {
+		logger.LogInfo(ctx, fmt.Sprintf("Creem 退款或争议已处理，忽略 trade_no=%s event_type=%s external_id=%s", topUp.TradeNo, event.EventType, externalId))
+		c.Status(http.StatusOK)
+		return
+	}
+	if errors.Is(err, model.ErrTopUpStatusInvalid) {
+		// 订单未到账或处于争议中，重试也无法处理
+		logger.LogWarn(ctx, fmt.Sprintf("Creem 退款或争议时订单状态不支持，忽略处理 trade_no=%s status=%s event_type=%s external_id=%s", topUp.TradeNo, topUp.Status, event.EventType, externalId))
+		c.Status(http.StatusOK)
+		return
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Creem 退款或争议处理失败 trade_no=%s event_type=%s external_id=%s error=%q", topUp.TradeNo, event.EventType, externalId, err.Error()))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("Creem 退款或争议处理成功 trade_no=%s event_type=%s refund_type=%s money=%.2f quota=%d", topUp.TradeNo, event.EventType, refund.Type, refund.Money, refund.Quota))
+	c.Status(http.StatusOK)
+}
+
 type CreemCheckoutRequest struct {
 	ProductId string `json:"product_id"`
 	RequestId string `json:"request_id"`
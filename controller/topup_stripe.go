@@ -18,6 +18,7 @@ import (
 	"github.com/QuantumNous/new-api/setting/system_setting"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
 	"github.com/stripe/stripe-go/v81/webhook"
@@ -183,6 +184,12 @@ func StripeWebhook(c *gin.Context) {
 		sessionAsyncPaymentSucceeded(ctx, event, callerIp)
 	case stripe.EventTypeCheckoutSessionAsyncPaymentFailed:
 		sessionAsyncPaymentFailed(ctx, event, callerIp)
+	case stripe.EventTypeChargeRefunded:
+		chargeRefunded(ctx, event, callerIp)
+	case stripe.EventTypeChargeDisputeCreated:
+		chargeDisputeCreated(ctx, event, callerIp)
+	case stripe.EventTypeChargeDisputeClosed:
+		chargeDisputeClosed(ctx, event, callerIp)
 	default:
 		logger.LogInfo(ctx, fmt.Sprintf("Stripe webhook 忽略事件 event_type=%s client_ip=%s", string(event.Type), callerIp))
 	}
@@ -279,7 +286,7 @@ func fulfillOrder(ctx context.Context, event stripe.Event, referenceId string, c
 		return
 	}
 
-	err := model.Recharge(referenceId, customerId, callerIp)
+	err := model.Recharge(referenceId, customerId, event.GetObjectValue("payment_intent"), callerIp)
 	if err != nil {
 		logger.LogError(ctx, fmt.Sprintf("Stripe 充值处理失败 trade_no=%s event_type=%s client_ip=%s error=%q", referenceId, string(event.Type), callerIp, err.Error()))
 		return
@@ -327,6 +334,104 @@ func sessionExpired(ctx context.Context, event stripe.Event) {
 	logger.LogInfo(ctx, fmt.Sprintf("Stripe 充值订单已过期 trade_no=%s", referenceId))
 }
 
+// chargeRefunded claws back quota in proportion to the charge's cumulative refunded amount.
+func chargeRefunded(ctx context.Context, event stripe.Event, callerIp string) {
+	topUp := findStripeTopUp(ctx, event, callerIp)
+	if topUp == nil {
+		return
+	}
+	amount, _ := strconv.ParseFloat(event.GetObjectValue("amount"), 64)
+	amountRefunded, _ := strconv.ParseFloat(event.GetObjectValue("amount_refunded"), 64)
+	if amount <= 0 || amountRefunded <= 0 {
+		logger.LogWarn(ctx, fmt.Sprintf("Stripe 退款金额异常，忽略处理 trade_no=%s amount=%.0f amount_refunded=%.0f client_ip=%s", topUp.TradeNo, amount, amountRefunded, callerIp))
+		return
+	}
+	totalMoney := decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromFloat(amountRefunded)).Div(decimal.NewFromFloat(amount)).InexactFloat64()
+	refundStripeTopUp(ctx, event, topUp, model.TopUpRefundParams{
+		Type:       model.TopUpRefundTypeRefund,
+		TotalMoney: totalMoney,
+	}, callerIp)
+}
+
+// chargeDisputeCreated claws back the whole order while the dispute is open.
+func chargeDisputeCreated(ctx context.Context, event stripe.Event, callerIp string) {
+	topUp := findStripeTopUp(ctx, event, callerIp)
+	if topUp == nil {
+		return
+	}
+	refundStripeTopUp(ctx, event, topUp, model.TopUpRefundParams{
+		Type:   model.TopUpRefundTypeDispute,
+		Reason: event.GetObjectValue("reason"),
+	}, callerIp)
+}
+
+// chargeDisputeClosed returns the held quota when the dispute is won, or keeps it clawed back when lost.
+func chargeDisputeClosed(ctx context.Context, event stripe.Event, callerIp string) {
+	topUp := findStripeTopUp(ctx, event, callerIp)
+	if topUp == nil {
+		return
+	}
+	status := event.GetObjectValue("status")
+	refundType := model.TopUpRefundTypeDisputeWon
+	if status == "lost" {
+		refundType = model.TopUpRefundTypeDisputeLost
+	}
+	refundStripeTopUp(ctx, event, topUp, model.TopUpRefundParams{
+		Type:   refundType,
+		Reason: status,
+	}, callerIp)
+}
+
+// stripeTradeNoMetadataKey is the PaymentIntent metadata key carrying the local trade number.
+const stripeTradeNoMetadataKey = "trade_no"
+
+// findStripeTopUp locates the top-up order by the PaymentIntent of a charge or dispute event,
+// falling back to the trade number in metadata or client_reference_id when the PaymentIntent was not recorded.
+func findStripeTopUp(ctx context.Context, event stripe.Event, callerIp string) *model.TopUp {
+	paymentIntent := event.GetObjectValue("payment_intent")
+	topUp := model.GetTopUpByPaymentId(model.PaymentProviderStripe, paymentIntent)
+	if topUp == nil {
+		metadataTradeNo := ""
+		if metadata, ok := event.Data.Object["metadata"].(map[string]interface{}); ok {
+			metadataTradeNo, _ = metadata[stripeTradeNoMetadataKey].(string)
+		}
+		for _, tradeNo := range []string{metadataTradeNo, event.GetObjectValue("client_reference_id")} {
+			if tradeNo == "" {
+				continue
+			}
+			if candidate := model.GetTopUpByTradeNo(tradeNo); candidate != nil && candidate.PaymentProvider == model.PaymentProviderStripe {
+				topUp = candidate
+				break
+			}
+		}
+	}
+	if topUp == nil {
+		logger.LogInfo(ctx, fmt.Sprintf("Stripe 退款或争议未找到对应充值订单，忽略处理 event_type=%s payment_intent=%s client_ip=%s", string(event.Type), paymentIntent, callerIp))
+	}
+	return topUp
+}
+
+func refundStripeTopUp(ctx context.Context, event stripe.Event, topUp *model.TopUp, params model.TopUpRefundParams, callerIp string) {
+	LockOrder(topUp.TradeNo)
+	defer UnlockOrder(topUp.TradeNo)
+
+	params.TradeNo = topUp.TradeNo
+	params.PaymentProvider = model.PaymentProviderStripe
+	params.Source = model.PaymentProviderStripe
+	params.ExternalId = event.ID
+	params.CallerIp = callerIp
+	refund, err := model.RefundTopUp(params)
+	if errors.Is(err, model.ErrTopUpRefundProcessed) {
+		logger.LogInfo(ctx, fmt.Sprintf("Stripe 退款或争议已处理，忽略 trade_no=%s event_type=%s event_id=%s client_ip=%s", topUp.TradeNo, string(event.Type), event.ID, callerIp))
+		return
+	}
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("Stripe 退款或争议处理失败 trade_no=%s event_type=%s event_id=%s client_ip=%s error=%q", topUp.TradeNo, string(event.Type), event.ID, callerIp, err.Error()))
+		return
+	}
+	logger.LogInfo(ctx, fmt.Sprintf("Stripe 退款或争议处理成功 trade_no=%s event_type=%s refund_type=%s money=%.2f quota=%d client_ip=%s", topUp.TradeNo, string(event.Type), refund.Type, refund.Money, refund.Quota, callerIp))
+}
+
 // genStripeLink generates a Stripe Checkout session URL for payment.
 // It creates a new checkout session with the specified parameters and returns the payment URL.
 //
@@ -366,6 +471,10 @@ func genStripeLink(referenceId string, customerId string, email string, amount i
 		},
 		Mode:                stripe.String(string(stripe.CheckoutSessionModePayment)),
 		AllowPromotionCodes: stripe.Bool(setting.StripePromotionCodesEnabled),
+		// charges and disputes carry the PaymentIntent metadata, so refunds can be matched without a recorded PaymentId
+		PaymentIntentData: &stripe.CheckoutSessionPaymentIntentDataParams{
+			Metadata: map[string]string{stripeTradeNoMetadataKey: referenceId},
+		},
 	}
 
 	if "" == customerId {
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go/v81"
+)
+
+func TestFindStripeTopUpFallsBackToTradeNo(t *testing.T) {
+	db := openTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.TopUp{}))
+	for _, topUp := range []*model.TopUp{
+		{UserId: 1, TradeNo: "ref_recorded", PaymentProvider: model.PaymentProviderStripe, PaymentId: "pi_recorded", Status: common.TopUpStatusSuccess},
+		{UserId: 1, TradeNo: "ref_metadata", PaymentProvider: model.PaymentProviderStripe, Status: common.TopUpStatusSuccess},
+		{UserId: 1, TradeNo: "ref_creem", PaymentProvider: model.PaymentProviderCreem, Status: common.TopUpStatusSuccess},
+	} {
+		require.NoError(t, topUp.Insert())
+	}
+	event := func(object map[string]interface{}) stripe.Event {
+		return stripe.Event{Type: stripe.EventTypeChargeRefunded, Data: &stripe.EventData{Object: object}}
+	}
+
+	topUp := findStripeTopUp(context.Background(), event(map[string]interface{}{"payment_intent": "pi_recorded"}), "")
+	require.NotNil(t, topUp)
+	require.Equal(t, "ref_recorded", topUp.TradeNo)
+
+	topUp = findStripeTopUp(context.Background(), event(map[string]interface{}{
+		"payment_intent": "pi_unknown",
+		"metadata":       map[string]interface{}{stripeTradeNoMetadataKey: "ref_metadata"},
+	}), "")
+	require.NotNil(t, topUp)
+	require.Equal(t, "ref_metadata", topUp.TradeNo)
+
+	topUp = findStripeTopUp(context.Background(), event(map[string]interface{}{"client_reference_id": "ref_metadata"}), "")
+	require.NotNil(t, topUp)
+	require.Equal(t, "ref_metadata", topUp.TradeNo)
+
+	// 其他支付网关的订单不会被 Stripe 回调匹配
+	require.Nil(t, findStripeTopUp(context.Background(), event(map[string]interface{}{"client_reference_id": "ref_creem"}), ""))
+}
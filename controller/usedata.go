@@ -14,7 +14,8 @@ func GetAllQuotaDates(c *gin.Context) {
 	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
 	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
 	username := c.Query("username")
-	dates, err := model.GetAllQuotaDates(startTimestamp, endTimestamp, username)
+	organizationId, _ := strconv.Atoi(c.Query("organization_id"))
+	dates, err := model.GetAllQuotaDates(startTimestamp, endTimestamp, username, organizationId)
 	if err != nil {
 		common.ApiError(c, err)
 		return
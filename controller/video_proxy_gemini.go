@@ -207,7 +207,7 @@ func isTaskProxyContentURL(url string, taskID string) bool {
 
 func getVertexTaskKey(channel *model.Channel, task *model.Task) string {
 	if task != nil {
-		if key := strings.TrimSpace(task.PrivateData.Key); key != "" {
+		if key := strings.TrimSpace(task.PrivateData.GetKey()); key != "" {
 			return key
 		}
 	}
@@ -221,7 +221,7 @@ func getVertexTaskKey(channel *model.Channel, task *model.Task) string {
 			return key
 		}
 	}
-	return strings.TrimSpace(channel.Key)
+	return ""
 }
 
 func extractVertexVideoURLFromTaskData(task *model.Task) string {
@@ -19,6 +19,7 @@ import (
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/oauth"
+	"github.com/QuantumNous/new-api/pkg/circuitbreaker"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
 	"github.com/QuantumNous/new-api/relay"
 	"github.com/QuantumNous/new-api/router"
@@ -99,6 +100,11 @@ func main() {
 
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
+	// 其他节点修改配置、渠道、令牌或用户后立即失效本地缓存，定时同步作为兜底
+	model.StartCacheInvalidationSubscriber()
+
+	// 管理员上传的分词器
+	service.StartTokenizerSyncTask(common.SyncFrequency)
 
 	// 数据看板
 	go model.UpdateQuotaData()
@@ -116,6 +122,9 @@ func main() {
 	// Codex credential auto-refresh check every 10 minutes, refresh when expires within 1 day
 	service.StartCodexCredentialAutoRefreshTask()
 
+	// Encrypt plaintext secrets and migrate secrets encrypted with a retired master key
+	service.StartSecretReencryptTask()
+
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
@@ -131,6 +140,12 @@ func main() {
 	// Channel upstream model update check task
 	controller.StartChannelUpstreamModelUpdateTask()
 
+	// Batch API background worker
+	controller.StartBatchWorker()
+
+	// Responses store retention cleanup
+	service.StartResponsesStoreCleanupTask()
+
 	if common.IsMasterNode && constant.UpdateTask {
 		gopool.Go(func() {
 			controller.UpdateMidjourneyTaskBulk()
@@ -314,6 +329,7 @@ func InitResources() error {
 	}
 
 	perfmetrics.Init()
+	circuitbreaker.Init()
 
 	// 启动系统监控
 	common.StartSystemMonitor()
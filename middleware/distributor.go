@@ -36,6 +36,9 @@ func Distribute() func(c *gin.Context) {
 			abortWithOpenAiMessage(c, http.StatusBadRequest, i18n.T(c, i18n.MsgDistributorInvalidRequest, map[string]any{"Error": err.Error()}))
 			return
 		}
+		if shouldCountTokenRequest(c, shouldSelectChannel) && !checkTokenRequestLimits(c) {
+			return
+		}
 		if ok {
 			id, err := strconv.Atoi(channelId.(string))
 			if err != nil {
@@ -99,6 +102,9 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 
+				// 虚拟模型从回退链中第一个有可用渠道的模型开始
+				modelRequest.Model, _ = service.StartModelFallback(c, modelRequest.Model, usingGroup)
+
 				if preferredChannelID, found := service.GetPreferredChannelByAffinity(c, modelRequest.Model, usingGroup); found {
 					preferred, err := model.CacheGetChannel(preferredChannelID)
 					if err == nil && preferred != nil {
@@ -158,6 +164,7 @@ func Distribute() func(c *gin.Context) {
 		common.SetContextKey(c, constant.ContextKeyRequestStartTime, time.Now())
 		SetupContextForSelectedChannel(c, channel, modelRequest.Model)
 		c.Next()
+		service.ReleaseCircuitBreaker(c)
 		if channel != nil && c.Writer != nil && c.Writer.Status() < http.StatusBadRequest {
 			service.RecordChannelAffinity(c, channel.Id)
 		}
@@ -342,7 +349,36 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	return &modelRequest, shouldSelectChannel, nil
 }
 
+// SetupContextForSelectedChannel 中转请求选定渠道后写入上下文，并占用熔断器的半开探测名额
 func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) *types.NewAPIError {
+	if newAPIError := setupChannelContext(c, channel, modelName); newAPIError != nil {
+		return newAPIError
+	}
+	acquireChannelCircuitBreaker(c, channel)
+	return nil
+}
+
+// SetupContextForChannelTest 渠道测试写入上下文，不经过熔断器
+func SetupContextForChannelTest(c *gin.Context, channel *model.Channel, modelName string) *types.NewAPIError {
+	return setupChannelContext(c, channel, modelName)
+}
+
+// acquireChannelCircuitBreaker 多密钥渠道选中的密钥探测名额已被其他请求占用时换一个密钥；
+// 仍未取得时照常转发，结果不计入熔断器
+func acquireChannelCircuitBreaker(c *gin.Context, channel *model.Channel) {
+	if service.AcquireCircuitBreaker(c, channel.Id) || !channel.ChannelInfo.IsMultiKey {
+		return
+	}
+	key, index, err := channel.GetNextEnabledKey()
+	if err != nil || index == common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex) {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyChannelMultiKeyIndex, index)
+	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
+	service.AcquireCircuitBreaker(c, channel.Id)
+}
+
+func setupChannelContext(c *gin.Context, channel *model.Channel, modelName string) *types.NewAPIError {
 	c.Set("original_model", modelName) // for retry
 	if channel == nil {
 		return types.NewError(errors.New("channel is nil"), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
@@ -367,7 +403,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	key, index, newAPIError := selectChannelKey(c, channel)
 	if newAPIError != nil {
 		return newAPIError
 	}
@@ -433,3 +469,13 @@ func extractModelNameFromGeminiPath(path string) string {
 	// 返回模型名部分
 	return path[startIndex : startIndex+colonIndex]
 }
+
+// selectChannelKey 渠道亲和记录了该渠道上次使用的密钥时优先沿用，让上游的提示缓存继续命中
+func selectChannelKey(c *gin.Context, channel *model.Channel) (string, int, *types.NewAPIError) {
+	if idx, ok := service.GetPreferredKeyIndexByAffinity(c, channel.Id); ok {
+		if key, ok := channel.GetEnabledKeyAt(idx); ok {
+			return key, idx, nil
+		}
+	}
+	return channel.GetNextEnabledKey()
+}
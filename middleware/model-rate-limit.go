@@ -171,6 +171,11 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 			c.Next()
 			return
 		}
+		// token 计数请求不计入模型请求次数，由 CountTokensRateLimit 单独限流
+		if IsCountTokensRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
 
 		// 计算限流参数
 		duration := int64(setting.ModelRequestRateLimitDurationMinutes * 60)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -203,3 +204,23 @@ func SearchRateLimit() func(c *gin.Context) {
 	}
 	return userRateLimitFactory(common.SearchRateLimitNum, common.SearchRateLimitDuration, "SR")
 }
+
+// IsCountTokensRequest 判断是否为 token 计数请求（Claude /v1/messages/count_tokens 与 Gemini :countTokens）
+func IsCountTokensRequest(path string) bool {
+	return path == "/v1/messages/count_tokens" || strings.HasSuffix(path, ":countTokens")
+}
+
+// CountTokensRateLimit returns a per-user rate limiter that only applies to token counting requests.
+// Configurable via COUNT_TOKENS_RATE_LIMIT_ENABLE / COUNT_TOKENS_RATE_LIMIT / COUNT_TOKENS_RATE_LIMIT_DURATION.
+func CountTokensRateLimit() func(c *gin.Context) {
+	if !common.CountTokensRateLimitEnable {
+		return defNext
+	}
+	limit := userRateLimitFactory(common.CountTokensRateLimitNum, common.CountTokensRateLimitDuration, "CTK")
+	return func(c *gin.Context) {
+		if !IsCountTokensRequest(c.Request.URL.Path) {
+			return
+		}
+		limit(c)
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldCountTokenRequest 令牌的每分钟请求数与周期预算只对转发到上游的请求生效，token 计数与任务查询不计入
+func shouldCountTokenRequest(c *gin.Context, shouldSelectChannel bool) bool {
+	if IsCountTokensRequest(c.Request.URL.Path) {
+		return false
+	}
+	return shouldSelectChannel || c.GetInt("relay_mode") == relayconstant.RelayModeVideoSubmit
+}
+
+// checkTokenRequestLimits 超出令牌的每分钟请求数或周期预算时中止请求
+func checkTokenRequestLimits(c *gin.Context) bool {
+	tokenId := c.GetInt("token_id")
+	if tokenId == 0 {
+		return true
+	}
+	token := &model.Token{
+		Id:           tokenId,
+		RpmLimit:     common.GetContextKeyInt(c, constant.ContextKeyTokenRpmLimit),
+		BudgetPeriod: common.GetContextKeyString(c, constant.ContextKeyTokenBudgetPeriod),
+		BudgetQuota:  common.GetContextKeyInt(c, constant.ContextKeyTokenBudgetQuota),
+	}
+	if err := service.CheckTokenRequestLimits(token); err != nil {
+		status := http.StatusTooManyRequests
+		if errors.Is(err, service.ErrTokenBudgetExhausted) {
+			status = http.StatusForbidden
+		}
+		abortWithOpenAiMessage(c, status, err.Error())
+		return false
+	}
+	return true
+}
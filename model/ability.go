@@ -119,6 +119,7 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	abilities = filterCircuitAvailableAbilities(abilities)
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
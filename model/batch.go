@@ -0,0 +1,152 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch 通过 /v1/batches 提交的离线批处理任务
+type Batch struct {
+	Id               int    `json:"id"`
+	BatchId          string `json:"batch_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(16);index"`
+	// ClientIp 提交时的客户端 IP，执行时沿用以通过令牌 IP 限制
+	ClientIp       string `json:"-" gorm:"type:varchar(64)"`
+	TotalCount     int    `json:"total_count"`
+	CompletedCount int    `json:"completed_count"`
+	FailedCount    int    `json:"failed_count"`
+	Metadata       string `json:"metadata" gorm:"type:text"`
+	Errors         string `json:"errors" gorm:"type:text"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt   int64  `json:"in_progress_at" gorm:"bigint"`
+	FinalizingAt   int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt    int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt       int64  `json:"failed_at" gorm:"bigint"`
+	ExpiresAt      int64  `json:"expires_at" gorm:"bigint"`
+	ExpiredAt      int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt   int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt    int64  `json:"cancelled_at" gorm:"bigint"`
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+// Update 全量保存批次状态
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+// UpdateProgress 仅更新计数，避免覆盖并发写入的取消状态
+func (batch *Batch) UpdateProgress() error {
+	return DB.Model(&Batch{}).Where("id = ?", batch.Id).Updates(map[string]interface{}{
+		"completed_count": batch.CompletedCount,
+		"failed_count":    batch.FailedCount,
+	}).Error
+}
+
+// UpdateWithStatus CAS 更新：仅当数据库中的状态仍为 fromStatus 时才写入，返回是否更新成功
+func (batch *Batch) UpdateWithStatus(fromStatus string) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", batch.Id, fromStatus).Select("*").Updates(batch)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func GetBatchById(id int) (*Batch, error) {
+	var batch Batch
+	if err := DB.First(&batch, id).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetUserBatchByBatchId(userId int, batchId string) (*Batch, error) {
+	if batchId == "" {
+		return nil, errors.New("batch id is empty")
+	}
+	var batch Batch
+	err := DB.Where("user_id = ? AND batch_id = ?", userId, batchId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// GetUserBatches 按创建时间倒序分页，after 为上一页最后一个批次 ID
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, bool, error) {
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var cursor Batch
+		if err := DB.Where("user_id = ? AND batch_id = ?", userId, after).First(&cursor).Error; err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	var batches []*Batch
+	err := query.Order("id desc").Limit(limit + 1).Find(&batches).Error
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	return batches, hasMore, nil
+}
+
+// GetPendingBatches 返回等待执行的批次，按提交顺序
+func GetPendingBatches(limit int) []*Batch {
+	var batches []*Batch
+	DB.Where("status = ?", BatchStatusValidating).Order("id asc").Limit(limit).Find(&batches)
+	return batches
+}
+
+// GetBatchStatus 读取最新状态，用于执行过程中检测取消
+func GetBatchStatus(id int) (string, error) {
+	var status string
+	err := DB.Model(&Batch{}).Where("id = ?", id).Select("status").Scan(&status).Error
+	return status, err
+}
+
+// FailInterruptedBatches 将因进程退出而中断的批次标记为失败。
+// 已执行的请求已经计费，重新执行会导致重复扣费，因此不自动重跑。
+func FailInterruptedBatches(reason string) error {
+	now := common.GetTimestamp()
+	err := DB.Model(&Batch{}).Where("status = ?", BatchStatusCancelling).
+		Updates(map[string]interface{}{
+			"status":       BatchStatusCancelled,
+			"cancelled_at": now,
+		}).Error
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Batch{}).Where("status IN ?", []string{BatchStatusInProgress, BatchStatusFinalizing}).
+		Updates(map[string]interface{}{
+			"status":    BatchStatusFailed,
+			"failed_at": now,
+			"errors":    reason,
+		}).Error
+}
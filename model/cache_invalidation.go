@@ -0,0 +1,220 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const (
+	cacheInvalidationChannel = "new-api:cache_invalidation"
+	configRevisionNodesKey   = "new-api:config_revision:nodes"
+)
+
+// 失效事件类型
+const (
+	CacheInvalidationOption  = "option"
+	CacheInvalidationChannel = "channel"
+	CacheInvalidationToken   = "token"
+	CacheInvalidationUser    = "user"
+	CacheInvalidationPricing = "pricing"
+)
+
+// CacheInvalidationEvent 通过 Redis 发布订阅广播给其他节点的缓存失效事件
+type CacheInvalidationEvent struct {
+	Kind string `json:"kind"`
+	// Key 配置项名、渠道 ID、令牌的 HMAC 或用户 ID，为空时重新加载全部
+	Key      string `json:"key,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+	Node     string `json:"node"`
+}
+
+// NodeConfigRevision 节点已应用的配置修订号
+type NodeConfigRevision struct {
+	Node      string `json:"node"`
+	Revision  int64  `json:"revision"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+var (
+	cacheInvalidationNodeId = common.GetUUID()
+	appliedOptionRevision   atomic.Int64
+)
+
+func cacheInvalidationEnabled() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+// configRevisionNodeName 优先使用 NODE_NAME，未配置时使用主机名与进程号
+func configRevisionNodeName() string {
+	if common.NodeName != "" {
+		return common.NodeName
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// PublishCacheInvalidation 广播缓存失效事件，未启用 Redis 时各节点只依赖定时同步
+func PublishCacheInvalidation(kind string, key string, revision int) {
+	if !cacheInvalidationEnabled() {
+		return
+	}
+	data, err := common.Marshal(CacheInvalidationEvent{
+		Kind:     kind,
+		Key:      key,
+		Revision: revision,
+		Node:     cacheInvalidationNodeId,
+	})
+	if err != nil {
+		return
+	}
+	gopool.Go(func() {
+		if err := common.RDB.Publish(context.Background(), cacheInvalidationChannel, data).Err(); err != nil {
+			common.SysError("failed to publish cache invalidation: " + err.Error())
+		}
+	})
+}
+
+// StartCacheInvalidationSubscriber 订阅其他节点的缓存失效事件，断线期间丢失的事件由定时同步兜底
+func StartCacheInvalidationSubscriber() {
+	if !cacheInvalidationEnabled() {
+		return
+	}
+	reportAppliedOptionRevision()
+	gopool.Go(func() {
+		pubsub := common.RDB.Subscribe(context.Background(), cacheInvalidationChannel)
+		defer pubsub.Close()
+		common.SysLog("cache invalidation subscriber started")
+		for msg := range pubsub.Channel() {
+			var event CacheInvalidationEvent
+			if err := common.UnmarshalJsonStr(msg.Payload, &event); err != nil {
+				common.SysError("failed to decode cache invalidation: " + err.Error())
+				continue
+			}
+			if event.Node == cacheInvalidationNodeId {
+				continue
+			}
+			handleCacheInvalidation(event)
+		}
+	})
+}
+
+func handleCacheInvalidation(event CacheInvalidationEvent) {
+	switch event.Kind {
+	case CacheInvalidationOption:
+		if event.Key == "" {
+			loadOptionsFromDatabase()
+		} else {
+			reloadOptionFromDatabase(event.Key)
+		}
+		markOptionRevisionApplied(int64(event.Revision))
+	case CacheInvalidationChannel:
+		if common.MemoryCacheEnabled {
+			loadChannelCache()
+		}
+	case CacheInvalidationPricing:
+		InvalidatePricingCache()
+	case CacheInvalidationToken:
+		// 令牌与用户缓存保存在共享的 Redis 中，再次删除是为了清掉其他节点在数据库提交前读到并回写的旧值
+		if event.Key != "" {
+			_ = common.RedisDelKey(fmt.Sprintf("token:%s", event.Key))
+		}
+	case CacheInvalidationUser:
+		if userId, err := strconv.Atoi(event.Key); err == nil {
+			_ = common.RedisDelKey(getUserCacheKey(userId))
+		}
+	}
+}
+
+func reloadOptionFromDatabase(key string) {
+	var option Option
+	if err := DB.Where(&Option{Key: key}).First(&option).Error; err != nil {
+		common.SysError("failed to reload option " + key + ": " + err.Error())
+		return
+	}
+	value, err := common.DecryptSecret(option.Value)
+	if err != nil {
+		common.SysError("failed to decrypt option " + key + ": " + err.Error())
+		return
+	}
+	if err := updateOptionMap(option.Key, value); err != nil {
+		common.SysError("failed to update option map: " + err.Error())
+	}
+}
+
+// markOptionRevisionApplied 记录本节点已应用的最大配置修订号并上报
+func markOptionRevisionApplied(revision int64) {
+	for {
+		current := appliedOptionRevision.Load()
+		if revision <= current {
+			break
+		}
+		if appliedOptionRevision.CompareAndSwap(current, revision) {
+			break
+		}
+	}
+	reportAppliedOptionRevision()
+}
+
+// GetAppliedOptionRevision 本节点已应用的配置修订号
+func GetAppliedOptionRevision() int64 {
+	return appliedOptionRevision.Load()
+}
+
+func reportAppliedOptionRevision() {
+	if !cacheInvalidationEnabled() {
+		return
+	}
+	data, err := common.Marshal(NodeConfigRevision{
+		Node:      configRevisionNodeName(),
+		Revision:  appliedOptionRevision.Load(),
+		UpdatedAt: common.GetTimestamp(),
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := common.RDB.HSet(ctx, configRevisionNodesKey, configRevisionNodeName(), data).Err(); err != nil {
+		common.SysError("failed to report config revision: " + err.Error())
+	}
+}
+
+// GetNodeConfigRevisions 返回各节点上报的配置修订号，未启用 Redis 时只有本节点
+func GetNodeConfigRevisions() ([]NodeConfigRevision, error) {
+	if !cacheInvalidationEnabled() {
+		return []NodeConfigRevision{{
+			Node:      configRevisionNodeName(),
+			Revision:  appliedOptionRevision.Load(),
+			UpdatedAt: common.GetTimestamp(),
+		}}, nil
+	}
+	values, err := common.RDB.HGetAll(context.Background(), configRevisionNodesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]NodeConfigRevision, 0, len(values))
+	for _, value := range values {
+		var node NodeConfigRevision
+		if err := common.UnmarshalJsonStr(value, &node); err == nil {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Node < nodes[j].Node })
+	return nodes, nil
+}
+
+// GetLatestOptionRevisionId 数据库中最新的配置修订号
+func GetLatestOptionRevisionId() (int64, error) {
+	var latest OptionRevision
+	err := DB.Order("id desc").Limit(1).Find(&latest).Error
+	return int64(latest.Id), err
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCacheInvalidation_ReloadsOption(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	require.NoError(t, DB.Create(&Option{Key: "Notice", Value: "from another node"}).Error)
+
+	handleCacheInvalidation(CacheInvalidationEvent{Kind: CacheInvalidationOption, Key: "Notice", Revision: 1000})
+
+	common.OptionMapRWMutex.RLock()
+	require.Equal(t, "from another node", common.OptionMap["Notice"])
+	common.OptionMapRWMutex.RUnlock()
+	require.GreaterOrEqual(t, GetAppliedOptionRevision(), int64(1000))
+
+	// 修订号只增不减，乱序到达的旧事件不会回退
+	markOptionRevisionApplied(10)
+	require.GreaterOrEqual(t, GetAppliedOptionRevision(), int64(1000))
+}
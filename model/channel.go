@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -56,6 +57,8 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+	// KeyCount 缓存中多密钥渠道的密钥数量，用于熔断判断而无需保存明文密钥
+	KeyCount int `json:"-" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -139,6 +142,33 @@ func (c *ChannelInfo) Scan(value interface{}) error {
 	return common.Unmarshal(bytesValue, c)
 }
 
+// BeforeSave 密钥以信封加密的形式写入数据库
+func (channel *Channel) BeforeSave(tx *gorm.DB) error {
+	key, err := common.EncryptSecret(channel.Key)
+	if err != nil {
+		return err
+	}
+	// 缓存中的渠道可能被并发读取，密钥未变化时不写回
+	if key != channel.Key {
+		channel.Key = key
+	}
+	return nil
+}
+
+// GetPlainKey 返回解密后的密钥，仅在实际使用密钥时调用，不要保存结果
+func (channel *Channel) GetPlainKey() (string, error) {
+	return common.DecryptSecret(channel.Key)
+}
+
+// UpdateChannelKey 只更新渠道密钥，如 Codex 刷新凭证后写回
+func UpdateChannelKey(channelId int, key string) error {
+	encrypted, err := common.EncryptSecret(key)
+	if err != nil {
+		return err
+	}
+	return DB.Model(&Channel{}).Where("id = ?", channelId).Update("key", encrypted).Error
+}
+
 func (channel *Channel) GetKeys() []string {
 	if channel.Key == "" {
 		return []string{}
@@ -146,7 +176,28 @@ func (channel *Channel) GetKeys() []string {
 	if len(channel.Keys) > 0 {
 		return channel.Keys
 	}
-	trimmed := strings.TrimSpace(channel.Key)
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to decrypt channel key: channel_id=%d, error=%v", channel.Id, err))
+		return []string{}
+	}
+	return splitChannelKeys(plainKey)
+}
+
+// GetFirstKey 返回解密后的第一个密钥，用于拉取模型列表等管理操作
+func (channel *Channel) GetFirstKey() string {
+	keys := channel.GetKeys()
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+func splitChannelKeys(plainKey string) []string {
+	if plainKey == "" {
+		return []string{}
+	}
+	trimmed := strings.TrimSpace(plainKey)
 	// If the key starts with '[', try to parse it as a JSON array (e.g., for Vertex AI scenarios)
 	if strings.HasPrefix(trimmed, "[") {
 		var arr []json.RawMessage
@@ -159,18 +210,22 @@ func (channel *Channel) GetKeys() []string {
 		}
 	}
 	// Otherwise, fall back to splitting by newline
-	keys := strings.Split(strings.Trim(channel.Key, "\n"), "\n")
+	keys := strings.Split(strings.Trim(plainKey, "\n"), "\n")
 	return keys
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
+	plainKey, err := channel.GetPlainKey()
+	if err != nil {
+		return "", 0, types.NewError(err, types.ErrorCodeChannelInvalidKey)
+	}
 	if !channel.ChannelInfo.IsMultiKey {
-		return channel.Key, 0, nil
+		return plainKey, 0, nil
 	}
 
 	// Obtain all keys (split by \n)
-	keys := channel.GetKeys()
+	keys := splitChannelKeys(plainKey)
 	if len(keys) == 0 {
 		// No keys available, return error, should disable the channel
 		return "", 0, types.NewError(errors.New("no keys available"), types.ErrorCodeChannelNoAvailableKey)
@@ -206,11 +261,18 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	// 跳过熔断中的密钥；全部熔断时忽略熔断状态，避免渠道整体不可用
+	enabledIdx = filterKeyCircuitAvailable(channel.Id, enabledIdx)
+	selectable := make(map[int]bool, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		selectable[idx] = true
+	}
+
+	var selectedIdx int
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
+		selectedIdx = enabledIdx[rand.Intn(len(enabledIdx))]
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
@@ -234,20 +296,55 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		if start < 0 || start >= len(keys) {
 			start = 0
 		}
+		// Fallback – should not happen, but use first enabled key
+		selectedIdx = enabledIdx[0]
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if selectable[idx] {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
-				return keys[idx], idx, nil
+				selectedIdx = idx
+				break
 			}
 		}
-		// Fallback – should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		selectedIdx = enabledIdx[0]
 	}
+	return keys[selectedIdx], selectedIdx, nil
+}
+
+// GetEnabledKeyAt 多密钥渠道中指定下标的密钥已启用且未熔断时返回该密钥，用于渠道亲和沿用上次的密钥
+func (channel *Channel) GetEnabledKeyAt(idx int) (string, bool) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return "", false
+	}
+	keys := channel.GetKeys()
+	if idx < 0 || idx >= len(keys) {
+		return "", false
+	}
+	lock := GetChannelPollingLock(channel.Id)
+	lock.Lock()
+	defer lock.Unlock()
+	if status, ok := channel.ChannelInfo.MultiKeyStatusList[idx]; ok && status != common.ChannelStatusEnabled {
+		return "", false
+	}
+	if !keyCircuitAvailable(channel.Id, idx) {
+		return "", false
+	}
+	return keys[idx], true
+}
+
+// GetKeyAt 返回指定下标的密钥，不检查密钥状态与熔断，用于清理该密钥此前创建的上游资源
+func (channel *Channel) GetKeyAt(idx int) (string, error) {
+	if !channel.ChannelInfo.IsMultiKey {
+		return channel.GetPlainKey()
+	}
+	keys := channel.GetKeys()
+	if idx < 0 || idx >= len(keys) {
+		return "", fmt.Errorf("channel #%d has no key at index %d", channel.Id, idx)
+	}
+	return keys[idx], nil
 }
 
 func (channel *Channel) SaveChannelInfo() error {
@@ -512,11 +609,11 @@ func (channel *Channel) Update() error {
 	if channel.ChannelInfo.IsMultiKey {
 		var keyStr string
 		if channel.Key != "" {
-			keyStr = channel.Key
+			keyStr, _ = channel.GetPlainKey()
 		} else {
 			// If key is not provided, read the existing key from the database
 			if existing, err := GetChannelById(channel.Id, true); err == nil {
-				keyStr = existing.Key
+				keyStr, _ = existing.GetPlainKey()
 			}
 		}
 		// Parse the key list (supports newline separation or JSON array)
@@ -728,6 +825,7 @@ func UpdateChannelStatus(channelId int, usingKey string, status int, reason stri
 			return false
 		}
 	}
+	PublishCacheInvalidation(CacheInvalidationChannel, strconv.Itoa(channelId), 0)
 	return true
 }
 
@@ -1016,6 +1114,13 @@ func CountAllChannels() (int64, error) {
 	return total, err
 }
 
+// GetChannelStatusSnapshot returns id/type/status/channel_info of all channels for metrics
+func GetChannelStatusSnapshot() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Select("id", "type", "status", "channel_info").Find(&channels).Error
+	return channels, err
+}
+
 // CountAllTags returns number of non-empty distinct tags
 func CountAllTags() (int64, error) {
 	var total int64
@@ -0,0 +1,97 @@
+package model
+
+import "github.com/QuantumNous/new-api/pkg/circuitbreaker"
+
+// filterCircuitAvailableChannels 过滤掉熔断中的渠道；全部熔断时返回原列表，避免整体不可用
+func filterCircuitAvailableChannels(channelIds []int) []int {
+	if !circuitbreaker.Enabled() {
+		return channelIds
+	}
+	available := make([]int, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		channel, ok := channelsIDM[channelId]
+		if !ok || channelCircuitAvailable(channel) {
+			available = append(available, channelId)
+		}
+	}
+	if len(available) == 0 {
+		return channelIds
+	}
+	return available
+}
+
+// filterCircuitAvailableAbilities 未启用内存缓存时按数据库中的渠道信息过滤熔断中的渠道，全部熔断时返回原列表
+func filterCircuitAvailableAbilities(abilities []Ability) []Ability {
+	if !circuitbreaker.Enabled() || len(abilities) == 0 {
+		return abilities
+	}
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+	var channels []*Channel
+	if err := DB.Select("id", "channel_info").Where("id IN ?", channelIds).Find(&channels).Error; err != nil {
+		return abilities
+	}
+	unavailable := make(map[int]bool)
+	for _, channel := range channels {
+		if !channelCircuitAvailable(channel) {
+			unavailable[channel.Id] = true
+		}
+	}
+	available := make([]Ability, 0, len(abilities))
+	for _, ability := range abilities {
+		if !unavailable[ability.ChannelId] {
+			available = append(available, ability)
+		}
+	}
+	if len(available) == 0 {
+		return abilities
+	}
+	return available
+}
+
+// channelCircuitAvailable 单密钥渠道看渠道级熔断器，多密钥渠道只要有一个密钥可用即可
+func channelCircuitAvailable(channel *Channel) bool {
+	if !channel.ChannelInfo.IsMultiKey {
+		return circuitbreaker.Available(circuitbreaker.ChannelKey(channel.Id))
+	}
+	keyCount := channelKeyCount(channel)
+	for idx := 0; idx < keyCount; idx++ {
+		if circuitbreaker.Available(circuitbreaker.KeyIndexKey(channel.Id, idx)) {
+			return true
+		}
+	}
+	return keyCount == 0
+}
+
+// channelKeyCount 优先使用缓存记录的密钥数量，未经缓存加载的渠道使用渠道信息中的数量
+func channelKeyCount(channel *Channel) int {
+	if channel.KeyCount > 0 {
+		return channel.KeyCount
+	}
+	if len(channel.Keys) > 0 {
+		return len(channel.Keys)
+	}
+	return channel.ChannelInfo.MultiKeySize
+}
+
+func filterKeyCircuitAvailable(channelId int, enabledIdx []int) []int {
+	if !circuitbreaker.Enabled() {
+		return enabledIdx
+	}
+	available := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if circuitbreaker.Available(circuitbreaker.KeyIndexKey(channelId, idx)) {
+			available = append(available, idx)
+		}
+	}
+	if len(available) == 0 {
+		return enabledIdx
+	}
+	return available
+}
+
+func keyCircuitAvailable(channelId int, keyIndex int) bool {
+	return !circuitbreaker.Enabled() || circuitbreaker.Available(circuitbreaker.KeyIndexKey(channelId, keyIndex))
+}
@@ -0,0 +1,71 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/pkg/circuitbreaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func enableCircuitBreakerForTest(t *testing.T) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+	})
+	setting.Enabled = true
+	setting.FailureThreshold = 1
+	setting.WindowSeconds = 60
+	setting.CooldownSeconds = 30
+}
+
+func TestChannelCircuitAvailable_MultiKeyFromCache(t *testing.T) {
+	truncateTables(t)
+	enableCircuitBreakerForTest(t)
+	channel := &Channel{
+		Id:          901,
+		Name:        "multi-key",
+		Key:         "sk-a\nsk-b",
+		Status:      1,
+		Group:       "default",
+		Models:      "gpt-4o",
+		ChannelInfo: ChannelInfo{IsMultiKey: true},
+	}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.AddAbilities(nil))
+	t.Cleanup(func() {
+		circuitbreaker.Reset(circuitbreaker.KeyIndexKey(channel.Id, 0))
+		circuitbreaker.Reset(circuitbreaker.KeyIndexKey(channel.Id, 1))
+	})
+
+	loadChannelCache()
+	cached := channelsIDM[channel.Id]
+	require.NotNil(t, cached)
+	require.Empty(t, cached.Keys)
+	require.Equal(t, 2, cached.KeyCount)
+	require.True(t, channelCircuitAvailable(cached))
+
+	// 只要还有一个密钥未熔断，渠道仍可用
+	circuitbreaker.RecordFailure(circuitbreaker.KeyIndexKey(channel.Id, 0), "boom")
+	require.True(t, channelCircuitAvailable(cached))
+	circuitbreaker.RecordFailure(circuitbreaker.KeyIndexKey(channel.Id, 1), "boom")
+	require.False(t, channelCircuitAvailable(cached))
+
+	// 全部熔断时不过滤，避免整体不可用
+	require.Equal(t, []int{channel.Id}, filterCircuitAvailableChannels([]int{channel.Id}))
+}
+
+func TestChannelCircuitAvailable_UsesMultiKeySizeOutsideCache(t *testing.T) {
+	enableCircuitBreakerForTest(t)
+	channel := &Channel{Id: 902, ChannelInfo: ChannelInfo{IsMultiKey: true, MultiKeySize: 2}}
+	t.Cleanup(func() {
+		circuitbreaker.Reset(circuitbreaker.KeyIndexKey(channel.Id, 0))
+		circuitbreaker.Reset(circuitbreaker.KeyIndexKey(channel.Id, 1))
+	})
+
+	circuitbreaker.RecordFailure(circuitbreaker.KeyIndexKey(channel.Id, 0), "boom")
+	require.True(t, channelCircuitAvailable(channel))
+	circuitbreaker.RecordFailure(circuitbreaker.KeyIndexKey(channel.Id, 1), "boom")
+	require.False(t, channelCircuitAvailable(channel))
+}
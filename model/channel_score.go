@@ -0,0 +1,255 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+const channelLatencyWindow = 64
+
+// channelPerfStats 单个渠道的实时表现，仅保存在本节点内存中
+type channelPerfStats struct {
+	mu          sync.Mutex
+	samples     int64
+	successEwma float64
+	// responseEwma 首字延迟：流式请求取 TTFT，非流式取总耗时
+	responseEwma float64
+	latencyEwma  float64
+	ttftEwma     float64
+	recent       [channelLatencyWindow]float64
+	recentIdx    int
+	recentCount  int
+	p95          float64
+	lastUpdate   int64
+}
+
+// ChannelPerfSnapshot 渠道实时表现快照
+type ChannelPerfSnapshot struct {
+	Samples      int64   `json:"samples"`
+	SuccessRate  float64 `json:"success_rate"`
+	ResponseMs   float64 `json:"response_ms"`
+	LatencyMs    float64 `json:"latency_ms"`
+	TtftMs       float64 `json:"ttft_ms"`
+	P95Ms        float64 `json:"p95_ms"`
+	LastUpdateAt int64   `json:"last_update_at"`
+}
+
+// ChannelSelectionWeight 渠道在某个分组/模型下的选择权重
+type ChannelSelectionWeight struct {
+	ChannelId       int                  `json:"channel_id"`
+	Name            string               `json:"name"`
+	Priority        int64                `json:"priority"`
+	Weight          int                  `json:"weight"`
+	BaseWeight      float64              `json:"base_weight"`
+	EffectiveWeight float64              `json:"effective_weight"`
+	Probability     float64              `json:"probability"`
+	Stats           *ChannelPerfSnapshot `json:"stats,omitempty"`
+}
+
+var channelPerfStatsM sync.Map // channel id -> *channelPerfStats
+
+func ewma(current float64, sample float64, alpha float64, first bool) float64 {
+	if first {
+		return sample
+	}
+	return alpha*sample + (1-alpha)*current
+}
+
+// ObserveChannelPerformance 记录一次渠道请求结果，失败样本只影响成功率
+func ObserveChannelPerformance(channelId int, success bool, latencyMs int64, ttftMs int64, hasTtft bool) {
+	if channelId <= 0 {
+		return
+	}
+	alpha := operation_setting.GetAdaptiveChannelSetting().EwmaAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	actual, _ := channelPerfStatsM.LoadOrStore(channelId, &channelPerfStats{})
+	stats := actual.(*channelPerfStats)
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	first := stats.samples == 0
+	successValue := 0.0
+	if success {
+		successValue = 1
+	}
+	stats.successEwma = ewma(stats.successEwma, successValue, alpha, first)
+	stats.samples++
+	stats.lastUpdate = time.Now().Unix()
+	if !success || latencyMs <= 0 {
+		return
+	}
+
+	responseMs := float64(latencyMs)
+	if hasTtft && ttftMs > 0 {
+		responseMs = float64(ttftMs)
+		stats.ttftEwma = ewma(stats.ttftEwma, float64(ttftMs), alpha, stats.ttftEwma == 0)
+	}
+	stats.latencyEwma = ewma(stats.latencyEwma, float64(latencyMs), alpha, stats.latencyEwma == 0)
+	stats.responseEwma = ewma(stats.responseEwma, responseMs, alpha, stats.responseEwma == 0)
+
+	stats.recent[stats.recentIdx] = responseMs
+	stats.recentIdx = (stats.recentIdx + 1) % channelLatencyWindow
+	if stats.recentCount < channelLatencyWindow {
+		stats.recentCount++
+	}
+	window := make([]float64, stats.recentCount)
+	copy(window, stats.recent[:stats.recentCount])
+	sort.Float64s(window)
+	stats.p95 = window[int(math.Ceil(float64(len(window))*0.95))-1]
+}
+
+func GetChannelPerfSnapshot(channelId int) (ChannelPerfSnapshot, bool) {
+	actual, ok := channelPerfStatsM.Load(channelId)
+	if !ok {
+		return ChannelPerfSnapshot{}, false
+	}
+	stats := actual.(*channelPerfStats)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return ChannelPerfSnapshot{
+		Samples:      stats.samples,
+		SuccessRate:  stats.successEwma,
+		ResponseMs:   stats.responseEwma,
+		LatencyMs:    stats.latencyEwma,
+		TtftMs:       stats.ttftEwma,
+		P95Ms:        stats.p95,
+		LastUpdateAt: stats.lastUpdate,
+	}, true
+}
+
+// adaptiveWeightFactors 计算同一优先级内各渠道的权重系数：
+// 成功率按指数惩罚，延迟按与最快渠道的比值惩罚；样本不足或过期的渠道系数为 1
+func adaptiveWeightFactors(channels []*Channel) []float64 {
+	setting := operation_setting.GetAdaptiveChannelSetting()
+	now := time.Now().Unix()
+	factors := make([]float64, len(channels))
+	latencyScores := make([]float64, len(channels))
+	bestLatency := 0.0
+	for i, channel := range channels {
+		factors[i] = 1
+		snapshot, ok := GetChannelPerfSnapshot(channel.Id)
+		if !ok || snapshot.Samples < int64(setting.MinSamples) {
+			continue
+		}
+		if setting.StaleSeconds > 0 && now-snapshot.LastUpdateAt > int64(setting.StaleSeconds) {
+			continue
+		}
+		factors[i] = math.Pow(snapshot.SuccessRate, setting.SuccessExponent)
+		if snapshot.ResponseMs > 0 {
+			score := (1-setting.P95Weight)*snapshot.ResponseMs + setting.P95Weight*snapshot.P95Ms
+			latencyScores[i] = score
+			if bestLatency == 0 || score < bestLatency {
+				bestLatency = score
+			}
+		}
+	}
+	for i := range factors {
+		if latencyScores[i] > 0 && bestLatency > 0 {
+			factors[i] *= math.Pow(bestLatency/latencyScores[i], setting.LatencyExponent)
+		}
+		if factors[i] < setting.MinWeightRatio {
+			factors[i] = setting.MinWeightRatio
+		}
+	}
+	return factors
+}
+
+// channelSelectionWeights 返回同一优先级内各渠道的静态权重与用于随机选择的有效权重
+func channelSelectionWeights(group string, channels []*Channel) (base []float64, effective []float64) {
+	sumWeight := 0
+	for _, channel := range channels {
+		sumWeight += channel.GetWeight()
+	}
+
+	// smoothing factor and adjustment
+	smoothingFactor := 1
+	smoothingAdjustment := 0
+	if sumWeight == 0 {
+		// when all channels have weight 0, each channel's effective weight = 100
+		smoothingAdjustment = 100
+	} else if sumWeight/len(channels) < 10 {
+		// when the average weight is less than 10, set smoothing factor to 100
+		smoothingFactor = 100
+	}
+
+	base = make([]float64, len(channels))
+	effective = make([]float64, len(channels))
+	for i, channel := range channels {
+		base[i] = float64(channel.GetWeight()*smoothingFactor + smoothingAdjustment)
+		effective[i] = base[i]
+	}
+	if operation_setting.IsAdaptiveChannelGroup(group) {
+		total := 0.0
+		for i, factor := range adaptiveWeightFactors(channels) {
+			effective[i] *= factor
+			total += effective[i]
+		}
+		// 有效权重全部归零时无法随机选择，回退到静态权重
+		if total <= 0 {
+			copy(effective, base)
+		}
+	}
+	return base, effective
+}
+
+// GetChannelSelectionWeights 返回分组/模型下全部优先级的渠道权重，用于管理端查看
+func GetChannelSelectionWeights(group string, model string) []ChannelSelectionWeight {
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+
+	channelIds := group2model2channels[group][model]
+	if len(channelIds) == 0 {
+		channelIds = group2model2channels[group][ratio_setting.FormatMatchingModelName(model)]
+	}
+	tiers := make(map[int64][]*Channel)
+	var priorities []int64
+	for _, channelId := range channelIds {
+		channel, ok := channelsIDM[channelId]
+		if !ok {
+			continue
+		}
+		priority := channel.GetPriority()
+		if _, exists := tiers[priority]; !exists {
+			priorities = append(priorities, priority)
+		}
+		tiers[priority] = append(tiers[priority], channel)
+	}
+	sort.Slice(priorities, func(i, j int) bool {
+		return priorities[i] > priorities[j]
+	})
+
+	result := make([]ChannelSelectionWeight, 0, len(channelIds))
+	for _, priority := range priorities {
+		channels := tiers[priority]
+		base, weights := channelSelectionWeights(group, channels)
+		total := 0.0
+		for _, weight := range weights {
+			total += weight
+		}
+		for i, channel := range channels {
+			item := ChannelSelectionWeight{
+				ChannelId:       channel.Id,
+				Name:            channel.Name,
+				Priority:        priority,
+				Weight:          channel.GetWeight(),
+				BaseWeight:      base[i],
+				EffectiveWeight: weights[i],
+			}
+			if total > 0 {
+				item.Probability = weights[i] / total
+			}
+			if snapshot, ok := GetChannelPerfSnapshot(channel.Id); ok {
+				item.Stats = &snapshot
+			}
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelSelectionWeightsAdaptive(t *testing.T) {
+	setting := operation_setting.GetAdaptiveChannelSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+	})
+	setting.Enabled = true
+	setting.Groups = []string{"adaptive"}
+	setting.MinSamples = 5
+
+	weight := uint(10)
+	fast := &Channel{Id: 900001, Weight: &weight}
+	slow := &Channel{Id: 900002, Weight: &weight}
+	flaky := &Channel{Id: 900003, Weight: &weight}
+	fresh := &Channel{Id: 900004, Weight: &weight}
+	for i := 0; i < 20; i++ {
+		ObserveChannelPerformance(fast.Id, true, 1000, 200, true)
+		ObserveChannelPerformance(slow.Id, true, 4000, 800, true)
+		ObserveChannelPerformance(flaky.Id, i%2 == 0, 1000, 200, true)
+	}
+	channels := []*Channel{fast, slow, flaky, fresh}
+
+	base, effective := channelSelectionWeights("default", channels)
+	require.Equal(t, base, effective)
+
+	base, effective = channelSelectionWeights("adaptive", channels)
+	require.Equal(t, []float64{10, 10, 10, 10}, base)
+	require.InDelta(t, 10, effective[0], 1e-9)
+	require.Less(t, effective[1], effective[0])
+	require.Less(t, effective[2], effective[0])
+	require.InDelta(t, 10, effective[3], 1e-9)
+	for _, w := range effective {
+		require.GreaterOrEqual(t, w, 10*setting.MinWeightRatio)
+	}
+}
+
+func TestChannelSelectionWeightsFallbackWhenAdaptiveWeightsZero(t *testing.T) {
+	setting := operation_setting.GetAdaptiveChannelSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+	})
+	setting.Enabled = true
+	setting.Groups = []string{"adaptive"}
+	setting.MinSamples = 5
+	// 绕过保存时的限制直接写入 0，模拟旧配置
+	setting.MinWeightRatio = 0
+
+	weight := uint(10)
+	first := &Channel{Id: 900011, Weight: &weight}
+	second := &Channel{Id: 900012, Weight: &weight}
+	for i := 0; i < 20; i++ {
+		ObserveChannelPerformance(first.Id, false, 1000, 200, true)
+		ObserveChannelPerformance(second.Id, false, 1000, 200, true)
+	}
+
+	base, effective := channelSelectionWeights("adaptive", []*Channel{first, second})
+	require.Equal(t, base, effective)
+}
@@ -0,0 +1,1161 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/billing_setting"
+	"github.com/QuantumNous/new-api/setting/config"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const ConfigBundleVersion = 1
+
+const (
+	ConfigBundleFormatYAML = "yaml"
+	ConfigBundleFormatJSON = "json"
+)
+
+const (
+	ConfigPlanActionCreate = "create"
+	ConfigPlanActionUpdate = "update"
+	ConfigPlanActionDelete = "delete"
+)
+
+const (
+	configPlanKindChannel      = "channel"
+	configPlanKindVendor       = "vendor"
+	configPlanKindModel        = "model"
+	configPlanKindPrefillGroup = "prefill_group"
+	configPlanKindOption       = "option"
+)
+
+const maskedSecretValue = "******"
+
+// ConfigBundle 声明式配置包，导出为 YAML/JSON 后可放入 git 管理，导入时先生成计划再应用。
+// 渠道的能力（abilities）由渠道的模型与分组生成；分组倍率、计费表达式等保存在 Options 与 Modules 中
+type ConfigBundle struct {
+	Version       int                  `json:"version"`
+	Channels      []BundleChannel      `json:"channels,omitempty"`
+	Vendors       []BundleVendor       `json:"vendors,omitempty"`
+	Models        []BundleModel        `json:"models,omitempty"`
+	PrefillGroups []BundlePrefillGroup `json:"prefill_groups,omitempty"`
+	// Options 非分层配置项，JSON 格式的值展开为对象以便审阅
+	Options map[string]any `json:"options,omitempty"`
+	// Modules config.GlobalConfig 注册的配置模块，模块名 -> 字段 -> 值
+	Modules map[string]map[string]any `json:"modules,omitempty"`
+}
+
+// BundleChannel 以名称标识渠道，密钥只保存引用（env:NAME 或 file:/path），导入时解析
+type BundleChannel struct {
+	Name               string `json:"name"`
+	Type               int    `json:"type"`
+	KeyRef             string `json:"key_ref,omitempty"`
+	MultiKeyMode       string `json:"multi_key_mode,omitempty"`
+	Status             int    `json:"status"`
+	Models             string `json:"models"`
+	Group              string `json:"group"`
+	Tag                string `json:"tag,omitempty"`
+	Priority           int64  `json:"priority"`
+	Weight             uint   `json:"weight"`
+	AutoBan            int    `json:"auto_ban"`
+	BaseURL            string `json:"base_url,omitempty"`
+	TestModel          string `json:"test_model,omitempty"`
+	OpenAIOrganization string `json:"openai_organization,omitempty"`
+	Other              string `json:"other,omitempty"`
+	ModelMapping       string `json:"model_mapping,omitempty"`
+	StatusCodeMapping  string `json:"status_code_mapping,omitempty"`
+	Setting            string `json:"setting,omitempty"`
+	Settings           string `json:"settings,omitempty"`
+	ParamOverride      string `json:"param_override,omitempty"`
+	HeaderOverride     string `json:"header_override,omitempty"`
+	Remark             string `json:"remark,omitempty"`
+}
+
+type BundleVendor struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Icon        string `json:"icon,omitempty"`
+	Status      int    `json:"status"`
+}
+
+// BundleModel 模型元数据，供应商以名称引用
+type BundleModel struct {
+	ModelName        string `json:"model_name"`
+	Vendor           string `json:"vendor,omitempty"`
+	Description      string `json:"description,omitempty"`
+	Icon             string `json:"icon,omitempty"`
+	Tags             string `json:"tags,omitempty"`
+	Endpoints        string `json:"endpoints,omitempty"`
+	Status           int    `json:"status"`
+	SyncOfficial     int    `json:"sync_official"`
+	NameRule         int    `json:"name_rule"`
+	ContextLength    int    `json:"context_length,omitempty"`
+	MaxOutputTokens  int    `json:"max_output_tokens,omitempty"`
+	LongContextModel string `json:"long_context_model,omitempty"`
+}
+
+type BundlePrefillGroup struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Items       any    `json:"items"`
+	Description string `json:"description,omitempty"`
+}
+
+// ConfigPlanItem 应用配置包时对一个对象执行的操作
+type ConfigPlanItem struct {
+	Kind    string              `json:"kind"`
+	Name    string              `json:"name"`
+	Action  string              `json:"action"`
+	Changes []OptionFieldChange `json:"changes,omitempty"`
+
+	apply func(tx *gorm.DB) error
+}
+
+// ConfigPlan 配置包与当前配置的差异；Items 为空表示已与配置包一致
+type ConfigPlan struct {
+	Items    []*ConfigPlanItem `json:"items"`
+	Warnings []string          `json:"warnings,omitempty"`
+	Summary  map[string]int    `json:"summary"`
+
+	options map[string]string
+}
+
+// ConfigApplyOptions Prune 为 true 时删除配置包中没有的渠道、供应商、模型与预填组，配置项不会被删除
+type ConfigApplyOptions struct {
+	Prune bool
+	Audit OptionAudit
+}
+
+// ParseConfigBundle 解析 YAML 或 JSON 格式的配置包，以 { 开头时按 JSON 解析
+func ParseConfigBundle(data []byte) (*ConfigBundle, error) {
+	var bundle ConfigBundle
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		if err := common.UnmarshalJsonStr(trimmed, &bundle); err != nil {
+			return nil, fmt.Errorf("invalid config bundle json: %w", err)
+		}
+	} else {
+		var raw any
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("invalid config bundle yaml: %w", err)
+		}
+		jsonData, err := common.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config bundle yaml: %w", err)
+		}
+		if err := common.Unmarshal(jsonData, &bundle); err != nil {
+			return nil, fmt.Errorf("invalid config bundle yaml: %w", err)
+		}
+	}
+	if bundle.Version != ConfigBundleVersion {
+		return nil, fmt.Errorf("unsupported config bundle version: %d", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// MarshalConfigBundle 按 format 编码配置包，YAML 的字段名与 JSON 一致
+func MarshalConfigBundle(bundle *ConfigBundle, format string) ([]byte, error) {
+	jsonData, err := common.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if format == ConfigBundleFormatJSON {
+		return jsonData, nil
+	}
+	var raw any
+	if err := common.Unmarshal(jsonData, &raw); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(raw)
+}
+
+// ExportConfigBundle 导出当前配置，密钥类字段导出为环境变量引用
+func ExportConfigBundle() (*ConfigBundle, error) {
+	bundle := &ConfigBundle{
+		Version: ConfigBundleVersion,
+		Options: make(map[string]any),
+		Modules: make(map[string]map[string]any),
+	}
+
+	var channels []*Channel
+	if err := DB.Order("id asc").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		entry := bundleChannelFromChannel(channel)
+		entry.KeyRef = secretEnvRef("CHANNEL_" + channel.Name + "_KEY")
+		bundle.Channels = append(bundle.Channels, entry)
+	}
+
+	var vendors []*Vendor
+	if err := DB.Order("id asc").Find(&vendors).Error; err != nil {
+		return nil, err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+		bundle.Vendors = append(bundle.Vendors, bundleVendorFromVendor(vendor))
+	}
+
+	var models []*Model
+	if err := DB.Order("id asc").Find(&models).Error; err != nil {
+		return nil, err
+	}
+	for _, m := range models {
+		bundle.Models = append(bundle.Models, bundleModelFromModel(m, vendorNames[m.VendorID]))
+	}
+
+	var groups []*PrefillGroup
+	if err := DB.Order("id asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		bundle.PrefillGroups = append(bundle.PrefillGroups, bundlePrefillGroupFromGroup(group))
+	}
+
+	common.OptionMapRWMutex.RLock()
+	defer common.OptionMapRWMutex.RUnlock()
+	for key, value := range common.OptionMap {
+		exported := exportOptionValue(key, value)
+		if module, field, ok := splitModuleOptionKey(key); ok {
+			if bundle.Modules[module] == nil {
+				bundle.Modules[module] = make(map[string]any)
+			}
+			bundle.Modules[module][field] = exported
+			continue
+		}
+		bundle.Options[key] = exported
+	}
+	return bundle, nil
+}
+
+// PlanConfigBundle 生成应用配置包需要执行的操作，不修改数据
+func PlanConfigBundle(bundle *ConfigBundle, opts ConfigApplyOptions) (*ConfigPlan, error) {
+	return planConfigBundle(DB, bundle, opts)
+}
+
+// ApplyConfigBundle 在同一事务中执行计划；配置包与当前配置一致时不做任何修改，可重复应用
+func ApplyConfigBundle(bundle *ConfigBundle, opts ConfigApplyOptions) (*ConfigPlan, error) {
+	var plan *ConfigPlan
+	revisionId := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		plan, err = planConfigBundle(tx, bundle, opts)
+		if err != nil {
+			return err
+		}
+		for _, item := range plan.Items {
+			if err := item.apply(tx); err != nil {
+				return fmt.Errorf("%s %s %s: %w", item.Action, item.Kind, item.Name, err)
+			}
+		}
+		audit := opts.Audit
+		audit.Source = OptionRevisionSourceImport
+		for _, key := range sortedKeys(plan.options) {
+			_, id, err := saveOptionWithRevision(tx, key, plan.options[key], audit, 0)
+			if err != nil {
+				return fmt.Errorf("update option %s: %w", key, err)
+			}
+			revisionId = max(revisionId, id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range sortedKeys(plan.options) {
+		if err := updateOptionMap(key, plan.options[key]); err != nil {
+			common.SysError("failed to apply imported option " + key + ": " + err.Error())
+		}
+	}
+	if revisionId > 0 {
+		markOptionRevisionApplied(int64(revisionId))
+		PublishCacheInvalidation(CacheInvalidationOption, "", revisionId)
+	}
+	if len(plan.Items) == 0 {
+		return plan, nil
+	}
+	for _, item := range plan.Items {
+		if item.Kind == configPlanKindChannel {
+			InitChannelCache()
+			break
+		}
+	}
+	RefreshPricing()
+	return plan, nil
+}
+
+func planConfigBundle(tx *gorm.DB, bundle *ConfigBundle, opts ConfigApplyOptions) (*ConfigPlan, error) {
+	plan := &ConfigPlan{
+		Items:   make([]*ConfigPlanItem, 0),
+		Summary: make(map[string]int),
+		options: make(map[string]string),
+	}
+	// 供应商先于模型创建，模型按名称引用供应商
+	if err := planVendors(tx, plan, bundle.Vendors, opts.Prune); err != nil {
+		return nil, err
+	}
+	if err := planModels(tx, plan, bundle.Models, opts.Prune); err != nil {
+		return nil, err
+	}
+	if err := planPrefillGroups(tx, plan, bundle.PrefillGroups, opts.Prune); err != nil {
+		return nil, err
+	}
+	if err := planChannels(tx, plan, bundle.Channels, opts.Prune); err != nil {
+		return nil, err
+	}
+	if err := planOptions(plan, bundle); err != nil {
+		return nil, err
+	}
+	for _, item := range plan.Items {
+		plan.Summary[item.Action]++
+	}
+	return plan, nil
+}
+
+func (p *ConfigPlan) add(item *ConfigPlanItem) {
+	p.Items = append(p.Items, item)
+}
+
+func planChannels(tx *gorm.DB, plan *ConfigPlan, desired []BundleChannel, prune bool) error {
+	var existing []*Channel
+	if err := tx.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*Channel, len(existing))
+	duplicated := make(map[string]bool)
+	for _, channel := range existing {
+		if _, ok := byName[channel.Name]; ok {
+			duplicated[channel.Name] = true
+		}
+		byName[channel.Name] = channel
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		entry := entry
+		if entry.Name == "" {
+			return errors.New("channel name is required")
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate channel in bundle: %s", entry.Name)
+		}
+		seen[entry.Name] = true
+		if duplicated[entry.Name] {
+			return fmt.Errorf("channel name %s is used by more than one existing channel", entry.Name)
+		}
+		key, resolved, err := resolveSecretRef(entry.KeyRef)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", entry.Name, err)
+		}
+		current, ok := byName[entry.Name]
+		if !ok {
+			if !resolved || key == "" {
+				return fmt.Errorf("channel %s: key_ref must resolve to a key for new channels", entry.Name)
+			}
+			plan.add(&ConfigPlanItem{
+				Kind:    configPlanKindChannel,
+				Name:    entry.Name,
+				Action:  ConfigPlanActionCreate,
+				Changes: append(diffBundleEntries(BundleChannel{}, entry), maskedKeyChange()),
+				apply: func(tx *gorm.DB) error {
+					channel := &Channel{CreatedTime: common.GetTimestamp()}
+					applyBundleChannel(channel, entry, key)
+					if err := tx.Create(channel).Error; err != nil {
+						return err
+					}
+					// Create 会用 default 标签覆盖零值，写回配置包中的取值
+					if err := tx.Model(&Channel{}).Where("id = ?", channel.Id).Updates(map[string]any{
+						"status": entry.Status,
+						"group":  entry.Group,
+					}).Error; err != nil {
+						return err
+					}
+					return channel.AddAbilities(tx)
+				},
+			})
+			continue
+		}
+		currentKey, err := current.GetPlainKey()
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", entry.Name, err)
+		}
+		changes := diffBundleEntries(bundleChannelFromChannel(current), entry)
+		keyChanged := resolved && key != currentKey
+		if keyChanged {
+			changes = append(changes, maskedKeyChange())
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		if !resolved {
+			key = currentKey
+		}
+		channelId := current.Id
+		plan.add(&ConfigPlanItem{
+			Kind:    configPlanKindChannel,
+			Name:    entry.Name,
+			Action:  ConfigPlanActionUpdate,
+			Changes: changes,
+			apply: func(tx *gorm.DB) error {
+				var channel Channel
+				if err := tx.First(&channel, "id = ?", channelId).Error; err != nil {
+					return err
+				}
+				applyBundleChannel(&channel, entry, key)
+				if err := tx.Save(&channel).Error; err != nil {
+					return err
+				}
+				return channel.UpdateAbilities(tx)
+			},
+		})
+	}
+	if !prune {
+		return nil
+	}
+	for _, channel := range existing {
+		if seen[channel.Name] {
+			continue
+		}
+		channelId := channel.Id
+		plan.add(&ConfigPlanItem{
+			Kind:   configPlanKindChannel,
+			Name:   channel.Name,
+			Action: ConfigPlanActionDelete,
+			apply: func(tx *gorm.DB) error {
+				if err := tx.Delete(&Channel{}, channelId).Error; err != nil {
+					return err
+				}
+				return tx.Where("channel_id = ?", channelId).Delete(&Ability{}).Error
+			},
+		})
+	}
+	return nil
+}
+
+func bundleChannelFromChannel(channel *Channel) BundleChannel {
+	entry := BundleChannel{
+		Name:               channel.Name,
+		Type:               channel.Type,
+		Status:             channel.Status,
+		Models:             channel.Models,
+		Group:              channel.Group,
+		Tag:                channel.GetTag(),
+		Priority:           channel.GetPriority(),
+		Weight:             uint(channel.GetWeight()),
+		BaseURL:            derefString(channel.BaseURL),
+		TestModel:          derefString(channel.TestModel),
+		OpenAIOrganization: derefString(channel.OpenAIOrganization),
+		Other:              channel.Other,
+		ModelMapping:       derefString(channel.ModelMapping),
+		StatusCodeMapping:  derefString(channel.StatusCodeMapping),
+		Setting:            derefString(channel.Setting),
+		Settings:           channel.OtherSettings,
+		ParamOverride:      derefString(channel.ParamOverride),
+		HeaderOverride:     derefString(channel.HeaderOverride),
+		Remark:             derefString(channel.Remark),
+	}
+	if channel.AutoBan != nil {
+		entry.AutoBan = *channel.AutoBan
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		entry.MultiKeyMode = string(channel.ChannelInfo.MultiKeyMode)
+	}
+	return entry
+}
+
+// applyBundleChannel 用配置包中的字段覆盖渠道，余额、用量、多密钥状态等运行时数据保持不变
+func applyBundleChannel(channel *Channel, entry BundleChannel, key string) {
+	currentKey, _ := channel.GetPlainKey()
+	keyChanged := currentKey != key
+	channel.Name = entry.Name
+	channel.Type = entry.Type
+	channel.Key = key
+	channel.Status = entry.Status
+	channel.Models = entry.Models
+	channel.Group = entry.Group
+	channel.Tag = optionalString(entry.Tag)
+	channel.Priority = common.GetPointer(entry.Priority)
+	channel.Weight = common.GetPointer(entry.Weight)
+	channel.AutoBan = common.GetPointer(entry.AutoBan)
+	channel.BaseURL = common.GetPointer(entry.BaseURL)
+	channel.TestModel = optionalString(entry.TestModel)
+	channel.OpenAIOrganization = optionalString(entry.OpenAIOrganization)
+	channel.Other = entry.Other
+	channel.ModelMapping = optionalString(entry.ModelMapping)
+	channel.StatusCodeMapping = common.GetPointer(entry.StatusCodeMapping)
+	channel.Setting = optionalString(entry.Setting)
+	channel.OtherSettings = entry.Settings
+	channel.ParamOverride = optionalString(entry.ParamOverride)
+	channel.HeaderOverride = optionalString(entry.HeaderOverride)
+	channel.Remark = optionalString(entry.Remark)
+	channel.ChannelInfo.IsMultiKey = entry.MultiKeyMode != ""
+	channel.ChannelInfo.MultiKeyMode = constant.MultiKeyMode(entry.MultiKeyMode)
+	if channel.ChannelInfo.IsMultiKey {
+		channel.ChannelInfo.MultiKeySize = len(channel.GetKeys())
+		if keyChanged {
+			// 密钥列表变化后原有的按下标记录的状态已失效
+			channel.ChannelInfo.MultiKeyStatusList = nil
+			channel.ChannelInfo.MultiKeyDisabledReason = nil
+			channel.ChannelInfo.MultiKeyDisabledTime = nil
+			channel.ChannelInfo.MultiKeyPollingIndex = 0
+		}
+	}
+}
+
+func maskedKeyChange() OptionFieldChange {
+	return OptionFieldChange{Path: "key", From: maskedSecretValue, To: maskedSecretValue}
+}
+
+func planVendors(tx *gorm.DB, plan *ConfigPlan, desired []BundleVendor, prune bool) error {
+	var existing []*Vendor
+	if err := tx.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*Vendor, len(existing))
+	for _, vendor := range existing {
+		byName[vendor.Name] = vendor
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		entry := entry
+		if entry.Name == "" {
+			return errors.New("vendor name is required")
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate vendor in bundle: %s", entry.Name)
+		}
+		seen[entry.Name] = true
+		current, ok := byName[entry.Name]
+		if !ok {
+			plan.add(&ConfigPlanItem{
+				Kind:    configPlanKindVendor,
+				Name:    entry.Name,
+				Action:  ConfigPlanActionCreate,
+				Changes: diffBundleEntries(BundleVendor{}, entry),
+				apply: func(tx *gorm.DB) error {
+					now := common.GetTimestamp()
+					vendor := &Vendor{
+						Name:        entry.Name,
+						Description: entry.Description,
+						Icon:        entry.Icon,
+						Status:      entry.Status,
+						CreatedTime: now,
+						UpdatedTime: now,
+					}
+					if err := tx.Create(vendor).Error; err != nil {
+						return err
+					}
+					return tx.Model(&Vendor{}).Where("id = ?", vendor.Id).Update("status", entry.Status).Error
+				},
+			})
+			continue
+		}
+		changes := diffBundleEntries(bundleVendorFromVendor(current), entry)
+		if len(changes) == 0 {
+			continue
+		}
+		vendorId := current.Id
+		plan.add(&ConfigPlanItem{
+			Kind:    configPlanKindVendor,
+			Name:    entry.Name,
+			Action:  ConfigPlanActionUpdate,
+			Changes: changes,
+			apply: func(tx *gorm.DB) error {
+				return tx.Model(&Vendor{}).Where("id = ?", vendorId).Updates(map[string]any{
+					"description":  entry.Description,
+					"icon":         entry.Icon,
+					"status":       entry.Status,
+					"updated_time": common.GetTimestamp(),
+				}).Error
+			},
+		})
+	}
+	if !prune {
+		return nil
+	}
+	for _, vendor := range existing {
+		if seen[vendor.Name] {
+			continue
+		}
+		vendorId := vendor.Id
+		plan.add(&ConfigPlanItem{
+			Kind:   configPlanKindVendor,
+			Name:   vendor.Name,
+			Action: ConfigPlanActionDelete,
+			apply: func(tx *gorm.DB) error {
+				return tx.Delete(&Vendor{}, vendorId).Error
+			},
+		})
+	}
+	return nil
+}
+
+func bundleVendorFromVendor(vendor *Vendor) BundleVendor {
+	return BundleVendor{
+		Name:        vendor.Name,
+		Description: vendor.Description,
+		Icon:        vendor.Icon,
+		Status:      vendor.Status,
+	}
+}
+
+func planModels(tx *gorm.DB, plan *ConfigPlan, desired []BundleModel, prune bool) error {
+	var existing []*Model
+	if err := tx.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	var vendors []*Vendor
+	if err := tx.Find(&vendors).Error; err != nil {
+		return err
+	}
+	vendorNames := make(map[int]string, len(vendors))
+	for _, vendor := range vendors {
+		vendorNames[vendor.Id] = vendor.Name
+	}
+	byName := make(map[string]*Model, len(existing))
+	for _, m := range existing {
+		byName[m.ModelName] = m
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		entry := entry
+		if entry.ModelName == "" {
+			return errors.New("model_name is required")
+		}
+		if seen[entry.ModelName] {
+			return fmt.Errorf("duplicate model in bundle: %s", entry.ModelName)
+		}
+		seen[entry.ModelName] = true
+		current, ok := byName[entry.ModelName]
+		if !ok {
+			plan.add(&ConfigPlanItem{
+				Kind:    configPlanKindModel,
+				Name:    entry.ModelName,
+				Action:  ConfigPlanActionCreate,
+				Changes: diffBundleEntries(BundleModel{}, entry),
+				apply: func(tx *gorm.DB) error {
+					m := &Model{ModelName: entry.ModelName, CreatedTime: common.GetTimestamp()}
+					if err := applyBundleModel(tx, m, entry); err != nil {
+						return err
+					}
+					if err := tx.Create(m).Error; err != nil {
+						return err
+					}
+					return tx.Model(&Model{}).Where("id = ?", m.Id).Updates(map[string]any{
+						"status":        entry.Status,
+						"sync_official": entry.SyncOfficial,
+					}).Error
+				},
+			})
+			continue
+		}
+		changes := diffBundleEntries(bundleModelFromModel(current, vendorNames[current.VendorID]), entry)
+		if len(changes) == 0 {
+			continue
+		}
+		modelId := current.Id
+		plan.add(&ConfigPlanItem{
+			Kind:    configPlanKindModel,
+			Name:    entry.ModelName,
+			Action:  ConfigPlanActionUpdate,
+			Changes: changes,
+			apply: func(tx *gorm.DB) error {
+				var m Model
+				if err := tx.First(&m, "id = ?", modelId).Error; err != nil {
+					return err
+				}
+				if err := applyBundleModel(tx, &m, entry); err != nil {
+					return err
+				}
+				return tx.Save(&m).Error
+			},
+		})
+	}
+	if !prune {
+		return nil
+	}
+	for _, m := range existing {
+		if seen[m.ModelName] {
+			continue
+		}
+		modelId := m.Id
+		plan.add(&ConfigPlanItem{
+			Kind:   configPlanKindModel,
+			Name:   m.ModelName,
+			Action: ConfigPlanActionDelete,
+			apply: func(tx *gorm.DB) error {
+				return tx.Delete(&Model{}, modelId).Error
+			},
+		})
+	}
+	return nil
+}
+
+func bundleModelFromModel(m *Model, vendorName string) BundleModel {
+	return BundleModel{
+		ModelName:        m.ModelName,
+		Vendor:           vendorName,
+		Description:      m.Description,
+		Icon:             m.Icon,
+		Tags:             m.Tags,
+		Endpoints:        m.Endpoints,
+		Status:           m.Status,
+		SyncOfficial:     m.SyncOfficial,
+		NameRule:         m.NameRule,
+		ContextLength:    m.ContextLength,
+		MaxOutputTokens:  m.MaxOutputTokens,
+		LongContextModel: m.LongContextModel,
+	}
+}
+
+func applyBundleModel(tx *gorm.DB, m *Model, entry BundleModel) error {
+	m.VendorID = 0
+	if entry.Vendor != "" {
+		var vendor Vendor
+		if err := tx.Where("name = ?", entry.Vendor).First(&vendor).Error; err != nil {
+			return fmt.Errorf("vendor %s not found", entry.Vendor)
+		}
+		m.VendorID = vendor.Id
+	}
+	m.Description = entry.Description
+	m.Icon = entry.Icon
+	m.Tags = entry.Tags
+	m.Endpoints = entry.Endpoints
+	m.Status = entry.Status
+	m.SyncOfficial = entry.SyncOfficial
+	m.NameRule = entry.NameRule
+	m.ContextLength = entry.ContextLength
+	m.MaxOutputTokens = entry.MaxOutputTokens
+	m.LongContextModel = entry.LongContextModel
+	m.UpdatedTime = common.GetTimestamp()
+	return nil
+}
+
+func planPrefillGroups(tx *gorm.DB, plan *ConfigPlan, desired []BundlePrefillGroup, prune bool) error {
+	var existing []*PrefillGroup
+	if err := tx.Order("id asc").Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*PrefillGroup, len(existing))
+	for _, group := range existing {
+		byName[group.Name] = group
+	}
+	seen := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		entry := entry
+		if entry.Name == "" {
+			return errors.New("prefill group name is required")
+		}
+		if seen[entry.Name] {
+			return fmt.Errorf("duplicate prefill group in bundle: %s", entry.Name)
+		}
+		seen[entry.Name] = true
+		items, err := common.Marshal(entry.Items)
+		if err != nil {
+			return fmt.Errorf("prefill group %s: %w", entry.Name, err)
+		}
+		current, ok := byName[entry.Name]
+		if !ok {
+			plan.add(&ConfigPlanItem{
+				Kind:    configPlanKindPrefillGroup,
+				Name:    entry.Name,
+				Action:  ConfigPlanActionCreate,
+				Changes: diffBundleEntries(BundlePrefillGroup{}, entry),
+				apply: func(tx *gorm.DB) error {
+					now := common.GetTimestamp()
+					return tx.Create(&PrefillGroup{
+						Name:        entry.Name,
+						Type:        entry.Type,
+						Items:       JSONValue(items),
+						Description: entry.Description,
+						CreatedTime: now,
+						UpdatedTime: now,
+					}).Error
+				},
+			})
+			continue
+		}
+		changes := diffBundleEntries(bundlePrefillGroupFromGroup(current), entry)
+		if len(changes) == 0 {
+			continue
+		}
+		groupId := current.Id
+		plan.add(&ConfigPlanItem{
+			Kind:    configPlanKindPrefillGroup,
+			Name:    entry.Name,
+			Action:  ConfigPlanActionUpdate,
+			Changes: changes,
+			apply: func(tx *gorm.DB) error {
+				return tx.Model(&PrefillGroup{}).Where("id = ?", groupId).Updates(map[string]any{
+					"type":         entry.Type,
+					"items":        JSONValue(items),
+					"description":  entry.Description,
+					"updated_time": common.GetTimestamp(),
+				}).Error
+			},
+		})
+	}
+	if !prune {
+		return nil
+	}
+	for _, group := range existing {
+		if seen[group.Name] {
+			continue
+		}
+		groupId := group.Id
+		plan.add(&ConfigPlanItem{
+			Kind:   configPlanKindPrefillGroup,
+			Name:   group.Name,
+			Action: ConfigPlanActionDelete,
+			apply: func(tx *gorm.DB) error {
+				return tx.Delete(&PrefillGroup{}, groupId).Error
+			},
+		})
+	}
+	return nil
+}
+
+func bundlePrefillGroupFromGroup(group *PrefillGroup) BundlePrefillGroup {
+	var items any
+	if len(group.Items) > 0 {
+		_ = common.Unmarshal(group.Items, &items)
+	}
+	return BundlePrefillGroup{
+		Name:        group.Name,
+		Type:        group.Type,
+		Items:       items,
+		Description: group.Description,
+	}
+}
+
+// planOptions 只处理已知的配置项，未知键给出警告并跳过；密钥类配置项的值为密钥引用，引用未解析时保持原值
+func planOptions(plan *ConfigPlan, bundle *ConfigBundle) error {
+	desired := make(map[string]any, len(bundle.Options))
+	for key, value := range bundle.Options {
+		if _, _, ok := splitModuleOptionKey(key); ok {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("option %s belongs to a config module, put it under modules", key))
+			continue
+		}
+		desired[key] = value
+	}
+	for module, fields := range bundle.Modules {
+		if config.GlobalConfig.Get(module) == nil {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("unknown config module %s skipped", module))
+			continue
+		}
+		for field, value := range fields {
+			desired[module+"."+field] = value
+		}
+	}
+
+	common.OptionMapRWMutex.RLock()
+	current := make(map[string]string, len(desired))
+	known := make(map[string]bool, len(desired))
+	for key := range desired {
+		current[key], known[key] = common.OptionMap[key]
+	}
+	common.OptionMapRWMutex.RUnlock()
+
+	for _, key := range sortedKeys(desired) {
+		if !known[key] {
+			plan.Warnings = append(plan.Warnings, fmt.Sprintf("unknown option %s skipped", key))
+			continue
+		}
+		value, err := importOptionValue(desired[key])
+		if err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+		value = normalizeOptionValue(key, value)
+		if IsSensitiveOptionKey(key) {
+			secret, resolved, err := resolveSecretRef(value)
+			if err != nil {
+				return fmt.Errorf("option %s: %w", key, err)
+			}
+			if !resolved || secret == current[key] {
+				continue
+			}
+			plan.options[key] = secret
+			plan.add(&ConfigPlanItem{
+				Kind:    configPlanKindOption,
+				Name:    key,
+				Action:  ConfigPlanActionUpdate,
+				Changes: []OptionFieldChange{{Path: key, From: maskedSecretValue, To: maskedSecretValue}},
+				apply:   func(tx *gorm.DB) error { return nil },
+			})
+			continue
+		}
+		if optionValuesEqual(current[key], value) {
+			continue
+		}
+		if err := validateBundleOption(key, value); err != nil {
+			return fmt.Errorf("option %s: %w", key, err)
+		}
+		plan.options[key] = value
+		changes := diffOptionJSON(current[key], value)
+		if changes == nil {
+			changes = []OptionFieldChange{{Path: key, From: current[key], To: value}}
+		}
+		plan.add(&ConfigPlanItem{
+			Kind:    configPlanKindOption,
+			Name:    key,
+			Action:  ConfigPlanActionUpdate,
+			Changes: changes,
+			// 配置项在事务最后统一写入并记录修订
+			apply: func(tx *gorm.DB) error { return nil },
+		})
+	}
+	return nil
+}
+
+// validateBundleOption 与后台修改配置时的校验保持一致，避免导入无法解析的配置
+func validateBundleOption(key string, value string) error {
+	switch key {
+	case "GroupRatio":
+		return ratio_setting.CheckGroupRatio(value)
+	case "DynamicGroupRatioSetting":
+		return ratio_setting.CheckDynamicGroupRatioSetting(value)
+	case "ModelRequestRateLimitGroup":
+		return setting.CheckModelRequestRateLimitGroup(value)
+	case "AutomaticDisableStatusCodes", "AutomaticRetryStatusCodes":
+		_, err := operation_setting.ParseHTTPStatusCodeRanges(value)
+		return err
+	case "billing_setting." + billing_setting.BillingExprField:
+		var exprs map[string]string
+		if err := common.UnmarshalJsonStr(value, &exprs); err != nil {
+			return err
+		}
+		for _, modelName := range sortedKeys(exprs) {
+			if err := billing_setting.SmokeTestExpr(exprs[modelName]); err != nil {
+				return fmt.Errorf("%s: %w", modelName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// splitModuleOptionKey 判断配置项是否属于 config.GlobalConfig 注册的模块
+func splitModuleOptionKey(key string) (string, string, bool) {
+	module, field, ok := strings.Cut(key, ".")
+	if !ok || config.GlobalConfig.Get(module) == nil {
+		return "", "", false
+	}
+	return module, field, true
+}
+
+// exportOptionValue JSON 对象与数组展开导出，密钥类配置项导出为环境变量引用
+func exportOptionValue(key string, value string) any {
+	if IsSensitiveOptionKey(key) {
+		if value == "" {
+			return ""
+		}
+		return secretEnvRef("OPTION_" + key)
+	}
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		var parsed any
+		if err := common.UnmarshalJsonStr(trimmed, &parsed); err == nil {
+			return parsed
+		}
+	}
+	return value
+}
+
+func importOptionValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	default:
+		data, err := common.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+}
+
+// optionValuesEqual 两个值都是 JSON 对象或数组时按内容比较，忽略格式与键顺序
+func optionValuesEqual(current string, desired string) bool {
+	if current == desired {
+		return true
+	}
+	var a, b any
+	trimmed := strings.TrimSpace(current)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return false
+	}
+	if common.UnmarshalJsonStr(current, &a) != nil || common.UnmarshalJsonStr(desired, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+const (
+	configSecretEnvPrefixEnv     = "CONFIG_SECRET_ENV_PREFIX"
+	configSecretDirEnv           = "CONFIG_SECRET_DIR"
+	defaultConfigSecretEnvPrefix = "NEW_API_SECRET_"
+	defaultConfigSecretDir       = "/run/secrets"
+)
+
+// configSecretEnvPrefix 密钥引用允许读取的环境变量前缀，避免配置包读出 SQL_DSN、SESSION_SECRET 等部署变量
+func configSecretEnvPrefix() string {
+	prefix := strings.TrimSpace(common.GetEnvOrDefaultString(configSecretEnvPrefixEnv, defaultConfigSecretEnvPrefix))
+	if prefix == "" {
+		return defaultConfigSecretEnvPrefix
+	}
+	return prefix
+}
+
+// configSecretDir 密钥引用允许读取的文件目录
+func configSecretDir() string {
+	dir := strings.TrimSpace(common.GetEnvOrDefaultString(configSecretDirEnv, defaultConfigSecretDir))
+	if dir == "" {
+		return defaultConfigSecretDir
+	}
+	return filepath.Clean(dir)
+}
+
+// pathWithinDir 判断 path 是否位于 dir 之内（不含 dir 本身）
+func pathWithinDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// resolveSecretFile 读取密钥目录内的文件，目录与文件的符号链接解析后仍须位于目录之内
+func resolveSecretFile(target string) (string, bool, error) {
+	dir := configSecretDir()
+	path := filepath.Clean(target)
+	if !filepath.IsAbs(path) || !pathWithinDir(dir, path) {
+		return "", false, fmt.Errorf("secret file must be inside %s", dir)
+	}
+	realPath, err := filepath.EvalSymlinks(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false, err
+	}
+	if !pathWithinDir(realDir, realPath) {
+		return "", false, fmt.Errorf("secret file must be inside %s", dir)
+	}
+	data, err := os.ReadFile(realPath)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// secretEnvRef 生成导出用的环境变量引用，变量名带有允许的前缀
+func secretEnvRef(name string) string {
+	return "env:" + configSecretEnvPrefix() + secretEnvName(name)
+}
+
+// resolveSecretRef 解析 env:NAME 或 file:/path 形式的密钥引用；引用为空、环境变量未设置或文件不存在时返回未解析。
+// 环境变量名必须以 CONFIG_SECRET_ENV_PREFIX 开头，文件必须位于 CONFIG_SECRET_DIR 目录内
+func resolveSecretRef(ref string) (string, bool, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", false, nil
+	}
+	scheme, target, ok := strings.Cut(ref, ":")
+	if !ok || target == "" {
+		return "", false, errors.New("secret reference must be env:NAME or file:/path")
+	}
+	switch scheme {
+	case "env":
+		prefix := configSecretEnvPrefix()
+		if !strings.HasPrefix(target, prefix) || target == prefix {
+			return "", false, fmt.Errorf("secret env name must start with %s", prefix)
+		}
+		value, ok := os.LookupEnv(target)
+		return value, ok, nil
+	case "file":
+		return resolveSecretFile(target)
+	default:
+		return "", false, fmt.Errorf("unsupported secret reference scheme: %s", scheme)
+	}
+}
+
+// secretEnvName 把名称转换为环境变量名，非字母数字的字符替换为下划线
+func secretEnvName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// diffBundleEntries 按 JSON 字段比较两个配置对象
+func diffBundleEntries(current any, desired any) []OptionFieldChange {
+	currentJSON, err := common.Marshal(current)
+	if err != nil {
+		return nil
+	}
+	desiredJSON, err := common.Marshal(desired)
+	if err != nil {
+		return nil
+	}
+	changes := diffOptionJSON(string(currentJSON), string(desiredJSON))
+	// key_ref 只是引用，是否需要更新密钥由解析结果决定
+	filtered := changes[:0]
+	for _, change := range changes {
+		if change.Path != "key_ref" {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,179 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigBundleYAML = `
+version: 1
+vendors:
+  - name: OpenAI
+    status: 1
+models:
+  - model_name: gpt-4o
+    vendor: OpenAI
+    status: 1
+    context_length: 128000
+channels:
+  - name: primary
+    type: 1
+    key_ref: env:NEW_API_SECRET_TEST_BUNDLE_PRIMARY_KEY
+    status: 1
+    models: gpt-4o,gpt-4o-mini
+    group: default,vip
+    priority: 10
+    weight: 5
+options:
+  SystemName: Gateway
+  ModelRatio:
+    gpt-4o: 1.25
+  Unknown: value
+`
+
+func prepareConfigBundleTest(t *testing.T) {
+	truncateTables(t)
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap = map[string]string{"SystemName": "New API", "ModelRatio": `{"gpt-4o":1.25}`}
+	common.OptionMapRWMutex.Unlock()
+	t.Setenv("NEW_API_SECRET_TEST_BUNDLE_PRIMARY_KEY", "sk-primary")
+}
+
+func TestApplyConfigBundle_Idempotent(t *testing.T) {
+	prepareConfigBundleTest(t)
+	bundle, err := ParseConfigBundle([]byte(testConfigBundleYAML))
+	require.NoError(t, err)
+
+	plan, err := PlanConfigBundle(bundle, ConfigApplyOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 4, plan.Summary[ConfigPlanActionCreate]+plan.Summary[ConfigPlanActionUpdate])
+	require.Contains(t, plan.Warnings, "unknown option Unknown skipped")
+
+	_, err = ApplyConfigBundle(bundle, ConfigApplyOptions{})
+	require.NoError(t, err)
+
+	var channel Channel
+	require.NoError(t, DB.Where("name = ?", "primary").First(&channel).Error)
+	require.Equal(t, "sk-primary", channel.Key)
+	var abilities int64
+	DB.Model(&Ability{}).Where("channel_id = ?", channel.Id).Count(&abilities)
+	require.EqualValues(t, 4, abilities)
+	var m Model
+	require.NoError(t, DB.Where("model_name = ?", "gpt-4o").First(&m).Error)
+	require.NotZero(t, m.VendorID)
+	require.Equal(t, "Gateway", common.OptionMap["SystemName"])
+
+	plan, err = ApplyConfigBundle(bundle, ConfigApplyOptions{})
+	require.NoError(t, err)
+	require.Empty(t, plan.Items)
+
+	// 导出后再导入不应产生任何修改
+	exported, err := ExportConfigBundle()
+	require.NoError(t, err)
+	require.Equal(t, "env:NEW_API_SECRET_CHANNEL_PRIMARY_KEY", exported.Channels[0].KeyRef)
+	data, err := MarshalConfigBundle(exported, ConfigBundleFormatYAML)
+	require.NoError(t, err)
+	reimported, err := ParseConfigBundle(data)
+	require.NoError(t, err)
+	plan, err = PlanConfigBundle(reimported, ConfigApplyOptions{Prune: true})
+	require.NoError(t, err)
+	require.Empty(t, plan.Items)
+}
+
+func TestPlanConfigBundle_UpdateAndPrune(t *testing.T) {
+	prepareConfigBundleTest(t)
+	bundle, err := ParseConfigBundle([]byte(testConfigBundleYAML))
+	require.NoError(t, err)
+	_, err = ApplyConfigBundle(bundle, ConfigApplyOptions{})
+	require.NoError(t, err)
+
+	bundle.Channels[0].Priority = 20
+	bundle.Channels[0].KeyRef = ""
+	bundle.Models = nil
+	plan, err := PlanConfigBundle(bundle, ConfigApplyOptions{Prune: true})
+	require.NoError(t, err)
+	require.Len(t, plan.Items, 2)
+	require.Equal(t, ConfigPlanActionDelete, plan.Items[0].Action)
+	require.Equal(t, "gpt-4o", plan.Items[0].Name)
+	require.Equal(t, ConfigPlanActionUpdate, plan.Items[1].Action)
+	require.Equal(t, []OptionFieldChange{{Path: "priority", From: float64(10), To: float64(20)}}, plan.Items[1].Changes)
+
+	_, err = ApplyConfigBundle(bundle, ConfigApplyOptions{Prune: true})
+	require.NoError(t, err)
+	var channel Channel
+	require.NoError(t, DB.Where("name = ?", "primary").First(&channel).Error)
+	require.Equal(t, "sk-primary", channel.Key)
+	require.EqualValues(t, 20, channel.GetPriority())
+}
+
+func TestPlanConfigBundle_RejectsLiteralSecret(t *testing.T) {
+	prepareConfigBundleTest(t)
+	bundle := &ConfigBundle{Version: ConfigBundleVersion, Channels: []BundleChannel{{Name: "raw", KeyRef: "sk-raw"}}}
+	_, err := PlanConfigBundle(bundle, ConfigApplyOptions{})
+	require.Error(t, err)
+}
+
+func TestResolveSecretRef_RestrictsTargets(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CONFIG_SECRET_DIR", dir)
+	t.Setenv("NEW_API_SECRET_PRIMARY", "sk-env")
+	t.Setenv("SQL_DSN", "root:pass@tcp(db)/new-api")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "primary"), []byte("sk-file\n"), 0600))
+	outside := filepath.Join(t.TempDir(), "outside")
+	require.NoError(t, os.WriteFile(outside, []byte("sk-outside"), 0600))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dir, "link")))
+
+	value, resolved, err := resolveSecretRef("env:NEW_API_SECRET_PRIMARY")
+	require.NoError(t, err)
+	require.True(t, resolved)
+	require.Equal(t, "sk-env", value)
+
+	value, resolved, err = resolveSecretRef("file:" + filepath.Join(dir, "primary"))
+	require.NoError(t, err)
+	require.True(t, resolved)
+	require.Equal(t, "sk-file", value)
+
+	_, resolved, err = resolveSecretRef("file:" + filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.False(t, resolved)
+
+	for _, ref := range []string{
+		"env:SQL_DSN",
+		"env:SECRET_ENCRYPTION_KEYS",
+		"env:SESSION_SECRET",
+		"env:NEW_API_SECRET_",
+		"file:/proc/self/environ",
+		"file:/etc/passwd",
+		"file:" + dir,
+		"file:" + dir + "/../outside",
+		"file:" + filepath.Join(dir, "link"),
+		"file:primary",
+	} {
+		_, resolved, err := resolveSecretRef(ref)
+		require.Error(t, err, ref)
+		require.False(t, resolved, ref)
+	}
+
+	t.Setenv("CONFIG_SECRET_ENV_PREFIX", "GATEWAY_")
+	t.Setenv("GATEWAY_PRIMARY", "sk-gateway")
+	value, resolved, err = resolveSecretRef("env:GATEWAY_PRIMARY")
+	require.NoError(t, err)
+	require.True(t, resolved)
+	require.Equal(t, "sk-gateway", value)
+	_, _, err = resolveSecretRef("env:NEW_API_SECRET_PRIMARY")
+	require.Error(t, err)
+}
+
+func TestPlanConfigBundle_ValidatesOptions(t *testing.T) {
+	prepareConfigBundleTest(t)
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap["AutomaticRetryStatusCodes"] = "500-599"
+	common.OptionMapRWMutex.Unlock()
+	bundle := &ConfigBundle{Version: ConfigBundleVersion, Options: map[string]any{"AutomaticRetryStatusCodes": "abc"}}
+	_, err := PlanConfigBundle(bundle, ConfigApplyOptions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// CustomTokenizer 管理员上传的 tokenizer.json，文件保存在文件存储中，按模型名正则匹配
+type CustomTokenizer struct {
+	Id           int    `json:"id"`
+	Name         string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	ModelPattern string `json:"model_pattern" gorm:"type:varchar(255)"`
+	Priority     int    `json:"priority" gorm:"default:0"`
+	Enabled      bool   `json:"enabled" gorm:"default:false"`
+	StorageType  string `json:"storage_type" gorm:"type:varchar(16)"`
+	StorageKey   string `json:"-" gorm:"type:varchar(255)"`
+	Bytes        int64  `json:"bytes" gorm:"bigint"`
+	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime  int64  `json:"updated_time" gorm:"bigint"`
+}
+
+func (t *CustomTokenizer) Insert() error {
+	now := common.GetTimestamp()
+	t.CreatedTime = now
+	t.UpdatedTime = now
+	return DB.Create(t).Error
+}
+
+// Update 更新匹配规则、优先级与启用状态，文件内容不可修改
+func (t *CustomTokenizer) Update() error {
+	t.UpdatedTime = common.GetTimestamp()
+	return DB.Model(t).Select("model_pattern", "priority", "enabled", "updated_time").Updates(t).Error
+}
+
+func (t *CustomTokenizer) Delete() error {
+	return DB.Delete(t).Error
+}
+
+func GetCustomTokenizerById(id int) (*CustomTokenizer, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var t CustomTokenizer
+	if err := DB.First(&t, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetAllCustomTokenizers 按优先级从高到低返回
+func GetAllCustomTokenizers() ([]*CustomTokenizer, error) {
+	var tokenizers []*CustomTokenizer
+	err := DB.Order("priority desc, id asc").Find(&tokenizers).Error
+	return tokenizers, err
+}
+
+// GetCustomTokenizersVersion 返回数量与最后更新时间，用于多节点判断是否需要重新加载
+func GetCustomTokenizersVersion() (int64, int64, error) {
+	var result struct {
+		Count       int64
+		UpdatedTime int64
+	}
+	err := DB.Model(&CustomTokenizer{}).Select("count(*) as count, coalesce(max(updated_time), 0) as updated_time").Scan(&result).Error
+	return result.Count, result.UpdatedTime, err
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+	FileStatusError     = "error"
+)
+
+// File 通过 /v1/files 上传的文件，归属于用户与令牌
+type File struct {
+	Id          int    `json:"id"`
+	FileId      string `json:"file_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	TokenId     int    `json:"token_id" gorm:"index"`
+	Filename    string `json:"filename" gorm:"type:varchar(255)"`
+	Purpose     string `json:"purpose" gorm:"type:varchar(32);index"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128)"`
+	Bytes       int64  `json:"bytes" gorm:"bigint"`
+	Status      string `json:"status" gorm:"type:varchar(16)"`
+	StorageType string `json:"storage_type" gorm:"type:varchar(16)"`
+	StorageKey  string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt   int64  `json:"expires_at" gorm:"bigint"`
+}
+
+var (
+	ErrFileCountExceeded   = errors.New("file count limit reached")
+	ErrFileStorageExceeded = errors.New("file storage limit exceeded")
+)
+
+// FileUpstream 记录网关文件在上游渠道中的文件 ID 映射，多密钥渠道按上传时使用的密钥区分
+type FileUpstream struct {
+	Id             int    `json:"id"`
+	FileId         string `json:"file_id" gorm:"type:varchar(64);uniqueIndex:idx_file_upstream_channel"`
+	ChannelId      int    `json:"channel_id" gorm:"uniqueIndex:idx_file_upstream_channel"`
+	KeyIndex       int    `json:"key_index" gorm:"default:0;uniqueIndex:idx_file_upstream_channel"`
+	UpstreamFileId string `json:"upstream_file_id" gorm:"type:varchar(128)"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+// InsertWithLimit 锁定用户后校验文件数量与占用空间再写入，避免并发上传超出限制；limit 为 0 表示不限制
+func (file *File) InsertWithLimit(maxFiles int64, maxBytes int64) error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if maxFiles > 0 || maxBytes > 0 {
+			var user User
+			if err := tx.Set("gorm:query_option", "FOR UPDATE").Select("id").Where("id = ?", file.UserId).First(&user).Error; err != nil {
+				return err
+			}
+			count, total, err := getUserFileUsage(tx, file.UserId)
+			if err != nil {
+				return err
+			}
+			if maxFiles > 0 && count >= maxFiles {
+				return ErrFileCountExceeded
+			}
+			if maxBytes > 0 && total+file.Bytes > maxBytes {
+				return ErrFileStorageExceeded
+			}
+		}
+		return tx.Create(file).Error
+	})
+}
+
+func (file *File) UpdateStatus(status string) error {
+	file.Status = status
+	return DB.Model(file).Update("status", status).Error
+}
+
+func GetUserFileByFileId(userId int, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is empty")
+	}
+	var file File
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserFiles 按创建时间倒序分页，after 为上一页最后一个文件 ID（OpenAI 游标分页语义）
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, bool, error) {
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var cursor File
+		if err := DB.Where("user_id = ? AND file_id = ?", userId, after).First(&cursor).Error; err == nil {
+			query = query.Where("id < ?", cursor.Id)
+		}
+	}
+	var files []*File
+	err := query.Order("id desc").Limit(limit + 1).Find(&files).Error
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	return files, hasMore, nil
+}
+
+// GetUserFileUsage 返回用户当前的文件数量与占用字节数
+func GetUserFileUsage(userId int) (count int64, totalBytes int64, err error) {
+	return getUserFileUsage(DB, userId)
+}
+
+func getUserFileUsage(tx *gorm.DB, userId int) (count int64, totalBytes int64, err error) {
+	var result struct {
+		Count int64
+		Total int64
+	}
+	err = tx.Model(&File{}).Select("COUNT(*) AS count, COALESCE(SUM(bytes), 0) AS total").
+		Where("user_id = ?", userId).Scan(&result).Error
+	return result.Count, result.Total, err
+}
+
+func DeleteFile(file *File) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("file_id = ?", file.FileId).Delete(&FileUpstream{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(file).Error
+	})
+}
+
+func GetFileUpstream(fileId string, channelId int, keyIndex int) (*FileUpstream, error) {
+	var mapping FileUpstream
+	err := DB.Where("file_id = ? AND channel_id = ? AND key_index = ?", fileId, channelId, keyIndex).First(&mapping).Error
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+func GetFileUpstreams(fileId string) ([]*FileUpstream, error) {
+	var mappings []*FileUpstream
+	err := DB.Where("file_id = ?", fileId).Find(&mappings).Error
+	return mappings, err
+}
+
+func SaveFileUpstream(fileId string, channelId int, keyIndex int, upstreamFileId string) error {
+	mapping := FileUpstream{
+		FileId:         fileId,
+		ChannelId:      channelId,
+		KeyIndex:       keyIndex,
+		UpstreamFileId: upstreamFileId,
+		CreatedAt:      common.GetTimestamp(),
+	}
+	return DB.Where("file_id = ? AND channel_id = ? AND key_index = ?", fileId, channelId, keyIndex).
+		Assign(FileUpstream{UpstreamFileId: upstreamFileId}).
+		FirstOrCreate(&mapping).Error
+}
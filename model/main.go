@@ -283,6 +283,15 @@ func migrateDB() error {
 		&PerfMetric{},
 		&UserIPAccessLog{},
 		&RegistrationCode{},
+		&File{},
+		&FileUpstream{},
+		&Batch{},
+		&Organization{},
+		&OrganizationMember{},
+		&StoredResponse{},
+		&CustomTokenizer{},
+		&OptionRevision{},
+		&TopUpRefund{},
 	)
 	if err != nil {
 		return err
@@ -334,6 +343,15 @@ func migrateDBFast() error {
 		{&PerfMetric{}, "PerfMetric"},
 		{&UserIPAccessLog{}, "UserIPAccessLog"},
 		{&RegistrationCode{}, "RegistrationCode"},
+		{&File{}, "File"},
+		{&FileUpstream{}, "FileUpstream"},
+		{&Batch{}, "Batch"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&CustomTokenizer{}, "CustomTokenizer"},
+		{&OptionRevision{}, "OptionRevision"},
+		{&TopUpRefund{}, "TopUpRefund"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -39,6 +39,12 @@ type Model struct {
 	QuotaTypes    []int          `json:"quota_types,omitempty" gorm:"-"`
 	NameRule      int            `json:"name_rule" gorm:"default:0"`
 
+	// 上下文窗口与最大输出 token 数，0 表示未知
+	ContextLength   int `json:"context_length" gorm:"default:0"`
+	MaxOutputTokens int `json:"max_output_tokens" gorm:"default:0"`
+	// LongContextModel 超出上下文窗口时改用的长上下文模型
+	LongContextModel string `json:"long_context_model,omitempty" gorm:"type:varchar(128)"`
+
 	MatchedModels []string `json:"matched_models,omitempty" gorm:"-"`
 	MatchedCount  int      `json:"matched_count,omitempty" gorm:"-"`
 }
@@ -77,7 +83,7 @@ func (mi *Model) Update() error {
 	mi.UpdatedTime = common.GetTimestamp()
 	// 使用 Select 强制更新所有字段，包括零值
 	return DB.Model(&Model{}).Where("id = ?", mi.Id).
-		Select("model_name", "description", "icon", "tags", "vendor_id", "endpoints", "status", "sync_official", "name_rule", "updated_time").
+		Select("model_name", "description", "icon", "tags", "vendor_id", "endpoints", "status", "sync_official", "name_rule", "context_length", "max_output_tokens", "long_context_model", "updated_time").
 		Updates(mi).Error
 }
 
@@ -173,6 +173,7 @@ func InitOptionMap() {
 	common.OptionMap["SelfUseModeEnabled"] = strconv.FormatBool(operation_setting.SelfUseModeEnabled)
 	common.OptionMap["ModelRequestRateLimitEnabled"] = strconv.FormatBool(setting.ModelRequestRateLimitEnabled)
 	common.OptionMap["CheckSensitiveOnPromptEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnPromptEnabled)
+	common.OptionMap["CheckSensitiveOnCompletionEnabled"] = strconv.FormatBool(setting.CheckSensitiveOnCompletionEnabled)
 	common.OptionMap["StopOnSensitiveEnabled"] = strconv.FormatBool(setting.StopOnSensitiveEnabled)
 	common.OptionMap["SensitiveWords"] = setting.SensitiveWordsToString()
 	common.OptionMap["StreamCacheQueueLength"] = strconv.Itoa(setting.StreamCacheQueueLength)
@@ -197,13 +198,23 @@ func InitOptionMap() {
 }
 
 func loadOptionsFromDatabase() {
+	// 先读修订号再加载，加载到的配置至少包含该修订
+	revision, revisionErr := GetLatestOptionRevisionId()
 	options, _ := AllOption()
 	for _, option := range options {
-		err := updateOptionMap(option.Key, option.Value)
+		value, err := common.DecryptSecret(option.Value)
+		if err != nil {
+			common.SysError("failed to decrypt option " + option.Key + ": " + err.Error())
+			continue
+		}
+		err = updateOptionMap(option.Key, value)
 		if err != nil {
 			common.SysLog("failed to update option map: " + err.Error())
 		}
 	}
+	if revisionErr == nil {
+		markOptionRevisionApplied(revision)
+	}
 }
 
 func SyncOptions(frequency int) {
@@ -214,20 +225,36 @@ func SyncOptions(frequency int) {
 	}
 }
 
+// UpdateOption 系统内部写入配置，同样记录修订
 func UpdateOption(key string, value string) error {
-	// Save to database first
-	option := Option{
-		Key: key,
+	return UpdateOptionWithAudit(key, value, OptionAudit{Source: OptionRevisionSourceSystem})
+}
+
+func isVisiblePublicKeyOption(key string) bool {
+	switch key {
+	case "WaffoPancakeWebhookPublicKey", "WaffoPancakeWebhookTestKey":
+		return true
+	default:
+		return false
 	}
-	// https://gorm.io/docs/update.html#Save-All-Fields
-	DB.FirstOrCreate(&option, Option{Key: key})
-	option.Value = value
-	// Save is a combination function.
-	// If save value does not contain primary key, it will execute Create,
-	// otherwise it will execute Update (with all fields).
-	DB.Save(&option)
-	// Update OptionMap
-	return updateOptionMap(key, value)
+}
+
+// IsSensitiveOptionKey 密钥类配置不返回给前端，修订记录与配置导出中也不包含其取值
+func IsSensitiveOptionKey(key string) bool {
+	isSensitiveKey := strings.HasSuffix(key, "Token") ||
+		strings.HasSuffix(key, "Secret") ||
+		strings.HasSuffix(key, "Key") ||
+		strings.HasSuffix(key, "secret") ||
+		strings.HasSuffix(key, "api_key")
+	return isSensitiveKey && !isVisiblePublicKeyOption(key)
+}
+
+// encryptOptionValue 密钥类配置以密文写入数据库与修订记录，内存中保存明文
+func encryptOptionValue(key string, value string) (string, error) {
+	if !IsSensitiveOptionKey(key) {
+		return value, nil
+	}
+	return common.EncryptSecret(value)
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -325,6 +352,8 @@ func updateOptionMap(key string, value string) (err error) {
 			operation_setting.SelfUseModeEnabled = boolValue
 		case "CheckSensitiveOnPromptEnabled":
 			setting.CheckSensitiveOnPromptEnabled = boolValue
+		case "CheckSensitiveOnCompletionEnabled":
+			setting.CheckSensitiveOnCompletionEnabled = boolValue
 		case "ModelRequestRateLimitEnabled":
 			setting.ModelRequestRateLimitEnabled = boolValue
 		case "StopOnSensitiveEnabled":
@@ -563,6 +592,19 @@ func updateOptionMap(key string, value string) (err error) {
 	return err
 }
 
+// normalizeOptionValue 保存前修正超出范围的取值，使数据库与内存中的配置一致
+func normalizeOptionValue(key string, value string) string {
+	switch key {
+	case "adaptive_channel_setting.min_weight_ratio":
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return value
+		}
+		return strconv.FormatFloat(operation_setting.ClampAdaptiveWeightRatio(ratio), 'f', -1, 64)
+	}
+	return value
+}
+
 // handleConfigUpdate 处理分层配置更新，返回是否已处理
 func handleConfigUpdate(key, value string) bool {
 	parts := strings.SplitN(key, ".", 2)
@@ -595,6 +637,8 @@ func handleConfigUpdate(key, value string) bool {
 		ratio_setting.InvalidateExposedDataCache()
 	} else if configName == "theme" {
 		system_setting.UpdateAndSyncTheme()
+	} else if configName == "adaptive_channel_setting" {
+		operation_setting.NormalizeAdaptiveChannelSetting()
 	}
 
 	return true // 已处理
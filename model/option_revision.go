@@ -0,0 +1,336 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OptionRevisionSourceUpdate   = "update"
+	OptionRevisionSourceSystem   = "system"
+	OptionRevisionSourceRollback = "rollback"
+	OptionRevisionSourceImport   = "import"
+)
+
+// OptionAudit 配置修改的操作者信息
+type OptionAudit struct {
+	ActorId   int
+	ActorName string
+	Ip        string
+	Source    string
+}
+
+// OptionRevision 配置项的一次修改记录，Id 为全局递增的修订号，Version 为该配置项自身的版本号
+type OptionRevision struct {
+	Id         int    `json:"id"`
+	Key        string `json:"key" gorm:"column:option_key;type:varchar(191);index"`
+	Version    int    `json:"version"`
+	OldValue   string `json:"old_value" gorm:"type:text"`
+	NewValue   string `json:"new_value" gorm:"type:text"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64)"`
+	Ip         string `json:"ip" gorm:"type:varchar(64)"`
+	Source     string `json:"source" gorm:"type:varchar(16)"`
+	RollbackTo int    `json:"rollback_to,omitempty"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+// OptionRevisionChange 某个配置项在两个修订之间的取值
+type OptionRevisionChange struct {
+	Key       string `json:"key"`
+	FromValue string `json:"from_value"`
+	ToValue   string `json:"to_value"`
+	// Fields 两个值都是 JSON 对象时逐字段列出差异，如 ModelRatio 中各模型的倍率
+	Fields []OptionFieldChange `json:"fields,omitempty"`
+}
+
+// OptionFieldChange JSON 配置中一个字段的变化，字段不存在时对应的值为 nil
+type OptionFieldChange struct {
+	Path string `json:"path"`
+	From any    `json:"from"`
+	To   any    `json:"to"`
+}
+
+// UpdateOptionWithAudit 保存配置并在同一事务中写入修订记录，值未变化时不记录
+func UpdateOptionWithAudit(key string, value string, audit OptionAudit) error {
+	value = normalizeOptionValue(key, value)
+	revisionId := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		_, revisionId, err = saveOptionWithRevision(tx, key, value, audit, 0)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	if revisionId > 0 {
+		markOptionRevisionApplied(int64(revisionId))
+		PublishCacheInvalidation(CacheInvalidationOption, key, revisionId)
+	}
+	return nil
+}
+
+// saveOptionWithRevision 返回修改前的值以及新修订号，值未变化时修订号为 0
+func saveOptionWithRevision(tx *gorm.DB, key string, value string, audit OptionAudit, rollbackTo int) (string, int, error) {
+	var option Option
+	err := tx.Where(&Option{Key: key}).First(&option).Error
+	created := errors.Is(err, gorm.ErrRecordNotFound)
+	if err != nil && !created {
+		return "", 0, err
+	}
+	oldValue, err := common.DecryptSecret(option.Value)
+	if err != nil {
+		return "", 0, err
+	}
+	if created {
+		// 数据库中还没有该配置项时，生效的是内存中的默认值
+		common.OptionMapRWMutex.RLock()
+		oldValue = common.OptionMap[key]
+		common.OptionMapRWMutex.RUnlock()
+		option = Option{Key: key}
+	}
+	if option.Value, err = encryptOptionValue(key, value); err != nil {
+		return "", 0, err
+	}
+	if err := tx.Save(&option).Error; err != nil {
+		return "", 0, err
+	}
+	if oldValue == value {
+		return oldValue, 0, nil
+	}
+	var latest OptionRevision
+	version := 1
+	if err := tx.Where("option_key = ?", key).Order("id desc").Limit(1).Find(&latest).Error; err != nil {
+		return "", 0, err
+	}
+	if latest.Id > 0 {
+		version = latest.Version + 1
+	}
+	source := audit.Source
+	if source == "" {
+		source = OptionRevisionSourceUpdate
+	}
+	storedOldValue, err := encryptOptionValue(key, oldValue)
+	if err != nil {
+		return "", 0, err
+	}
+	revision := OptionRevision{
+		Key:        key,
+		Version:    version,
+		OldValue:   storedOldValue,
+		NewValue:   option.Value,
+		ActorId:    audit.ActorId,
+		ActorName:  audit.ActorName,
+		Ip:         audit.Ip,
+		Source:     source,
+		RollbackTo: rollbackTo,
+		CreatedAt:  common.GetTimestamp(),
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return "", 0, err
+	}
+	return oldValue, revision.Id, nil
+}
+
+// optionKeyScope 按配置项或配置模块（如 model_fallback_setting）过滤，都为空时不过滤
+func optionKeyScope(key string, module string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if key != "" {
+			return db.Where("option_key = ?", key)
+		}
+		if module != "" {
+			return db.Where("option_key LIKE ?", module+".%")
+		}
+		return db
+	}
+}
+
+// GetOptionRevisions 按修订号从新到旧分页返回修改记录
+func GetOptionRevisions(key string, module string, startIdx int, num int) ([]*OptionRevision, int64, error) {
+	var revisions []*OptionRevision
+	var total int64
+	query := DB.Model(&OptionRevision{}).Scopes(optionKeyScope(key, module))
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err := query.Order("id desc").Limit(num).Offset(startIdx).Find(&revisions).Error
+	return revisions, total, err
+}
+
+func GetOptionRevisionById(id int) (*OptionRevision, error) {
+	var revision OptionRevision
+	if err := DB.First(&revision, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// getOptionValueAt 返回配置项在修订号 revisionId 写入后的取值：
+// 该修订及之前有修改时取最后一次修改后的值，否则取之后第一次修改前的值；从未修改过时返回 false
+func getOptionValueAt(tx *gorm.DB, key string, revisionId int) (string, bool, error) {
+	var before OptionRevision
+	if err := tx.Where("option_key = ? AND id <= ?", key, revisionId).Order("id desc").Limit(1).Find(&before).Error; err != nil {
+		return "", false, err
+	}
+	if before.Id > 0 {
+		value, err := common.DecryptSecret(before.NewValue)
+		return value, err == nil, err
+	}
+	var after OptionRevision
+	if err := tx.Where("option_key = ? AND id > ?", key, revisionId).Order("id asc").Limit(1).Find(&after).Error; err != nil {
+		return "", false, err
+	}
+	if after.Id > 0 {
+		value, err := common.DecryptSecret(after.OldValue)
+		return value, err == nil, err
+	}
+	return "", false, nil
+}
+
+// changedOptionKeys 返回修订号区间 (fromId, toId] 内修改过的配置项
+func changedOptionKeys(tx *gorm.DB, fromId int, toId int, key string, module string) ([]string, error) {
+	var keys []string
+	query := tx.Model(&OptionRevision{}).Scopes(optionKeyScope(key, module)).Where("id > ?", fromId)
+	if toId > 0 {
+		query = query.Where("id <= ?", toId)
+	}
+	if err := query.Distinct("option_key").Pluck("option_key", &keys).Error; err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// DiffOptionRevisions 返回两个修订之间取值不同的配置项
+func DiffOptionRevisions(fromId int, toId int, key string, module string) ([]OptionRevisionChange, error) {
+	low, high := min(fromId, toId), max(fromId, toId)
+	keys, err := changedOptionKeys(DB, low, high, key, module)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]OptionRevisionChange, 0, len(keys))
+	for _, k := range keys {
+		fromValue, _, err := getOptionValueAt(DB, k, fromId)
+		if err != nil {
+			return nil, err
+		}
+		toValue, _, err := getOptionValueAt(DB, k, toId)
+		if err != nil {
+			return nil, err
+		}
+		if fromValue != toValue {
+			changes = append(changes, OptionRevisionChange{
+				Key:       k,
+				FromValue: fromValue,
+				ToValue:   toValue,
+				Fields:    diffOptionJSON(fromValue, toValue),
+			})
+		}
+	}
+	return changes, nil
+}
+
+// RollbackOptions 把配置恢复到修订号 revisionId 写入后的状态。
+// 指定 key 或 module 时只回滚对应的配置项，否则回滚之后修改过的所有配置项；所有修改在同一事务中完成
+func RollbackOptions(revisionId int, key string, module string, audit OptionAudit) ([]OptionRevisionChange, error) {
+	if _, err := GetOptionRevisionById(revisionId); err != nil {
+		return nil, err
+	}
+	audit.Source = OptionRevisionSourceRollback
+	changes := make([]OptionRevisionChange, 0)
+	lastRevisionId := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		keys, err := changedOptionKeys(tx, revisionId, 0, key, module)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			target, ok, err := getOptionValueAt(tx, k, revisionId)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			// 与后台修改配置时的校验一致，无法应用的历史值不写入
+			if err := validateBundleOption(k, target); err != nil {
+				return fmt.Errorf("option %s: %w", k, err)
+			}
+			oldValue, newRevisionId, err := saveOptionWithRevision(tx, k, target, audit, revisionId)
+			if err != nil {
+				return err
+			}
+			if newRevisionId > 0 {
+				lastRevisionId = newRevisionId
+				changes = append(changes, OptionRevisionChange{Key: k, FromValue: oldValue, ToValue: target})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var applyErr error
+	for _, change := range changes {
+		if err := updateOptionMap(change.Key, change.ToValue); err != nil {
+			common.SysError("failed to apply rolled back option " + change.Key + ": " + err.Error())
+			if applyErr == nil {
+				applyErr = fmt.Errorf("option %s: %w", change.Key, err)
+			}
+		}
+	}
+	if lastRevisionId > 0 {
+		markOptionRevisionApplied(int64(lastRevisionId))
+		PublishCacheInvalidation(CacheInvalidationOption, "", lastRevisionId)
+	}
+	return changes, applyErr
+}
+
+// diffOptionJSON 两个值都能解析为 JSON 对象时返回逐字段差异，嵌套对象的路径用 . 连接，数组整体比较
+func diffOptionJSON(fromValue string, toValue string) []OptionFieldChange {
+	var from, to map[string]any
+	if common.UnmarshalJsonStr(fromValue, &from) != nil || common.UnmarshalJsonStr(toValue, &to) != nil {
+		return nil
+	}
+	changes := make([]OptionFieldChange, 0)
+	diffJSONObject("", from, to, &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+func diffJSONObject(prefix string, from map[string]any, to map[string]any, changes *[]OptionFieldChange) {
+	keys := make(map[string]struct{}, len(from)+len(to))
+	for k := range from {
+		keys[k] = struct{}{}
+	}
+	for k := range to {
+		keys[k] = struct{}{}
+	}
+	for k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		fromItem, fromOk := from[k]
+		toItem, toOk := to[k]
+		fromObject, fromIsObject := fromItem.(map[string]any)
+		toObject, toIsObject := toItem.(map[string]any)
+		if fromIsObject && toIsObject {
+			diffJSONObject(path, fromObject, toObject, changes)
+			continue
+		}
+		if fromOk && toOk && reflect.DeepEqual(fromItem, toItem) {
+			continue
+		}
+		*changes = append(*changes, OptionFieldChange{Path: path, From: fromItem, To: toItem})
+	}
+}
@@ -0,0 +1,121 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func prepareOptionRevisionTest(t *testing.T) {
+	truncateTables(t)
+	common.OptionMapRWMutex.Lock()
+	common.OptionMap = map[string]string{"Notice": "", "SystemName": "New API"}
+	common.OptionMapRWMutex.Unlock()
+}
+
+func TestUpdateOptionWithAudit_RecordsRevisions(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	audit := OptionAudit{ActorId: 1, ActorName: "root", Ip: "127.0.0.1"}
+
+	require.NoError(t, UpdateOptionWithAudit("SystemName", "Yang API", audit))
+	require.NoError(t, UpdateOptionWithAudit("SystemName", "Yang API", audit))
+	require.NoError(t, UpdateOptionWithAudit("SystemName", "Gateway", audit))
+
+	revisions, total, err := GetOptionRevisions("SystemName", "", 0, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, total)
+	require.Equal(t, "Yang API", revisions[0].OldValue)
+	require.Equal(t, "Gateway", revisions[0].NewValue)
+	require.Equal(t, 2, revisions[0].Version)
+	require.Equal(t, "New API", revisions[1].OldValue)
+	require.Equal(t, "root", revisions[1].ActorName)
+	require.Equal(t, OptionRevisionSourceUpdate, revisions[1].Source)
+}
+
+func TestRollbackOptions_Snapshot(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	audit := OptionAudit{ActorId: 1}
+
+	require.NoError(t, UpdateOptionWithAudit("Notice", "v1", audit))
+	revisions, _, err := GetOptionRevisions("Notice", "", 0, 1)
+	require.NoError(t, err)
+	checkpoint := revisions[0].Id
+
+	require.NoError(t, UpdateOptionWithAudit("Notice", "v2", audit))
+	require.NoError(t, UpdateOptionWithAudit("SystemName", "Broken", audit))
+
+	changes, err := RollbackOptions(checkpoint, "", "", audit)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	require.Equal(t, "v1", common.OptionMap["Notice"])
+	require.Equal(t, "New API", common.OptionMap["SystemName"])
+
+	latest, _, err := GetOptionRevisions("", "", 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, OptionRevisionSourceRollback, latest[0].Source)
+	require.Equal(t, checkpoint, latest[0].RollbackTo)
+
+	changes, err = RollbackOptions(checkpoint, "", "", audit)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+}
+
+func TestRollbackOptions_RejectsInvalidValue(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	saved := ratio_setting.GroupRatio2JSONString()
+	t.Cleanup(func() { _ = ratio_setting.UpdateGroupRatioByJSONString(saved) })
+	audit := OptionAudit{ActorId: 1}
+
+	// 早期未校验写入的错误值
+	require.Error(t, UpdateOptionWithAudit("GroupRatio", `{"default":`, audit))
+	revisions, _, err := GetOptionRevisions("GroupRatio", "", 0, 1)
+	require.NoError(t, err)
+	broken := revisions[0].Id
+	require.NoError(t, UpdateOptionWithAudit("GroupRatio", `{"default":1}`, audit))
+
+	_, err = RollbackOptions(broken, "GroupRatio", "", audit)
+	require.Error(t, err)
+	var option Option
+	require.NoError(t, DB.Where(&Option{Key: "GroupRatio"}).First(&option).Error)
+	require.Equal(t, `{"default":1}`, option.Value)
+}
+
+func TestDiffOptionRevisions_JSONFields(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	audit := OptionAudit{ActorId: 1}
+
+	require.NoError(t, UpdateOptionWithAudit("ModelRatio", `{"gpt-4o":1.25,"claude":1.5}`, audit))
+	require.NoError(t, UpdateOptionWithAudit("ModelRatio", `{"gpt-4o":2.5,"deepseek":0.5}`, audit))
+	revisions, _, err := GetOptionRevisions("ModelRatio", "", 0, 2)
+	require.NoError(t, err)
+
+	changes, err := DiffOptionRevisions(revisions[1].Id, revisions[0].Id, "", "")
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	require.Equal(t, []OptionFieldChange{
+		{Path: "claude", From: 1.5, To: nil},
+		{Path: "deepseek", From: nil, To: 0.5},
+		{Path: "gpt-4o", From: 1.25, To: 2.5},
+	}, changes[0].Fields)
+}
+
+func TestUpdateOptionClampsMinWeightRatio(t *testing.T) {
+	prepareOptionRevisionTest(t)
+	setting := operation_setting.GetAdaptiveChannelSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+	})
+
+	require.NoError(t, UpdateOption("adaptive_channel_setting.min_weight_ratio", "0"))
+	require.Equal(t, operation_setting.MinAdaptiveWeightRatio, setting.MinWeightRatio)
+	var option Option
+	require.NoError(t, DB.Where("key = ?", "adaptive_channel_setting.min_weight_ratio").First(&option).Error)
+	require.Equal(t, "0.01", option.Value)
+
+	require.NoError(t, UpdateOption("adaptive_channel_setting.min_weight_ratio", "0.2"))
+	require.Equal(t, 0.2, setting.MinWeightRatio)
+}
@@ -0,0 +1,405 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"gorm.io/gorm"
+)
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+	OrganizationRoleViewer = "viewer"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+var (
+	ErrOrganizationNotFound       = errors.New("组织不存在")
+	ErrOrganizationDisabled       = errors.New("组织已被禁用")
+	ErrOrganizationNotMember      = errors.New("不是该组织的成员")
+	ErrOrganizationNoPermission   = errors.New("组织权限不足")
+	ErrOrganizationQuotaNotEnough = errors.New("组织额度不足")
+	ErrOrganizationMemberCapHit   = errors.New("组织成员额度已用尽")
+)
+
+// Organization 组织，成员共享组织钱包
+type Organization struct {
+	Id          int            `json:"id"`
+	Name        string         `json:"name" gorm:"type:varchar(64);index"`
+	OwnerId     int            `json:"owner_id" gorm:"index"`
+	Status      int            `json:"status" gorm:"default:1"`
+	Quota       int            `json:"quota" gorm:"default:0"`
+	UsedQuota   int            `json:"used_quota" gorm:"default:0"`
+	CreatedTime int64          `json:"created_time" gorm:"bigint"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	// 查询当前用户的组织列表时填充
+	Role string `json:"role,omitempty" gorm:"-"`
+}
+
+// OrganizationMember 组织成员，QuotaLimit 为成员可从组织钱包消费的上限，0 表示不限制
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member_user,priority:1"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user,priority:2;index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"default:0"`
+	UsedQuota      int    `json:"used_quota" gorm:"default:0"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	Username       string `json:"username" gorm:"-"`
+}
+
+// OrganizationRoleLevel 角色等级，数值越大权限越高，未知角色为 0
+func OrganizationRoleLevel(role string) int {
+	switch role {
+	case OrganizationRoleOwner:
+		return 4
+	case OrganizationRoleAdmin:
+		return 3
+	case OrganizationRoleMember:
+		return 2
+	case OrganizationRoleViewer:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// IsValidOrganizationRole 可分配给成员的角色，owner 只能在创建组织时产生
+func IsValidOrganizationRole(role string) bool {
+	return role == OrganizationRoleAdmin || role == OrganizationRoleMember || role == OrganizationRoleViewer
+}
+
+// HasRole 成员角色是否不低于 role
+func (member *OrganizationMember) HasRole(role string) bool {
+	return OrganizationRoleLevel(member.Role) >= OrganizationRoleLevel(role)
+}
+
+// CheckSpend 检查成员能否再从组织钱包消费 amount 额度
+func (member *OrganizationMember) CheckSpend(amount int) error {
+	if !member.HasRole(OrganizationRoleMember) {
+		return ErrOrganizationNoPermission
+	}
+	if member.QuotaLimit > 0 && member.UsedQuota+amount > member.QuotaLimit {
+		return fmt.Errorf("%w, 上限: %s, 已用: %s", ErrOrganizationMemberCapHit,
+			logger.FormatQuota(member.QuotaLimit), logger.FormatQuota(member.UsedQuota))
+	}
+	return nil
+}
+
+// CreateOrganization 创建组织，创建者成为 owner
+func CreateOrganization(org *Organization, ownerId int) error {
+	org.OwnerId = ownerId
+	org.Status = OrganizationStatusEnabled
+	org.Quota = 0
+	org.UsedQuota = 0
+	org.CreatedTime = common.GetTimestamp()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         ownerId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    org.CreatedTime,
+		}).Error
+	})
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, ErrOrganizationNotFound
+	}
+	var org Organization
+	if err := DB.First(&org, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotFound
+		}
+		return nil, err
+	}
+	return &org, nil
+}
+
+func GetAllOrganizations(startIdx int, num int) (orgs []*Organization, total int64, err error) {
+	err = DB.Model(&Organization{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(num).Offset(startIdx).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户所在的组织及其角色
+func GetUserOrganizations(userId int) ([]*Organization, error) {
+	var members []OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return []*Organization{}, nil
+	}
+	roles := make(map[int]string, len(members))
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		roles[member.OrganizationId] = member.Role
+		ids = append(ids, member.OrganizationId)
+	}
+	var orgs []*Organization
+	if err := DB.Where("id IN ?", ids).Order("id desc").Find(&orgs).Error; err != nil {
+		return nil, err
+	}
+	for _, org := range orgs {
+		org.Role = roles[org.Id]
+	}
+	return orgs, nil
+}
+
+func (org *Organization) Update() error {
+	return DB.Model(org).Select("name", "status").Updates(org).Error
+}
+
+// DeleteOrganization 删除组织：剩余额度退回 owner，组织令牌全部禁用
+func DeleteOrganization(id int) error {
+	org, err := GetOrganizationById(id)
+	if err != nil {
+		return err
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Token{}).Where("organization_id = ?", id).
+			Update("status", common.TokenStatusDisabled).Error; err != nil {
+			return err
+		}
+		if org.Quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", org.OwnerId).
+				Update("quota", gorm.Expr("quota + ?", org.Quota)).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(org).Error
+	})
+	if err != nil {
+		return err
+	}
+	if org.Quota > 0 {
+		if err := InvalidateUserCache(org.OwnerId); err != nil {
+			common.SysLog("failed to invalidate user cache: " + err.Error())
+		}
+		RecordLog(org.OwnerId, LogTypeManage, fmt.Sprintf("组织 %s 解散，剩余额度 %s 退回", org.Name, logger.LogQuota(org.Quota)))
+	}
+	return invalidateOrganizationTokensCache(id, 0)
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.Where("organization_id = ? AND user_id = ?", orgId, userId).First(&member).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOrganizationNotMember
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", orgId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		member.Username, _ = GetUsernameById(member.UserId, false)
+	}
+	return members, nil
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	var count int64
+	if err := DB.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", member.OrganizationId, member.UserId).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("该用户已是组织成员")
+	}
+	member.UsedQuota = 0
+	member.CreatedTime = common.GetTimestamp()
+	return DB.Create(member).Error
+}
+
+func (member *OrganizationMember) Update() error {
+	return DB.Model(member).Select("role", "quota_limit").Updates(member).Error
+}
+
+// RemoveOrganizationMember 移除成员并禁用其名下的组织令牌
+func RemoveOrganizationMember(orgId int, userId int) error {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgId, userId).
+			Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Token{}).Where("organization_id = ? AND user_id = ?", orgId, userId).
+			Update("status", common.TokenStatusDisabled).Error
+	})
+	if err != nil {
+		return err
+	}
+	return invalidateOrganizationTokensCache(orgId, userId)
+}
+
+// invalidateOrganizationTokensCache 清理组织令牌的 Redis 缓存，userId 为 0 时清理全部成员的令牌
+func invalidateOrganizationTokensCache(orgId int, userId int) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	tx := DB.Unscoped().Select("id", commonKeyCol).Where("organization_id = ?", orgId)
+	if userId > 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	var tokens []Token
+	if err := tx.Find(&tokens).Error; err != nil {
+		return err
+	}
+	var firstErr error
+	for _, t := range tokens {
+		if t.Key == "" {
+			continue
+		}
+		if err := cacheDeleteToken(t.Key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func GetOrganizationTokens(orgId int, startIdx int, num int) (tokens []*Token, total int64, err error) {
+	tx := DB.Model(&Token{}).Where("organization_id = ?", orgId)
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	err = tx.Order("id desc").Limit(num).Offset(startIdx).Find(&tokens).Error
+	return tokens, total, err
+}
+
+// CheckOrganizationSpend 校验组织状态、组织余额以及成员的角色与额度上限
+func CheckOrganizationSpend(orgId int, userId int, amount int) (*Organization, error) {
+	org, err := GetOrganizationById(orgId)
+	if err != nil {
+		return nil, err
+	}
+	if org.Status != OrganizationStatusEnabled {
+		return nil, ErrOrganizationDisabled
+	}
+	member, err := GetOrganizationMember(orgId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := member.CheckSpend(amount); err != nil {
+		return nil, err
+	}
+	if org.Quota <= 0 || org.Quota < amount {
+		return nil, fmt.Errorf("%w, 剩余额度: %s", ErrOrganizationQuotaNotEnough, logger.FormatQuota(org.Quota))
+	}
+	return org, nil
+}
+
+// IsOrganizationSpendDenied 判断 CheckOrganizationSpend 的错误是否为业务拒绝（而非数据库错误）
+func IsOrganizationSpendDenied(err error) bool {
+	for _, target := range []error{ErrOrganizationNotFound, ErrOrganizationDisabled, ErrOrganizationNotMember,
+		ErrOrganizationNoPermission, ErrOrganizationQuotaNotEnough, ErrOrganizationMemberCapHit} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeltaConsumeOrganizationQuota 记账组织消费：delta > 0 扣减组织余额并累加成员用量，delta < 0 退还
+func DeltaConsumeOrganizationQuota(orgId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", delta),
+			"used_quota": gorm.Expr("used_quota + ?", delta),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", orgId, userId).
+			Update("used_quota", gorm.Expr("used_quota + ?", delta)).Error
+	})
+}
+
+// ReserveOrganizationQuota 预扣组织额度：以组织余额和成员额度上限为条件原子更新，并发请求不会超额
+func ReserveOrganizationQuota(orgId int, userId int, amount int) error {
+	if amount <= 0 {
+		return DeltaConsumeOrganizationQuota(orgId, userId, amount)
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Organization{}).Where("id = ? AND status = ? AND quota >= ?", orgId, OrganizationStatusEnabled, amount).
+			Updates(map[string]interface{}{
+				"quota":      gorm.Expr("quota - ?", amount),
+				"used_quota": gorm.Expr("used_quota + ?", amount),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationQuotaNotEnough
+		}
+		result = tx.Model(&OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ? AND (quota_limit = 0 OR used_quota + ? <= quota_limit)", orgId, userId, amount).
+			Update("used_quota", gorm.Expr("used_quota + ?", amount))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationMemberCapHit
+		}
+		return nil
+	})
+}
+
+// IncreaseOrganizationQuota 管理员调整组织余额，quota 可为负数
+func IncreaseOrganizationQuota(orgId int, quota int) error {
+	return DB.Model(&Organization{}).Where("id = ?", orgId).
+		Update("quota", gorm.Expr("quota + ?", quota)).Error
+}
+
+// TransferUserQuotaToOrganization 从个人钱包向组织钱包转入额度
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("用户额度不足")
+		}
+		return tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", quota)).Error
+	})
+	if err != nil {
+		return err
+	}
+	if err := cacheDecrUserQuota(userId, int64(quota)); err != nil {
+		common.SysLog("failed to decrease user quota cache: " + err.Error())
+	}
+	return nil
+}
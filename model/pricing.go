@@ -36,6 +36,8 @@ type Pricing struct {
 	BillingMode            string                  `json:"billing_mode,omitempty"`
 	BillingExpr            string                  `json:"billing_expr,omitempty"`
 	PricingVersion         string                  `json:"pricing_version,omitempty"`
+	ContextLength          int                     `json:"context_length,omitempty"`
+	MaxOutputTokens        int                     `json:"max_output_tokens,omitempty"`
 }
 
 type PricingVendor struct {
@@ -63,6 +65,18 @@ var (
 	modelSupportEndpointsLock = sync.RWMutex{}
 )
 
+// ModelContextLimit 模型元数据中的上下文窗口信息
+type ModelContextLimit struct {
+	ContextLength    int
+	MaxOutputTokens  int
+	LongContextModel string
+}
+
+var (
+	modelContextLimits     = make(map[string]ModelContextLimit)
+	modelContextLimitsLock = sync.RWMutex{}
+)
+
 func GetPricing() []Pricing {
 	if time.Since(lastGetPricingTime) > time.Minute*1 || len(pricingMap) == 0 {
 		updatePricingLock.Lock()
@@ -107,6 +121,15 @@ func GetModelSupportEndpointTypes(model string) []constant.EndpointType {
 	return make([]constant.EndpointType, 0)
 }
 
+// GetModelContextLimit 返回模型的上下文窗口信息，未配置上下文长度时返回 false
+func GetModelContextLimit(model string) (ModelContextLimit, bool) {
+	GetPricing()
+	modelContextLimitsLock.RLock()
+	defer modelContextLimitsLock.RUnlock()
+	limit, ok := modelContextLimits[model]
+	return limit, ok
+}
+
 func updatePricing() {
 	//modelRatios := common.GetModelRatios()
 	enableAbilities, err := GetAllEnableAbilityWithChannels()
@@ -177,6 +200,21 @@ func updatePricing() {
 	// 初始化默认供应商映射
 	initDefaultVendorMapping(metaMap, vendorMap, enableAbilities)
 
+	contextLimits := make(map[string]ModelContextLimit)
+	for modelName, meta := range metaMap {
+		if meta.ContextLength <= 0 {
+			continue
+		}
+		contextLimits[modelName] = ModelContextLimit{
+			ContextLength:    meta.ContextLength,
+			MaxOutputTokens:  meta.MaxOutputTokens,
+			LongContextModel: strings.TrimSpace(meta.LongContextModel),
+		}
+	}
+	modelContextLimitsLock.Lock()
+	modelContextLimits = contextLimits
+	modelContextLimitsLock.Unlock()
+
 	// 构建对前端友好的供应商列表
 	vendorsList = make([]PricingVendor, 0, len(vendorMap))
 	for _, v := range vendorMap {
@@ -303,6 +341,8 @@ func updatePricing() {
 			pricing.Icon = meta.Icon
 			pricing.Tags = meta.Tags
 			pricing.VendorID = meta.VendorID
+			pricing.ContextLength = meta.ContextLength
+			pricing.MaxOutputTokens = meta.MaxOutputTokens
 		}
 		modelPrice, findPrice := ratio_setting.GetModelPrice(model, false)
 		if findPrice {
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// StoredResponse 网关保存的 Responses API 响应，InputItems 仅包含本轮输入，历史通过 PreviousResponseId 串联
+type StoredResponse struct {
+	Id                 int    `json:"id"`
+	ResponseId         string `json:"response_id" gorm:"type:varchar(128);uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id" gorm:"index"`
+	ChannelId          int    `json:"channel_id"`
+	ChannelKeyIndex    int    `json:"channel_key_index"`
+	Model              string `json:"model" gorm:"type:varchar(255)"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(128)"`
+	// UpstreamStored 上游是否也保存了该响应，为 false 时续接必须由网关重建对话
+	UpstreamStored bool            `json:"upstream_stored"`
+	InputItems     json.RawMessage `json:"input_items" gorm:"type:json"`
+	Response       json.RawMessage `json:"response" gorm:"type:json"`
+	CreatedAt      int64           `json:"created_at" gorm:"bigint;index"`
+	ExpiresAt      int64           `json:"expires_at" gorm:"bigint;index"`
+}
+
+func (r *StoredResponse) Insert() error {
+	if r.CreatedAt == 0 {
+		r.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(r).Error
+}
+
+// GetUserStoredResponse 查询用户未过期的响应
+func GetUserStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, errors.New("response id is empty")
+	}
+	var stored StoredResponse
+	err := DB.Where("user_id = ? AND response_id = ? AND expires_at > ?", userId, responseId, common.GetTimestamp()).
+		First(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+func DeleteStoredResponse(stored *StoredResponse) error {
+	return DB.Delete(stored).Error
+}
+
+// DeleteExpiredStoredResponses 分批删除过期响应，返回删除数量
+func DeleteExpiredStoredResponses(limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&StoredResponse{}).Where("expires_at <= ?", common.GetTimestamp()).
+		Order("id asc").Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Where("id IN ?", ids).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
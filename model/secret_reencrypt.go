@@ -0,0 +1,225 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const secretReencryptBatchSize = 200
+
+// SecretReencryptResult 一次重新加密各表更新的行数，Failed 为无法解密（如缺少旧主密钥）的行数
+type SecretReencryptResult struct {
+	Channels        int   `json:"channels"`
+	OAuthProviders  int   `json:"oauth_providers"`
+	Options         int   `json:"options"`
+	OptionRevisions int   `json:"option_revisions"`
+	Users           int   `json:"users"`
+	Tasks           int   `json:"tasks"`
+	Failed          int   `json:"failed"`
+	StartedAt       int64 `json:"started_at"`
+	FinishedAt      int64 `json:"finished_at"`
+}
+
+func (r *SecretReencryptResult) Total() int {
+	return r.Channels + r.OAuthProviders + r.Options + r.OptionRevisions + r.Users + r.Tasks
+}
+
+// ReencryptSecrets 把明文或使用旧主密钥加密的密钥用当前主密钥重新加密，也用于迁移加密前写入的数据。
+// 每行以读取到的原值为条件更新，不会覆盖期间的修改；未配置主密钥时不做任何处理
+func ReencryptSecrets() (*SecretReencryptResult, error) {
+	result := &SecretReencryptResult{StartedAt: common.GetTimestamp()}
+	if !common.SecretEncryptionEnabled() {
+		result.FinishedAt = common.GetTimestamp()
+		return result, nil
+	}
+	steps := []func(*SecretReencryptResult) error{
+		reencryptChannelKeys,
+		reencryptOAuthProviderSecrets,
+		reencryptOptionValues,
+		reencryptOptionRevisionValues,
+		reencryptUserWebhookSecrets,
+		reencryptTaskKeys,
+	}
+	for _, step := range steps {
+		if err := step(result); err != nil {
+			return result, err
+		}
+	}
+	result.FinishedAt = common.GetTimestamp()
+	if result.Channels > 0 {
+		InitChannelCache()
+	}
+	return result, nil
+}
+
+// reencryptSecretValue 返回重新加密后的值，不需要处理时 ok 为 false
+func reencryptSecretValue(result *SecretReencryptResult, value string, source string) (string, bool) {
+	if !common.SecretNeedsReencryption(value) {
+		return value, false
+	}
+	encrypted, err := common.ReencryptSecret(value)
+	if err != nil {
+		result.Failed++
+		common.SysError(fmt.Sprintf("failed to re-encrypt %s: %v", source, err))
+		return value, false
+	}
+	return encrypted, true
+}
+
+func reencryptChannelKeys(result *SecretReencryptResult) error {
+	lastId := 0
+	for {
+		var channels []*Channel
+		if err := DB.Select("id", "key").Where("id > ?", lastId).Order("id asc").Limit(secretReencryptBatchSize).Find(&channels).Error; err != nil {
+			return err
+		}
+		if len(channels) == 0 {
+			return nil
+		}
+		for _, channel := range channels {
+			lastId = channel.Id
+			key, ok := reencryptSecretValue(result, channel.Key, fmt.Sprintf("channel %d key", channel.Id))
+			if !ok {
+				continue
+			}
+			res := DB.Model(&Channel{}).Where(&Channel{Id: channel.Id, Key: channel.Key}).Update("key", key)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Channels += int(res.RowsAffected)
+		}
+	}
+}
+
+func reencryptOAuthProviderSecrets(result *SecretReencryptResult) error {
+	var providers []*CustomOAuthProvider
+	if err := DB.Select("id", "client_secret").Find(&providers).Error; err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		secret, ok := reencryptSecretValue(result, provider.ClientSecret, fmt.Sprintf("oauth provider %d client secret", provider.Id))
+		if !ok {
+			continue
+		}
+		res := DB.Model(&CustomOAuthProvider{}).Where("id = ? AND client_secret = ?", provider.Id, provider.ClientSecret).Update("client_secret", secret)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.OAuthProviders += int(res.RowsAffected)
+	}
+	return nil
+}
+
+func reencryptOptionValues(result *SecretReencryptResult) error {
+	options, err := AllOption()
+	if err != nil {
+		return err
+	}
+	for _, option := range options {
+		if !IsSensitiveOptionKey(option.Key) {
+			continue
+		}
+		value, ok := reencryptSecretValue(result, option.Value, "option "+option.Key)
+		if !ok {
+			continue
+		}
+		res := DB.Model(&Option{}).Where(&Option{Key: option.Key, Value: option.Value}).Update("value", value)
+		if res.Error != nil {
+			return res.Error
+		}
+		result.Options += int(res.RowsAffected)
+	}
+	return nil
+}
+
+func reencryptOptionRevisionValues(result *SecretReencryptResult) error {
+	lastId := 0
+	for {
+		var revisions []*OptionRevision
+		if err := DB.Select("id", "option_key", "old_value", "new_value").Where("id > ?", lastId).Order("id asc").Limit(secretReencryptBatchSize).Find(&revisions).Error; err != nil {
+			return err
+		}
+		if len(revisions) == 0 {
+			return nil
+		}
+		for _, revision := range revisions {
+			lastId = revision.Id
+			if !IsSensitiveOptionKey(revision.Key) {
+				continue
+			}
+			source := fmt.Sprintf("option revision %d", revision.Id)
+			oldValue, oldOk := reencryptSecretValue(result, revision.OldValue, source)
+			newValue, newOk := reencryptSecretValue(result, revision.NewValue, source)
+			if !oldOk && !newOk {
+				continue
+			}
+			res := DB.Model(&OptionRevision{}).Where("id = ?", revision.Id).Updates(map[string]any{
+				"old_value": oldValue,
+				"new_value": newValue,
+			})
+			if res.Error != nil {
+				return res.Error
+			}
+			result.OptionRevisions += int(res.RowsAffected)
+		}
+	}
+}
+
+func reencryptUserWebhookSecrets(result *SecretReencryptResult) error {
+	lastId := 0
+	for {
+		var users []*User
+		if err := DB.Select("id", "setting").Where("id > ? AND setting LIKE ?", lastId, "%webhook_secret%").Order("id asc").Limit(secretReencryptBatchSize).Find(&users).Error; err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		for _, user := range users {
+			lastId = user.Id
+			setting := user.GetSetting()
+			secret, ok := reencryptSecretValue(result, setting.WebhookSecret, fmt.Sprintf("user %d webhook secret", user.Id))
+			if !ok {
+				continue
+			}
+			originSetting := user.Setting
+			setting.WebhookSecret = secret
+			user.SetSetting(setting)
+			res := DB.Model(&User{}).Where("id = ? AND setting = ?", user.Id, originSetting).Update("setting", user.Setting)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected > 0 {
+				result.Users++
+				_ = invalidateUserCache(user.Id)
+			}
+		}
+	}
+}
+
+func reencryptTaskKeys(result *SecretReencryptResult) error {
+	lastId := int64(0)
+	for {
+		var tasks []*Task
+		if err := DB.Select("id", "private_data").Where("id > ?", lastId).Order("id asc").Limit(secretReencryptBatchSize).Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+		for _, task := range tasks {
+			lastId = task.ID
+			key, ok := reencryptSecretValue(result, task.PrivateData.Key, fmt.Sprintf("task %d key", task.ID))
+			if !ok {
+				continue
+			}
+			task.PrivateData.Key = key
+			res := DB.Model(&Task{}).Where("id = ?", task.ID).Update("private_data", task.PrivateData)
+			if res.Error != nil {
+				return res.Error
+			}
+			result.Tasks += int(res.RowsAffected)
+		}
+	}
+}
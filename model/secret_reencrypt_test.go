@@ -0,0 +1,99 @@
+package model
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func setTestSecretMasterKeys(t *testing.T, ids ...string) {
+	t.Helper()
+	entries := make([]string, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, id+":"+base64.StdEncoding.EncodeToString([]byte(strings.Repeat(id[:1], 32))))
+	}
+	require.NoError(t, common.SetSecretMasterKeys(strings.Join(entries, ",")))
+	t.Cleanup(func() { _ = common.SetSecretMasterKeys("") })
+}
+
+func TestChannelKey_EncryptedAtRest(t *testing.T) {
+	truncateTables(t)
+	setTestSecretMasterKeys(t, "a1")
+
+	channel := &Channel{Name: "encrypted", Key: "sk-one\nsk-two", Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	channel.ChannelInfo.IsMultiKey = true
+	channel.ChannelInfo.MultiKeySize = 2
+	require.NoError(t, channel.Insert())
+
+	var stored Channel
+	require.NoError(t, DB.First(&stored, channel.Id).Error)
+	require.True(t, common.IsEncryptedSecret(stored.Key))
+	require.NotContains(t, stored.Key, "sk-one")
+
+	require.Equal(t, []string{"sk-one", "sk-two"}, stored.GetKeys())
+	key, _, apiErr := stored.GetNextEnabledKey()
+	require.Nil(t, apiErr)
+	require.Contains(t, []string{"sk-one", "sk-two"}, key)
+
+	require.NoError(t, UpdateChannelKey(channel.Id, "sk-three"))
+	require.NoError(t, DB.First(&stored, channel.Id).Error)
+	plainKey, err := stored.GetPlainKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-three", plainKey)
+}
+
+func TestReencryptSecrets_MigratesPlaintextAndRotates(t *testing.T) {
+	truncateTables(t)
+
+	// 启用加密前写入的明文数据
+	channel := &Channel{Name: "legacy", Key: "sk-legacy", Status: common.ChannelStatusEnabled, Models: "gpt-4o", Group: "default"}
+	require.NoError(t, channel.Insert())
+	provider := &CustomOAuthProvider{Name: "Legacy", Slug: "legacy", ClientId: "id", ClientSecret: "client-secret"}
+	require.NoError(t, DB.Create(provider).Error)
+	user := &User{Username: "webhook", Password: "password", Setting: `{"webhook_secret":"hook-secret"}`}
+	require.NoError(t, DB.Create(user).Error)
+	require.NoError(t, DB.Create(&Task{TaskID: "task-1", PrivateData: TaskPrivateData{Key: "sk-task"}}).Error)
+
+	setTestSecretMasterKeys(t, "a1")
+	result, err := ReencryptSecrets()
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Channels)
+	require.Equal(t, 1, result.OAuthProviders)
+	require.Equal(t, 1, result.Users)
+	require.Equal(t, 1, result.Tasks)
+	require.Zero(t, result.Failed)
+
+	var stored Channel
+	require.NoError(t, DB.First(&stored, channel.Id).Error)
+	require.Equal(t, "a1", common.SecretMasterKeyID(stored.Key))
+	var storedProvider CustomOAuthProvider
+	require.NoError(t, DB.First(&storedProvider, provider.Id).Error)
+	clientSecret, err := storedProvider.GetClientSecret()
+	require.NoError(t, err)
+	require.Equal(t, "client-secret", clientSecret)
+	var storedUser User
+	require.NoError(t, DB.First(&storedUser, user.Id).Error)
+	require.True(t, common.IsEncryptedSecret(storedUser.GetSetting().WebhookSecret))
+	require.Contains(t, storedUser.GetSettingForOwner(), "hook-secret")
+	var storedTask Task
+	require.NoError(t, DB.Where("task_id = ?", "task-1").First(&storedTask).Error)
+	require.Equal(t, "sk-task", storedTask.PrivateData.GetKey())
+
+	// 轮换主密钥后旧密文迁移到新主密钥，再次执行不会重复处理
+	setTestSecretMasterKeys(t, "b2", "a1")
+	result, err = ReencryptSecrets()
+	require.NoError(t, err)
+	require.Equal(t, 4, result.Total())
+	require.NoError(t, DB.First(&stored, channel.Id).Error)
+	require.Equal(t, "b2", common.SecretMasterKeyID(stored.Key))
+	plainKey, err := stored.GetPlainKey()
+	require.NoError(t, err)
+	require.Equal(t, "sk-legacy", plainKey)
+
+	result, err = ReencryptSecrets()
+	require.NoError(t, err)
+	require.Zero(t, result.Total())
+}
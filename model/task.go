@@ -101,12 +101,23 @@ type TaskPrivateData struct {
 	UpstreamTaskID string `json:"upstream_task_id,omitempty"` // 上游真实 task ID
 	ResultURL      string `json:"result_url,omitempty"`       // 任务成功后的结果 URL（视频地址等）
 	// 计费上下文：用于异步退款/差额结算（轮询阶段读取）
-	BillingSource  string              `json:"billing_source,omitempty"`  // "wallet" 或 "subscription"
+	BillingSource  string              `json:"billing_source,omitempty"`  // "wallet"、"subscription" 或 "organization"
 	SubscriptionId int                 `json:"subscription_id,omitempty"` // 订阅 ID，用于订阅退款
 	TokenId        int                 `json:"token_id,omitempty"`        // 令牌 ID，用于令牌额度退款
+	OrganizationId int                 `json:"organization_id,omitempty"` // 组织 ID，组织钱包计费时用于退款
 	BillingContext *TaskBillingContext `json:"billing_context,omitempty"` // 计费参数快照（用于轮询阶段重新计算）
 }
 
+// GetKey 返回解密后的上游密钥，解密失败时返回空字符串
+func (p TaskPrivateData) GetKey() string {
+	key, err := common.DecryptSecret(p.Key)
+	if err != nil {
+		common.SysError("failed to decrypt task key: " + err.Error())
+		return ""
+	}
+	return key
+}
+
 // TaskBillingContext 记录任务提交时的计费参数，以便轮询阶段可以重新计算额度。
 type TaskBillingContext struct {
 	ModelPrice      float64            `json:"model_price,omitempty"`       // 模型单价
@@ -175,7 +186,10 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 	if relayInfo != nil && relayInfo.ChannelMeta != nil {
 		if relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeGemini ||
 			relayInfo.ChannelMeta.ChannelType == constant.ChannelTypeVertexAi {
-			privateData.Key = relayInfo.ChannelMeta.ApiKey
+			// 任务数据会持久化，密钥加密后保存
+			if key, err := common.EncryptSecret(relayInfo.ChannelMeta.ApiKey); err == nil {
+				privateData.Key = key
+			}
 		}
 		if relayInfo.UpstreamModelName != "" {
 			properties.UpstreamModelName = relayInfo.UpstreamModelName
@@ -446,6 +460,23 @@ type TaskQuotaUsage struct {
 	Count float64 `json:"count"`
 }
 
+type TaskQueueDepth struct {
+	Platform string `json:"platform"`
+	Status   string `json:"status"`
+	Count    int64  `json:"count"`
+}
+
+// CountUnfinishedTasks returns unfinished task counts grouped by platform and status
+func CountUnfinishedTasks() ([]TaskQueueDepth, error) {
+	var depths []TaskQueueDepth
+	err := DB.Model(&Task{}).
+		Select("platform, status, count(*) as count").
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Group("platform, status").
+		Scan(&depths).Error
+	return depths, err
+}
+
 // TaskCountAllTasks returns total tasks that match the given query params (admin usage)
 func TaskCountAllTasks(queryParams SyncTaskQueryParams) int64 {
 	var total int64
@@ -26,6 +26,7 @@ func TestMain(m *testing.M) {
 	common.RedisEnabled = false
 	common.BatchUpdateEnabled = false
 	common.LogConsumeEnabled = true
+	initCol()
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -43,6 +44,14 @@ func TestMain(m *testing.M) {
 		&SubscriptionPlan{},
 		&SubscriptionOrder{},
 		&UserSubscription{},
+		&Option{},
+		&OptionRevision{},
+		&Ability{},
+		&Vendor{},
+		&Model{},
+		&PrefillGroup{},
+		&CustomOAuthProvider{},
+		&TopUpRefund{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -62,6 +71,14 @@ func truncateTables(t *testing.T) {
 		DB.Exec("DELETE FROM subscription_orders")
 		DB.Exec("DELETE FROM subscription_plans")
 		DB.Exec("DELETE FROM user_subscriptions")
+		DB.Exec("DELETE FROM options")
+		DB.Exec("DELETE FROM option_revisions")
+		DB.Exec("DELETE FROM abilities")
+		DB.Exec("DELETE FROM vendors")
+		DB.Exec("DELETE FROM models")
+		DB.Exec("DELETE FROM prefill_groups")
+		DB.Exec("DELETE FROM custom_oauth_providers")
+		DB.Exec("DELETE FROM top_up_refunds")
 	})
 }
 
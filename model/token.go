@@ -4,13 +4,25 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/samber/hot"
 	"gorm.io/gorm"
 )
 
+// tokenResumeCheckInterval 同一用户被暂停的令牌检查余额的最小间隔，避免被暂停令牌的每个请求都查询余额
+const tokenResumeCheckInterval = 10 * time.Second
+
+var tokenResumeChecks = hot.NewHotCache[int, struct{}](hot.LRU, 10000).
+	WithTTL(tokenResumeCheckInterval).
+	Build()
+
+// TokenContextTruncationMiddleOut 从中间向两端删除整轮对话，保留开头与最近的消息
+const TokenContextTruncationMiddleOut = "middle-out"
+
 type Token struct {
 	Id                 int            `json:"id"`
 	UserId             int            `json:"user_id" gorm:"index"`
@@ -27,7 +39,17 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
+	CrossGroupRetry    bool           `json:"cross_group_retry"`                                     // 跨分组重试，仅auto分组有效
+	ResponseCache      bool           `json:"response_cache"`                                        // 启用响应缓存
+	PIIRedaction       bool           `json:"pii_redaction"`                                         // 请求发往上游前脱敏个人信息
+	ContextTruncation  string         `json:"context_truncation" gorm:"type:varchar(16);default:''"` // 超出上下文长度时的截断策略：空（不截断）/middle-out
+	OrganizationId     int            `json:"organization_id" gorm:"index;default:0"`                // 组织令牌，消费组织钱包
+	BudgetPeriod       string         `json:"budget_period" gorm:"type:varchar(16);default:'never'"` // 周期预算：never/daily/weekly/monthly
+	BudgetQuota        int            `json:"budget_quota" gorm:"default:0"`                         // 每个周期可消费的额度，0 表示不限制
+	RpmLimit           int            `json:"rpm_limit" gorm:"default:0"`                            // 每分钟请求数上限，0 表示不限制
+	TpmLimit           int            `json:"tpm_limit" gorm:"default:0"`                            // 每分钟 token 数上限，0 表示不限制
+	BudgetUsed         int            `json:"budget_used" gorm:"default:0"`                          // 当前预算周期已用额度
+	BudgetPeriodStart  int64          `json:"budget_period_start" gorm:"bigint;default:0"`           // 当前预算周期的起点，周期变化时用量从 0 开始
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
 }
 
@@ -56,6 +78,65 @@ func (token *Token) GetMaskedKey() string {
 	return MaskTokenKey(token.Key)
 }
 
+// NormalizeTokenBudgetPeriod 令牌预算周期与订阅重置周期取值一致，但不支持自定义周期
+func NormalizeTokenBudgetPeriod(period string) string {
+	switch strings.TrimSpace(period) {
+	case SubscriptionResetDaily, SubscriptionResetWeekly, SubscriptionResetMonthly:
+		return strings.TrimSpace(period)
+	default:
+		return SubscriptionResetNever
+	}
+}
+
+// NormalizeTokenContextTruncation 未知的截断策略视为不截断
+func NormalizeTokenContextTruncation(strategy string) string {
+	if strings.TrimSpace(strategy) == TokenContextTruncationMiddleOut {
+		return TokenContextTruncationMiddleOut
+	}
+	return ""
+}
+
+// HasBudget 令牌是否设置了周期预算
+func (token *Token) HasBudget() bool {
+	return token.BudgetQuota > 0 && NormalizeTokenBudgetPeriod(token.BudgetPeriod) != SubscriptionResetNever
+}
+
+// GetTokenBudgetUsed 返回令牌在 periodStart 开始的预算周期内的用量
+func GetTokenBudgetUsed(tokenId int, periodStart int64) (int, error) {
+	var token Token
+	if err := DB.Select("budget_used", "budget_period_start").Where("id = ?", tokenId).First(&token).Error; err != nil {
+		return 0, err
+	}
+	if token.BudgetPeriodStart != periodStart {
+		return 0, nil
+	}
+	return token.BudgetUsed, nil
+}
+
+// ReserveTokenBudget 以预算上限为条件原子占用 amount，进入新周期时用量从 0 开始；超出预算时返回 false 且不修改
+func ReserveTokenBudget(tokenId int, periodStart int64, amount int, budget int) (bool, error) {
+	// 按书写顺序赋值的数据库中 budget_used 需先于 budget_period_start 计算
+	result := DB.Exec("UPDATE tokens SET budget_used = CASE WHEN budget_period_start = ? THEN budget_used + ? ELSE ? END, budget_period_start = ? "+
+		"WHERE id = ? AND ((budget_period_start = ? AND budget_used + ? <= ?) OR (budget_period_start <> ? AND ? <= ?))",
+		periodStart, amount, amount, periodStart,
+		tokenId, periodStart, amount, budget, periodStart, amount, budget)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdjustTokenBudget 结算或退款时调整 periodStart 周期的用量，不做上限检查；令牌已进入更新的周期时不再调整
+func AdjustTokenBudget(tokenId int, periodStart int64, delta int) error {
+	if delta < 0 {
+		return DB.Model(&Token{}).Where("id = ? AND budget_period_start = ?", tokenId, periodStart).
+			Update("budget_used", gorm.Expr("budget_used + ?", delta)).Error
+	}
+	return DB.Exec("UPDATE tokens SET budget_used = CASE WHEN budget_period_start = ? THEN budget_used + ? ELSE ? END, budget_period_start = ? "+
+		"WHERE id = ? AND budget_period_start <= ?",
+		periodStart, delta, delta, periodStart, tokenId, periodStart).Error
+}
+
 func (token *Token) GetIpLimits() []string {
 	// delete empty spaces
 	//split with \n
@@ -191,6 +272,9 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	}
 	token, err = GetTokenByKey(key, false)
 	if err == nil {
+		if token.Status == common.TokenStatusSuspended && resumeSuspendedTokens(token.UserId) {
+			token.Status = common.TokenStatusEnabled
+		}
 		if token.Status == common.TokenStatusExhausted ||
 			token.Status == common.TokenStatusExpired ||
 			token.Status != common.TokenStatusEnabled {
@@ -225,6 +309,42 @@ func ValidateUserToken(key string) (token *Token, err error) {
 	return nil, fmt.Errorf("%w: %v", ErrDatabase, err)
 }
 
+// SuspendUserTokens 暂停用户所有启用中的令牌，用于退款扣回后余额为负的用户
+func SuspendUserTokens(userId int) (int, error) {
+	return updateUserTokensStatus(userId, common.TokenStatusEnabled, common.TokenStatusSuspended)
+}
+
+// resumeSuspendedTokens 用户余额不再为负时重新启用被暂停的令牌，每个用户在检查间隔内只检查一次
+func resumeSuspendedTokens(userId int) bool {
+	if _, checked, _ := tokenResumeChecks.Get(userId); checked {
+		return false
+	}
+	tokenResumeChecks.Set(userId, struct{}{})
+	quota, err := GetUserQuota(userId, false)
+	if err != nil || quota < 0 {
+		return false
+	}
+	if _, err := updateUserTokensStatus(userId, common.TokenStatusSuspended, common.TokenStatusEnabled); err != nil {
+		common.SysLog("failed to resume suspended tokens: " + err.Error())
+		return false
+	}
+	return true
+}
+
+func updateUserTokensStatus(userId int, from int, to int) (int, error) {
+	var tokens []*Token
+	if err := DB.Where("user_id = ? AND status = ?", userId, from).Find(&tokens).Error; err != nil {
+		return 0, err
+	}
+	for _, token := range tokens {
+		token.Status = to
+		if err := token.SelectUpdate(); err != nil {
+			return 0, err
+		}
+	}
+	return len(tokens), nil
+}
+
 func GetTokenByIds(id int, userId int) (*Token, error) {
 	if id == 0 || userId == 0 {
 		return nil, errors.New("id 或 userId 为空！")
@@ -290,12 +410,15 @@ func (token *Token) Update() (err error) {
 				err := cacheSetToken(*token)
 				if err != nil {
 					common.SysLog("failed to update token cache: " + err.Error())
+					return
 				}
+				PublishCacheInvalidation(CacheInvalidationToken, common.GenerateHMAC(token.Key), 0)
 			})
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "response_cache", "pii_redaction", "context_truncation",
+		"budget_period", "budget_quota", "rpm_limit", "tpm_limit").Updates(token).Error
 	return err
 }
 
@@ -306,7 +429,9 @@ func (token *Token) SelectUpdate() (err error) {
 				err := cacheSetToken(*token)
 				if err != nil {
 					common.SysLog("failed to update token cache: " + err.Error())
+					return
 				}
+				PublishCacheInvalidation(CacheInvalidationToken, common.GenerateHMAC(token.Key), 0)
 			})
 		}
 	}()
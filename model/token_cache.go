@@ -24,6 +24,7 @@ func cacheDeleteToken(key string) error {
 	if err != nil {
 		return err
 	}
+	PublishCacheInvalidation(CacheInvalidationToken, key, 0)
 	return nil
 }
 
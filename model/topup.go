@@ -22,6 +22,14 @@ type TopUp struct {
 	CreateTime      int64   `json:"create_time"`
 	CompleteTime    int64   `json:"complete_time"`
 	Status          string  `json:"status"`
+	// PaymentId 支付网关侧的支付 ID（Stripe PaymentIntent、Creem 订单），用于匹配退款与争议回调
+	PaymentId   string  `json:"payment_id" gorm:"type:varchar(255);index;default:''"`
+	RefundMoney float64 `json:"refund_money"`
+	// CreditedQuota 充值到账时实际增加的额度，退款按此扣回，不受之后调整 QuotaPerUnit 影响
+	CreditedQuota int64 `json:"credited_quota"`
+	// RefundQuota 当前已扣回的额度，争议处理中为全部到账额度
+	RefundQuota int64 `json:"refund_quota"`
+	RefundTime  int64 `json:"refund_time"`
 }
 
 const (
@@ -77,6 +85,19 @@ func GetTopUpByTradeNo(tradeNo string) *TopUp {
 	return topUp
 }
 
+// GetTopUpByPaymentId 按支付网关侧的支付 ID 查找订单
+func GetTopUpByPaymentId(paymentProvider string, paymentId string) *TopUp {
+	if paymentId == "" {
+		return nil
+	}
+	var topUp *TopUp
+	err := DB.Where("payment_provider = ? AND payment_id = ?", paymentProvider, paymentId).First(&topUp).Error
+	if err != nil {
+		return nil
+	}
+	return topUp
+}
+
 func UpdatePendingTopUpStatus(tradeNo string, expectedPaymentProvider string, targetStatus string) error {
 	if tradeNo == "" {
 		return errors.New("未提供支付单号")
@@ -104,7 +125,7 @@ func UpdatePendingTopUpStatus(tradeNo string, expectedPaymentProvider string, ta
 	})
 }
 
-func Recharge(referenceId string, customerId string, callerIp string) (err error) {
+func Recharge(referenceId string, customerId string, paymentId string, callerIp string) (err error) {
 	if referenceId == "" {
 		return errors.New("未提供支付单号")
 	}
@@ -131,14 +152,16 @@ func Recharge(referenceId string, customerId string, callerIp string) (err error
 			return errors.New("充值订单状态错误")
 		}
 
+		quota = topUp.Money * common.QuotaPerUnit
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.PaymentId = paymentId
+		topUp.CreditedQuota = decimal.NewFromFloat(topUp.Money).Mul(decimal.NewFromFloat(common.QuotaPerUnit)).IntPart()
 		err = tx.Save(topUp).Error
 		if err != nil {
 			return err
 		}
 
-		quota = topUp.Money * common.QuotaPerUnit
 		err = tx.Model(&User{}).Where("id = ?", topUp.UserId).Updates(map[string]interface{}{"stripe_customer": customerId, "quota": gorm.Expr("quota + ?", quota)}).Error
 		if err != nil {
 			return err
@@ -364,6 +387,7 @@ func ManualCompleteTopUp(tradeNo string, callerIp string) error {
 		// 标记完成
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.CreditedQuota = int64(quotaToAdd)
 		if err := tx.Save(topUp).Error; err != nil {
 			return err
 		}
@@ -387,7 +411,7 @@ func ManualCompleteTopUp(tradeNo string, callerIp string) error {
 	RecordTopupLog(userId, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney), callerIp, paymentMethod, "admin")
 	return nil
 }
-func RechargeCreem(referenceId string, customerEmail string, customerName string, callerIp string) (err error) {
+func RechargeCreem(referenceId string, customerEmail string, customerName string, paymentId string, callerIp string) (err error) {
 	if referenceId == "" {
 		return errors.New("未提供支付单号")
 	}
@@ -414,16 +438,17 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 			return errors.New("充值订单状态错误")
 		}
 
+		// Creem 直接使用 Amount 作为充值额度（整数）
+		quota = topUp.Amount
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.PaymentId = paymentId
+		topUp.CreditedQuota = quota
 		err = tx.Save(topUp).Error
 		if err != nil {
 			return err
 		}
 
-		// Creem 直接使用 Amount 作为充值额度（整数）
-		quota = topUp.Amount
-
 		// 构建更新字段，优先使用邮箱，如果邮箱为空则使用用户名
 		updateFields := map[string]interface{}{
 			"quota": gorm.Expr("quota + ?", quota),
@@ -502,6 +527,7 @@ func RechargeWaffo(tradeNo string, callerIp string) (err error) {
 
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.CreditedQuota = int64(quotaToAdd)
 		if err := tx.Save(topUp).Error; err != nil {
 			return err
 		}
@@ -563,6 +589,7 @@ func RechargeWaffoPancake(tradeNo string) (err error) {
 
 		topUp.CompleteTime = common.GetTimestamp()
 		topUp.Status = common.TopUpStatusSuccess
+		topUp.CreditedQuota = int64(quotaToAdd)
 		if err := tx.Save(topUp).Error; err != nil {
 			return err
 		}
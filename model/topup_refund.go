@@ -0,0 +1,288 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+const (
+	TopUpRefundTypeRefund      = "refund"
+	TopUpRefundTypeDispute     = "dispute"
+	TopUpRefundTypeDisputeWon  = "dispute_won"
+	TopUpRefundTypeDisputeLost = "dispute_lost"
+)
+
+const TopUpRefundSourceAdmin = "admin"
+
+var (
+	ErrTopUpRefundProcessed     = errors.New("topup refund already processed")
+	ErrTopUpRefundExceedsAmount = errors.New("退款金额超过可退金额")
+)
+
+// TopUpRefund 充值订单的一次退款或争议处理记录，Quota 为正表示扣回，为负表示返还
+type TopUpRefund struct {
+	Id      int    `json:"id"`
+	TopUpId int    `json:"topup_id" gorm:"index"`
+	UserId  int    `json:"user_id" gorm:"index"`
+	TradeNo string `json:"trade_no" gorm:"type:varchar(255);index"`
+	Type    string `json:"type" gorm:"type:varchar(16)"`
+	Source  string `json:"source" gorm:"type:varchar(32)"`
+	// ExternalId 网关事件或退款 ID，保证同一回调只处理一次
+	ExternalId string  `json:"external_id" gorm:"type:varchar(255);uniqueIndex"`
+	Money      float64 `json:"money"`
+	Quota      int64   `json:"quota"`
+	Reason     string  `json:"reason" gorm:"type:varchar(255)"`
+	OperatorId int     `json:"operator_id"`
+	CreatedAt  int64   `json:"created_at" gorm:"bigint"`
+}
+
+// TopUpRefundParams 退款或争议的处理参数
+type TopUpRefundParams struct {
+	TradeNo string
+	// PaymentProvider 校验订单的支付网关，管理员操作为空
+	PaymentProvider string
+	Type            string
+	Source          string
+	ExternalId      string
+	// Money 本次退款金额，TotalMoney 为网关给出的累计退款金额，大于 0 时忽略 Money；均为 0 时退还剩余金额
+	Money      float64
+	TotalMoney float64
+	Reason     string
+	OperatorId int
+	CallerIp   string
+}
+
+// topUpCreditedQuota 返回订单到账的额度。优先使用充值时记录的额度，
+// 之前的订单没有记录，按各支付网关充值时的计算方式以当前 QuotaPerUnit 推算
+func topUpCreditedQuota(topUp *TopUp) int64 {
+	if topUp.CreditedQuota > 0 {
+		return topUp.CreditedQuota
+	}
+	dQuotaPerUnit := decimal.NewFromFloat(common.QuotaPerUnit)
+	switch topUp.PaymentProvider {
+	case PaymentProviderStripe:
+		return decimal.NewFromFloat(topUp.Money).Mul(dQuotaPerUnit).IntPart()
+	case PaymentProviderCreem:
+		return topUp.Amount
+	default:
+		return decimal.NewFromInt(topUp.Amount).Mul(dQuotaPerUnit).IntPart()
+	}
+}
+
+// topUpRefundTargetQuota 返回订单当前应扣回的额度：争议处理中扣回全部，否则按退款金额占比扣回
+func topUpRefundTargetQuota(topUp *TopUp) int64 {
+	credited := topUpCreditedQuota(topUp)
+	if topUp.Status == common.TopUpStatusDisputed || topUp.Status == common.TopUpStatusRefunded {
+		return credited
+	}
+	if topUp.RefundMoney <= 0 || topUp.Money <= 0 {
+		return 0
+	}
+	return decimal.NewFromInt(credited).Mul(decimal.NewFromFloat(topUp.RefundMoney)).Div(decimal.NewFromFloat(topUp.Money)).IntPart()
+}
+
+func topUpRefundedStatus(topUp *TopUp) string {
+	switch {
+	case topUp.RefundMoney <= 0:
+		return common.TopUpStatusSuccess
+	case topUp.RefundMoney >= topUp.Money:
+		return common.TopUpStatusRefunded
+	default:
+		return common.TopUpStatusPartiallyRefunded
+	}
+}
+
+func isTopUpRefundable(status string) bool {
+	switch status {
+	case common.TopUpStatusSuccess, common.TopUpStatusPartiallyRefunded, common.TopUpStatusRefunded, common.TopUpStatusDisputed:
+		return true
+	}
+	return false
+}
+
+// RefundTopUp 处理退款或争议：更新订单状态，按到账额度扣回或返还用户额度，允许余额为负。
+// 扣回后余额为负时暂停用户的令牌，每次处理都会写入充值日志
+func RefundTopUp(params TopUpRefundParams) (*TopUpRefund, error) {
+	if params.TradeNo == "" {
+		return nil, errors.New("未提供订单号")
+	}
+
+	refCol := "`trade_no`"
+	if common.UsingPostgreSQL {
+		refCol = `"trade_no"`
+	}
+
+	topUp := &TopUp{}
+	refund := &TopUpRefund{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").Where(refCol+" = ?", params.TradeNo).First(topUp).Error; err != nil {
+			return ErrTopUpNotFound
+		}
+		if params.PaymentProvider != "" && topUp.PaymentProvider != params.PaymentProvider {
+			return ErrPaymentMethodMismatch
+		}
+		if params.ExternalId != "" {
+			var count int64
+			if err := tx.Model(&TopUpRefund{}).Where("external_id = ?", params.ExternalId).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrTopUpRefundProcessed
+			}
+		}
+		if !isTopUpRefundable(topUp.Status) {
+			return ErrTopUpStatusInvalid
+		}
+
+		money := 0.0
+		switch params.Type {
+		case TopUpRefundTypeRefund:
+			if topUp.Status == common.TopUpStatusDisputed {
+				return ErrTopUpStatusInvalid
+			}
+			remaining := decimal.NewFromFloat(topUp.Money).Sub(decimal.NewFromFloat(topUp.RefundMoney))
+			dMoney := decimal.NewFromFloat(params.Money)
+			if params.TotalMoney > 0 {
+				dMoney = decimal.NewFromFloat(params.TotalMoney).Sub(decimal.NewFromFloat(topUp.RefundMoney))
+			} else if params.Money == 0 {
+				dMoney = remaining
+			}
+			if dMoney.GreaterThan(remaining) {
+				if params.Source == TopUpRefundSourceAdmin {
+					return ErrTopUpRefundExceedsAmount
+				}
+				// 网关累计金额可能包含手续费等差额，只处理到订单金额为止
+				dMoney = remaining
+			}
+			if !dMoney.IsPositive() {
+				return ErrTopUpRefundProcessed
+			}
+			money = dMoney.InexactFloat64()
+			topUp.RefundMoney = decimal.NewFromFloat(topUp.RefundMoney).Add(dMoney).InexactFloat64()
+			topUp.Status = topUpRefundedStatus(topUp)
+		case TopUpRefundTypeDispute:
+			if topUp.Status == common.TopUpStatusDisputed {
+				return ErrTopUpRefundProcessed
+			}
+			topUp.Status = common.TopUpStatusDisputed
+		case TopUpRefundTypeDisputeWon:
+			if topUp.Status != common.TopUpStatusDisputed {
+				return ErrTopUpRefundProcessed
+			}
+			topUp.Status = topUpRefundedStatus(topUp)
+		case TopUpRefundTypeDisputeLost:
+			if topUp.Status != common.TopUpStatusDisputed {
+				return ErrTopUpRefundProcessed
+			}
+			money = topUp.Money - topUp.RefundMoney
+			topUp.RefundMoney = topUp.Money
+			topUp.Status = common.TopUpStatusRefunded
+		default:
+			return errors.New("未知的退款类型")
+		}
+
+		quota := topUpRefundTargetQuota(topUp) - topUp.RefundQuota
+		topUp.RefundQuota += quota
+		topUp.RefundTime = common.GetTimestamp()
+		if err := tx.Save(topUp).Error; err != nil {
+			return err
+		}
+		if quota != 0 {
+			if err := tx.Model(&User{}).Where("id = ?", topUp.UserId).Update("quota", gorm.Expr("quota - ?", quota)).Error; err != nil {
+				return err
+			}
+		}
+
+		externalId := params.ExternalId
+		if externalId == "" {
+			externalId = fmt.Sprintf("%s:%s", params.Source, common.GetUUID())
+		}
+		*refund = TopUpRefund{
+			TopUpId:    topUp.Id,
+			UserId:     topUp.UserId,
+			TradeNo:    topUp.TradeNo,
+			Type:       params.Type,
+			Source:     params.Source,
+			ExternalId: externalId,
+			Money:      money,
+			Quota:      quota,
+			Reason:     params.Reason,
+			OperatorId: params.OperatorId,
+			CreatedAt:  common.GetTimestamp(),
+		}
+		return tx.Create(refund).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := invalidateUserCache(topUp.UserId); err != nil {
+		common.SysLog("failed to invalidate user cache: " + err.Error())
+	}
+	RecordTopupLog(topUp.UserId, topUpRefundLogContent(topUp, refund), params.CallerIp, topUp.PaymentMethod, params.Source)
+
+	if refund.Quota > 0 {
+		suspendTokensIfNegative(topUp.UserId, params.CallerIp, topUp.PaymentMethod, params.Source)
+	} else if refund.Quota < 0 {
+		// 返还额度后下次使用令牌时立即检查是否可以恢复
+		tokenResumeChecks.Delete(topUp.UserId)
+	}
+	return refund, nil
+}
+
+func topUpRefundLogContent(topUp *TopUp, refund *TopUpRefund) string {
+	var action string
+	switch refund.Type {
+	case TopUpRefundTypeRefund:
+		action = fmt.Sprintf("充值订单退款 %.2f", refund.Money)
+	case TopUpRefundTypeDispute:
+		action = "充值订单发生支付争议"
+	case TopUpRefundTypeDisputeWon:
+		action = "充值订单争议已撤销"
+	case TopUpRefundTypeDisputeLost:
+		action = "充值订单争议败诉"
+	}
+	content := fmt.Sprintf("%s，订单号: %s", action, topUp.TradeNo)
+	if refund.Quota > 0 {
+		content += fmt.Sprintf("，扣回额度: %v", logger.FormatQuota(int(refund.Quota)))
+	} else if refund.Quota < 0 {
+		content += fmt.Sprintf("，返还额度: %v", logger.FormatQuota(int(-refund.Quota)))
+	}
+	if refund.Reason != "" {
+		content += "，原因: " + refund.Reason
+	}
+	return content
+}
+
+// suspendTokensIfNegative 扣回后余额为负时暂停用户的令牌，余额恢复后令牌在下次使用时自动启用
+func suspendTokensIfNegative(userId int, callerIp string, paymentMethod string, source string) {
+	quota, err := GetUserQuota(userId, true)
+	if err != nil {
+		common.SysError("failed to get user quota after refund: " + err.Error())
+		return
+	}
+	if quota >= 0 {
+		return
+	}
+	count, err := SuspendUserTokens(userId)
+	if err != nil {
+		common.SysError("failed to suspend user tokens after refund: " + err.Error())
+		return
+	}
+	if count > 0 {
+		RecordTopupLog(userId, fmt.Sprintf("退款扣回后账户余额为 %v，已暂停 %d 个令牌", logger.FormatQuota(quota), count), callerIp, paymentMethod, source)
+	}
+}
+
+// GetTopUpRefunds 返回订单的退款与争议记录
+func GetTopUpRefunds(tradeNo string) ([]*TopUpRefund, error) {
+	var refunds []*TopUpRefund
+	err := DB.Where("trade_no = ?", tradeNo).Order("id asc").Find(&refunds).Error
+	return refunds, err
+}
@@ -0,0 +1,145 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func insertPaidTopUpForRefundTest(t *testing.T, tradeNo string, userId int, provider string) *TopUp {
+	t.Helper()
+	topUp := &TopUp{
+		UserId:          userId,
+		Amount:          10,
+		Money:           10,
+		TradeNo:         tradeNo,
+		PaymentMethod:   provider,
+		PaymentProvider: provider,
+		PaymentId:       "pi_" + tradeNo,
+		Status:          common.TopUpStatusSuccess,
+	}
+	require.NoError(t, topUp.Insert())
+	return topUp
+}
+
+func getUserQuotaForRefundTest(t *testing.T, userId int) int {
+	t.Helper()
+	quota, err := GetUserQuota(userId, true)
+	require.NoError(t, err)
+	return quota
+}
+
+func TestRefundTopUp_PartialThenCumulative(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 801, 0)
+	insertPaidTopUpForRefundTest(t, "refund-partial", 801, PaymentProviderStripe)
+	credited := int(topUpCreditedQuota(&TopUp{PaymentProvider: PaymentProviderStripe, Money: 10}))
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", 801).Update("quota", credited).Error)
+
+	refund, err := RefundTopUp(TopUpRefundParams{
+		TradeNo: "refund-partial", Type: TopUpRefundTypeRefund, Source: TopUpRefundSourceAdmin, Money: 2.5,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(credited/4), refund.Quota)
+	require.Equal(t, credited-credited/4, getUserQuotaForRefundTest(t, 801))
+	require.Equal(t, common.TopUpStatusPartiallyRefunded, GetTopUpByTradeNo("refund-partial").Status)
+
+	_, err = RefundTopUp(TopUpRefundParams{
+		TradeNo: "refund-partial", Type: TopUpRefundTypeRefund, Source: TopUpRefundSourceAdmin, Money: 8,
+	})
+	require.ErrorIs(t, err, ErrTopUpRefundExceedsAmount)
+
+	// 网关给出累计退款金额，已登记的部分不会重复扣回
+	params := TopUpRefundParams{
+		TradeNo: "refund-partial", PaymentProvider: PaymentProviderStripe, Type: TopUpRefundTypeRefund,
+		Source: PaymentProviderStripe, ExternalId: "evt_full", TotalMoney: 10,
+	}
+	refund, err = RefundTopUp(params)
+	require.NoError(t, err)
+	require.InDelta(t, 7.5, refund.Money, 0.0001)
+	require.Zero(t, getUserQuotaForRefundTest(t, 801))
+
+	topUp := GetTopUpByTradeNo("refund-partial")
+	require.Equal(t, common.TopUpStatusRefunded, topUp.Status)
+	require.Equal(t, int64(credited), topUp.RefundQuota)
+
+	_, err = RefundTopUp(params)
+	require.ErrorIs(t, err, ErrTopUpRefundProcessed)
+
+	refunds, err := GetTopUpRefunds("refund-partial")
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+	var logs int64
+	require.NoError(t, LOG_DB.Model(&Log{}).Where("user_id = ? AND type = ?", 801, LogTypeTopup).Count(&logs).Error)
+	require.Equal(t, int64(2), logs)
+}
+
+func TestRefundTopUp_DisputeSuspendsAndRestores(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 802, 10)
+	insertPaidTopUpForRefundTest(t, "refund-dispute", 802, PaymentProviderCreem)
+	token := &Token{UserId: 802, Key: "refund-dispute-token", Name: "t", Status: common.TokenStatusEnabled, ExpiredTime: -1, UnlimitedQuota: true}
+	require.NoError(t, token.Insert())
+
+	// 已消耗部分额度，争议扣回全部到账额度后余额为负
+	require.NoError(t, DB.Model(&User{}).Where("id = ?", 802).Update("quota", 4).Error)
+	params := TopUpRefundParams{
+		TradeNo: "refund-dispute", PaymentProvider: PaymentProviderCreem, Type: TopUpRefundTypeDispute,
+		Source: PaymentProviderCreem, ExternalId: "dp_1",
+	}
+	refund, err := RefundTopUp(params)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), refund.Quota)
+	require.Equal(t, -6, getUserQuotaForRefundTest(t, 802))
+	require.Equal(t, common.TopUpStatusDisputed, GetTopUpByTradeNo("refund-dispute").Status)
+
+	_, err = ValidateUserToken("refund-dispute-token")
+	require.ErrorIs(t, err, ErrTokenInvalid)
+	stored, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	require.Equal(t, common.TokenStatusSuspended, stored.Status)
+
+	params.Type = TopUpRefundTypeDisputeWon
+	params.ExternalId = "dp_1_won"
+	refund, err = RefundTopUp(params)
+	require.NoError(t, err)
+	require.Equal(t, int64(-10), refund.Quota)
+	require.Equal(t, 4, getUserQuotaForRefundTest(t, 802))
+	require.Equal(t, common.TopUpStatusSuccess, GetTopUpByTradeNo("refund-dispute").Status)
+
+	// 余额恢复后令牌在下次使用时自动启用
+	validated, err := ValidateUserToken("refund-dispute-token")
+	require.NoError(t, err)
+	require.Equal(t, common.TokenStatusEnabled, validated.Status)
+}
+
+func TestRefundTopUp_RejectsPendingOrder(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 803, 0)
+	insertTopUpForPaymentGuardTest(t, "refund-pending", 803, PaymentProviderStripe)
+
+	_, err := RefundTopUp(TopUpRefundParams{TradeNo: "refund-pending", Type: TopUpRefundTypeRefund, Source: TopUpRefundSourceAdmin})
+	require.ErrorIs(t, err, ErrTopUpStatusInvalid)
+	_, err = RefundTopUp(TopUpRefundParams{TradeNo: "refund-missing", Type: TopUpRefundTypeRefund, Source: TopUpRefundSourceAdmin})
+	require.ErrorIs(t, err, ErrTopUpNotFound)
+}
+
+func TestRefundTopUp_UsesCreditedQuotaAfterUnitChange(t *testing.T) {
+	truncateTables(t)
+	insertUserForPaymentGuardTest(t, 804, 0)
+	insertTopUpForPaymentGuardTest(t, "refund-credited", 804, PaymentProviderWaffo)
+	require.NoError(t, RechargeWaffo("refund-credited", ""))
+	credited := getUserQuotaForRefundTest(t, 804)
+	require.Equal(t, int64(credited), GetTopUpByTradeNo("refund-credited").CreditedQuota)
+
+	// 充值后调整 QuotaPerUnit 不影响扣回的额度
+	originalQuotaPerUnit := common.QuotaPerUnit
+	common.QuotaPerUnit = originalQuotaPerUnit * 2
+	t.Cleanup(func() { common.QuotaPerUnit = originalQuotaPerUnit })
+
+	refund, err := RefundTopUp(TopUpRefundParams{TradeNo: "refund-credited", Type: TopUpRefundTypeRefund, Source: TopUpRefundSourceAdmin})
+	require.NoError(t, err)
+	require.Equal(t, int64(credited), refund.Quota)
+	require.Zero(t, getUserQuotaForRefundTest(t, 804))
+}
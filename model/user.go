@@ -90,7 +90,14 @@ func (user *User) GetSetting() dto.UserSetting {
 	return setting
 }
 
+// SetSetting webhook 密钥以密文保存
 func (user *User) SetSetting(setting dto.UserSetting) {
+	webhookSecret, err := common.EncryptSecret(setting.WebhookSecret)
+	if err != nil {
+		common.SysLog("failed to encrypt webhook secret: " + err.Error())
+		return
+	}
+	setting.WebhookSecret = webhookSecret
 	settingBytes, err := json.Marshal(setting)
 	if err != nil {
 		common.SysLog("failed to marshal setting: " + err.Error())
@@ -99,6 +106,25 @@ func (user *User) SetSetting(setting dto.UserSetting) {
 	user.Setting = string(settingBytes)
 }
 
+// GetSettingForOwner 返回给用户本人的设置，webhook 密钥解密后返回以便在个人设置中编辑
+func (user *User) GetSettingForOwner() string {
+	setting := user.GetSetting()
+	if !common.IsEncryptedSecret(setting.WebhookSecret) {
+		return user.Setting
+	}
+	webhookSecret, err := common.DecryptSecret(setting.WebhookSecret)
+	if err != nil {
+		common.SysLog("failed to decrypt webhook secret: " + err.Error())
+		webhookSecret = ""
+	}
+	setting.WebhookSecret = webhookSecret
+	settingBytes, err := json.Marshal(setting)
+	if err != nil {
+		return user.Setting
+	}
+	return string(settingBytes)
+}
+
 // 根据用户角色生成默认的边栏配置
 func generateDefaultSidebarConfigForRole(userRole int) string {
 	defaultConfig := map[string]interface{}{}
@@ -398,6 +424,15 @@ func GetUserById(id int, selectAll bool) (*User, error) {
 	return &user, err
 }
 
+func GetUserIdByUsername(username string) (int, error) {
+	if username == "" {
+		return 0, errors.New("username 为空！")
+	}
+	var user User
+	err := DB.Select("id").First(&user, "username = ?", username).Error
+	return user.Id, err
+}
+
 func GetUserIdByAffCode(affCode string) (int, error) {
 	if affCode == "" {
 		return 0, errors.New("affCode 为空！")
@@ -601,7 +636,7 @@ func (user *User) Update(updatePassword bool) error {
 	}
 
 	// Update cache
-	return updateUserCache(*user)
+	return cacheUserUpdated(*user)
 }
 
 func (user *User) Edit(updatePassword bool) error {
@@ -630,7 +665,7 @@ func (user *User) Edit(updatePassword bool) error {
 	}
 
 	// Update cache
-	return updateUserCache(*user)
+	return cacheUserUpdated(*user)
 }
 
 func (user *User) ClearBinding(bindingType string) error {
@@ -661,7 +696,7 @@ func (user *User) ClearBinding(bindingType string) error {
 		return err
 	}
 
-	return updateUserCache(*user)
+	return cacheUserUpdated(*user)
 }
 
 func (user *User) Delete() error {
@@ -2,6 +2,7 @@ package model
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
@@ -54,7 +55,11 @@ func invalidateUserCache(userId int) error {
 	if !common.RedisEnabled {
 		return nil
 	}
-	return common.RedisDelKey(getUserCacheKey(userId))
+	if err := common.RedisDelKey(getUserCacheKey(userId)); err != nil {
+		return err
+	}
+	PublishCacheInvalidation(CacheInvalidationUser, strconv.Itoa(userId), 0)
+	return nil
 }
 
 // InvalidateUserCache is the exported version of invalidateUserCache.
@@ -76,6 +81,15 @@ func updateUserCache(user User) error {
 	)
 }
 
+// cacheUserUpdated 用户写入数据库后刷新缓存并通知其他节点
+func cacheUserUpdated(user User) error {
+	if err := updateUserCache(user); err != nil {
+		return err
+	}
+	PublishCacheInvalidation(CacheInvalidationUser, strconv.Itoa(user.Id), 0)
+	return nil
+}
+
 // GetUserCache gets complete user cache from hash
 func GetUserCache(userId int) (userCache *UserBase, err error) {
 	var user *User
@@ -110,9 +110,15 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 	var req *http.Request
 	var err error
 
+	clientSecret, err := p.config.GetClientSecret()
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("[OAuth-Generic-%s] ExchangeToken error: decrypt client secret failed: %s", p.config.Slug, err.Error()))
+		return nil, err
+	}
+
 	if authStyle == AuthStyleInParams {
 		values.Set("client_id", p.config.ClientId)
-		values.Set("client_secret", p.config.ClientSecret)
+		values.Set("client_secret", clientSecret)
 	}
 
 	req, err = http.NewRequestWithContext(ctx, "POST", p.config.TokenEndpoint, strings.NewReader(values.Encode()))
@@ -124,7 +130,7 @@ func (p *GenericOAuthProvider) ExchangeToken(ctx context.Context, code string, c
 
 	if authStyle == AuthStyleInHeader {
 		// Basic Auth
-		credentials := base64.StdEncoding.EncodeToString([]byte(p.config.ClientId + ":" + p.config.ClientSecret))
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.config.ClientId + ":" + clientSecret))
 		req.Header.Set("Authorization", "Basic "+credentials)
 	}
 
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -40,16 +41,34 @@ type HybridCache[V any] struct {
 	memOnce sync.Once
 	memInit func() *hot.HotCache[string, V]
 	mem     *hot.HotCache[string, V]
+
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 func NewHybridCache[V any](cfg HybridCacheConfig[V]) *HybridCache[V] {
-	return &HybridCache[V]{
+	c := &HybridCache[V]{
 		ns:           cfg.Namespace,
 		redis:        cfg.Redis,
 		redisCodec:   cfg.RedisCodec,
 		redisEnabled: cfg.RedisEnabled,
 		memInit:      cfg.Memory,
 	}
+	registerStats(cfg.Namespace, c)
+	return c
+}
+
+// Stats returns hit/miss counters of Get since process start.
+func (c *HybridCache[V]) Stats() Stats {
+	return Stats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+func (c *HybridCache[V]) observe(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
 }
 
 func (c *HybridCache[V]) FullKey(key string) string {
@@ -78,6 +97,11 @@ func (c *HybridCache[V]) memCache() *hot.HotCache[string, V] {
 }
 
 func (c *HybridCache[V]) Get(key string) (value V, found bool, err error) {
+	defer func() {
+		if err == nil {
+			c.observe(found)
+		}
+	}()
 	full := c.ns.FullKey(key)
 	if full == "" {
 		var zero V
@@ -0,0 +1,32 @@
+package cachex
+
+import "sync"
+
+// Stats is a snapshot of cache hit/miss counters.
+type Stats struct {
+	Hits   int64
+	Misses int64
+}
+
+type statsSource interface {
+	Stats() Stats
+}
+
+var statsRegistry sync.Map // Namespace -> statsSource
+
+func registerStats(ns Namespace, source statsSource) {
+	if ns == "" {
+		return
+	}
+	statsRegistry.Store(ns, source)
+}
+
+// AllStats returns hit/miss counters of every HybridCache by namespace.
+func AllStats() map[Namespace]Stats {
+	result := make(map[Namespace]Stats)
+	statsRegistry.Range(func(key, value any) bool {
+		result[key.(Namespace)] = value.(statsSource).Stats()
+		return true
+	})
+	return result
+}
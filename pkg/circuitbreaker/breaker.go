@@ -0,0 +1,291 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const (
+	StatusClosed   = "closed"
+	StatusOpen     = "open"
+	StatusHalfOpen = "half_open"
+)
+
+// State 未处于关闭状态的熔断器；关闭状态不保存
+type State struct {
+	Key       string `json:"key"`
+	Trips     int    `json:"trips"`
+	OpenedAt  int64  `json:"opened_at"`
+	OpenUntil int64  `json:"open_until"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Status 冷却期内为 open，冷却结束后为 half_open
+func (s State) Status(now int64) string {
+	if now < s.OpenUntil {
+		return StatusOpen
+	}
+	return StatusHalfOpen
+}
+
+type failureWindow struct {
+	start int64
+	count int
+}
+
+var (
+	mu sync.RWMutex
+	// states 本节点视图；启用 Redis 时定期从 Redis 同步
+	states = map[string]State{}
+
+	// 以下仅在未启用 Redis 时使用
+	memFailures        = map[string]*failureWindow{}
+	memProbes          = map[string]int64{}
+	memHalfOpenSuccess = map[string]int{}
+)
+
+// ChannelKey 渠道级熔断键
+func ChannelKey(channelId int) string {
+	return fmt.Sprintf("%d", channelId)
+}
+
+// KeyIndexKey 多密钥渠道中单个密钥的熔断键
+func KeyIndexKey(channelId int, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+func Enabled() bool {
+	return operation_setting.GetCircuitBreakerSetting().Enabled
+}
+
+func useRedis() bool {
+	return common.RedisEnabled && common.RDB != nil
+}
+
+func getState(key string) (State, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	state, ok := states[key]
+	return state, ok
+}
+
+// Available 判断是否可以向该目标发送请求，不产生副作用：
+// 关闭状态可用；冷却中不可用；半开状态仅在没有进行中的探测时可用
+func Available(key string) bool {
+	if !Enabled() {
+		return true
+	}
+	state, ok := getState(key)
+	if !ok {
+		return true
+	}
+	if state.Status(time.Now().Unix()) == StatusOpen {
+		return false
+	}
+	return !probeInFlight(key)
+}
+
+// Acquire 在选中目标后调用，半开状态下占用探测名额，返回 false 表示名额已被占用
+func Acquire(key string) bool {
+	allowed, _ := TryAcquire(key)
+	return allowed
+}
+
+// TryAcquire 与 Acquire 相同，probe 为 true 表示占用了半开探测名额，调用方需上报结果或调用 Release
+func TryAcquire(key string) (allowed bool, probe bool) {
+	if !Enabled() {
+		return true, false
+	}
+	state, ok := getState(key)
+	if !ok {
+		return true, false
+	}
+	if state.Status(time.Now().Unix()) == StatusOpen {
+		return false, false
+	}
+	if !acquireProbe(key) {
+		return false, false
+	}
+	return true, true
+}
+
+// Release 释放未上报结果的探测名额，熔断器状态不变
+func Release(key string) {
+	releaseProbe(key)
+}
+
+// RecordSuccess 半开状态下累计成功次数，达到阈值后关闭熔断器
+func RecordSuccess(key string) {
+	if !Enabled() {
+		return
+	}
+	state, ok := getState(key)
+	if !ok || state.Status(time.Now().Unix()) != StatusHalfOpen {
+		return
+	}
+	successes := incrHalfOpenSuccess(key)
+	releaseProbe(key)
+	threshold := operation_setting.GetCircuitBreakerSetting().HalfOpenSuccessThreshold
+	if successes >= threshold {
+		Reset(key)
+		common.SysLog(fmt.Sprintf("circuit breaker %s closed after %d successful probes", key, successes))
+	}
+}
+
+// RecordFailure 关闭状态下累计失败次数，达到阈值熔断；半开探测失败则以更长的冷却时间重新熔断
+func RecordFailure(key string, reason string) {
+	if !Enabled() {
+		return
+	}
+	now := time.Now().Unix()
+	state, ok := getState(key)
+	if ok {
+		if state.Status(now) == StatusHalfOpen {
+			releaseProbe(key)
+			open(key, state.Trips+1, reason)
+		}
+		return
+	}
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if incrFailure(key, setting.WindowSeconds) >= setting.FailureThreshold {
+		open(key, 0, reason)
+	}
+}
+
+func cooldownSeconds(trips int) int64 {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	cooldown := int64(setting.CooldownSeconds)
+	if cooldown <= 0 {
+		cooldown = 30
+	}
+	maxCooldown := int64(setting.MaxCooldownSeconds)
+	for i := 0; i < trips; i++ {
+		cooldown *= 2
+		if maxCooldown > 0 && cooldown >= maxCooldown {
+			return maxCooldown
+		}
+	}
+	return cooldown
+}
+
+func open(key string, trips int, reason string) {
+	now := time.Now().Unix()
+	state := State{
+		Key:       key,
+		Trips:     trips,
+		OpenedAt:  now,
+		OpenUntil: now + cooldownSeconds(trips),
+		Reason:    reason,
+	}
+	mu.Lock()
+	states[key] = state
+	delete(memFailures, key)
+	delete(memHalfOpenSuccess, key)
+	mu.Unlock()
+	if useRedis() {
+		redisSaveState(state)
+	}
+	common.SysLog(fmt.Sprintf("circuit breaker %s opened for %ds (trips: %d), reason: %s", key, state.OpenUntil-now, trips, reason))
+}
+
+// Reset 关闭熔断器并清除计数
+func Reset(key string) {
+	mu.Lock()
+	delete(states, key)
+	delete(memFailures, key)
+	delete(memProbes, key)
+	delete(memHalfOpenSuccess, key)
+	mu.Unlock()
+	if useRedis() {
+		redisDeleteState(key)
+	}
+}
+
+// List 返回所有未关闭的熔断器，按键排序
+func List() []State {
+	mu.RLock()
+	result := make([]State, 0, len(states))
+	for _, state := range states {
+		result = append(result, state)
+	}
+	mu.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func incrFailure(key string, windowSeconds int) int {
+	if windowSeconds <= 0 {
+		windowSeconds = 60
+	}
+	if useRedis() {
+		return redisIncrFailure(key, windowSeconds)
+	}
+	now := time.Now().Unix()
+	mu.Lock()
+	defer mu.Unlock()
+	window, ok := memFailures[key]
+	if !ok || now-window.start >= int64(windowSeconds) {
+		window = &failureWindow{start: now}
+		memFailures[key] = window
+	}
+	window.count++
+	return window.count
+}
+
+func incrHalfOpenSuccess(key string) int {
+	if useRedis() {
+		return redisIncrHalfOpenSuccess(key)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	memHalfOpenSuccess[key]++
+	return memHalfOpenSuccess[key]
+}
+
+func probeTimeoutSeconds() int {
+	timeout := operation_setting.GetCircuitBreakerSetting().ProbeTimeoutSeconds
+	if timeout <= 0 {
+		return 60
+	}
+	return timeout
+}
+
+func probeInFlight(key string) bool {
+	if useRedis() {
+		return redisProbeInFlight(key)
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return memProbes[key] > time.Now().Unix()
+}
+
+func acquireProbe(key string) bool {
+	if useRedis() {
+		return redisAcquireProbe(key, probeTimeoutSeconds())
+	}
+	now := time.Now().Unix()
+	mu.Lock()
+	defer mu.Unlock()
+	if memProbes[key] > now {
+		return false
+	}
+	memProbes[key] = now + int64(probeTimeoutSeconds())
+	return true
+}
+
+func releaseProbe(key string) {
+	if useRedis() {
+		redisReleaseProbe(key)
+		return
+	}
+	mu.Lock()
+	delete(memProbes, key)
+	mu.Unlock()
+}
@@ -0,0 +1,114 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func enableForTest(t *testing.T) *operation_setting.CircuitBreakerSetting {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	saved := *setting
+	t.Cleanup(func() {
+		*setting = saved
+	})
+	setting.Enabled = true
+	setting.FailureThreshold = 3
+	setting.WindowSeconds = 60
+	setting.CooldownSeconds = 30
+	setting.MaxCooldownSeconds = 100
+	setting.HalfOpenSuccessThreshold = 2
+	return setting
+}
+
+func expireCooldown(key string) {
+	mu.Lock()
+	state := states[key]
+	state.OpenUntil = time.Now().Unix() - 1
+	states[key] = state
+	mu.Unlock()
+}
+
+func TestBreakerStateMachine(t *testing.T) {
+	enableForTest(t)
+	key := KeyIndexKey(1, 0)
+	t.Cleanup(func() { Reset(key) })
+
+	for i := 0; i < 2; i++ {
+		RecordFailure(key, "boom")
+		require.True(t, Available(key))
+	}
+	RecordFailure(key, "boom")
+	require.False(t, Available(key))
+	require.False(t, Acquire(key))
+
+	// 冷却结束进入半开，只允许一个探测
+	expireCooldown(key)
+	require.True(t, Available(key))
+	require.True(t, Acquire(key))
+	require.False(t, Available(key))
+	require.False(t, Acquire(key))
+
+	// 探测失败重新熔断，冷却时间翻倍
+	RecordFailure(key, "still broken")
+	state, ok := getState(key)
+	require.True(t, ok)
+	require.Equal(t, 1, state.Trips)
+	require.Equal(t, int64(60), state.OpenUntil-state.OpenedAt)
+
+	// 连续探测成功后关闭
+	expireCooldown(key)
+	require.True(t, Acquire(key))
+	RecordSuccess(key)
+	require.True(t, Acquire(key))
+	RecordSuccess(key)
+	_, ok = getState(key)
+	require.False(t, ok)
+	require.True(t, Available(key))
+}
+
+func TestReleaseReturnsProbeLease(t *testing.T) {
+	enableForTest(t)
+	key := ChannelKey(2)
+	t.Cleanup(func() { Reset(key) })
+
+	allowed, probe := TryAcquire(key)
+	require.True(t, allowed)
+	require.False(t, probe)
+
+	open(key, 0, "boom")
+	expireCooldown(key)
+	allowed, probe = TryAcquire(key)
+	require.True(t, allowed)
+	require.True(t, probe)
+	allowed, probe = TryAcquire(key)
+	require.False(t, allowed)
+	require.False(t, probe)
+
+	// 未上报结果的请求释放名额后，其他请求可以继续探测
+	Release(key)
+	require.True(t, Available(key))
+	state, ok := getState(key)
+	require.True(t, ok)
+	require.Equal(t, StatusHalfOpen, state.Status(time.Now().Unix()))
+}
+
+func TestCooldownBackoffIsCapped(t *testing.T) {
+	enableForTest(t)
+	require.Equal(t, int64(30), cooldownSeconds(0))
+	require.Equal(t, int64(60), cooldownSeconds(1))
+	require.Equal(t, int64(100), cooldownSeconds(5))
+}
+
+func TestDisabledBreakerAlwaysAvailable(t *testing.T) {
+	setting := enableForTest(t)
+	setting.Enabled = false
+	key := ChannelKey(2)
+	for i := 0; i < 10; i++ {
+		RecordFailure(key, "boom")
+	}
+	require.True(t, Available(key))
+	require.Empty(t, List())
+}
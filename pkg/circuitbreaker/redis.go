@@ -0,0 +1,136 @@
+package circuitbreaker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	redisStatesKey        = "circuit_breaker:states"
+	redisFailurePrefix    = "circuit_breaker:fail:"
+	redisProbePrefix      = "circuit_breaker:probe:"
+	redisHalfOpenPrefix   = "circuit_breaker:half_open_ok:"
+	redisOperationTimeout = time.Second
+	syncInterval          = 2 * time.Second
+)
+
+var syncOnce sync.Once
+
+// Init 启用 Redis 时定期同步熔断状态，使所有节点看到一致的熔断器
+func Init() {
+	if !useRedis() {
+		return
+	}
+	syncOnce.Do(func() {
+		go func() {
+			for {
+				syncFromRedis()
+				time.Sleep(syncInterval)
+			}
+		}()
+	})
+}
+
+func redisContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), redisOperationTimeout)
+}
+
+func syncFromRedis() {
+	if !Enabled() {
+		return
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	values, err := common.RDB.HGetAll(ctx, redisStatesKey).Result()
+	if err != nil {
+		common.SysError("failed to sync circuit breaker states: " + err.Error())
+		return
+	}
+	synced := make(map[string]State, len(values))
+	for key, value := range values {
+		var state State
+		if err := common.UnmarshalJsonStr(value, &state); err != nil {
+			continue
+		}
+		synced[key] = state
+	}
+	mu.Lock()
+	states = synced
+	mu.Unlock()
+}
+
+func redisSaveState(state State) {
+	data, err := common.Marshal(state)
+	if err != nil {
+		return
+	}
+	ctx, cancel := redisContext()
+	defer cancel()
+	pipe := common.RDB.TxPipeline()
+	pipe.HSet(ctx, redisStatesKey, state.Key, string(data))
+	pipe.Del(ctx, redisFailurePrefix+state.Key, redisHalfOpenPrefix+state.Key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to save circuit breaker %s: %s", state.Key, err.Error()))
+	}
+}
+
+func redisDeleteState(key string) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	pipe := common.RDB.TxPipeline()
+	pipe.HDel(ctx, redisStatesKey, key)
+	pipe.Del(ctx, redisFailurePrefix+key, redisProbePrefix+key, redisHalfOpenPrefix+key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		common.SysError(fmt.Sprintf("failed to reset circuit breaker %s: %s", key, err.Error()))
+	}
+}
+
+func redisIncrFailure(key string, windowSeconds int) int {
+	ctx, cancel := redisContext()
+	defer cancel()
+	redisKey := redisFailurePrefix + key
+	count, err := common.RDB.Incr(ctx, redisKey).Result()
+	if err != nil {
+		return 0
+	}
+	if count == 1 {
+		common.RDB.Expire(ctx, redisKey, time.Duration(windowSeconds)*time.Second)
+	}
+	return int(count)
+}
+
+func redisIncrHalfOpenSuccess(key string) int {
+	ctx, cancel := redisContext()
+	defer cancel()
+	redisKey := redisHalfOpenPrefix + key
+	count, err := common.RDB.Incr(ctx, redisKey).Result()
+	if err != nil {
+		return 0
+	}
+	common.RDB.Expire(ctx, redisKey, time.Hour)
+	return int(count)
+}
+
+func redisProbeInFlight(key string) bool {
+	ctx, cancel := redisContext()
+	defer cancel()
+	exists, err := common.RDB.Exists(ctx, redisProbePrefix+key).Result()
+	return err == nil && exists > 0
+}
+
+func redisAcquireProbe(key string, timeoutSeconds int) bool {
+	ctx, cancel := redisContext()
+	defer cancel()
+	ok, err := common.RDB.SetNX(ctx, redisProbePrefix+key, common.GetTimestamp(), time.Duration(timeoutSeconds)*time.Second).Result()
+	return err == nil && ok
+}
+
+func redisReleaseProbe(key string) {
+	ctx, cancel := redisContext()
+	defer cancel()
+	common.RDB.Del(ctx, redisProbePrefix+key)
+}
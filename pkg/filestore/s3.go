@@ -0,0 +1,151 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/file_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// unsignedPayload 流式上传时不计算请求体哈希，S3 兼容服务均支持
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+var s3HttpClient = &http.Client{Timeout: 10 * time.Minute}
+
+// s3Store 基于 SigV4 签名的 S3 兼容存储（AWS S3 / MinIO / R2 等）
+type s3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	prefix    string
+	pathStyle bool
+	creds     aws.Credentials
+	signer    *v4.Signer
+}
+
+func newS3Store(setting *file_setting.FileSetting) (*s3Store, error) {
+	if setting.S3Bucket == "" {
+		return nil, errors.New("s3 bucket is not configured")
+	}
+	if setting.S3AccessKeyId == "" || setting.S3Secret == "" {
+		return nil, errors.New("s3 credentials are not configured")
+	}
+	region := setting.S3Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	rawEndpoint := setting.S3Endpoint
+	if rawEndpoint == "" {
+		rawEndpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	endpoint, err := url.Parse(strings.TrimRight(rawEndpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	return &s3Store{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    setting.S3Bucket,
+		prefix:    strings.Trim(setting.S3ObjectPrefix, "/"),
+		pathStyle: setting.S3PathStyle,
+		creds: aws.Credentials{
+			AccessKeyID:     setting.S3AccessKeyId,
+			SecretAccessKey: setting.S3Secret,
+		},
+		signer: v4.NewSigner(),
+	}, nil
+}
+
+func (s *s3Store) Type() string {
+	return file_setting.StorageTypeS3
+}
+
+func (s *s3Store) objectURL(key string) string {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = u.Path + "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = u.Path + "/" + key
+	}
+	return u.String()
+}
+
+func (s *s3Store) do(ctx context.Context, method string, key string, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	if err := s.signer.SignHTTP(ctx, s.creds, req, unsignedPayload, "s3", s.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign s3 request: %w", err)
+	}
+	return s3HttpClient.Do(req)
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64) (int64, error) {
+	if size < 0 {
+		return 0, errors.New("s3 upload requires a known content length")
+	}
+	counter := &countingReader{r: r}
+	resp, err := s.do(ctx, http.MethodPut, key, counter, size)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("s3 put failed with status %d: %s", resp.StatusCode, string(msg))
+	}
+	return counter.n, nil
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 get failed with status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
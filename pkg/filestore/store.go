@@ -0,0 +1,45 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/file_setting"
+)
+
+// Store 文件接口的存储后端
+type Store interface {
+	// Type 返回存储类型，写入 File.StorageType 以便后续按原后端读取
+	Type() string
+	// Put 写入对象，返回实际写入的字节数
+	Put(ctx context.Context, key string, r io.Reader, size int64) (int64, error)
+	// Get 读取对象，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// Current 根据当前配置返回用于写入新文件的存储后端
+func Current() (Store, error) {
+	return ByType(file_setting.GetSetting().StorageType)
+}
+
+// ByType 返回指定类型的存储后端，用于读取或删除已有文件
+func ByType(storageType string) (Store, error) {
+	setting := file_setting.GetSetting()
+	switch strings.ToLower(storageType) {
+	case "", file_setting.StorageTypeLocal:
+		return newLocalStore(setting.LocalPath), nil
+	case file_setting.StorageTypeS3:
+		return newS3Store(setting)
+	default:
+		return nil, fmt.Errorf("unsupported file storage type: %s", storageType)
+	}
+}
+
+// ObjectKey 生成对象存储键，按用户分目录
+func ObjectKey(userId int, fileId string) string {
+	return fmt.Sprintf("%d/%s", userId, fileId)
+}
@@ -10,8 +10,10 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/perf_metrics_setting"
+	"github.com/QuantumNous/new-api/types"
 )
 
 var hotBuckets sync.Map
@@ -28,6 +30,7 @@ func RecordRelaySample(info *relaycommon.RelayInfo, success bool, outputTokens i
 	if info == nil {
 		return
 	}
+	prommetrics.ObserveRelay(info, success)
 	now := time.Now()
 	hasTtft := info.IsStream && info.HasSendResponse()
 	ttftMs := int64(0)
@@ -42,6 +45,10 @@ func RecordRelaySample(info *relaycommon.RelayInfo, success bool, outputTokens i
 	if generationMs <= 0 {
 		generationMs = latencyMs
 	}
+	// 失败样本由重试循环按渠道逐次记录，这里只记录成功样本，避免重复计数
+	if success && info.ChannelMeta != nil {
+		model.ObserveChannelPerformance(info.ChannelId, true, latencyMs, ttftMs, hasTtft)
+	}
 	Record(Sample{
 		Model:        info.OriginModelName,
 		Group:        info.UsingGroup,
@@ -54,6 +61,17 @@ func RecordRelaySample(info *relaycommon.RelayInfo, success bool, outputTokens i
 	})
 }
 
+// RecordChannelFailure 记录一次可归因于渠道的失败，用于自适应渠道选择
+func RecordChannelFailure(channelId int, err *types.NewAPIError) {
+	if err == nil {
+		return
+	}
+	if !types.IsChannelError(err) && err.StatusCode < 500 && err.StatusCode != 429 && err.StatusCode != 408 {
+		return
+	}
+	model.ObserveChannelPerformance(channelId, false, 0, 0, false)
+}
+
 func Record(sample Sample) {
 	setting := perf_metrics_setting.GetSetting()
 	if !setting.Enabled || sample.Model == "" {
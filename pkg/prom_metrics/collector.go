@@ -0,0 +1,123 @@
+package prommetrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	channelStatusDesc = prometheus.NewDesc(namespace+"_channel_status",
+		"Channel status: 1 enabled, 2 manually disabled, 3 auto disabled.", []string{"channel", "type"}, nil)
+	channelKeysDesc = prometheus.NewDesc(namespace+"_channel_keys",
+		"Keys of multi-key channels by status.", []string{"channel", "status"}, nil)
+	taskQueueDesc = prometheus.NewDesc(namespace+"_task_queue_depth",
+		"Unfinished async tasks by platform and status.", []string{"platform", "status"}, nil)
+	cacheRequestsDesc = prometheus.NewDesc(namespace+"_cache_requests_total",
+		"Cache lookups by namespace and result.", []string{"namespace", "result"}, nil)
+	redisPoolDesc = prometheus.NewDesc(namespace+"_redis_pool_connections",
+		"Redis connection pool connections by state.", []string{"state"}, nil)
+	redisPoolEventsDesc = prometheus.NewDesc(namespace+"_redis_pool_events_total",
+		"Redis connection pool events.", []string{"event"}, nil)
+)
+
+// stateSnapshotTTL 渠道与任务状态的缓存时间，多个 Prometheus 实例频繁抓取时也不会每次查询数据库
+const stateSnapshotTTL = 15 * time.Second
+
+// stateCollector 在抓取时输出渠道、任务、缓存与 Redis 连接池的状态。
+// 渠道与任务需要查询数据库，按 ttl 缓存；缓存与连接池统计在内存中，每次抓取直接读取
+type stateCollector struct {
+	ttl time.Duration
+
+	mu          sync.Mutex
+	refreshedAt time.Time
+	channels    []*model.Channel
+	tasks       []model.TaskQueueDepth
+}
+
+func newStateCollector() *stateCollector {
+	return &stateCollector{ttl: stateSnapshotTTL}
+}
+
+// snapshot 返回缓存的渠道与任务状态，过期时重新查询；查询失败时保留上一次的结果
+func (s *stateCollector) snapshot() ([]*model.Channel, []model.TaskQueueDepth) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.refreshedAt.IsZero() && time.Since(s.refreshedAt) < s.ttl {
+		return s.channels, s.tasks
+	}
+	s.refreshedAt = time.Now()
+	if channels, err := model.GetChannelStatusSnapshot(); err != nil {
+		common.SysError("failed to collect channel metrics: " + err.Error())
+	} else {
+		s.channels = channels
+	}
+	if tasks, err := model.CountUnfinishedTasks(); err != nil {
+		common.SysError("failed to collect task metrics: " + err.Error())
+	} else {
+		s.tasks = tasks
+	}
+	return s.channels, s.tasks
+}
+
+func (s *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelStatusDesc
+	ch <- channelKeysDesc
+	ch <- taskQueueDesc
+	ch <- cacheRequestsDesc
+	ch <- redisPoolDesc
+	ch <- redisPoolEventsDesc
+}
+
+func (s *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	channels, tasks := s.snapshot()
+	collectChannels(ch, channels)
+	collectTasks(ch, tasks)
+	for ns, stats := range cachex.AllStats() {
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(stats.Hits), string(ns), "hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(stats.Misses), string(ns), "miss")
+	}
+	if common.RedisEnabled && common.RDB != nil {
+		stats := common.RDB.PoolStats()
+		ch <- prometheus.MustNewConstMetric(redisPoolDesc, prometheus.GaugeValue, float64(stats.TotalConns), "total")
+		ch <- prometheus.MustNewConstMetric(redisPoolDesc, prometheus.GaugeValue, float64(stats.IdleConns), "idle")
+		ch <- prometheus.MustNewConstMetric(redisPoolDesc, prometheus.GaugeValue, float64(stats.StaleConns), "stale")
+		ch <- prometheus.MustNewConstMetric(redisPoolEventsDesc, prometheus.CounterValue, float64(stats.Hits), "hit")
+		ch <- prometheus.MustNewConstMetric(redisPoolEventsDesc, prometheus.CounterValue, float64(stats.Misses), "miss")
+		ch <- prometheus.MustNewConstMetric(redisPoolEventsDesc, prometheus.CounterValue, float64(stats.Timeouts), "timeout")
+	}
+}
+
+func collectChannels(ch chan<- prometheus.Metric, channels []*model.Channel) {
+	for _, channel := range channels {
+		id := strconv.Itoa(channel.Id)
+		ch <- prometheus.MustNewConstMetric(channelStatusDesc, prometheus.GaugeValue, float64(channel.Status), id, strconv.Itoa(channel.Type))
+		if !channel.ChannelInfo.IsMultiKey {
+			continue
+		}
+		// 未记录状态的 key 视为启用
+		counts := map[int]int{common.ChannelStatusEnabled: channel.ChannelInfo.MultiKeySize}
+		for _, status := range channel.ChannelInfo.MultiKeyStatusList {
+			if status == common.ChannelStatusEnabled {
+				continue
+			}
+			counts[common.ChannelStatusEnabled]--
+			counts[status]++
+		}
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(channelKeysDesc, prometheus.GaugeValue, float64(count), id, strconv.Itoa(status))
+		}
+	}
+}
+
+func collectTasks(ch chan<- prometheus.Metric, tasks []model.TaskQueueDepth) {
+	for _, depth := range tasks {
+		ch <- prometheus.MustNewConstMetric(taskQueueDesc, prometheus.GaugeValue, float64(depth.Count), depth.Platform, depth.Status)
+	}
+}
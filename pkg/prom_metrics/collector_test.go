@@ -0,0 +1,71 @@
+package prommetrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/glebarez/sqlite"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func openPromMetricsTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	common.UsingSQLite = true
+	common.UsingMySQL = false
+	common.UsingPostgreSQL = false
+	common.RedisEnabled = false
+
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}, &model.Task{}))
+	model.DB = db
+	model.LOG_DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestStateCollectorCachesSnapshot(t *testing.T) {
+	db := openPromMetricsTestDB(t)
+	require.NoError(t, db.Create(&model.Channel{
+		Id: 1, Type: 1, Key: "a\nb\nc", Status: common.ChannelStatusEnabled,
+		ChannelInfo: model.ChannelInfo{IsMultiKey: true, MultiKeySize: 3, MultiKeyStatusList: map[int]int{1: common.ChannelStatusAutoDisabled}},
+	}).Error)
+	require.NoError(t, db.Create(&model.Task{Platform: "suno", Status: model.TaskStatusInProgress}).Error)
+	require.NoError(t, db.Create(&model.Task{Platform: "suno", Status: model.TaskStatusSuccess}).Error)
+
+	collector := newStateCollector()
+	expected := `
+# HELP new_api_channel_keys Keys of multi-key channels by status.
+# TYPE new_api_channel_keys gauge
+new_api_channel_keys{channel="1",status="1"} 2
+new_api_channel_keys{channel="1",status="3"} 1
+# HELP new_api_channel_status Channel status: 1 enabled, 2 manually disabled, 3 auto disabled.
+# TYPE new_api_channel_status gauge
+new_api_channel_status{channel="1",type="1"} 1
+# HELP new_api_task_queue_depth Unfinished async tasks by platform and status.
+# TYPE new_api_task_queue_depth gauge
+new_api_task_queue_depth{platform="suno",status="IN_PROGRESS"} 1
+`
+	metricNames := []string{"new_api_channel_keys", "new_api_channel_status", "new_api_task_queue_depth"}
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), metricNames...))
+
+	// 缓存有效期内的抓取不会查询数据库
+	require.NoError(t, db.Model(&model.Channel{}).Where("id = ?", 1).Update("status", common.ChannelStatusManuallyDisabled).Error)
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), metricNames...))
+
+	collector.mu.Lock()
+	collector.refreshedAt = time.Now().Add(-collector.ttl)
+	collector.mu.Unlock()
+	expected = strings.Replace(expected, `new_api_channel_status{channel="1",type="1"} 1`, `new_api_channel_status{channel="1",type="1"} 2`, 1)
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), metricNames...))
+}
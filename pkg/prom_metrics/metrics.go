@@ -0,0 +1,183 @@
+package prommetrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "new_api"
+
+var relayLabels = []string{"model", "channel", "group"}
+
+var (
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Relay requests by result.",
+	}, append(relayLabels, "result"))
+	relayRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_rejected_total",
+		Help:      "Relay requests rejected before a channel was selected, by error code.",
+	}, []string{"model", "group", "reason"})
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Total relay request latency.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300},
+	}, relayLabels)
+	relayTTFT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_time_to_first_token_seconds",
+		Help:      "Time to first streamed response.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10, 20, 30},
+	}, relayLabels)
+	relayTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_tokens_total",
+		Help:      "Tokens consumed by relay requests.",
+	}, append(relayLabels, "type"))
+	quotaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_consumed_total",
+		Help:      "Quota consumed by relay requests.",
+	}, relayLabels)
+	tokenizerError = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "tokenizer_estimate_error_ratio",
+		Help:      "Relative error of estimated prompt tokens against upstream usage.",
+		Buckets:   []float64{-0.5, -0.25, -0.1, -0.05, -0.02, 0, 0.02, 0.05, 0.1, 0.25, 0.5, 1},
+	}, []string{"model", "tokenizer"})
+)
+
+var (
+	registry     *prometheus.Registry
+	registryOnce sync.Once
+)
+
+// Enabled 是否启用 /metrics，未启用时不记录任何指标
+func Enabled() bool {
+	return constant.MetricsEnabled
+}
+
+func getRegistry() *prometheus.Registry {
+	registryOnce.Do(func() {
+		registry = prometheus.NewRegistry()
+		registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+			relayRequests, relayRejected, relayDuration, relayTTFT, relayTokens, quotaConsumed, tokenizerError,
+			newStateCollector(),
+		)
+		registerDBStats(registry)
+	})
+	return registry
+}
+
+func registerDBStats(r *prometheus.Registry) {
+	if model.DB != nil {
+		if sqlDB, err := model.DB.DB(); err == nil {
+			r.MustRegister(collectors.NewDBStatsCollector(sqlDB, "main"))
+		}
+	}
+	if model.LOG_DB != nil && model.LOG_DB != model.DB {
+		if sqlDB, err := model.LOG_DB.DB(); err == nil {
+			r.MustRegister(collectors.NewDBStatsCollector(sqlDB, "log"))
+		}
+	}
+}
+
+// Handler 返回 Prometheus 文本格式的指标
+func Handler() http.Handler {
+	return promhttp.HandlerFor(getRegistry(), promhttp.HandlerOpts{
+		EnableOpenMetrics: true,
+		ErrorLog:          promErrorLogger{},
+	})
+}
+
+type promErrorLogger struct{}
+
+func (promErrorLogger) Println(v ...interface{}) {
+	common.SysError("prometheus metrics error: " + fmt.Sprint(v...))
+}
+
+func groupLabelValue(group string) string {
+	if group == "" {
+		return "default"
+	}
+	return group
+}
+
+func relayLabelValues(info *relaycommon.RelayInfo) []string {
+	channel := ""
+	if info.ChannelMeta != nil {
+		channel = strconv.Itoa(info.ChannelId)
+	}
+	return []string{info.OriginModelName, channel, groupLabelValue(info.UsingGroup)}
+}
+
+// ObserveRelayRejected 记录选择渠道之前被拒绝的请求，如参数校验、敏感词、上下文窗口、预扣费与限流失败
+func ObserveRelayRejected(modelName string, group string, code types.ErrorCode) {
+	if !Enabled() {
+		return
+	}
+	relayRejected.WithLabelValues(modelName, groupLabelValue(group), string(code)).Inc()
+}
+
+// ObserveRelay 记录一次中继请求的结果、总延迟与首字延迟
+func ObserveRelay(info *relaycommon.RelayInfo, success bool) {
+	if !Enabled() || info == nil {
+		return
+	}
+	labels := relayLabelValues(info)
+	result := "success"
+	if !success {
+		result = "error"
+	}
+	relayRequests.WithLabelValues(append(labels, result)...).Inc()
+	if !success {
+		return
+	}
+	relayDuration.WithLabelValues(labels...).Observe(time.Since(info.StartTime).Seconds())
+	if info.IsStream && info.HasSendResponse() {
+		relayTTFT.WithLabelValues(labels...).Observe(info.FirstResponseTime.Sub(info.StartTime).Seconds())
+	}
+}
+
+// ObserveConsume 记录结算后的 token 用量与消耗额度
+func ObserveConsume(info *relaycommon.RelayInfo, promptTokens, completionTokens, quota int) {
+	if !Enabled() || info == nil {
+		return
+	}
+	labels := relayLabelValues(info)
+	if promptTokens > 0 {
+		relayTokens.WithLabelValues(append(labels, "prompt")...).Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		relayTokens.WithLabelValues(append(labels, "completion")...).Add(float64(completionTokens))
+	}
+	if quota > 0 {
+		quotaConsumed.WithLabelValues(labels...).Add(float64(quota))
+	}
+}
+
+// ObserveTokenizerError 记录预估输入 token 数相对上游用量的误差比例
+func ObserveTokenizerError(model, tokenizer string, errorRate float64) {
+	if !Enabled() {
+		return
+	}
+	tokenizerError.WithLabelValues(model, tokenizer).Observe(errorRate)
+}
@@ -0,0 +1,608 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/dlclark/regexp2"
+	"github.com/samber/hot"
+	"golang.org/x/text/unicode/norm"
+)
+
+// gpt2SplitPattern ByteLevel 预分词器 use_regex=true 时使用的 GPT-2 切分规则
+const gpt2SplitPattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// regexMatchTimeout 单次正则匹配的超时时间，tokenizer.json 中的规则来自管理员上传，避免回溯过多的规则卡住请求
+const regexMatchTimeout = 100 * time.Millisecond
+
+// pieceCacheCapacity 每个分词器缓存的预分词片段计数数量
+const pieceCacheCapacity = 65536
+
+// BPE 从 HuggingFace tokenizer.json 加载的 BPE 分词器，仅用于计数。
+// 支持 Qwen、DeepSeek、Llama 3 等字节级 BPE，以及 Gemma、Mistral 等 SentencePiece 风格（Metaspace + byte_fallback）的 BPE
+type BPE struct {
+	vocab map[string]int
+	// symbolIds 词表与 merges 中出现的所有符号的编号，合并过程只比较编号
+	symbolIds    map[string]int
+	inVocab      []bool
+	merges       map[mergePair]mergeRule
+	byteFallback bool
+	ignoreMerges bool
+	normalizers  []normalizer
+	preTokenizer []preTokenizer
+	// pieceCache 片段的 token 数，同一片段在对话中反复出现
+	pieceCache *hot.HotCache[string, int]
+}
+
+type mergePair struct {
+	left  int
+	right int
+}
+
+type mergeRule struct {
+	rank   int
+	merged int
+}
+
+type hfTokenizerFile struct {
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Model        struct {
+		Type         string         `json:"type"`
+		Vocab        map[string]int `json:"vocab"`
+		Merges       hfMerges       `json:"merges"`
+		ByteFallback bool           `json:"byte_fallback"`
+		IgnoreMerges bool           `json:"ignore_merges"`
+	} `json:"model"`
+}
+
+// hfMerges merges 有 "a b" 与 ["a","b"] 两种格式
+type hfMerges [][2]string
+
+func (m *hfMerges) UnmarshalJSON(data []byte) error {
+	var raw []any
+	if err := common.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	merges := make([][2]string, 0, len(raw))
+	for _, item := range raw {
+		switch v := item.(type) {
+		case string:
+			left, right, ok := strings.Cut(v, " ")
+			if !ok {
+				return fmt.Errorf("invalid merge: %q", v)
+			}
+			merges = append(merges, [2]string{left, right})
+		case []any:
+			if len(v) != 2 {
+				return fmt.Errorf("invalid merge: %v", v)
+			}
+			left, _ := v[0].(string)
+			right, _ := v[1].(string)
+			merges = append(merges, [2]string{left, right})
+		default:
+			return fmt.Errorf("invalid merge: %v", v)
+		}
+	}
+	*m = merges
+	return nil
+}
+
+type hfPattern struct {
+	String *string `json:"String"`
+	Regex  *string `json:"Regex"`
+}
+
+type hfComponent struct {
+	Type string `json:"type"`
+	// Sequence
+	Normalizers   []*hfComponent `json:"normalizers"`
+	Pretokenizers []*hfComponent `json:"pretokenizers"`
+	// Prepend / Replace / Split
+	Prepend  string     `json:"prepend"`
+	Pattern  *hfPattern `json:"pattern"`
+	Content  string     `json:"content"`
+	Behavior string     `json:"behavior"`
+	Invert   bool       `json:"invert"`
+	// ByteLevel
+	AddPrefixSpace *bool `json:"add_prefix_space"`
+	UseRegex       *bool `json:"use_regex"`
+	// Metaspace
+	Replacement   string `json:"replacement"`
+	PrependScheme string `json:"prepend_scheme"`
+	Split         *bool  `json:"split"`
+	// Digits
+	IndividualDigits bool `json:"individual_digits"`
+}
+
+type normalizer func(string) string
+
+// preTokenizer 将输入片段继续切分；字节级预分词器同时完成字节到可见字符的映射
+type preTokenizer func([]string) []string
+
+// LoadHuggingFace 解析 tokenizer.json，只支持 BPE 模型
+func LoadHuggingFace(r io.Reader) (*BPE, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var file hfTokenizerFile
+	if err := common.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid tokenizer.json: %w", err)
+	}
+	if file.Model.Type != "" && file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model type %q, only BPE is supported", file.Model.Type)
+	}
+	if len(file.Model.Vocab) == 0 {
+		return nil, errors.New("tokenizer.json has empty vocab")
+	}
+
+	t := &BPE{
+		vocab:        file.Model.Vocab,
+		symbolIds:    make(map[string]int, len(file.Model.Vocab)),
+		inVocab:      make([]bool, 0, len(file.Model.Vocab)),
+		merges:       make(map[mergePair]mergeRule, len(file.Model.Merges)),
+		byteFallback: file.Model.ByteFallback,
+		ignoreMerges: file.Model.IgnoreMerges,
+		pieceCache:   hot.NewHotCache[string, int](hot.LRU, pieceCacheCapacity).Build(),
+	}
+	for symbol := range file.Model.Vocab {
+		t.symbolId(symbol)
+	}
+	for i, merge := range file.Model.Merges {
+		pair := mergePair{left: t.symbolId(merge[0]), right: t.symbolId(merge[1])}
+		if _, ok := t.merges[pair]; !ok {
+			t.merges[pair] = mergeRule{rank: i, merged: t.symbolId(merge[0] + merge[1])}
+		}
+	}
+	if file.Normalizer != nil {
+		if t.normalizers, err = buildNormalizers(file.Normalizer); err != nil {
+			return nil, err
+		}
+	}
+	if file.PreTokenizer != nil {
+		if t.preTokenizer, err = buildPreTokenizers(file.PreTokenizer); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// symbolId 返回符号的编号，不存在时分配新编号；只在加载时调用
+func (t *BPE) symbolId(symbol string) int {
+	if id, ok := t.symbolIds[symbol]; ok {
+		return id
+	}
+	id := len(t.inVocab)
+	t.symbolIds[symbol] = id
+	_, inVocab := t.vocab[symbol]
+	t.inVocab = append(t.inVocab, inVocab)
+	return id
+}
+
+func compileRegex(expr string) (*regexp2.Regexp, error) {
+	re, err := regexp2.Compile(expr, regexp2.None)
+	if err != nil {
+		return nil, err
+	}
+	re.MatchTimeout = regexMatchTimeout
+	return re, nil
+}
+
+func mustCompileRegex(expr string) *regexp2.Regexp {
+	re, err := compileRegex(expr)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+func buildNormalizers(c *hfComponent) ([]normalizer, error) {
+	switch c.Type {
+	case "Sequence":
+		var out []normalizer
+		for _, child := range c.Normalizers {
+			n, err := buildNormalizers(child)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, n...)
+		}
+		return out, nil
+	case "NFC":
+		return []normalizer{norm.NFC.String}, nil
+	case "NFKC":
+		return []normalizer{norm.NFKC.String}, nil
+	case "NFD":
+		return []normalizer{norm.NFD.String}, nil
+	case "NFKD":
+		return []normalizer{norm.NFKD.String}, nil
+	case "Lowercase":
+		return []normalizer{strings.ToLower}, nil
+	case "Prepend":
+		prepend := c.Prepend
+		return []normalizer{func(s string) string {
+			if s == "" {
+				return s
+			}
+			return prepend + s
+		}}, nil
+	case "Replace":
+		if c.Pattern == nil {
+			return nil, errors.New("replace normalizer without pattern")
+		}
+		content := c.Content
+		if c.Pattern.String != nil {
+			old := *c.Pattern.String
+			return []normalizer{func(s string) string { return strings.ReplaceAll(s, old, content) }}, nil
+		}
+		if c.Pattern.Regex == nil {
+			return nil, errors.New("replace normalizer without pattern")
+		}
+		re, err := compileRegex(*c.Pattern.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replace pattern: %w", err)
+		}
+		return []normalizer{func(s string) string {
+			out, err := re.Replace(s, content, -1, -1)
+			if err != nil {
+				return s
+			}
+			return out
+		}}, nil
+	default:
+		// Strip、StripAccents 等对计数影响很小，忽略
+		return nil, nil
+	}
+}
+
+func buildPreTokenizers(c *hfComponent) ([]preTokenizer, error) {
+	switch c.Type {
+	case "Sequence":
+		var out []preTokenizer
+		for _, child := range c.Pretokenizers {
+			p, err := buildPreTokenizers(child)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p...)
+		}
+		return out, nil
+	case "Split":
+		if c.Pattern == nil {
+			return nil, errors.New("split pre-tokenizer without pattern")
+		}
+		var expr string
+		if c.Pattern.Regex != nil {
+			expr = *c.Pattern.Regex
+		} else if c.Pattern.String != nil {
+			expr = regexp2.Escape(*c.Pattern.String)
+		}
+		re, err := compileRegex(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid split pattern: %w", err)
+		}
+		invert := c.Invert
+		return []preTokenizer{func(pieces []string) []string {
+			return flatMap(pieces, func(s string) []string { return splitByRegex(re, s, invert) })
+		}}, nil
+	case "ByteLevel":
+		addPrefixSpace := c.AddPrefixSpace != nil && *c.AddPrefixSpace
+		useRegex := c.UseRegex == nil || *c.UseRegex
+		var re *regexp2.Regexp
+		if useRegex {
+			re = mustCompileRegex(gpt2SplitPattern)
+		}
+		return []preTokenizer{func(pieces []string) []string {
+			if addPrefixSpace && len(pieces) > 0 && !strings.HasPrefix(pieces[0], " ") {
+				pieces[0] = " " + pieces[0]
+			}
+			if re != nil {
+				pieces = flatMap(pieces, func(s string) []string { return splitByRegex(re, s, false) })
+			}
+			for i, piece := range pieces {
+				pieces[i] = byteLevelEncode(piece)
+			}
+			return pieces
+		}}, nil
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		prependScheme := c.PrependScheme
+		if prependScheme == "" {
+			prependScheme = "always"
+			if c.AddPrefixSpace != nil && !*c.AddPrefixSpace {
+				prependScheme = "never"
+			}
+		}
+		split := c.Split == nil || *c.Split
+		return []preTokenizer{func(pieces []string) []string {
+			out := make([]string, 0, len(pieces))
+			for i, piece := range pieces {
+				piece = strings.ReplaceAll(piece, " ", replacement)
+				if prependScheme == "always" || (prependScheme == "first" && i == 0) {
+					if !strings.HasPrefix(piece, replacement) {
+						piece = replacement + piece
+					}
+				}
+				if split {
+					out = append(out, splitBeforeMarker(piece, replacement)...)
+				} else {
+					out = append(out, piece)
+				}
+			}
+			return out
+		}}, nil
+	case "Digits":
+		expr := `\p{N}+`
+		if c.IndividualDigits {
+			expr = `\p{N}`
+		}
+		re := mustCompileRegex(expr)
+		return []preTokenizer{func(pieces []string) []string {
+			return flatMap(pieces, func(s string) []string { return splitByRegex(re, s, false) })
+		}}, nil
+	case "Whitespace":
+		re := mustCompileRegex(`\w+|[^\w\s]+`)
+		return []preTokenizer{func(pieces []string) []string {
+			return flatMap(pieces, func(s string) []string { return matchesOnly(re, s) })
+		}}, nil
+	case "WhitespaceSplit":
+		return []preTokenizer{func(pieces []string) []string {
+			return flatMap(pieces, strings.Fields)
+		}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported pre-tokenizer type %q", c.Type)
+	}
+}
+
+func flatMap(pieces []string, f func(string) []string) []string {
+	out := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		out = append(out, f(piece)...)
+	}
+	return out
+}
+
+// splitByRegex 按 Isolated 语义切分：匹配部分与未匹配部分各自成为片段；invert 时匹配部分作为分隔符。
+// 匹配超时时剩余部分作为一个片段，计数会偏多但不会丢失内容
+func splitByRegex(re *regexp2.Regexp, s string, invert bool) []string {
+	if invert {
+		return matchesOnly(re, s)
+	}
+	var out []string
+	runes := []rune(s)
+	last := 0
+	match, _ := re.FindStringMatch(s)
+	for match != nil {
+		if match.Index > last {
+			out = append(out, string(runes[last:match.Index]))
+		}
+		if match.Length > 0 {
+			out = append(out, match.String())
+		}
+		last = match.Index + match.Length
+		match, _ = re.FindNextMatch(match)
+	}
+	if last < len(runes) {
+		out = append(out, string(runes[last:]))
+	}
+	return out
+}
+
+func matchesOnly(re *regexp2.Regexp, s string) []string {
+	var out []string
+	last := 0
+	match, err := re.FindStringMatch(s)
+	for match != nil {
+		if match.Length > 0 {
+			out = append(out, match.String())
+		}
+		last = match.Index + match.Length
+		match, err = re.FindNextMatch(match)
+	}
+	if err != nil {
+		if runes := []rune(s); last < len(runes) {
+			out = append(out, string(runes[last:]))
+		}
+	}
+	return out
+}
+
+// splitBeforeMarker 在每个替换符前切分，替换符归属于后一个片段
+func splitBeforeMarker(s, marker string) []string {
+	var out []string
+	start := 0
+	for i := 1; i < len(s); {
+		j := strings.Index(s[i:], marker)
+		if j < 0 {
+			break
+		}
+		pos := i + j
+		out = append(out, s[start:pos])
+		start = pos
+		i = pos + len(marker)
+	}
+	return append(out, s[start:])
+}
+
+var byteLevelAlphabet = buildByteLevelAlphabet()
+
+// buildByteLevelAlphabet GPT-2 bytes_to_unicode：可见字节保持原样，其余映射到 U+0100 之后
+func buildByteLevelAlphabet() [256]rune {
+	var table [256]rune
+	var assigned [256]bool
+	for b := '!'; b <= '~'; b++ {
+		table[b], assigned[b] = b, true
+	}
+	for b := '¡'; b <= '¬'; b++ {
+		table[b], assigned[b] = b, true
+	}
+	for b := '®'; b <= 'ÿ'; b++ {
+		table[b], assigned[b] = b, true
+	}
+	n := rune(0)
+	for b := 0; b < 256; b++ {
+		if !assigned[b] {
+			table[b] = 256 + n
+			n++
+		}
+	}
+	return table
+}
+
+func byteLevelEncode(s string) string {
+	var sb strings.Builder
+	sb.Grow(len(s) * 2)
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(byteLevelAlphabet[s[i]])
+	}
+	return sb.String()
+}
+
+// Count 返回文本的 token 数，不包含 BOS 等特殊 token
+func (t *BPE) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	for _, n := range t.normalizers {
+		text = n(text)
+	}
+	pieces := []string{text}
+	for _, p := range t.preTokenizer {
+		pieces = p(pieces)
+	}
+	count := 0
+	for _, piece := range pieces {
+		count += t.countPiece(piece)
+	}
+	return count
+}
+
+func (t *BPE) countPiece(piece string) int {
+	if piece == "" {
+		return 0
+	}
+	if t.ignoreMerges {
+		if _, ok := t.vocab[piece]; ok {
+			return 1
+		}
+	}
+	if count, found, _ := t.pieceCache.Get(piece); found {
+		return count
+	}
+	count := t.mergePiece(piece)
+	t.pieceCache.Set(piece, count)
+	return count
+}
+
+// bpeSymbol 合并过程中的符号，以双向链表连接；size 为 0 表示已被合并到左侧符号
+type bpeSymbol struct {
+	id   int
+	size int
+	prev int
+	next int
+}
+
+type mergeCandidate struct {
+	rank   int
+	pos    int
+	left   int
+	right  int
+	merged int
+}
+
+// mergeQueue 按 rank 排序的候选合并，rank 相同时先合并靠左的
+type mergeQueue []mergeCandidate
+
+func (q mergeQueue) Len() int { return len(q) }
+func (q mergeQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].pos < q[j].pos
+}
+func (q mergeQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *mergeQueue) Push(x any)   { *q = append(*q, x.(mergeCandidate)) }
+func (q *mergeQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// mergePiece 按 merges 的优先级合并片段内的符号并返回 token 数
+func (t *BPE) mergePiece(piece string) int {
+	symbols := make([]bpeSymbol, 0, utf8.RuneCountInString(piece))
+	for i := 0; i < len(piece); {
+		_, size := utf8.DecodeRuneInString(piece[i:])
+		id, ok := t.symbolIds[piece[i:i+size]]
+		if !ok {
+			id = -1
+		}
+		symbols = append(symbols, bpeSymbol{id: id, size: size, prev: len(symbols) - 1, next: len(symbols) + 1})
+		i += size
+	}
+	symbols[len(symbols)-1].next = -1
+
+	queue := make(mergeQueue, 0, len(symbols))
+	for i := 0; i < len(symbols)-1; i++ {
+		t.pushMerge(&queue, symbols, i)
+	}
+	for queue.Len() > 0 {
+		candidate := heap.Pop(&queue).(mergeCandidate)
+		left := &symbols[candidate.pos]
+		if left.size == 0 || left.next < 0 {
+			continue
+		}
+		right := &symbols[left.next]
+		// 两侧符号已参与其他合并时候选失效
+		if left.id != candidate.left || right.id != candidate.right {
+			continue
+		}
+		left.id = candidate.merged
+		left.size += right.size
+		left.next = right.next
+		right.size = 0
+		if left.next >= 0 {
+			symbols[left.next].prev = candidate.pos
+		}
+		if left.prev >= 0 {
+			t.pushMerge(&queue, symbols, left.prev)
+		}
+		t.pushMerge(&queue, symbols, candidate.pos)
+	}
+
+	count := 0
+	for i := 0; i >= 0; i = symbols[i].next {
+		symbol := symbols[i]
+		if t.byteFallback && (symbol.id < 0 || !t.inVocab[symbol.id]) {
+			// 词表外的字符按 UTF-8 字节逐个回退为 <0xXX>
+			count += symbol.size
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+func (t *BPE) pushMerge(queue *mergeQueue, symbols []bpeSymbol, pos int) {
+	next := symbols[pos].next
+	if next < 0 || symbols[pos].id < 0 || symbols[next].id < 0 {
+		return
+	}
+	rule, ok := t.merges[mergePair{left: symbols[pos].id, right: symbols[next].id}]
+	if !ok {
+		return
+	}
+	heap.Push(queue, mergeCandidate{rank: rule.rank, pos: pos, left: symbols[pos].id, right: symbols[next].id, merged: rule.merged})
+}
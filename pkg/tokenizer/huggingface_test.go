@@ -0,0 +1,73 @@
+package tokenizer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadHuggingFaceByteLevel(t *testing.T) {
+	tok, err := LoadHuggingFace(strings.NewReader(`{
+		"normalizer": {"type": "NFC"},
+		"pre_tokenizer": {"type": "Sequence", "pretokenizers": [
+			{"type": "Split", "pattern": {"Regex": "\\s*[\\p{L}]+|[^\\s\\p{L}]"}, "behavior": "Isolated", "invert": false},
+			{"type": "ByteLevel", "add_prefix_space": false, "use_regex": false}
+		]},
+		"model": {"type": "BPE", "vocab": {
+			"h": 0, "e": 1, "l": 2, "o": 3, "Ġ": 4, "w": 5, "r": 6, "d": 7, "!": 8,
+			"he": 9, "ll": 10, "hell": 11, "hello": 12, "Ġw": 13, "or": 14, "Ġwor": 15, "Ġworl": 16, "Ġworld": 17
+		}, "merges": ["h e", "l l", ["he", "ll"], "hell o", "Ġ w", "o r", "Ġw or", "Ġwor l", "Ġworl d"]}
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, tok.Count("hello world"))
+	assert.Equal(t, 3, tok.Count("hello world!"))
+	// "he" 合并后剩余字符各算一个 token
+	assert.Equal(t, 3, tok.Count("held"))
+	assert.Equal(t, 0, tok.Count(""))
+}
+
+func TestLoadHuggingFaceMetaspaceByteFallback(t *testing.T) {
+	tok, err := LoadHuggingFace(strings.NewReader(`{
+		"pre_tokenizer": {"type": "Metaspace", "replacement": "▁", "prepend_scheme": "always", "split": true},
+		"model": {"type": "BPE", "byte_fallback": true, "vocab": {
+			"▁": 0, "h": 1, "i": 2, "▁h": 3, "▁hi": 4
+		}, "merges": ["▁ h", "▁h i"]}
+	}`))
+	require.NoError(t, err)
+
+	// "▁hi" 一个 token，"▁" 一个 token，"你" 回退为 3 个字节 token
+	assert.Equal(t, 5, tok.Count("hi 你"))
+}
+
+func TestLoadHuggingFaceRejectsUnsupportedModel(t *testing.T) {
+	_, err := LoadHuggingFace(strings.NewReader(`{"model": {"type": "WordPiece", "vocab": {"a": 0}}}`))
+	assert.Error(t, err)
+}
+
+func TestBPEMergesByRankAcrossRepeatedSymbols(t *testing.T) {
+	tok, err := LoadHuggingFace(strings.NewReader(`{
+		"model": {"type": "BPE", "vocab": {"a": 0, "b": 1, "aa": 2, "aaaa": 3, "ab": 4},
+			"merges": ["a b", "a a", "aa aa"]}
+	}`))
+	require.NoError(t, err)
+
+	// "a b" 优先级最高："aaab" 先合并为 a a ab，再合并为 aa ab
+	assert.Equal(t, 2, tok.Count("aaab"))
+	assert.Equal(t, 1, tok.Count("aaaa"))
+	// aaaa + a
+	assert.Equal(t, 2, tok.Count("aaaaa"))
+	// 第二次计数命中片段缓存
+	assert.Equal(t, 2, tok.Count("aaaaa"))
+}
+
+func TestSplitByRegexKeepsRemainderOnTimeout(t *testing.T) {
+	re := mustCompileRegex(`(a+)+b`)
+	re.MatchTimeout = time.Millisecond
+	input := "x " + strings.Repeat("a", 40) + "c"
+	pieces := splitByRegex(re, input, false)
+	assert.Equal(t, input, strings.Join(pieces, ""))
+}
@@ -116,7 +116,7 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 		return nil, errors.New("request is nil")
 	}
 	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
+	if IsNovaModel(request.Model) {
 		novaReq := convertToNovaRequest(request)
 		a.IsNova = true
 		return novaReq, nil
@@ -141,8 +141,15 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	if IsNovaModel(request.Model) {
+		return nil, errors.New("responses api is not supported for nova models")
+	}
+	claudeReq, err := claude.RequestResponses2ClaudeMessage(c, &request)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert responses request to claude request")
+	}
+	info.UpstreamModelName = claudeReq.Model
+	return claudeReq, nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
@@ -150,6 +150,6 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 var ChannelName = "aws"
 
 // 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
+func IsNovaModel(modelId string) bool {
 	return strings.Contains(modelId, "nova-")
 }
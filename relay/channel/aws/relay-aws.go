@@ -115,7 +115,7 @@ func doAwsClientRequest(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor,
 		requestHeader.Set(key, value)
 	}
 
-	if isNovaModel(awsModelId) {
+	if IsNovaModel(awsModelId) {
 		var novaReq *NovaRequest
 		err = common.DecodeJson(requestBody, &novaReq)
 		if err != nil {
@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestGemini2ClaudeMessage 将 Gemini generateContent 请求经 OpenAI 格式转换为 Claude Messages 请求
+func RequestGemini2ClaudeMessage(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (*dto.ClaudeRequest, error) {
+	openaiRequest, err := service.GeminiToOpenAIRequest(request, info)
+	if err != nil {
+		return nil, err
+	}
+	return RequestOpenAI2ClaudeMessage(c, *openaiRequest)
+}
+
+// geminiStream 返回把 Claude 流式响应输出为 Gemini 格式的转换器，按原始请求决定是否输出思考内容
+func (claudeInfo *ClaudeResponseInfo) geminiStream(info *relaycommon.RelayInfo) *service.ChatToGeminiStream {
+	if claudeInfo.geminiConverter == nil {
+		includeThoughts := false
+		if request, ok := info.Request.(*dto.GeminiChatRequest); ok && request.GenerationConfig.ThinkingConfig != nil {
+			includeThoughts = request.GenerationConfig.ThinkingConfig.IncludeThoughts
+		}
+		claudeInfo.geminiConverter = service.NewChatToGeminiStream(info, includeThoughts)
+	}
+	return claudeInfo.geminiConverter
+}
+
+func handleGeminiStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) {
+	response := StreamResponseClaude2OpenAI(claudeResponse)
+	if !FormatClaudeResponseInfo(claudeResponse, response, claudeInfo) {
+		return
+	}
+	geminiResponse := claudeInfo.geminiStream(info).Chunk(response)
+	if geminiResponse == nil {
+		return
+	}
+	if err := helper.ObjectData(c, geminiResponse); err != nil {
+		logger.LogError(c, "send_stream_response_failed: "+err.Error())
+	}
+}
+
+func handleGeminiStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo) {
+	usage := buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+	if err := helper.ObjectData(c, claudeInfo.geminiStream(info).Finish(&usage)); err != nil {
+		common.SysLog("send final response failed: " + err.Error())
+	}
+}
+
+func responseClaude2Gemini(claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo, info *relaycommon.RelayInfo) *dto.GeminiChatResponse {
+	openaiResponse := ResponseClaude2OpenAI(claudeResponse)
+	openaiResponse.Usage = buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+	return service.ResponseOpenAI2Gemini(openaiResponse, info)
+}
@@ -0,0 +1,235 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesInputItem Responses 请求 input 数组中转换为 Claude 消息所需的字段
+type responsesInputItem struct {
+	Type             string                              `json:"type"`
+	Role             string                              `json:"role"`
+	Content          json.RawMessage                     `json:"content"`
+	CallId           string                              `json:"call_id"`
+	Name             string                              `json:"name"`
+	Arguments        json.RawMessage                     `json:"arguments"`
+	Output           json.RawMessage                     `json:"output"`
+	Summary          []dto.ResponsesReasoningSummaryPart `json:"summary"`
+	EncryptedContent string                              `json:"encrypted_content"`
+}
+
+// RequestResponses2ClaudeMessage 将 Responses API 请求直接转换为 Claude Messages 请求。
+// 采样参数、工具与思考配置沿用 OpenAI 格式的转换，input 逐项转换为内容块，
+// 推理项的 encrypted_content 还原为带签名的 thinking（或 redacted_thinking）块
+func RequestResponses2ClaudeMessage(c *gin.Context, request *dto.OpenAIResponsesRequest) (*dto.ClaudeRequest, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	// 网关未保存历史时无法解析 previous_response_id，Claude 上游也不保存响应
+	if request.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported for claude upstream")
+	}
+	paramsRequest := *request
+	paramsRequest.Input = nil
+	openaiRequest, err := service.ResponsesRequestToChatCompletionsRequest(&paramsRequest)
+	if err != nil {
+		return nil, err
+	}
+	claudeRequest, err := RequestOpenAI2ClaudeMessage(c, *openaiRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	var systemMessages []dto.ClaudeMediaMessage
+	if system, ok := claudeRequest.System.([]dto.ClaudeMediaMessage); ok {
+		systemMessages = system
+	}
+	messages := make([]dto.ClaudeMessage, 0)
+	appendBlocks := func(role string, blocks ...dto.ClaudeMediaMessage) {
+		if len(blocks) == 0 {
+			return
+		}
+		// 连续的同角色内容合并为一条消息，Claude 要求 user 与 assistant 交替
+		if n := len(messages); n > 0 && messages[n-1].Role == role {
+			messages[n-1].Content = append(messages[n-1].Content.([]dto.ClaudeMediaMessage), blocks...)
+			return
+		}
+		messages = append(messages, dto.ClaudeMessage{Role: role, Content: blocks})
+	}
+
+	switch common.GetJsonType(request.Input) {
+	case "unknown", "null":
+	case "string":
+		var text string
+		if err := common.Unmarshal(request.Input, &text); err != nil {
+			return nil, err
+		}
+		appendBlocks("user", claudeTextBlock(text))
+	case "array":
+		var items []responsesInputItem
+		if err := common.Unmarshal(request.Input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		for _, item := range items {
+			switch item.Type {
+			case "", "message":
+				role := strings.TrimSpace(item.Role)
+				if role == "" {
+					role = "user"
+				}
+				blocks, err := responsesContentToClaudeBlocks(c, role, item.Content)
+				if err != nil {
+					return nil, err
+				}
+				switch role {
+				case "system", "developer":
+					for _, block := range blocks {
+						if block.Type == "text" {
+							systemMessages = append(systemMessages, block)
+						}
+					}
+				case "assistant":
+					appendBlocks("assistant", blocks...)
+				default:
+					appendBlocks("user", blocks...)
+				}
+			case "function_call":
+				input := make(map[string]any)
+				if arguments := dto.ResponsesArgumentsString(item.Arguments); arguments != "" {
+					if err := common.UnmarshalJsonStr(arguments, &input); err != nil {
+						return nil, fmt.Errorf("invalid arguments for function call %s: %w", item.CallId, err)
+					}
+				}
+				appendBlocks("assistant", dto.ClaudeMediaMessage{
+					Type:  "tool_use",
+					Id:    item.CallId,
+					Name:  item.Name,
+					Input: input,
+				})
+			case "function_call_output":
+				appendBlocks("user", dto.ClaudeMediaMessage{
+					Type:      "tool_result",
+					ToolUseId: item.CallId,
+					Content:   service.ResponsesOutputToString(item.Output),
+				})
+			case "reasoning":
+				// 没有签名的推理内容无法回传给 Claude，按上游的做法丢弃
+				if item.EncryptedContent == "" {
+					continue
+				}
+				if data, ok := strings.CutPrefix(item.EncryptedContent, openaicompat.ClaudeRedactedThinkingPrefix); ok {
+					appendBlocks("assistant", dto.ClaudeMediaMessage{Type: "redacted_thinking", Data: data})
+					continue
+				}
+				var thinking strings.Builder
+				for _, part := range item.Summary {
+					thinking.WriteString(part.Text)
+				}
+				appendBlocks("assistant", dto.ClaudeMediaMessage{
+					Type:      "thinking",
+					Thinking:  common.GetPointer[string](thinking.String()),
+					Signature: item.EncryptedContent,
+				})
+			default:
+				// item_reference 等依赖 OpenAI 服务端状态的输入项无法回放
+				return nil, fmt.Errorf("input item type %s is not supported for claude upstream", item.Type)
+			}
+		}
+	default:
+		return nil, errors.New("input must be a string or an array")
+	}
+
+	if len(messages) > 0 && messages[0].Role != "user" {
+		messages = append([]dto.ClaudeMessage{{Role: "user", Content: []dto.ClaudeMediaMessage{claudeTextBlock("...")}}}, messages...)
+	}
+	if len(systemMessages) > 0 {
+		claudeRequest.System = systemMessages
+	}
+	claudeRequest.Messages = messages
+	return claudeRequest, nil
+}
+
+func claudeTextBlock(text string) dto.ClaudeMediaMessage {
+	if text == "" {
+		text = "..."
+	}
+	return dto.ClaudeMediaMessage{Type: "text", Text: common.GetPointer[string](text)}
+}
+
+// responsesContentToClaudeBlocks 将 Responses 消息内容转换为 Claude 内容块
+func responsesContentToClaudeBlocks(c *gin.Context, role string, raw json.RawMessage) ([]dto.ClaudeMediaMessage, error) {
+	content, err := service.ResponsesContentToChat(role, raw)
+	if err != nil {
+		return nil, err
+	}
+	if text, ok := content.(string); ok {
+		return []dto.ClaudeMediaMessage{claudeTextBlock(text)}, nil
+	}
+	blocks := make([]dto.ClaudeMediaMessage, 0)
+	for _, part := range content.([]dto.MediaContent) {
+		if part.Type == dto.ContentTypeText {
+			if part.Text != "" {
+				blocks = append(blocks, claudeTextBlock(part.Text))
+			}
+			continue
+		}
+		block, err := claudeMediaFromOpenAIContent(c, part)
+		if err != nil {
+			return nil, err
+		}
+		if block != nil {
+			blocks = append(blocks, *block)
+		}
+	}
+	return blocks, nil
+}
+
+func responsesIdFromContext(c *gin.Context) string {
+	return "resp_" + c.GetString(common.RequestIdKey)
+}
+
+// responsesStream 返回把 Claude 流式响应输出为 Responses 格式的转换器
+func (claudeInfo *ClaudeResponseInfo) responsesStream(c *gin.Context, info *relaycommon.RelayInfo) *openaicompat.ClaudeToResponsesStream {
+	if claudeInfo.responsesConverter == nil {
+		claudeInfo.responsesConverter = service.NewClaudeToResponsesStream(responsesIdFromContext(c), info.OriginModelName, int(claudeInfo.Created))
+	}
+	return claudeInfo.responsesConverter
+}
+
+func sendResponsesStreamEvents(c *gin.Context, events []dto.ResponsesStreamResponse) {
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			logger.LogError(c, "failed to marshal responses stream event: "+err.Error())
+			continue
+		}
+		helper.ResponseChunkData(c, event, string(data))
+	}
+}
+
+func handleResponsesStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, claudeResponse *dto.ClaudeResponse) {
+	FormatClaudeResponseInfo(claudeResponse, nil, claudeInfo)
+	sendResponsesStreamEvents(c, claudeInfo.responsesStream(c, info).Event(claudeResponse))
+}
+
+func handleResponsesStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo) {
+	usage := buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+	sendResponsesStreamEvents(c, claudeInfo.responsesStream(c, info).Finish(&usage))
+}
+
+func responseClaude2Responses(c *gin.Context, claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo, info *relaycommon.RelayInfo) *dto.OpenAIResponsesResponse {
+	usage := buildOpenAIStyleUsageFromClaudeUsage(claudeInfo.Usage)
+	return service.ClaudeResponseToResponsesResponse(claudeResponse, responsesIdFromContext(c), info.OriginModelName, int(claudeInfo.Created), &usage)
+}
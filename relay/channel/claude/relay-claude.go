@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/relay/reasonmap"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/openaicompat"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/setting/reasoning"
 	"github.com/QuantumNous/new-api/types"
@@ -377,29 +378,13 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 							})
 						}
 					default:
-						source := mediaMessage.ToFileSource()
-						if source == nil {
-							continue
-						}
-						base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Claude")
+						claudeMediaMessage, err := claudeMediaFromOpenAIContent(c, mediaMessage)
 						if err != nil {
-							return nil, fmt.Errorf("get file data failed: %s", err.Error())
-						}
-						claudeMediaMessage := dto.ClaudeMediaMessage{
-							Source: &dto.ClaudeMessageSource{
-								Type: "base64",
-							},
+							return nil, err
 						}
-						if strings.HasPrefix(mimeType, "application/pdf") {
-							claudeMediaMessage.Type = "document"
-						} else {
-							claudeMediaMessage.Type = "image"
+						if claudeMediaMessage != nil {
+							claudeMediaMessages = append(claudeMediaMessages, *claudeMediaMessage)
 						}
-
-						claudeMediaMessage.Source.MediaType = mimeType
-						claudeMediaMessage.Source.Data = base64Data
-						claudeMediaMessages = append(claudeMediaMessages, claudeMediaMessage)
-						continue
 					}
 				}
 
@@ -434,6 +419,32 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 	return &claudeRequest, nil
 }
 
+// claudeMediaFromOpenAIContent 将图片、PDF 等文件内容转换为 Claude 的 base64 内容块，无法获取文件来源时返回 nil
+func claudeMediaFromOpenAIContent(c *gin.Context, mediaMessage dto.MediaContent) (*dto.ClaudeMediaMessage, error) {
+	source := mediaMessage.ToFileSource()
+	if source == nil {
+		return nil, nil
+	}
+	base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting image for Claude")
+	if err != nil {
+		return nil, fmt.Errorf("get file data failed: %s", err.Error())
+	}
+	claudeMediaMessage := &dto.ClaudeMediaMessage{
+		Source: &dto.ClaudeMessageSource{
+			Type: "base64",
+		},
+	}
+	if strings.HasPrefix(mimeType, "application/pdf") {
+		claudeMediaMessage.Type = "document"
+	} else {
+		claudeMediaMessage.Type = "image"
+	}
+
+	claudeMediaMessage.Source.MediaType = mimeType
+	claudeMediaMessage.Source.Data = base64Data
+	return claudeMediaMessage, nil
+}
+
 func StreamResponseClaude2OpenAI(claudeResponse *dto.ClaudeResponse) *dto.ChatCompletionsStreamResponse {
 	var response dto.ChatCompletionsStreamResponse
 	response.Object = "chat.completion.chunk"
@@ -588,6 +599,9 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+
+	geminiConverter    *service.ChatToGeminiStream
+	responsesConverter *openaicompat.ClaudeToResponsesStream
 }
 
 func cacheCreationTokensForOpenAIUsage(usage *dto.Usage) int {
@@ -826,6 +840,10 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if err != nil {
 			logger.LogError(c, "send_stream_response_failed: "+err.Error())
 		}
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		handleGeminiStreamResponseData(c, info, claudeInfo, &claudeResponse)
+	} else if info.RelayFormat == types.RelayFormatOpenAIResponses {
+		handleResponsesStreamResponseData(c, info, claudeInfo, &claudeResponse)
 	}
 	return nil
 }
@@ -865,6 +883,10 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 			}
 		}
 		helper.Done(c)
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		handleGeminiStreamFinalResponse(c, info, claudeInfo)
+	} else if info.RelayFormat == types.RelayFormatOpenAIResponses {
+		handleResponsesStreamFinalResponse(c, info, claudeInfo)
 	}
 }
 
@@ -925,6 +947,16 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 	case types.RelayFormatClaude:
 		responseData = data
+	case types.RelayFormatGemini:
+		responseData, err = common.Marshal(responseClaude2Gemini(&claudeResponse, claudeInfo, info))
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
+	case types.RelayFormatOpenAIResponses:
+		responseData, err = common.Marshal(responseClaude2Responses(c, &claudeResponse, claudeInfo, info))
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
 	}
 
 	if claudeResponse.Usage != nil && claudeResponse.Usage.ServerToolUse != nil && claudeResponse.Usage.ServerToolUse.WebSearchRequests > 0 {
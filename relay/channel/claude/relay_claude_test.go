@@ -2,10 +2,15 @@ package claude
 
 import (
 	"encoding/base64"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/require"
 )
 
@@ -380,3 +385,208 @@ func TestRequestOpenAI2ClaudeMessage_ConvertsTextFileContentToText(t *testing.T)
 	require.NotNil(t, content[0].Text)
 	require.Equal(t, "alpha\nbeta", *content[0].Text)
 }
+
+func TestRequestGemini2ClaudeMessage(t *testing.T) {
+	var request dto.GeminiChatRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"systemInstruction":{"parts":[{"text":"be brief"}]},
+		"contents":[{"role":"user","parts":[{"text":"weather?"}]}],
+		"tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"OBJECT","properties":{"city":{"type":"STRING"}}}}]}],
+		"generationConfig":{"maxOutputTokens":128}
+	}`, &request))
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "claude-sonnet-4"}}
+
+	claudeRequest, err := RequestGemini2ClaudeMessage(nil, info, &request)
+	require.NoError(t, err)
+	require.Equal(t, "claude-sonnet-4", claudeRequest.Model)
+	require.Equal(t, uint(128), *claudeRequest.MaxTokens)
+	require.Len(t, claudeRequest.Messages, 1)
+	require.NotNil(t, claudeRequest.System)
+	require.Len(t, claudeRequest.Tools, 1)
+}
+
+func TestResponseClaude2Gemini(t *testing.T) {
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}
+	claudeResponse := &dto.ClaudeResponse{
+		Id:         "msg_1",
+		Type:       "message",
+		Role:       "assistant",
+		StopReason: "max_tokens",
+		Content:    []dto.ClaudeMediaMessage{{Type: "text", Text: common.GetPointer("hello")}},
+	}
+
+	geminiResponse := responseClaude2Gemini(claudeResponse, claudeInfo, &relaycommon.RelayInfo{})
+	require.Len(t, geminiResponse.Candidates, 1)
+	require.Equal(t, "hello", geminiResponse.Candidates[0].Content.Parts[0].Text)
+	require.Equal(t, "MAX_TOKENS", *geminiResponse.Candidates[0].FinishReason)
+	require.Equal(t, 10, geminiResponse.UsageMetadata.PromptTokenCount)
+	require.Equal(t, 5, geminiResponse.UsageMetadata.CandidatesTokenCount)
+}
+
+func TestRequestResponses2ClaudeMessage(t *testing.T) {
+	request := dto.OpenAIResponsesRequest{
+		Model:        "claude-sonnet-4",
+		Instructions: []byte(`"be brief"`),
+		Input: []byte(`[
+			{"role":"developer","content":"use tools"},
+			{"role":"user","content":[{"type":"input_text","text":"weather?"}]},
+			{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"need a tool"}],"encrypted_content":"sig_1"},
+			{"type":"reasoning","id":"rs_2","summary":[],"encrypted_content":"claude_redacted_thinking:opaque"},
+			{"type":"reasoning","id":"rs_3","summary":[{"type":"summary_text","text":"unsigned"}]},
+			{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+			{"type":"function_call_output","call_id":"call_1","output":"sunny"},
+			{"role":"assistant","content":[{"type":"output_text","text":"It is sunny."}]}
+		]`),
+		Tools:     []byte(`[{"type":"function","name":"get_weather","parameters":{"type":"object","properties":{"city":{"type":"string"}}}}]`),
+		Reasoning: &dto.Reasoning{Effort: "high"},
+	}
+
+	claudeRequest, err := RequestResponses2ClaudeMessage(nil, &request)
+	require.NoError(t, err)
+	require.Len(t, claudeRequest.Tools, 1)
+	require.NotNil(t, claudeRequest.Thinking)
+
+	system := claudeRequest.System.([]dto.ClaudeMediaMessage)
+	require.Len(t, system, 2)
+	require.Equal(t, "be brief", system[0].GetText())
+	require.Equal(t, "use tools", system[1].GetText())
+
+	require.Len(t, claudeRequest.Messages, 4)
+	require.Equal(t, "user", claudeRequest.Messages[0].Role)
+
+	assistant := claudeRequest.Messages[1]
+	require.Equal(t, "assistant", assistant.Role)
+	blocks := assistant.Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, blocks, 3)
+	require.Equal(t, "thinking", blocks[0].Type)
+	require.Equal(t, "need a tool", *blocks[0].Thinking)
+	require.Equal(t, "sig_1", blocks[0].Signature)
+	require.Equal(t, "redacted_thinking", blocks[1].Type)
+	require.Equal(t, "opaque", blocks[1].Data)
+	require.Equal(t, "tool_use", blocks[2].Type)
+	require.Equal(t, "call_1", blocks[2].Id)
+	require.Equal(t, map[string]any{"city": "Paris"}, blocks[2].Input)
+
+	toolResult := claudeRequest.Messages[2].Content.([]dto.ClaudeMediaMessage)
+	require.Equal(t, "user", claudeRequest.Messages[2].Role)
+	require.Equal(t, "tool_result", toolResult[0].Type)
+	require.Equal(t, "call_1", toolResult[0].ToolUseId)
+	require.Equal(t, "sunny", toolResult[0].Content)
+	require.Equal(t, "assistant", claudeRequest.Messages[3].Role)
+
+	request.Input = []byte(`[{"type":"item_reference","id":"msg_1"}]`)
+	_, err = RequestResponses2ClaudeMessage(nil, &request)
+	require.Error(t, err)
+}
+
+func TestHandleClaudeResponseDataResponsesRoundTripsThinking(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Set(common.RequestIdKey, "req1")
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		OriginModelName: "claude-sonnet-4",
+		ChannelMeta:     &relaycommon.ChannelMeta{UpstreamModelName: "claude-sonnet-4"},
+	}
+	claudeInfo := &ClaudeResponseInfo{Created: 1700000000, Usage: &dto.Usage{}}
+	body := `{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","stop_reason":"tool_use",
+		"content":[
+			{"type":"thinking","thinking":"need a tool","signature":"sig_1"},
+			{"type":"text","text":"checking"},
+			{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{"city":"Paris"}}
+		],
+		"usage":{"input_tokens":10,"output_tokens":5}}`
+
+	require.Nil(t, HandleClaudeResponseData(c, info, claudeInfo, nil, []byte(body)))
+
+	var response dto.OpenAIResponsesResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "resp_req1", response.ID)
+	require.Equal(t, "claude-sonnet-4", response.Model)
+	require.Len(t, response.Output, 3)
+	require.Equal(t, "reasoning", response.Output[0].Type)
+	require.Equal(t, "sig_1", response.Output[0].EncryptedContent)
+	require.Equal(t, "message", response.Output[1].Type)
+	require.Equal(t, "function_call", response.Output[2].Type)
+	require.Equal(t, "toolu_1", response.Output[2].CallId)
+	require.Equal(t, 10, response.Usage.InputTokens)
+
+	// 把本轮输出连同工具结果作为下一轮输入，thinking 块与签名应原样回到 Claude
+	var outputItems []any
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &struct {
+		Output *[]any `json:"output"`
+	}{Output: &outputItems}))
+	outputItems = append(outputItems, map[string]any{"type": "function_call_output", "call_id": "toolu_1", "output": "sunny"})
+	input, err := common.Marshal(append([]any{map[string]any{"role": "user", "content": "weather?"}}, outputItems...))
+	require.NoError(t, err)
+
+	claudeRequest, err := RequestResponses2ClaudeMessage(nil, &dto.OpenAIResponsesRequest{Model: "claude-sonnet-4", Input: input})
+	require.NoError(t, err)
+	require.Len(t, claudeRequest.Messages, 3)
+	blocks := claudeRequest.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, blocks, 3)
+	require.Equal(t, "thinking", blocks[0].Type)
+	require.Equal(t, "need a tool", *blocks[0].Thinking)
+	require.Equal(t, "sig_1", blocks[0].Signature)
+	require.Equal(t, "text", blocks[1].Type)
+	require.Equal(t, "tool_use", blocks[2].Type)
+	require.Equal(t, "toolu_1", blocks[2].Id)
+}
+
+func TestHandleStreamResponseDataResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Set(common.RequestIdKey, "req1")
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatOpenAIResponses,
+		OriginModelName: "claude-sonnet-4",
+		ChannelMeta:     &relaycommon.ChannelMeta{UpstreamModelName: "claude-sonnet-4"},
+	}
+	claudeInfo := &ClaudeResponseInfo{Created: 1700000000, Usage: &dto.Usage{}}
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"need "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"a tool"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig_1"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"opaque"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"content_block_start","index":2,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":2,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`{"type":"content_block_stop","index":2}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":7}}`,
+		`{"type":"message_stop"}`,
+	}
+	for _, event := range events {
+		require.Nil(t, HandleStreamResponseData(c, info, claudeInfo, event))
+	}
+	HandleStreamFinalResponse(c, info, claudeInfo)
+
+	var completed *dto.ResponsesStreamResponse
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var event dto.ResponsesStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(data, &event))
+		if event.Type == "response.completed" {
+			completed = &event
+		}
+	}
+	require.NotNil(t, completed)
+	output := completed.Response.Output
+	require.Len(t, output, 3)
+	require.Equal(t, "reasoning", output[0].Type)
+	require.Equal(t, "need a tool", output[0].Summary[0].Text)
+	require.Equal(t, "sig_1", output[0].EncryptedContent)
+	require.Equal(t, "claude_redacted_thinking:opaque", output[1].EncryptedContent)
+	require.Equal(t, "function_call", output[2].Type)
+	require.Equal(t, `{"city":"Paris"}`, dto.ResponsesArgumentsString(output[2].Arguments))
+	require.Equal(t, 10, completed.Response.Usage.InputTokens)
+	require.Equal(t, 7, completed.Response.Usage.OutputTokens)
+}
@@ -319,8 +319,17 @@ func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.Rela
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
-	// TODO implement me
-	return nil, errors.New("not implemented")
+	if a.RequestMode != RequestModeClaude {
+		return nil, errors.New("responses api is only supported for claude models")
+	}
+	claudeReq, err := claude.RequestResponses2ClaudeMessage(c, &request)
+	if err != nil {
+		return nil, err
+	}
+	vertexClaudeReq := copyRequest(claudeReq, anthropicVersion)
+	c.Set("request_model", claudeReq.Model)
+	info.UpstreamModelName = claudeReq.Model
+	return vertexClaudeReq, nil
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
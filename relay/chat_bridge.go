@@ -0,0 +1,335 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatBridgeConverter 将适配器输出的 Chat Completions 响应转换为客户端请求的格式
+type chatBridgeConverter interface {
+	// streamChunk 转换一个流式分片，返回需要写出的 SSE 数据
+	streamChunk(chunk *dto.ChatCompletionsStreamResponse) string
+	// streamFinish 流结束时返回需要写出的 SSE 数据
+	streamFinish(usage *dto.Usage) string
+	// convertBody 转换非流式响应
+	convertBody(resp *dto.OpenAITextResponse) any
+}
+
+// chatBridgeWriter 拦截适配器写出的 Chat Completions 响应，经 converter 转换后写给客户端
+type chatBridgeWriter struct {
+	gin.ResponseWriter
+	c         *gin.Context
+	isStream  bool
+	converter chatBridgeConverter
+	buf       bytes.Buffer
+	status    int
+}
+
+func newChatBridgeWriter(c *gin.Context, isStream bool, converter chatBridgeConverter) *chatBridgeWriter {
+	return &chatBridgeWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		isStream:       isStream,
+		converter:      converter,
+		status:         http.StatusOK,
+	}
+}
+
+func (w *chatBridgeWriter) WriteHeader(code int) {
+	if w.isStream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	// 非流式响应在转换完成后再写出状态码，避免提前发送 Content-Length
+	w.status = code
+}
+
+func (w *chatBridgeWriter) WriteHeaderNow() {
+	if w.isStream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *chatBridgeWriter) Flush() {
+	if w.isStream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *chatBridgeWriter) Write(data []byte) (int, error) {
+	w.buf.Write(data)
+	if w.isStream {
+		w.processLines()
+	}
+	return len(data), nil
+}
+
+func (w *chatBridgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// processLines 逐行解析 SSE 中的 Chat Completions 分片，不完整的行留到下次写入
+func (w *chatBridgeWriter) processLines() {
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// 未读到换行，放回缓冲区
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			return
+		}
+		line = strings.TrimSpace(line)
+		payload, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		payload = strings.TrimSpace(payload)
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		var chunk dto.ChatCompletionsStreamResponse
+		if err := common.UnmarshalJsonStr(payload, &chunk); err != nil {
+			logger.LogError(w.c, "failed to parse chat completions chunk: "+err.Error())
+			continue
+		}
+		if data := w.converter.streamChunk(&chunk); data != "" {
+			_, _ = w.ResponseWriter.WriteString(data)
+		}
+	}
+}
+
+// finish 输出流式结束数据或转换后的响应体
+func (w *chatBridgeWriter) finish(usage *dto.Usage) {
+	if w.isStream {
+		w.processLines()
+		if data := w.converter.streamFinish(usage); data != "" {
+			_, _ = w.ResponseWriter.WriteString(data)
+		}
+		w.ResponseWriter.Flush()
+		return
+	}
+
+	body := w.buf.Bytes()
+	header := w.ResponseWriter.Header()
+	// 无法识别的响应体原样返回
+	var chatResp dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &chatResp); err == nil && chatResp.Error == nil {
+		if usage != nil {
+			chatResp.Usage = *usage
+		}
+		if data, err := common.Marshal(w.converter.convertBody(&chatResp)); err == nil {
+			body = data
+			header.Set("Content-Type", "application/json")
+		}
+	}
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(body)
+}
+
+// responsesBridgeConverter 输出 Responses API 格式
+type responsesBridgeConverter struct {
+	c         *gin.Context
+	id        string
+	createdAt int
+	stream    *openaicompat.ChatToResponsesStream
+	started   bool
+}
+
+func newResponsesBridgeConverter(c *gin.Context, id string, model string) *responsesBridgeConverter {
+	createdAt := int(time.Now().Unix())
+	return &responsesBridgeConverter{
+		c:         c,
+		id:        id,
+		createdAt: createdAt,
+		stream:    service.NewChatToResponsesStream(id, model, createdAt),
+	}
+}
+
+func (r *responsesBridgeConverter) render(events []dto.ResponsesStreamResponse) string {
+	var sb strings.Builder
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			logger.LogError(r.c, "failed to marshal responses stream event: "+err.Error())
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("event: %s\ndata: %s\n\n", event.Type, data))
+	}
+	return sb.String()
+}
+
+func (r *responsesBridgeConverter) start() string {
+	if r.started {
+		return ""
+	}
+	r.started = true
+	return r.render(r.stream.Start())
+}
+
+func (r *responsesBridgeConverter) streamChunk(chunk *dto.ChatCompletionsStreamResponse) string {
+	return r.start() + r.render(r.stream.Chunk(chunk))
+}
+
+func (r *responsesBridgeConverter) streamFinish(usage *dto.Usage) string {
+	return r.start() + r.render(r.stream.Finish(usage))
+}
+
+func (r *responsesBridgeConverter) convertBody(resp *dto.OpenAITextResponse) any {
+	return service.ChatCompletionsResponseToResponsesResponse(resp, r.id, r.createdAt)
+}
+
+// geminiBridgeConverter 输出 Gemini generateContent 格式
+type geminiBridgeConverter struct {
+	c      *gin.Context
+	info   *relaycommon.RelayInfo
+	stream *service.ChatToGeminiStream
+}
+
+func newGeminiBridgeConverter(c *gin.Context, info *relaycommon.RelayInfo, includeThoughts bool) *geminiBridgeConverter {
+	return &geminiBridgeConverter{
+		c:      c,
+		info:   info,
+		stream: service.NewChatToGeminiStream(info, includeThoughts),
+	}
+}
+
+func (g *geminiBridgeConverter) render(resp *dto.GeminiChatResponse) string {
+	if resp == nil {
+		return ""
+	}
+	data, err := common.Marshal(resp)
+	if err != nil {
+		logger.LogError(g.c, "failed to marshal gemini response: "+err.Error())
+		return ""
+	}
+	return "data: " + string(data) + "\n\n"
+}
+
+func (g *geminiBridgeConverter) streamChunk(chunk *dto.ChatCompletionsStreamResponse) string {
+	return g.render(g.stream.Chunk(chunk))
+}
+
+func (g *geminiBridgeConverter) streamFinish(usage *dto.Usage) string {
+	return g.render(g.stream.Finish(usage))
+}
+
+func (g *geminiBridgeConverter) convertBody(resp *dto.OpenAITextResponse) any {
+	return service.ResponseOpenAI2Gemini(resp, g.info)
+}
+
+// relayViaChatCompletions 将已转换的 Chat Completions 请求交给适配器处理，再由 converter 把输出转换回客户端格式
+func relayViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, chatReq *dto.GeneralOpenAIRequest, converter chatBridgeConverter) (*dto.Usage, *types.NewAPIError) {
+	info.AppendRequestConversion(types.RelayFormatOpenAI)
+
+	savedRelayMode := info.RelayMode
+	savedRequestURLPath := info.RequestURLPath
+	savedRelayFormat := info.RelayFormat
+	savedShouldIncludeUsage := info.ShouldIncludeUsage
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RequestURLPath = savedRequestURLPath
+		info.RelayFormat = savedRelayFormat
+		info.ShouldIncludeUsage = savedShouldIncludeUsage
+	}()
+
+	// 适配器按 OpenAI Chat 格式输出，再由 chatBridgeWriter 转换
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RequestURLPath = "/v1/chat/completions"
+	info.RelayFormat = types.RelayFormatOpenAI
+	info.ShouldIncludeUsage = true
+
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, chatReq)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+	if err != nil {
+		return nil, newAPIErrorFromParamOverride(err)
+	}
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+			service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+			return nil, newAPIError
+		}
+	}
+
+	writer := newChatBridgeWriter(c, info.IsStream, converter)
+	c.Writer = writer
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	c.Writer = writer.ResponseWriter
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, newAPIError
+	}
+
+	usageDto, _ := usage.(*dto.Usage)
+	writer.finish(usageDto)
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
+	}
+	return usageDto, nil
+}
+
+// responsesViaChatCompletions 将 Responses 请求转换为 Chat Completions 交给适配器处理，再把输出转换回 Responses 格式
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest) (*dto.Usage, *types.NewAPIError) {
+	chatReq, err := service.ResponsesRequestToChatCompletionsRequest(request)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	applySystemPromptIfNeeded(c, info, chatReq)
+	converter := newResponsesBridgeConverter(c, "resp_"+c.GetString(common.RequestIdKey), info.OriginModelName)
+	return relayViaChatCompletions(c, info, adaptor, chatReq, converter)
+}
+
+// geminiViaChatCompletions 将 Gemini 请求转换为 Chat Completions 交给适配器处理，再把输出转换回 Gemini 格式。
+// 渠道系统提示词已由 GeminiHelper 合并到 systemInstruction 中
+func geminiViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.GeminiChatRequest) (*dto.Usage, *types.NewAPIError) {
+	chatReq, err := service.GeminiToOpenAIRequest(request, info)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if info.IsStream {
+		chatReq.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	includeThoughts := request.GenerationConfig.ThinkingConfig != nil && request.GenerationConfig.ThinkingConfig.IncludeThoughts
+	return relayViaChatCompletions(c, info, adaptor, chatReq, newGeminiBridgeConverter(c, info, includeThoughts))
+}
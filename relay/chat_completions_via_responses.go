@@ -81,11 +81,9 @@ func chatCompletionsViaResponses(c *gin.Context, info *relaycommon.RelayInfo, ad
 		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 	}
 
-	if len(info.ParamOverride) > 0 {
-		chatJSON, err = relaycommon.ApplyParamOverrideWithRelayInfo(chatJSON, info)
-		if err != nil {
-			return nil, newAPIErrorFromParamOverride(err)
-		}
+	chatJSON, err = relaycommon.ApplyParamOverrideWithRelayInfo(chatJSON, info)
+	if err != nil {
+		return nil, newAPIErrorFromParamOverride(err)
 	}
 
 	var overriddenChatReq dto.GeneralOpenAIRequest
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"maps"
+	"slices"
+	"sync"
+)
+
+// HedgeInfo 对冲请求中各次尝试共享的状态，首个向客户端写入数据的尝试胜出
+type HedgeInfo struct {
+	mu         sync.Mutex
+	channelIds []int
+	winner     int
+	decided    chan struct{}
+}
+
+func NewHedgeInfo() *HedgeInfo {
+	return &HedgeInfo{decided: make(chan struct{})}
+}
+
+func (h *HedgeInfo) AddChannel(channelId int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.channelIds = append(h.channelIds, channelId)
+}
+
+// ChannelIds 参与竞速的渠道，按发起顺序排列
+func (h *HedgeInfo) ChannelIds() []int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.channelIds)
+}
+
+// Claim 尝试在首次写入时调用，返回该尝试是否胜出
+func (h *HedgeInfo) Claim(attempt int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winner == 0 {
+		h.winner = attempt
+		close(h.decided)
+	}
+	return h.winner == attempt
+}
+
+// Winner 胜出的尝试编号，尚未决出时为 0
+func (h *HedgeInfo) Winner() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.winner
+}
+
+// Decided 决出胜者后关闭
+func (h *HedgeInfo) Decided() <-chan struct{} {
+	return h.decided
+}
+
+// IsHedgeLoser 对冲请求中未胜出的尝试不再结算与记录日志
+func (info *RelayInfo) IsHedgeLoser() bool {
+	if info.Hedge == nil {
+		return false
+	}
+	winner := info.Hedge.Winner()
+	return winner != 0 && winner != info.HedgeAttempt
+}
+
+// CloneForHedge 为并发的对冲尝试复制 RelayInfo，尝试过程中会被修改的字段各自独立，计费会话共享
+func (info *RelayInfo) CloneForHedge(hedge *HedgeInfo, attempt int) *RelayInfo {
+	clone := *info
+	clone.Hedge = hedge
+	clone.HedgeAttempt = attempt
+	clone.StreamStatus = nil
+	clone.RequestConversionChain = slices.Clone(info.RequestConversionChain)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.RuntimeHeadersOverride = maps.Clone(info.RuntimeHeadersOverride)
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		builtInTools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			if tool == nil {
+				continue
+			}
+			toolCopy := *tool
+			builtInTools[name] = &toolCopy
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: builtInTools}
+	}
+	return &clone
+}
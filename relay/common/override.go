@@ -169,7 +169,16 @@ func buildLegacyParamOverride(paramOverride map[string]interface{}) map[string]i
 	return legacy
 }
 
+// ApplyParamOverrideWithRelayInfo 对发往上游的请求体先做个人信息脱敏，再应用渠道参数覆盖；
+// 各接口转换后的请求体都经过这里，脱敏只在此处进行
 func ApplyParamOverrideWithRelayInfo(jsonData []byte, info *RelayInfo) ([]byte, error) {
+	if info != nil && info.PIIRedactor != nil {
+		redacted, err := info.PIIRedactor.RedactJSON(jsonData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redact pii: %w", err)
+		}
+		jsonData = redacted
+	}
 	paramOverride := getParamOverrideMap(info)
 	if len(paramOverride) == 0 {
 		return jsonData, nil
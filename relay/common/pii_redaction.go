@@ -0,0 +1,304 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// piiPlaceholderPrefix 占位符形如 [PII_EMAIL_1]
+const piiPlaceholderPrefix = "[PII_"
+
+// piiMaxPlaceholderLength 流式响应中可能被截断的占位符的最大长度
+const piiMaxPlaceholderLength = 48
+
+var piiPlaceholderRegexp = regexp.MustCompile(`\[PII_[A-Z0-9_]+_\d+\]`)
+
+var piiNameSanitizer = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// piiSkipKeys 这些字段不含用户输入的文本，不做脱敏
+var piiSkipKeys = map[string]struct{}{
+	"model":        {},
+	"role":         {},
+	"type":         {},
+	"id":           {},
+	"name":         {},
+	"tool_call_id": {},
+	"call_id":      {},
+	"url":          {},
+	"image_url":    {},
+	"file_id":      {},
+	"file_data":    {},
+	"data":         {},
+	"mime_type":    {},
+	"mimeType":     {},
+	"media_type":   {},
+	"fileUri":      {},
+	"detail":       {},
+	"format":       {},
+	"signature":    {},
+}
+
+var piiRegexpCache sync.Map
+
+type piiDetector struct {
+	name    string
+	pattern *regexp.Regexp
+	luhn    bool
+}
+
+// PIIRedactor 同一请求内相同的值使用相同的占位符，重试时沿用，响应还原时据此查找原值
+type PIIRedactor struct {
+	mu           sync.Mutex
+	detectors    []piiDetector
+	placeholders map[string]string
+	values       map[string]string
+	sequences    map[string]int
+	counts       map[string]int
+	restored     int
+}
+
+// NewPIIRedactor 请求未开启脱敏或没有可用的识别规则时返回 nil
+func NewPIIRedactor(group string, tokenEnabled bool) *PIIRedactor {
+	if !operation_setting.IsPIIRedactionEnabledFor(group, tokenEnabled) {
+		return nil
+	}
+	detectors := make([]piiDetector, 0)
+	for _, d := range operation_setting.GetPIIRedactionSetting().Detectors {
+		if !d.Enabled {
+			continue
+		}
+		name := piiNameSanitizer.ReplaceAllString(strings.ToUpper(d.Name), "_")
+		if name == "" {
+			continue
+		}
+		pattern, err := compilePIIDetector(d)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid pii detector %s: %v", d.Name, err))
+			continue
+		}
+		if pattern == nil {
+			continue
+		}
+		detectors = append(detectors, piiDetector{name: name, pattern: pattern, luhn: d.Luhn})
+	}
+	if len(detectors) == 0 {
+		return nil
+	}
+	return &PIIRedactor{
+		detectors:    detectors,
+		placeholders: make(map[string]string),
+		values:       make(map[string]string),
+		sequences:    make(map[string]int),
+		counts:       make(map[string]int),
+	}
+}
+
+func compilePIIDetector(d operation_setting.PIIDetector) (*regexp.Regexp, error) {
+	expr := d.Pattern
+	if d.Type == operation_setting.PIIDetectorTypeDictionary {
+		words := make([]string, 0, len(d.Words))
+		for _, w := range d.Words {
+			if w = strings.TrimSpace(w); w != "" {
+				words = append(words, regexp.QuoteMeta(w))
+			}
+		}
+		if len(words) == 0 {
+			return nil, nil
+		}
+		// 长词优先，避免短词截断长词
+		sort.Slice(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+		expr = "(?i)(?:" + strings.Join(words, "|") + ")"
+	}
+	if expr == "" {
+		return nil, nil
+	}
+	if cached, ok := piiRegexpCache.Load(expr); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	piiRegexpCache.Store(expr, pattern)
+	return pattern, nil
+}
+
+// RedactText 把文本中的个人信息替换为占位符
+func (r *PIIRedactor) RedactText(text string) string {
+	if text == "" {
+		return text
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range r.detectors {
+		text = d.pattern.ReplaceAllStringFunc(text, func(value string) string {
+			if d.luhn && !luhnValid(value) {
+				return value
+			}
+			return r.placeholderFor(d.name, value)
+		})
+	}
+	return text
+}
+
+func (r *PIIRedactor) placeholderFor(name, value string) string {
+	r.counts[name]++
+	key := name + "\x00" + value
+	if placeholder, ok := r.placeholders[key]; ok {
+		return placeholder
+	}
+	r.sequences[name]++
+	placeholder := fmt.Sprintf("%s%s_%d]", piiPlaceholderPrefix, name, r.sequences[name])
+	r.placeholders[key] = placeholder
+	r.values[placeholder] = value
+	return placeholder
+}
+
+// RedactJSON 对 JSON 中的字符串值脱敏，跳过模型名、角色、URL、二进制数据等字段
+func (r *PIIRedactor) RedactJSON(data []byte) ([]byte, error) {
+	// 保留数字原样，避免大整数经 float64 丢失精度
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	r.resetCounts()
+	return common.Marshal(r.redactValue(value))
+}
+
+func (r *PIIRedactor) redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return r.RedactText(v)
+	case []any:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+	case map[string]any:
+		for key, item := range v {
+			if _, skip := piiSkipKeys[key]; skip {
+				continue
+			}
+			v[key] = r.redactValue(item)
+		}
+	}
+	return value
+}
+
+func (r *PIIRedactor) resetCounts() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts = make(map[string]int)
+	r.restored = 0
+}
+
+// Restore 把占位符还原为原值，jsonEscape 为 true 时按 JSON 字符串转义后写入
+func (r *PIIRedactor) Restore(text string, jsonEscape bool) string {
+	if !strings.Contains(text, piiPlaceholderPrefix) {
+		return text
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return piiPlaceholderRegexp.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, ok := r.values[placeholder]
+		if !ok {
+			return placeholder
+		}
+		r.restored++
+		if jsonEscape {
+			if escaped, err := common.Marshal(value); err == nil {
+				return string(escaped[1 : len(escaped)-1])
+			}
+		}
+		return value
+	})
+}
+
+// PartialPlaceholderIndex 返回文本末尾可能是未完整占位符的起始位置，没有时返回 -1
+func PartialPlaceholderIndex(text string) int {
+	idx := strings.LastIndexByte(text, '[')
+	if idx < 0 || len(text)-idx >= piiMaxPlaceholderLength {
+		return -1
+	}
+	suffix := text[idx:]
+	if len(suffix) <= len(piiPlaceholderPrefix) {
+		if strings.HasPrefix(piiPlaceholderPrefix, suffix) {
+			return idx
+		}
+		return -1
+	}
+	if !strings.HasPrefix(suffix, piiPlaceholderPrefix) {
+		return -1
+	}
+	for _, ch := range suffix[len(piiPlaceholderPrefix):] {
+		if !(ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return -1
+		}
+	}
+	return idx
+}
+
+// Counts 最近一次脱敏各类型的替换次数
+func (r *PIIRedactor) Counts() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[string]int, len(r.counts))
+	for name, count := range r.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+func (r *PIIRedactor) Restored() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.restored
+}
+
+// PassThroughRequestBody 透传请求体；开启脱敏时先对原始 JSON 脱敏
+func PassThroughRequestBody(info *RelayInfo, storage common.BodyStorage) (io.Reader, error) {
+	if info == nil || info.PIIRedactor == nil {
+		return common.ReaderOnly(storage), nil
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	redacted, err := info.PIIRedactor.RedactJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(redacted), nil
+}
+
+func luhnValid(value string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(value) - 1; i >= 0; i-- {
+		ch := value[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		digit := int(ch - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+		count++
+	}
+	return count >= 13 && sum%10 == 0
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func enablePIIRedactionForTest(t *testing.T, groups ...string) {
+	setting := operation_setting.GetPIIRedactionSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.Groups = groups
+	setting.Detectors = append(append([]operation_setting.PIIDetector(nil), saved.Detectors...), operation_setting.PIIDetector{
+		Name: "customer", Type: operation_setting.PIIDetectorTypeDictionary, Words: []string{"Acme Corp"}, Enabled: true,
+	})
+}
+
+func TestNewPIIRedactorEnabledByGroupOrToken(t *testing.T) {
+	enablePIIRedactionForTest(t, "vip")
+	assert.NotNil(t, NewPIIRedactor("vip", false))
+	assert.NotNil(t, NewPIIRedactor("default", true))
+	assert.Nil(t, NewPIIRedactor("default", false))
+}
+
+func TestPIIRedactorRedactAndRestore(t *testing.T) {
+	enablePIIRedactionForTest(t)
+	r := NewPIIRedactor("default", true)
+	require.NotNil(t, r)
+
+	text := "联系 alice@example.com 或 13812345678，卡号 4111 1111 1111 1111，身份证 11010519491231002X，acme corp 客户，订单 1234567890123"
+	redacted := r.RedactText(text)
+	assert.Equal(t, "联系 [PII_EMAIL_1] 或 [PII_PHONE_1]，卡号 [PII_CARD_1]，身份证 [PII_ID_NUMBER_1]，[PII_CUSTOMER_1] 客户，订单 1234567890123", redacted)
+	// 相同的值使用相同的占位符
+	assert.Equal(t, "[PII_EMAIL_1] [PII_EMAIL_2]", r.RedactText("alice@example.com bob@example.com"))
+	assert.Equal(t, "[PII_EMAIL_1]", r.RedactText("alice@example.com"))
+
+	assert.Equal(t, text, r.Restore(redacted, false))
+	assert.Equal(t, `"a\"b [PII_EMAIL_9]"`, r.Restore(`"a\"b [PII_EMAIL_9]"`, true))
+}
+
+func TestApplyParamOverrideRedactsPII(t *testing.T) {
+	enablePIIRedactionForTest(t)
+	info := &RelayInfo{PIIRedactor: NewPIIRedactor("default", true)}
+	body := []byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"my mail is alice@example.com"}]}`)
+	redacted, err := ApplyParamOverrideWithRelayInfo(body, info)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"gpt-4o","messages":[{"role":"user","content":"my mail is [PII_EMAIL_1]"}]}`, string(redacted))
+	assert.Equal(t, map[string]int{"EMAIL": 1}, info.PIIRedactor.Counts())
+
+	// 重试时重新转换的请求体沿用同一占位符，计数不重复累计
+	redacted, err = ApplyParamOverrideWithRelayInfo(body, info)
+	require.NoError(t, err)
+	assert.Contains(t, string(redacted), "[PII_EMAIL_1]")
+	assert.Equal(t, map[string]int{"EMAIL": 1}, info.PIIRedactor.Counts())
+}
+
+func TestPartialPlaceholderIndex(t *testing.T) {
+	assert.Equal(t, 5, PartialPlaceholderIndex("mail [PII_EM"))
+	assert.Equal(t, 5, PartialPlaceholderIndex("mail ["))
+	assert.Equal(t, 5, PartialPlaceholderIndex("mail [PI"))
+	assert.Equal(t, -1, PartialPlaceholderIndex("mail [PII_EMAIL_1]"))
+	assert.Equal(t, -1, PartialPlaceholderIndex("see [1"))
+	assert.Equal(t, -1, PartialPlaceholderIndex("no placeholder"))
+}
@@ -88,6 +88,11 @@ type RelayInfo struct {
 	TokenId           int
 	TokenKey          string
 	TokenGroup        string
+	OrganizationId    int // 组织令牌所属组织，非 0 时从组织钱包扣费
+	TokenBudgetPeriod string
+	TokenBudgetQuota  int   // 令牌周期预算，0 表示不限制
+	TokenBudgetStart  int64 // 首次占用预算时所在周期的起点，结算与退款计入同一周期
+	TokenTpmLimit     int
 	UserId            int
 	UsingGroup        string // 使用的分组，当auto跨分组重试时，会变动
 	UserGroup         string // 用户所在分组
@@ -128,6 +133,8 @@ type RelayInfo struct {
 	// Billing 是计费会话，封装了预扣费/结算/退款的统一生命周期。
 	// 免费模型时为 nil。
 	Billing BillingSettler
+	// TPMReservation 准入时计入 TPM 滑动窗口的记录，结算或失败时据此修正
+	TPMReservation *TPMReservation
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
 	// "" or "wallet" => wallet; "subscription" => subscription
 	BillingSource string
@@ -152,6 +159,11 @@ type RelayInfo struct {
 	RuntimeHeadersOverride                map[string]interface{}
 	UseRuntimeHeadersOverride             bool
 	ParamOverrideAudit                    []string
+	// PIIRedactor 请求开启个人信息脱敏时非 nil，上游响应中的占位符据此还原
+	PIIRedactor *PIIRedactor
+	// Hedge 对冲请求共享状态，未触发对冲时为 nil；HedgeAttempt 为本次尝试的编号
+	Hedge        *HedgeInfo
+	HedgeAttempt int
 
 	PriceData types.PriceData
 
@@ -468,6 +480,11 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrganizationId: common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
+
+		TokenBudgetPeriod: common.GetContextKeyString(c, constant.ContextKeyTokenBudgetPeriod),
+		TokenBudgetQuota:  common.GetContextKeyInt(c, constant.ContextKeyTokenBudgetQuota),
+		TokenTpmLimit:     common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -502,6 +519,9 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		info.UserSetting = userSetting
 	}
 
+	// 各类接口都按令牌与分组创建脱敏器，请求体在参数覆盖阶段统一脱敏
+	info.PIIRedactor = NewPIIRedactor(info.UsingGroup, common.GetContextKeyBool(c, constant.ContextKeyTokenPIIRedaction))
+
 	return info
 }
 
@@ -0,0 +1,23 @@
+package common
+
+import "sync"
+
+// TPMReservation 请求准入时计入 TPM 滑动窗口的窗口键与预估 token 数
+type TPMReservation struct {
+	mu      sync.Mutex
+	buckets []string
+	pending int
+}
+
+func NewTPMReservation(buckets []string, tokens int) *TPMReservation {
+	return &TPMReservation{buckets: buckets, pending: tokens}
+}
+
+// Take 返回窗口键与尚未修正的预估 token 数；预估值只返回一次，之后（如 Realtime 多次结算）返回 0
+func (r *TPMReservation) Take() ([]string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.pending
+	r.pending = 0
+	return r.buckets, pending
+}
@@ -0,0 +1,119 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// countTokensAdaptor 复用渠道适配器的鉴权请求头，只替换请求地址
+type countTokensAdaptor struct {
+	channel.Adaptor
+	url string
+}
+
+func (a *countTokensAdaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	return a.url, nil
+}
+
+// countTokensUpstream 返回上游原生 token 计数接口地址与改写模型名后的请求体，上游不支持时返回 false
+func countTokensUpstream(info *relaycommon.RelayInfo, body []byte) (string, []byte, bool) {
+	switch {
+	case info.RelayFormat == types.RelayFormatClaude && info.ApiType == constant.APITypeAnthropic:
+		body, err := sjson.SetBytes(body, "model", info.UpstreamModelName)
+		if err != nil {
+			return "", nil, false
+		}
+		return fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl), body, true
+	case info.RelayFormat == types.RelayFormatGemini && info.ApiType == constant.APITypeGemini:
+		if gjson.GetBytes(body, "generateContentRequest.model").Exists() {
+			patched, err := sjson.SetBytes(body, "generateContentRequest.model", "models/"+info.UpstreamModelName)
+			if err != nil {
+				return "", nil, false
+			}
+			body = patched
+		}
+		version := model_setting.GetGeminiVersionSetting(info.UpstreamModelName)
+		return fmt.Sprintf("%s/%s/models/%s:countTokens", info.ChannelBaseUrl, version, info.UpstreamModelName), body, true
+	}
+	return "", nil, false
+}
+
+// CountTokensHelper 处理 token 计数请求：渠道原生支持时转发上游，否则本地估算。该请求不预扣也不计费
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	info.InitChannelMeta(c)
+
+	if err := helper.ModelMappedHelper(c, info, info.Request); err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	if url, upstreamBody, ok := countTokensUpstream(info, body); ok {
+		// 与正常中继一样先脱敏并应用参数覆盖，再发往上游
+		upstreamBody, err = relaycommon.ApplyParamOverrideWithRelayInfo(upstreamBody, info)
+		if err != nil {
+			return newAPIErrorFromParamOverride(err)
+		}
+		if forwardCountTokens(c, info, url, upstreamBody) {
+			return nil
+		}
+	}
+
+	tokens := service.CountTokenMeta(info.Request.GetTokenCountMeta(), info.OriginModelName)
+	if info.RelayFormat == types.RelayFormatGemini {
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: tokens})
+	} else {
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	}
+	return nil
+}
+
+// forwardCountTokens 转发到上游计数接口，上游不可用（网络错误或 5xx）时返回 false 以便本地估算
+func forwardCountTokens(c *gin.Context, info *relaycommon.RelayInfo, url string, body []byte) bool {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return false
+	}
+	adaptor.Init(info)
+	resp, err := channel.DoApiRequest(&countTokensAdaptor{Adaptor: adaptor, url: url}, c, info, bytes.NewReader(body))
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("count tokens upstream request failed, fallback to local estimate: %v", err))
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		logger.LogWarn(c, fmt.Sprintf("count tokens upstream returned status %d, fallback to local estimate", resp.StatusCode))
+		return false
+	}
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("count tokens read upstream response failed, fallback to local estimate: %v", err))
+		return false
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return true
+}
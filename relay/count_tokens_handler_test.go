@@ -0,0 +1,112 @@
+package relay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestCountTokensUpstream(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		RelayFormat: types.RelayFormatClaude,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ApiType:           constant.APITypeAnthropic,
+			ChannelBaseUrl:    "https://api.anthropic.com",
+			UpstreamModelName: "claude-sonnet-4-5",
+		},
+	}
+	url, body, ok := countTokensUpstream(info, []byte(`{"model":"alias","messages":[]}`))
+	require.True(t, ok)
+	assert.Equal(t, "https://api.anthropic.com/v1/messages/count_tokens", url)
+	assert.Equal(t, "claude-sonnet-4-5", gjson.GetBytes(body, "model").String())
+
+	info.RelayFormat = types.RelayFormatGemini
+	info.ApiType = constant.APITypeGemini
+	info.ChannelBaseUrl = "https://generativelanguage.googleapis.com"
+	info.UpstreamModelName = "gemini-2.5-flash"
+	url, body, ok = countTokensUpstream(info, []byte(`{"generateContentRequest":{"model":"models/alias","contents":[]}}`))
+	require.True(t, ok)
+	assert.True(t, strings.HasSuffix(url, "/models/gemini-2.5-flash:countTokens"))
+	assert.Equal(t, "models/gemini-2.5-flash", gjson.GetBytes(body, "generateContentRequest.model").String())
+
+	// 非原生渠道本地估算
+	info.ApiType = constant.APITypeOpenAI
+	_, _, ok = countTokensUpstream(info, nil)
+	assert.False(t, ok)
+}
+
+func TestCountTokensHelperLocal(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens",
+		strings.NewReader(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"hello world"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "claude-sonnet-4-5")
+	common.SetContextKey(c, constant.ContextKeyChannelType, constant.ChannelTypeOpenAI)
+
+	request := &dto.ClaudeRequest{}
+	require.NoError(t, common.UnmarshalBodyReusable(c, request))
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatClaude, request, nil)
+	require.NoError(t, err)
+
+	require.Nil(t, CountTokensHelper(c, info))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Greater(t, gjson.Get(w.Body.String(), "input_tokens").Int(), int64(0))
+}
+
+func TestCountTokensHelperRedactsUpstreamBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	piiSetting := operation_setting.GetPIIRedactionSetting()
+	saved := *piiSetting
+	t.Cleanup(func() { *piiSetting = saved })
+	piiSetting.Enabled = true
+	service.InitHttpClient()
+
+	var upstreamBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		upstreamBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"input_tokens":12}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens",
+		strings.NewReader(`{"model":"claude-sonnet-4-5","messages":[{"role":"user","content":"mail alice@example.com"}]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, "claude-sonnet-4-5")
+	common.SetContextKey(c, constant.ContextKeyChannelType, constant.ChannelTypeAnthropic)
+	common.SetContextKey(c, constant.ContextKeyChannelBaseUrl, upstream.URL)
+	common.SetContextKey(c, constant.ContextKeyChannelKey, "sk-test")
+	common.SetContextKey(c, constant.ContextKeyTokenPIIRedaction, true)
+
+	request := &dto.ClaudeRequest{}
+	require.NoError(t, common.UnmarshalBodyReusable(c, request))
+	info, err := relaycommon.GenRelayInfo(c, types.RelayFormatClaude, request, nil)
+	require.NoError(t, err)
+	require.NotNil(t, info.PIIRedactor)
+
+	require.Nil(t, CountTokensHelper(c, info))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(12), gjson.Get(w.Body.String(), "input_tokens").Int())
+	assert.NotContains(t, upstreamBody, "alice@example.com")
+	assert.Contains(t, upstreamBody, "[PII_EMAIL_1]")
+}
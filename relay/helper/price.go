@@ -5,10 +5,12 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/batch_setting"
 	"github.com/QuantumNous/new-api/setting/billing_setting"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
@@ -37,6 +39,26 @@ const claudeCacheCreation1hMultiplier = 6 / 3.75
 
 // HandleGroupRatio checks for "auto_group" in the context and updates the group ratio and relayInfo.UsingGroup if present
 func HandleGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.GroupRatioInfo {
+	groupRatioInfo := resolveGroupRatio(ctx, relayInfo)
+
+	// 批处理请求在分组倍率基础上叠加折扣
+	if common.GetContextKeyString(ctx, constant.ContextKeyBatchId) != "" {
+		discount := batch_setting.GetGroupDiscountRatio(relayInfo.UsingGroup)
+		groupRatioInfo.GroupRatio *= discount
+		groupRatioInfo.BatchDiscountRatio = discount
+	}
+
+	// 命中响应缓存的请求按缓存价格比例计费
+	if common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		ratio := operation_setting.GetResponseCachePriceRatio()
+		groupRatioInfo.GroupRatio *= ratio
+		groupRatioInfo.ResponseCacheRatio = ratio
+	}
+
+	return groupRatioInfo
+}
+
+func resolveGroupRatio(ctx *gin.Context, relayInfo *relaycommon.RelayInfo) types.GroupRatioInfo {
 	groupRatioInfo := types.GroupRatioInfo{
 		GroupRatio:        1.0, // default ratio
 		GroupSpecialRatio: -1,
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/billing_setting"
@@ -60,3 +61,30 @@ func TestModelPriceHelperTieredUsesPreloadedRequestInput(t *testing.T) {
 	require.Equal(t, billing_setting.BillingModeTieredExpr, info.TieredBillingSnapshot.BillingMode)
 	require.Equal(t, common.QuotaPerUnit, info.TieredBillingSnapshot.QuotaPerUnit)
 }
+
+func TestHandleGroupRatioAppliesBatchDiscount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	saved := map[string]string{}
+	require.NoError(t, config.GlobalConfig.SaveToDB(func(key, value string) error {
+		saved[key] = value
+		return nil
+	}))
+	t.Cleanup(func() {
+		require.NoError(t, config.GlobalConfig.LoadFromDB(saved))
+	})
+	require.NoError(t, config.GlobalConfig.LoadFromDB(map[string]string{
+		"batch_setting.group_discount_ratio": `{"default":0.4}`,
+	}))
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{UserGroup: "default", UsingGroup: "default"}
+
+	normal := HandleGroupRatio(ctx, info)
+	require.Zero(t, normal.BatchDiscountRatio)
+
+	common.SetContextKey(ctx, constant.ContextKeyBatchId, "batch_test")
+	discounted := HandleGroupRatio(ctx, info)
+	require.Equal(t, 0.4, discounted.BatchDiscountRatio)
+	require.InDelta(t, normal.GroupRatio*0.4, discounted.GroupRatio, 1e-9)
+}
@@ -2,6 +2,7 @@ package relay
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/relay/channel"
@@ -47,6 +48,8 @@ import (
 	"github.com/QuantumNous/new-api/relay/channel/xunfei"
 	"github.com/QuantumNous/new-api/relay/channel/zhipu"
 	"github.com/QuantumNous/new-api/relay/channel/zhipu_4v"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/gin-gonic/gin"
 )
 
@@ -124,6 +127,44 @@ func GetAdaptor(apiType int) channel.Adaptor {
 	return nil
 }
 
+// supportsNativeResponses 上游适配器是否原生实现了 /v1/responses，上游会自行保存响应并解析 previous_response_id
+func supportsNativeResponses(apiType int) bool {
+	switch apiType {
+	case constant.APITypeOpenAI, constant.APITypeOpenRouter, constant.APITypeXinference, constant.APITypeCodex,
+		constant.APITypeAli, constant.APITypeXai, constant.APITypeVolcEngine, constant.APITypePerplexity, constant.APITypeCloudflare:
+		return true
+	}
+	return false
+}
+
+// supportsClaudeResponses 上游是否为 Claude Messages，此时 Responses 请求直接转换为 Messages 请求，
+// 推理项与 thinking 签名可以往返保留；既不原生支持也不是 Claude 的上游通过 Chat Completions 桥接
+func supportsClaudeResponses(info *relaycommon.RelayInfo) bool {
+	if info.RelayFormat != types.RelayFormatOpenAIResponses {
+		return false
+	}
+	switch info.ApiType {
+	case constant.APITypeAnthropic:
+		return true
+	case constant.APITypeAws:
+		return !aws.IsNovaModel(info.UpstreamModelName)
+	case constant.APITypeVertexAi:
+		return strings.HasPrefix(info.UpstreamModelName, "claude")
+	}
+	return false
+}
+
+// supportsNativeGemini 上游适配器是否能直接处理 Gemini generateContent 请求，其余适配器通过 Chat Completions 桥接。
+// Claude 适配器将请求转换为 Messages 格式，并把响应转换回 Gemini 格式
+func supportsNativeGemini(apiType int) bool {
+	switch apiType {
+	case constant.APITypeGemini, constant.APITypeVertexAi, constant.APITypeOpenAI, constant.APITypeOpenRouter, constant.APITypeXinference,
+		constant.APITypeAnthropic:
+		return true
+	}
+	return false
+}
+
 func GetTaskPlatform(c *gin.Context) constant.TaskPlatform {
 	channelType := c.GetInt("channel_type")
 	if channelType > 0 {
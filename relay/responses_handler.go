@@ -70,13 +70,57 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
+	passThrough := model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled
+	nativeResponses := supportsNativeResponses(info.ApiType)
+
+	// 网关保存响应时，上游无法解析 previous_response_id 则用保存的历史重建对话
+	turnInput := request.Input
+	previousResponseId := request.PreviousResponseID
+	// 保存的本轮输入与上游收到的一致，也是脱敏后的内容
+	if info.PIIRedactor != nil && len(turnInput) > 0 {
+		redacted, err := info.PIIRedactor.RedactJSON(turnInput)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
+		turnInput = redacted
+	}
+	var storeWriter *service.ResponsesStoreWriter
+	if info.RelayMode != relayconstant.RelayModeResponsesCompact {
+		if !passThrough {
+			if _, err := service.PreparePreviousResponse(info, request, nativeResponses); err != nil {
+				return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+			}
+		}
+		if service.ResponsesStoreEnabled(request) {
+			storeWriter = service.NewResponsesStoreWriter(c.Writer, info.IsStream)
+			c.Writer = storeWriter
+			defer func() {
+				c.Writer = storeWriter.ResponseWriter
+			}()
+		}
+	}
+
+	// 上游不支持 Responses API 时，经由 Chat Completions 转换后转发；Claude 上游由适配器直接转换
+	if !passThrough && !nativeResponses && !supportsClaudeResponses(info) {
+		usageDto, newAPIError := responsesViaChatCompletions(c, info, adaptor, request)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		service.PostTextConsumeQuota(c, info, usageDto, nil)
+		service.SaveStoredResponse(c, info, storeWriter, turnInput, previousResponseId, false)
+		return nil
+	}
+
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		storage, err := common.GetBodyStorage(c)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
 		}
-		requestBody = common.ReaderOnly(storage)
+		requestBody, err = relaycommon.PassThroughRequestBody(info, storage)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+		}
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
 		if err != nil {
@@ -94,12 +138,10 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 			return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
 		}
 
-		// apply param override
-		if len(info.ParamOverride) > 0 {
-			jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
-			if err != nil {
-				return newAPIErrorFromParamOverride(err)
-			}
+		// apply pii redaction and param override
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			return newAPIErrorFromParamOverride(err)
 		}
 
 		if common.DebugEnabled {
@@ -157,5 +199,6 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	} else {
 		service.PostTextConsumeQuota(c, info, usageDto, nil)
 	}
+	service.SaveStoredResponse(c, info, storeWriter, turnInput, previousResponseId, nativeResponses)
 	return nil
 }
@@ -137,6 +137,8 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.POST("/unban-all", controller.UnbanAllUsers)
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
+				adminRoute.POST("/topup/refund", controller.AdminRefundTopUp)
+				adminRoute.GET("/topup/refunds", controller.GetTopUpRefunds)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id/oauth/bindings", controller.GetUserOAuthBindingsByAdmin)
 				adminRoute.DELETE("/:id/oauth/bindings/:provider_id", controller.UnbindCustomOAuthByAdmin)
@@ -191,11 +193,22 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			optionRoute.GET("/", controller.GetOptions)
 			optionRoute.PUT("/", controller.UpdateOption)
+			optionRoute.GET("/revisions", controller.GetOptionRevisions)
+			optionRoute.GET("/revisions/diff", controller.DiffOptionRevisions)
+			optionRoute.GET("/revisions/nodes", controller.GetOptionRevisionNodes)
+			optionRoute.POST("/revisions/rollback", controller.RollbackOptions)
 			optionRoute.GET("/channel_affinity_cache", controller.GetChannelAffinityCacheStats)
 			optionRoute.DELETE("/channel_affinity_cache", controller.ClearChannelAffinityCache)
 			optionRoute.POST("/rest_model_ratio", controller.ResetModelRatio)
 			optionRoute.POST("/migrate_console_setting", controller.MigrateConsoleSetting) // 用于迁移检测的旧键，下个版本会删除
 		}
+		configBundleRoute := apiRouter.Group("/config_bundle")
+		configBundleRoute.Use(middleware.RootAuth())
+		{
+			configBundleRoute.GET("/export", controller.ExportConfigBundle)
+			configBundleRoute.POST("/plan", controller.PlanConfigBundle)
+			configBundleRoute.POST("/apply", controller.ApplyConfigBundle)
+		}
 
 		// Custom OAuth provider management (root only)
 		customOAuthRoute := apiRouter.Group("/custom-oauth-provider")
@@ -218,6 +231,17 @@ func SetApiRouter(router *gin.Engine) {
 			performanceRoute.GET("/logs", controller.GetLogFiles)
 			performanceRoute.DELETE("/logs", controller.CleanupLogFiles)
 		}
+		tokenizerRoute := apiRouter.Group("/tokenizer")
+		tokenizerRoute.Use(middleware.RootAuth())
+		{
+			tokenizerRoute.GET("/", controller.GetTokenizers)
+			tokenizerRoute.POST("/", controller.UploadTokenizer)
+			tokenizerRoute.PUT("/:id", controller.UpdateTokenizer)
+			tokenizerRoute.DELETE("/:id", controller.DeleteTokenizer)
+			tokenizerRoute.POST("/count", controller.CountTokenizerTokens)
+			tokenizerRoute.GET("/accuracy", controller.GetTokenizerAccuracy)
+			tokenizerRoute.DELETE("/accuracy", controller.ResetTokenizerAccuracy)
+		}
 		ratioSyncRoute := apiRouter.Group("/ratio_sync")
 		ratioSyncRoute.Use(middleware.RootAuth())
 		{
@@ -231,6 +255,9 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/selection_weights", controller.GetChannelSelectionWeights)
+			channelRoute.GET("/circuit_breakers", controller.GetChannelCircuitBreakers)
+			channelRoute.DELETE("/circuit_breakers", controller.ResetChannelCircuitBreaker)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
@@ -281,6 +308,33 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/batch/keys", middleware.CriticalRateLimit(), middleware.DisableCache(), controller.GetTokenKeysBatch)
 		}
 
+		// Organizations (shared wallet, member roles)
+		organizationRoute := apiRouter.Group("/organization")
+		organizationRoute.Use(middleware.UserAuth())
+		{
+			organizationRoute.GET("/self", controller.GetSelfOrganizations)
+			organizationRoute.POST("/", controller.CreateOrganization)
+			organizationRoute.GET("/:id", controller.GetOrganization)
+			organizationRoute.PUT("/:id", controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", controller.DeleteOrganization)
+			organizationRoute.GET("/:id/members", controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members", controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", controller.RemoveOrganizationMember)
+			organizationRoute.POST("/:id/fund", middleware.CriticalRateLimit(), controller.FundOrganization)
+			organizationRoute.GET("/:id/tokens", controller.GetOrganizationTokens)
+			organizationRoute.POST("/:id/tokens/:token_id/disable", controller.DisableOrganizationToken)
+			organizationRoute.GET("/:id/logs", controller.GetOrganizationLogs)
+			organizationRoute.GET("/:id/logs/stat", controller.GetOrganizationLogsStat)
+			organizationRoute.GET("/:id/data", controller.GetOrganizationQuotaDates)
+		}
+		organizationAdminRoute := apiRouter.Group("/organization_admin")
+		organizationAdminRoute.Use(middleware.AdminAuth())
+		{
+			organizationAdminRoute.GET("/", controller.AdminGetAllOrganizations)
+			organizationAdminRoute.PUT("/", controller.AdminUpdateOrganization)
+		}
+
 		usageRoute := apiRouter.Group("/usage")
 		usageRoute.Use(middleware.CORS(), middleware.CriticalRateLimit())
 		{
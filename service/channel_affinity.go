@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/pkg/cachex"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
@@ -25,6 +26,7 @@ const (
 	ginKeyChannelAffinityMeta       = "channel_affinity_meta"
 	ginKeyChannelAffinityLogInfo    = "channel_affinity_log_info"
 	ginKeyChannelAffinitySkipRetry  = "channel_affinity_skip_retry_on_failure"
+	ginKeyChannelAffinityKeyIndex   = "channel_affinity_preferred_key_index"
 
 	channelAffinityCacheNamespace           = "new-api:channel_affinity:v1"
 	channelAffinityUsageCacheStatsNamespace = "new-api:channel_affinity_usage_cache_stats:v1"
@@ -324,6 +326,16 @@ func extractChannelAffinityValue(c *gin.Context, src operation_setting.ChannelAf
 		default:
 			return strings.TrimSpace(res.Raw)
 		}
+	case "prompt_prefix":
+		storage, err := common.GetBodyStorage(c)
+		if err != nil {
+			return ""
+		}
+		body, err := storage.Bytes()
+		if err != nil || len(body) == 0 {
+			return ""
+		}
+		return promptPrefixFingerprint(body, src.Messages)
 	default:
 		return ""
 	}
@@ -605,12 +617,16 @@ func GetPreferredChannelByAffinity(c *gin.Context, modelName string, usingGroup
 		})
 
 		cache := getChannelAffinityCache()
-		channelID, found, err := cache.Get(cacheKeySuffix)
+		value, found, err := cache.Get(cacheKeySuffix)
 		if err != nil {
 			common.SysError(fmt.Sprintf("channel affinity cache get failed: key=%s, err=%v", cacheKeyFull, err))
 			return 0, false
 		}
 		if found {
+			channelID, keyIndex, hasKey := unpackChannelAffinityValue(value)
+			if hasKey {
+				c.Set(ginKeyChannelAffinityKeyIndex, preferredChannelKey{ChannelID: channelID, KeyIndex: keyIndex})
+			}
 			return channelID, true
 		}
 		return 0, false
@@ -618,6 +634,43 @@ func GetPreferredChannelByAffinity(c *gin.Context, modelName string, usingGroup
 	return 0, false
 }
 
+// preferredChannelKey 亲和缓存中记录的多密钥渠道密钥下标
+type preferredChannelKey struct {
+	ChannelID int
+	KeyIndex  int
+}
+
+// packChannelAffinityValue 把多密钥渠道的密钥下标放在缓存值的高 32 位，旧的缓存值视为没有记录密钥
+func packChannelAffinityValue(channelID int, keyIndex int) int {
+	if keyIndex < 0 {
+		return channelID
+	}
+	return channelID | (keyIndex+1)<<32
+}
+
+func unpackChannelAffinityValue(value int) (int, int, bool) {
+	channelID := value & 0xFFFFFFFF
+	keyIndex := value>>32 - 1
+	return channelID, keyIndex, keyIndex >= 0
+}
+
+// GetPreferredKeyIndexByAffinity 选中的渠道与亲和记录一致时返回上次使用的密钥下标，只生效一次，重试时按正常规则选择密钥
+func GetPreferredKeyIndexByAffinity(c *gin.Context, channelID int) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	anyPreferred, ok := c.Get(ginKeyChannelAffinityKeyIndex)
+	if !ok {
+		return 0, false
+	}
+	preferred, ok := anyPreferred.(preferredChannelKey)
+	if !ok || preferred.ChannelID != channelID {
+		return 0, false
+	}
+	c.Set(ginKeyChannelAffinityKeyIndex, nil)
+	return preferred.KeyIndex, true
+}
+
 func ShouldSkipRetryAfterChannelAffinityFailure(c *gin.Context) bool {
 	if c == nil {
 		return false
@@ -696,8 +749,12 @@ func RecordChannelAffinity(c *gin.Context, channelID int) {
 	if ttlSeconds <= 0 {
 		ttlSeconds = 3600
 	}
+	value := channelID
+	if c != nil && c.GetInt("channel_id") == channelID && common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		value = packChannelAffinityValue(channelID, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex))
+	}
 	cache := getChannelAffinityCache()
-	if err := cache.SetWithTTL(cacheKey, channelID, time.Duration(ttlSeconds)*time.Second); err != nil {
+	if err := cache.SetWithTTL(cacheKey, value, time.Duration(ttlSeconds)*time.Second); err != nil {
 		common.SysError(fmt.Sprintf("channel affinity cache set failed: key=%s, err=%v", cacheKey, err))
 	}
 }
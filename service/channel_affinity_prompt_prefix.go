@@ -0,0 +1,94 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/tidwall/gjson"
+)
+
+// promptPrefixFields 请求中跨轮次保持不变的字段：系统提示与工具定义
+var promptPrefixFields = []string{"system", "instructions", "systemInstruction", "system_instruction", "tools"}
+
+// promptPrefixMessageFields 依次尝试的消息列表字段：OpenAI/Claude、Gemini、Responses
+var promptPrefixMessageFields = []string{"messages", "contents", "input"}
+
+// promptPrefixFingerprint 对系统提示、工具与前 n 条非系统消息计算指纹。
+// 同一会话的后续轮次只在末尾追加消息，指纹保持不变；cache_control 等缓存标记不计入指纹。
+// 请求中没有对话消息时返回空字符串
+func promptPrefixFingerprint(body []byte, n int) string {
+	if n <= 0 {
+		n = 1
+	}
+	parts := make([]string, 0, len(promptPrefixFields)+n)
+	for _, field := range promptPrefixFields {
+		if res := gjson.GetBytes(body, field); res.Exists() {
+			parts = append(parts, field+"="+canonicalPromptJSON(res))
+		}
+	}
+
+	counted := 0
+	for _, field := range promptPrefixMessageFields {
+		res := gjson.GetBytes(body, field)
+		if !res.Exists() {
+			continue
+		}
+		if res.Type == gjson.String {
+			if res.String() != "" {
+				parts = append(parts, field+"="+canonicalPromptJSON(res))
+				counted++
+			}
+			break
+		}
+		if !res.IsArray() {
+			continue
+		}
+		for _, message := range res.Array() {
+			if counted >= n {
+				break
+			}
+			role := message.Get("role").String()
+			if role != "system" && role != "developer" {
+				counted++
+			}
+			parts = append(parts, field+"="+canonicalPromptJSON(message))
+		}
+		break
+	}
+	if counted == 0 {
+		return ""
+	}
+	return common.Sha1([]byte(strings.Join(parts, "\n")))
+}
+
+// canonicalPromptJSON 去掉 cache_control 并按键排序重新编码，使客户端调整缓存断点或字段顺序时指纹不变
+func canonicalPromptJSON(res gjson.Result) string {
+	var value interface{}
+	if err := common.UnmarshalJsonStr(res.Raw, &value); err != nil {
+		return res.Raw
+	}
+	data, err := common.Marshal(stripCacheControl(value))
+	if err != nil {
+		return res.Raw
+	}
+	return string(data)
+}
+
+func stripCacheControl(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		delete(v, "cache_control")
+		for k, item := range v {
+			v[k] = stripCacheControl(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stripCacheControl(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
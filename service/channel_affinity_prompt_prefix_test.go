@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromptPrefixFingerprint_StableAcrossTurns(t *testing.T) {
+	first := []byte(`{"model":"gpt-4o","tools":[{"type":"function","function":{"name":"lookup"}}],"messages":[
+		{"role":"system","content":"You are helpful."},
+		{"role":"user","content":"hello"}]}`)
+	next := []byte(`{"messages":[
+		{"role":"system","content":"You are helpful."},
+		{"role":"user","content":"hello"},
+		{"role":"assistant","content":"hi"},
+		{"role":"user","content":"how are you?"}],"model":"gpt-4o","stream":true,"tools":[{"function":{"name":"lookup"},"type":"function"}]}`)
+	other := []byte(`{"model":"gpt-4o","tools":[{"type":"function","function":{"name":"lookup"}}],"messages":[
+		{"role":"system","content":"You are helpful."},
+		{"role":"user","content":"another session"}]}`)
+
+	fp := promptPrefixFingerprint(first, 1)
+	require.NotEmpty(t, fp)
+	require.Equal(t, fp, promptPrefixFingerprint(next, 1))
+	require.NotEqual(t, fp, promptPrefixFingerprint(other, 1))
+	require.NotEqual(t, promptPrefixFingerprint(next, 1), promptPrefixFingerprint(next, 3))
+}
+
+func TestPromptPrefixFingerprint_IgnoresCacheControl(t *testing.T) {
+	first := []byte(`{"system":[{"type":"text","text":"rules"}],"messages":[
+		{"role":"user","content":[{"type":"text","text":"hello","cache_control":{"type":"ephemeral"}}]}]}`)
+	next := []byte(`{"system":[{"type":"text","text":"rules","cache_control":{"type":"ephemeral"}}],"messages":[
+		{"role":"user","content":[{"type":"text","text":"hello"}]},
+		{"role":"assistant","content":"hi"}]}`)
+
+	require.Equal(t, promptPrefixFingerprint(first, 1), promptPrefixFingerprint(next, 1))
+}
+
+func TestPromptPrefixFingerprint_NoMessages(t *testing.T) {
+	require.Empty(t, promptPrefixFingerprint([]byte(`{"system":"rules","messages":[]}`), 1))
+	require.Empty(t, promptPrefixFingerprint([]byte(`{"prompt":"hello"}`), 1))
+	require.NotEmpty(t, promptPrefixFingerprint([]byte(`{"instructions":"rules","input":"hello"}`), 1))
+}
+
+func TestChannelAffinityValue_PackKeyIndex(t *testing.T) {
+	channelID, keyIndex, hasKey := unpackChannelAffinityValue(packChannelAffinityValue(42, 3))
+	require.Equal(t, 42, channelID)
+	require.Equal(t, 3, keyIndex)
+	require.True(t, hasKey)
+
+	channelID, _, hasKey = unpackChannelAffinityValue(42)
+	require.Equal(t, 42, channelID)
+	require.False(t, hasKey)
+
+	channelID, keyIndex, hasKey = unpackChannelAffinityValue(packChannelAffinityValue(7, 0))
+	require.Equal(t, 7, channelID)
+	require.Equal(t, 0, keyIndex)
+	require.True(t, hasKey)
+}
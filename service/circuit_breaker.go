@@ -0,0 +1,89 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/pkg/circuitbreaker"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// circuitBreakerKey 多密钥渠道按密钥熔断，其余按渠道熔断
+func circuitBreakerKey(c *gin.Context, channelId int) string {
+	if common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		return circuitbreaker.KeyIndexKey(channelId, common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex))
+	}
+	return circuitbreaker.ChannelKey(channelId)
+}
+
+// ShouldTripCircuitBreaker 错误是否可归因于渠道，客户端错误不计入熔断
+func ShouldTripCircuitBreaker(err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if types.IsChannelError(err) {
+		return true
+	}
+	if types.IsSkipRetryError(err) {
+		return false
+	}
+	if err.StatusCode >= 500 || err.StatusCode == 429 || err.StatusCode == 408 {
+		return true
+	}
+	if operation_setting.ShouldDisableByStatusCode(err.StatusCode) {
+		return true
+	}
+	search, _ := AcSearch(strings.ToLower(err.Error()), operation_setting.AutomaticDisableKeywords, true)
+	return search
+}
+
+// AcquireCircuitBreaker 中转请求选定渠道与密钥后调用，半开状态下占用探测名额，返回 false 表示未取得。
+// 未取得时请求仍可发送（如全部熔断后的兜底），但其结果不计入熔断器，避免释放其他请求的探测名额
+func AcquireCircuitBreaker(c *gin.Context, channelId int) bool {
+	ReleaseCircuitBreaker(c)
+	key := circuitBreakerKey(c, channelId)
+	allowed, probe := circuitbreaker.TryAcquire(key)
+	if probe {
+		common.SetContextKey(c, constant.ContextKeyCircuitBreakerProbe, key)
+	}
+	common.SetContextKey(c, constant.ContextKeyCircuitBreakerSkip, !allowed)
+	return allowed
+}
+
+// ReleaseCircuitBreaker 释放本请求持有但尚未上报结果的探测名额，换渠道或请求结束时调用
+func ReleaseCircuitBreaker(c *gin.Context) {
+	key := common.GetContextKeyString(c, constant.ContextKeyCircuitBreakerProbe)
+	if key == "" {
+		return
+	}
+	circuitbreaker.Release(key)
+	common.SetContextKey(c, constant.ContextKeyCircuitBreakerProbe, "")
+}
+
+// RecordCircuitBreakerFailure 记录一次渠道失败，返回 true 表示由熔断器接管，调用方不应再永久禁用渠道
+func RecordCircuitBreakerFailure(c *gin.Context, channelId int, err *types.NewAPIError) bool {
+	if !circuitbreaker.Enabled() || !ShouldTripCircuitBreaker(err) {
+		return false
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyCircuitBreakerSkip) {
+		reason := err.MaskSensitiveErrorWithStatusCode()
+		if len(reason) > 200 {
+			reason = reason[:200]
+		}
+		circuitbreaker.RecordFailure(circuitBreakerKey(c, channelId), reason)
+		common.SetContextKey(c, constant.ContextKeyCircuitBreakerProbe, "")
+	}
+	return operation_setting.GetCircuitBreakerSetting().ReplaceAutoDisable
+}
+
+func RecordCircuitBreakerSuccess(c *gin.Context, channelId int) {
+	if !circuitbreaker.Enabled() || common.GetContextKeyBool(c, constant.ContextKeyCircuitBreakerSkip) {
+		return
+	}
+	circuitbreaker.RecordSuccess(circuitBreakerKey(c, channelId))
+	common.SetContextKey(c, constant.ContextKeyCircuitBreakerProbe, "")
+}
@@ -96,7 +96,12 @@ func runCodexCredentialAutoRefreshOnce() {
 				continue
 			}
 
-			rawKey := strings.TrimSpace(ch.Key)
+			rawKey, err := ch.GetPlainKey()
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("codex credential auto-refresh: channel_id=%d name=%s decrypt key failed: %v", ch.Id, ch.Name, err))
+				continue
+			}
+			rawKey = strings.TrimSpace(rawKey)
 			if rawKey == "" {
 				continue
 			}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContextOverflowActionReroute  = "reroute"
+	ContextOverflowActionTruncate = "truncate"
+)
+
+// ContextOverflow 记录超出上下文窗口的请求如何被处理
+type ContextOverflow struct {
+	Action          string `json:"action"`
+	FromModel       string `json:"from_model,omitempty"`
+	PromptTokens    int    `json:"prompt_tokens"`
+	ContextLength   int    `json:"context_length"`
+	RemovedMessages int    `json:"removed_messages,omitempty"`
+}
+
+// ContextWindowExcess 返回预估输入与预留输出超出模型上下文窗口的 token 数，未配置上下文长度或未超出时返回 0
+func ContextWindowExcess(modelName string, promptTokens int, maxTokens int) (model.ModelContextLimit, int) {
+	limit, ok := model.GetModelContextLimit(modelName)
+	if !ok || limit.ContextLength <= 0 || promptTokens <= 0 {
+		return limit, 0
+	}
+	reserved := maxTokens
+	if limit.MaxOutputTokens > 0 && reserved > limit.MaxOutputTokens {
+		reserved = limit.MaxOutputTokens
+	}
+	return limit, max(promptTokens+reserved-limit.ContextLength, 0)
+}
+
+// ContextTruncationEnabled 令牌是否开启了 middle-out 截断
+func ContextTruncationEnabled(c *gin.Context) bool {
+	return common.GetContextKeyString(c, constant.ContextKeyTokenContextTruncation) == model.TokenContextTruncationMiddleOut
+}
+
+// TruncateMiddleOut 从对话中间删除整轮消息，直到删除的 token 数不少于 excess。
+// 保留系统提示、第一轮与最后一轮对话；工具调用与其结果属于同一轮，不会被拆开。
+// 无法删除足够的内容时不修改请求并返回 false
+func TruncateMiddleOut(request dto.Request, excess int, modelName string) (int, bool) {
+	switch r := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		messages, removed, ok := middleOutRemove(r.Messages, excess,
+			func(m dto.Message) bool { return m.Role == "user" },
+			func(m dto.Message) bool { return m.Role == "system" || m.Role == "developer" },
+			func(turn []dto.Message) int {
+				return CountTokenMeta((&dto.GeneralOpenAIRequest{Messages: turn}).GetTokenCountMeta(), modelName)
+			})
+		if ok {
+			r.Messages = messages
+		}
+		return removed, ok
+	case *dto.ClaudeRequest:
+		messages, removed, ok := middleOutRemove(r.Messages, excess,
+			func(m dto.ClaudeMessage) bool { return m.Role == "user" && !claudeHasToolResult(m) },
+			nil,
+			func(turn []dto.ClaudeMessage) int {
+				return CountTokenMeta((&dto.ClaudeRequest{Messages: turn}).GetTokenCountMeta(), modelName)
+			})
+		if ok {
+			r.Messages = messages
+		}
+		return removed, ok
+	case *dto.GeminiChatRequest:
+		contents, removed, ok := middleOutRemove(r.Contents, excess,
+			func(content dto.GeminiChatContent) bool {
+				return content.Role == "user" && !geminiHasFunctionResponse(content)
+			},
+			nil,
+			func(turn []dto.GeminiChatContent) int {
+				return CountTokenMeta((&dto.GeminiChatRequest{Contents: turn}).GetTokenCountMeta(), modelName)
+			})
+		if ok {
+			r.Contents = contents
+		}
+		return removed, ok
+	}
+	return 0, false
+}
+
+func claudeHasToolResult(message dto.ClaudeMessage) bool {
+	if message.IsStringContent() {
+		return false
+	}
+	contents, err := message.ParseContent()
+	if err != nil {
+		return false
+	}
+	for _, content := range contents {
+		if content.Type == "tool_result" {
+			return true
+		}
+	}
+	return false
+}
+
+func geminiHasFunctionResponse(content dto.GeminiChatContent) bool {
+	for _, part := range content.Parts {
+		if part.FunctionResponse != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// middleOutRemove 以 turnStart 为界把消息分成若干轮，从中间一轮开始向两端交替删除，返回剩余消息与删除的消息数
+func middleOutRemove[T any](items []T, excess int, turnStart func(T) bool, pinned func(T) bool, countTokens func([]T) int) ([]T, int, bool) {
+	starts := make([]int, 0)
+	for i, item := range items {
+		if turnStart(item) {
+			starts = append(starts, i)
+		}
+	}
+	// 第一轮与最后一轮之间至少要有一轮可删除
+	if len(starts) < 3 {
+		return items, 0, false
+	}
+	turnEnd := func(k int) int {
+		if k+1 < len(starts) {
+			return starts[k+1]
+		}
+		return len(items)
+	}
+	first, last := 1, len(starts)-2
+	middle := (first + last) / 2
+	order := []int{middle}
+	for offset := 1; len(order) < last-first+1; offset++ {
+		if middle+offset <= last {
+			order = append(order, middle+offset)
+		}
+		if middle-offset >= first {
+			order = append(order, middle-offset)
+		}
+	}
+
+	removedTurns := make(map[int]bool)
+	removedTokens := 0
+	for _, k := range order {
+		turn := items[starts[k]:turnEnd(k)]
+		if pinned != nil && containsPinned(turn, pinned) {
+			continue
+		}
+		removedTurns[k] = true
+		removedTokens += countTokens(turn)
+		if removedTokens >= excess {
+			break
+		}
+	}
+	if removedTokens < excess {
+		return items, 0, false
+	}
+
+	kept := make([]T, 0, len(items))
+	kept = append(kept, items[:starts[0]]...)
+	for k := range starts {
+		if !removedTurns[k] {
+			kept = append(kept, items[starts[k]:turnEnd(k)]...)
+		}
+	}
+	return kept, len(items) - len(kept), true
+}
+
+func containsPinned[T any](turn []T, pinned func(T) bool) bool {
+	for _, item := range turn {
+		if pinned(item) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetContextOverflow 记录超出上下文窗口时的处理方式，写入消费日志
+func SetContextOverflow(c *gin.Context, overflow *ContextOverflow) {
+	common.SetContextKey(c, constant.ContextKeyContextOverflow, overflow)
+}
+
+func appendContextOverflowInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil {
+		return
+	}
+	overflow, ok := common.GetContextKeyType[*ContextOverflow](ctx, constant.ContextKeyContextOverflow)
+	if !ok || overflow == nil {
+		return
+	}
+	other["context_overflow"] = overflow
+}
+
+// NewContextLengthExceededError 请求无法放入模型上下文窗口，在预扣费前拒绝
+func NewContextLengthExceededError(err error) *types.NewAPIError {
+	return types.NewErrorWithStatusCode(err, types.ErrorCodeContextLengthExceeded, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+}
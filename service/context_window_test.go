@@ -0,0 +1,68 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openAIRoles(messages []dto.Message) []string {
+	roles := make([]string, 0, len(messages))
+	for _, m := range messages {
+		roles = append(roles, m.Role+":"+m.StringContent())
+	}
+	return roles
+}
+
+func TestTruncateMiddleOutOpenAI(t *testing.T) {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 50)
+	request := &dto.GeneralOpenAIRequest{
+		Messages: []dto.Message{
+			{Role: "system", Content: "sys"},
+			{Role: "user", Content: "u1"},
+			{Role: "assistant", Content: "a1"},
+			{Role: "user", Content: "u2 " + long},
+			{Role: "assistant", Content: "", ToolCalls: []byte(`[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]`)},
+			{Role: "tool", Content: "r2", ToolCallId: "call_1"},
+			{Role: "user", Content: "u3 " + long},
+			{Role: "assistant", Content: "a3"},
+			{Role: "user", Content: "u4"},
+		},
+	}
+
+	removed, ok := TruncateMiddleOut(request, 10, "gpt-4o")
+	require.True(t, ok)
+	// 中间一轮（u2 及其工具调用）整体删除
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, []string{"system:sys", "user:u1", "assistant:a1", "user:u3 " + long, "assistant:a3", "user:u4"}, openAIRoles(request.Messages))
+
+	// 需要删除的内容超过可删除的轮次时不修改请求
+	before := len(request.Messages)
+	_, ok = TruncateMiddleOut(request, 1_000_000, "gpt-4o")
+	assert.False(t, ok)
+	assert.Len(t, request.Messages, before)
+}
+
+func TestTruncateMiddleOutClaudeKeepsToolResultWithCall(t *testing.T) {
+	request := &dto.ClaudeRequest{
+		Messages: []dto.ClaudeMessage{
+			{Role: "user", Content: "first"},
+			{Role: "assistant", Content: []any{map[string]any{"type": "tool_use", "id": "t1", "name": "f", "input": map[string]any{}}}},
+			{Role: "user", Content: []any{map[string]any{"type": "tool_result", "tool_use_id": "t1", "content": "ok"}}},
+			{Role: "assistant", Content: "done"},
+			{Role: "user", Content: "middle"},
+			{Role: "assistant", Content: "reply"},
+			{Role: "user", Content: "last"},
+		},
+	}
+	removed, ok := TruncateMiddleOut(request, 1, "claude-sonnet-4")
+	require.True(t, ok)
+	assert.Equal(t, 2, removed)
+	require.Len(t, request.Messages, 5)
+	assert.Equal(t, "first", request.Messages[0].GetStringContent())
+	assert.Equal(t, "done", request.Messages[3].GetStringContent())
+	assert.Equal(t, "last", request.Messages[4].GetStringContent())
+}
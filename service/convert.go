@@ -663,6 +663,9 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 
 	// 转换 messages
 	var messages []dto.Message
+	// Gemini 的工具调用没有 ID，按顺序生成，并按函数名与后续的工具响应配对
+	callCount := 0
+	pendingCalls := make(map[string][]string)
 	for _, content := range geminiRequest.Contents {
 		message := dto.Message{
 			Role: convertGeminiRoleToOpenAI(content.Role),
@@ -672,6 +675,10 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		var mediaContents []dto.MediaContent
 		var toolCalls []dto.ToolCallRequest
 		for _, part := range content.Parts {
+			if part.Thought {
+				// 思考内容无法回放给其他上游
+				continue
+			}
 			if part.Text != "" {
 				mediaContent := dto.MediaContent{
 					Type: "text",
@@ -700,8 +707,11 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				mediaContents = append(mediaContents, mediaContent)
 			} else if part.FunctionCall != nil {
 				// 处理 Gemini 的工具调用
+				callCount++
+				callId := fmt.Sprintf("call_%d", callCount)
+				pendingCalls[part.FunctionCall.FunctionName] = append(pendingCalls[part.FunctionCall.FunctionName], callId)
 				toolCall := dto.ToolCallRequest{
-					ID:   fmt.Sprintf("call_%d", len(toolCalls)+1), // 生成唯一ID
+					ID:   callId,
 					Type: "function",
 					Function: dto.FunctionRequest{
 						Name:      part.FunctionCall.FunctionName,
@@ -711,9 +721,14 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 				toolCalls = append(toolCalls, toolCall)
 			} else if part.FunctionResponse != nil {
 				// 处理 Gemini 的工具响应，创建单独的 tool 消息
+				callId := fmt.Sprintf("call_%d", callCount)
+				if ids := pendingCalls[part.FunctionResponse.Name]; len(ids) > 0 {
+					callId = ids[0]
+					pendingCalls[part.FunctionResponse.Name] = ids[1:]
+				}
 				toolMessage := dto.Message{
 					Role:       "tool",
-					ToolCallId: fmt.Sprintf("call_%d", len(toolCalls)), // 使用对应的调用ID
+					ToolCallId: callId,
 				}
 				toolMessage.SetStringContent(toJSONString(part.FunctionResponse.Response))
 				messages = append(messages, toolMessage)
@@ -753,8 +768,19 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		openaiRequest.MaxTokens = lo.ToPtr(*geminiRequest.GenerationConfig.MaxOutputTokens)
 	}
 	// gemini stop sequences 最多 5 个，openai stop 最多 4 个
-	if len(geminiRequest.GenerationConfig.StopSequences) > 0 {
-		openaiRequest.Stop = geminiRequest.GenerationConfig.StopSequences[:4]
+	if stops := geminiRequest.GenerationConfig.StopSequences; len(stops) > 0 {
+		if len(stops) > 4 {
+			stops = stops[:4]
+		}
+		openaiRequest.Stop = stops
+	}
+	switch {
+	case len(geminiRequest.GenerationConfig.ResponseJsonSchema) > 0:
+		openaiRequest.ResponseFormat = geminiResponseFormat(geminiRequest.GenerationConfig.ResponseJsonSchema)
+	case geminiRequest.GenerationConfig.ResponseSchema != nil:
+		openaiRequest.ResponseFormat = geminiResponseFormat(normalizeGeminiSchema(geminiRequest.GenerationConfig.ResponseSchema))
+	case geminiRequest.GenerationConfig.ResponseMimeType == "application/json":
+		openaiRequest.ResponseFormat = &dto.ResponseFormat{Type: "json_object"}
 	}
 	if geminiRequest.GenerationConfig.CandidateCount != nil && *geminiRequest.GenerationConfig.CandidateCount > 0 {
 		openaiRequest.N = lo.ToPtr(*geminiRequest.GenerationConfig.CandidateCount)
@@ -771,12 +797,16 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 					continue
 				}
 				for _, function := range functionDeclarations {
+					parameters := function.Parameters
+					if parameters != nil {
+						parameters = normalizeGeminiSchema(parameters)
+					}
 					openAITool := dto.ToolCallRequest{
 						Type: "function",
 						Function: dto.FunctionRequest{
 							Name:        function.Name,
 							Description: function.Description,
-							Parameters:  function.Parameters,
+							Parameters:  parameters,
 						},
 					}
 					tools = append(tools, openAITool)
@@ -785,6 +815,7 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 		}
 		if len(tools) > 0 {
 			openaiRequest.Tools = tools
+			openaiRequest.ToolChoice = geminiToolChoice(geminiRequest.ToolConfig)
 		}
 	}
 
@@ -801,6 +832,91 @@ func GeminiToOpenAIRequest(geminiRequest *dto.GeminiChatRequest, info *relaycomm
 	return openaiRequest, nil
 }
 
+func geminiResponseFormat(schema any) *dto.ResponseFormat {
+	jsonSchema, err := common.Marshal(dto.FormatJsonSchema{Name: "response", Schema: schema})
+	if err != nil {
+		return &dto.ResponseFormat{Type: "json_object"}
+	}
+	return &dto.ResponseFormat{Type: "json_schema", JsonSchema: jsonSchema}
+}
+
+// normalizeGeminiSchema 将 Gemini 的 OpenAPI Schema（类型为大写）转换为 JSON Schema。
+// 只处理 schema 节点的 type，properties 中的属性名以及 enum、default、example 等用户数据保持原样
+func normalizeGeminiSchema(schema any) any {
+	var normalized any
+	if err := common.Unmarshal([]byte(toJSONString(schema)), &normalized); err != nil {
+		return schema
+	}
+	normalizeGeminiSchemaNode(normalized)
+	return normalized
+}
+
+func normalizeGeminiSchemaNode(v any) {
+	node, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	switch t := node["type"].(type) {
+	case string:
+		node["type"] = strings.ToLower(t)
+	case []any:
+		for i, item := range t {
+			if s, ok := item.(string); ok {
+				t[i] = strings.ToLower(s)
+			}
+		}
+	}
+	// 值为单个 schema 的字段
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		switch child := node[key].(type) {
+		case map[string]any:
+			normalizeGeminiSchemaNode(child)
+		case []any:
+			for _, item := range child {
+				normalizeGeminiSchemaNode(item)
+			}
+		}
+	}
+	// 值为 schema 数组的字段
+	for _, key := range []string{"anyOf", "oneOf", "allOf", "prefixItems"} {
+		if children, ok := node[key].([]any); ok {
+			for _, child := range children {
+				normalizeGeminiSchemaNode(child)
+			}
+		}
+	}
+	// 值为名称到 schema 映射的字段
+	for _, key := range []string{"properties", "patternProperties", "$defs", "definitions"} {
+		if children, ok := node[key].(map[string]any); ok {
+			for _, child := range children {
+				normalizeGeminiSchemaNode(child)
+			}
+		}
+	}
+}
+
+// geminiToolChoice 将 functionCallingConfig 转换为 tool_choice，仅允许单个函数时指定该函数
+func geminiToolChoice(config *dto.ToolConfig) any {
+	if config == nil || config.FunctionCallingConfig == nil {
+		return nil
+	}
+	switch strings.ToUpper(string(config.FunctionCallingConfig.Mode)) {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if names := config.FunctionCallingConfig.AllowedFunctionNames; len(names) == 1 {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": names[0]},
+			}
+		}
+		return "required"
+	case "AUTO":
+		return "auto"
+	}
+	return nil
+}
+
 func convertGeminiRoleToOpenAI(geminiRole string) string {
 	switch geminiRole {
 	case "user":
@@ -863,7 +979,10 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 			Parts: make([]dto.GeminiPart, 0),
 		}
 
-		// 处理工具调用
+		// 文本内容在前，工具调用在后
+		if textContent := choice.Message.StringContent(); textContent != "" {
+			content.Parts = append(content.Parts, dto.GeminiPart{Text: textContent})
+		}
 		toolCalls := choice.Message.ParseToolCalls()
 		if len(toolCalls) > 0 {
 			for _, toolCall := range toolCalls {
@@ -885,15 +1004,6 @@ func ResponseOpenAI2Gemini(openAIResponse *dto.OpenAITextResponse, info *relayco
 				}
 				content.Parts = append(content.Parts, part)
 			}
-		} else {
-			// 处理文本内容
-			textContent := choice.Message.StringContent()
-			if textContent != "" {
-				part := dto.GeminiPart{
-					Text: textContent,
-				}
-				content.Parts = append(content.Parts, part)
-			}
 		}
 
 		candidate.Content = content
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/filestore"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/file_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GatewayFileIdPrefix 网关文件 ID 前缀，与 OpenAI 保持一致，方便 SDK 透明使用
+const GatewayFileIdPrefix = "file-"
+
+func NewGatewayFileId() string {
+	return GatewayFileIdPrefix + common.GetRandomString(24)
+}
+
+// ChannelSupportsUpstreamFiles 渠道是否实现了 OpenAI 兼容的 /v1/files 接口
+func ChannelSupportsUpstreamFiles(channelType int) bool {
+	switch channelType {
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeCustom:
+		return true
+	default:
+		return false
+	}
+}
+
+func OpenStoredFile(ctx context.Context, file *model.File) (io.ReadCloser, error) {
+	store, err := filestore.ByType(file.StorageType)
+	if err != nil {
+		return nil, err
+	}
+	return store.Get(ctx, file.StorageKey)
+}
+
+func ReadStoredFile(ctx context.Context, file *model.File) ([]byte, error) {
+	reader, err := OpenStoredFile(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// DeleteStoredFile 删除文件的存储对象、上游副本以及数据库记录
+func DeleteStoredFile(ctx context.Context, file *model.File) error {
+	store, err := filestore.ByType(file.StorageType)
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(ctx, file.StorageKey); err != nil {
+		return err
+	}
+	mappings, err := model.GetFileUpstreams(file.FileId)
+	if err == nil {
+		for _, mapping := range mappings {
+			if delErr := deleteUpstreamFile(ctx, mapping); delErr != nil {
+				common.SysLog(fmt.Sprintf("failed to delete upstream file %s on channel #%d: %s", mapping.UpstreamFileId, mapping.ChannelId, delErr.Error()))
+			}
+		}
+	}
+	return model.DeleteFile(file)
+}
+
+// ResolveChatFileReferences 将消息中引用的网关文件 ID 替换为上游可识别的内容：
+// 渠道支持文件接口时上传到上游并替换为上游文件 ID，否则内联为 base64 数据。
+func ResolveChatFileReferences(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) error {
+	if request == nil || !file_setting.GetSetting().Enabled {
+		return nil
+	}
+	for i := range request.Messages {
+		message := &request.Messages[i]
+		if message.IsStringContent() {
+			continue
+		}
+		contents := message.ParseContent()
+		changed := false
+		for j := range contents {
+			if contents[j].Type != dto.ContentTypeFile {
+				continue
+			}
+			messageFile := contents[j].GetFile()
+			if messageFile == nil || !strings.HasPrefix(messageFile.FileId, GatewayFileIdPrefix) {
+				continue
+			}
+			file, err := model.GetUserFileByFileId(info.UserId, messageFile.FileId)
+			if err != nil {
+				// 不是网关托管的文件，原样透传给上游
+				continue
+			}
+			resolved, err := resolveMessageFile(c, info, file)
+			if err != nil {
+				return err
+			}
+			contents[j].File = resolved
+			changed = true
+		}
+		if changed {
+			message.SetMediaContent(contents)
+		}
+	}
+	return nil
+}
+
+func resolveMessageFile(c *gin.Context, info *relaycommon.RelayInfo, file *model.File) (*dto.MessageFile, error) {
+	if file_setting.GetSetting().UpstreamForwardEnabled && ChannelSupportsUpstreamFiles(info.ChannelType) {
+		upstreamId, err := GetOrUploadUpstreamFile(c, info, file)
+		if err != nil {
+			return nil, err
+		}
+		return &dto.MessageFile{FileId: upstreamId}, nil
+	}
+	data, err := ReadStoredFile(c.Request.Context(), file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", file.FileId, err)
+	}
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return &dto.MessageFile{
+		FileName: file.Filename,
+		FileData: fmt.Sprintf("data:%s;base64,%s", contentType, base64.StdEncoding.EncodeToString(data)),
+	}, nil
+}
+
+// GetOrUploadUpstreamFile 返回文件在当前渠道上的上游 ID，首次使用时上传并记录映射
+func GetOrUploadUpstreamFile(c *gin.Context, info *relaycommon.RelayInfo, file *model.File) (string, error) {
+	keyIndex := 0
+	if info.ChannelIsMultiKey {
+		keyIndex = info.ChannelMultiKeyIndex
+	}
+	if mapping, err := model.GetFileUpstream(file.FileId, info.ChannelId, keyIndex); err == nil && mapping.UpstreamFileId != "" {
+		return mapping.UpstreamFileId, nil
+	}
+	upstreamId, err := uploadFileToUpstream(c.Request.Context(), info.ChannelBaseUrl, info.ApiKey, info.ChannelSetting.Proxy, file)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file %s to upstream: %w", file.FileId, err)
+	}
+	if err := model.SaveFileUpstream(file.FileId, info.ChannelId, keyIndex, upstreamId); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("failed to save upstream file mapping: %s", err.Error()))
+	}
+	return upstreamId, nil
+}
+
+func uploadFileToUpstream(ctx context.Context, baseURL string, key string, proxy string, file *model.File) (string, error) {
+	content, err := ReadStoredFile(ctx, file)
+	if err != nil {
+		return "", err
+	}
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	purpose := file.Purpose
+	if purpose == "" {
+		purpose = "user_data"
+	}
+	if err := writer.WriteField("purpose", purpose); err != nil {
+		return "", err
+	}
+	part, err := writer.CreateFormFile("file", file.Filename)
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v1/files", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+key)
+	client, err := GetHttpClientWithProxy(proxy)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("upstream returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var uploaded dto.OpenAIFile
+	if err := common.Unmarshal(respBody, &uploaded); err != nil {
+		return "", err
+	}
+	if uploaded.Id == "" {
+		return "", fmt.Errorf("upstream returned empty file id")
+	}
+	return uploaded.Id, nil
+}
+
+func deleteUpstreamFile(ctx context.Context, mapping *model.FileUpstream) error {
+	channel, err := model.CacheGetChannel(mapping.ChannelId)
+	if err != nil {
+		return err
+	}
+	// 上游文件只能由上传时使用的密钥删除
+	key, err := channel.GetKeyAt(mapping.KeyIndex)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, strings.TrimRight(channel.GetBaseURL(), "/")+"/v1/files/"+mapping.UpstreamFileId, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	}
+	return nil
+}
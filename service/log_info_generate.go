@@ -70,6 +70,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		adminInfo["local_count_tokens"] = isLocalCountTokens
 	}
 
+	if relayInfo.Hedge != nil {
+		adminInfo["hedge_channels"] = relayInfo.Hedge.ChannelIds()
+	}
+
 	AppendChannelAffinityAdminInfo(ctx, adminInfo)
 
 	other["admin_info"] = adminInfo
@@ -77,6 +81,12 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 	appendRequestConversionChain(relayInfo, other)
 	appendFinalRequestFormat(relayInfo, other)
 	appendBillingInfo(relayInfo, other)
+	appendModelFallbackInfo(ctx, relayInfo, other)
+	appendContextOverflowInfo(ctx, relayInfo, other)
+	appendBatchInfo(ctx, relayInfo, other)
+	appendResponseCacheInfo(ctx, relayInfo, other)
+	appendOutputModerationInfo(ctx, other)
+	appendPIIRedactionInfo(relayInfo, other)
 	appendParamOverrideInfo(relayInfo, other)
 	appendStreamStatus(relayInfo, other)
 	return other
@@ -116,6 +126,26 @@ func appendStreamStatus(relayInfo *relaycommon.RelayInfo, other map[string]inter
 	other["stream_status"] = streamInfo
 }
 
+func appendBatchInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil {
+		return
+	}
+	batchId := common.GetContextKeyString(ctx, constant.ContextKeyBatchId)
+	if batchId == "" {
+		return
+	}
+	other["batch_id"] = batchId
+	other["batch_discount_ratio"] = relayInfo.PriceData.GroupRatioInfo.BatchDiscountRatio
+}
+
+func appendResponseCacheInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || !common.GetContextKeyBool(ctx, constant.ContextKeyResponseCacheHit) {
+		return
+	}
+	other["response_cache_hit"] = true
+	other["response_cache_price_ratio"] = relayInfo.PriceData.GroupRatioInfo.ResponseCacheRatio
+}
+
 func appendBillingInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
 	if relayInfo == nil || other == nil {
 		return
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contextLengthErrorKeywords 上游返回的超出上下文长度错误中常见的内容
+var contextLengthErrorKeywords = []string{
+	"context_length_exceeded",
+	"maximum context length",
+	"context window",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"exceeds the context",
+}
+
+// requestTimeoutErrorKeywords 请求失败且错误已被转成文本时，Go HTTP 客户端超时错误中的内容
+var requestTimeoutErrorKeywords = []string{
+	"context deadline exceeded",
+	"i/o timeout",
+	"timeout awaiting response headers",
+	"tls handshake timeout",
+	"client.timeout exceeded",
+}
+
+// ModelFallbackAttempt 回退链中未能完成请求的一个模型
+type ModelFallbackAttempt struct {
+	Model      string `json:"model"`
+	ErrorClass string `json:"error_class"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+// ModelFallback 一次虚拟模型请求的回退状态，保存在请求上下文中
+type ModelFallback struct {
+	VirtualModel string
+
+	mu       sync.Mutex
+	steps    []operation_setting.ModelFallbackStep
+	index    int
+	attempts []ModelFallbackAttempt
+}
+
+// StartModelFallback 请求的是虚拟模型时创建回退状态，返回第一个在分组中有可用渠道的实际模型。
+// 所有模型都没有可用渠道时返回第一个模型，由后续选择渠道时报错
+func StartModelFallback(c *gin.Context, modelName string, group string) (string, bool) {
+	virtualModel := operation_setting.GetVirtualModel(modelName)
+	if virtualModel == nil {
+		return modelName, false
+	}
+	fallback := &ModelFallback{
+		VirtualModel: virtualModel.Name,
+		steps:        append([]operation_setting.ModelFallbackStep(nil), virtualModel.Steps...),
+	}
+	for i, step := range fallback.steps {
+		if hasAvailableChannel(c, group, step.Model) {
+			fallback.index = i
+			break
+		}
+		if i == len(fallback.steps)-1 {
+			fallback.index = 0
+			fallback.attempts = nil
+			break
+		}
+		fallback.attempts = append(fallback.attempts, ModelFallbackAttempt{
+			Model:      step.Model,
+			ErrorClass: operation_setting.ModelFallbackOnChannelError,
+		})
+	}
+	common.SetContextKey(c, constant.ContextKeyModelFallback, fallback)
+	return fallback.steps[fallback.index].Model, true
+}
+
+func hasAvailableChannel(c *gin.Context, group string, modelName string) bool {
+	groups := []string{group}
+	if group == "auto" {
+		groups = GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	}
+	for _, g := range groups {
+		if channel, err := model.GetRandomSatisfiedChannel(g, modelName, 0); err == nil && channel != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GetModelFallback 返回请求的回退状态，请求的不是虚拟模型时返回 nil
+func GetModelFallback(c *gin.Context) *ModelFallback {
+	fallback, ok := common.GetContextKeyType[*ModelFallback](c, constant.ContextKeyModelFallback)
+	if !ok {
+		return nil
+	}
+	return fallback
+}
+
+// Next 当前模型的错误满足其回退条件时切换到下一个模型
+func (f *ModelFallback) Next(apiErr *types.NewAPIError) (string, bool) {
+	errorClass := ClassifyModelFallbackError(apiErr)
+	if errorClass == "" {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index >= len(f.steps)-1 || !f.steps[f.index].ShouldFallbackOn(errorClass) {
+		return "", false
+	}
+	return f.advance(errorClass, apiErr.StatusCode), true
+}
+
+// NextMatching 与 Next 相同，但跳过 fits 返回 false 的模型；没有合适的模型时不改变回退进度
+func (f *ModelFallback) NextMatching(apiErr *types.NewAPIError, fits func(modelName string) bool) (string, bool) {
+	errorClass := ClassifyModelFallbackError(apiErr)
+	if errorClass == "" {
+		return "", false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := f.index; i < len(f.steps)-1 && f.steps[i].ShouldFallbackOn(errorClass); i++ {
+		if !fits(f.steps[i+1].Model) {
+			continue
+		}
+		for f.index <= i {
+			f.advance(errorClass, apiErr.StatusCode)
+		}
+		return f.steps[f.index].Model, true
+	}
+	return "", false
+}
+
+// Skip 无条件跳过当前模型，用于模型未配置价格等无法发起请求的情况
+func (f *ModelFallback) Skip(reason string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index >= len(f.steps)-1 {
+		return "", false
+	}
+	return f.advance(reason, 0), true
+}
+
+func (f *ModelFallback) advance(errorClass string, statusCode int) string {
+	f.attempts = append(f.attempts, ModelFallbackAttempt{
+		Model:      f.steps[f.index].Model,
+		ErrorClass: errorClass,
+		StatusCode: statusCode,
+	})
+	f.index++
+	return f.steps[f.index].Model
+}
+
+func (f *ModelFallback) Attempts() []ModelFallbackAttempt {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ModelFallbackAttempt(nil), f.attempts...)
+}
+
+// isRequestTimeoutError 发往上游的请求本身超时（连接、等待响应头或上下文截止），上游错误内容中的 timeout 字样不算
+func isRequestTimeoutError(apiErr *types.NewAPIError) bool {
+	if errors.Is(apiErr, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(apiErr, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if apiErr.GetErrorCode() != types.ErrorCodeDoRequestFailed {
+		return false
+	}
+	message := strings.ToLower(apiErr.Error())
+	for _, keyword := range requestTimeoutErrorKeywords {
+		if strings.Contains(message, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifyModelFallbackError 把错误归类为回退条件，本地错误（如请求无效、额度不足）返回空字符串
+func ClassifyModelFallbackError(apiErr *types.NewAPIError) string {
+	if apiErr == nil {
+		return ""
+	}
+	code := apiErr.GetErrorCode()
+	message := strings.ToLower(apiErr.Error())
+	if code == types.ErrorCodeContextLengthExceeded {
+		return operation_setting.ModelFallbackOnContextLength
+	}
+	// 只有请求被拒绝的响应才按内容判断，避免 429 中的 "too many tokens" 等被误判
+	if apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusRequestEntityTooLarge {
+		for _, keyword := range contextLengthErrorKeywords {
+			if strings.Contains(message, keyword) {
+				return operation_setting.ModelFallbackOnContextLength
+			}
+		}
+	}
+	switch apiErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout, 524:
+		return operation_setting.ModelFallbackOnTimeout
+	}
+	if code == types.ErrorCodeChannelResponseTimeExceeded || isRequestTimeoutError(apiErr) {
+		return operation_setting.ModelFallbackOnTimeout
+	}
+	if code == types.ErrorCodeGetChannelFailed || code == types.ErrorCodeModelNotFound || types.IsChannelError(apiErr) {
+		return operation_setting.ModelFallbackOnChannelError
+	}
+	if apiErr.StatusCode == http.StatusTooManyRequests {
+		return operation_setting.ModelFallbackOnRateLimit
+	}
+	if types.IsSkipRetryError(apiErr) {
+		return ""
+	}
+	if apiErr.StatusCode >= 500 || apiErr.StatusCode < 100 {
+		return operation_setting.ModelFallbackOnServerError
+	}
+	if apiErr.StatusCode >= 400 && apiErr.GetErrorType() != types.ErrorTypeNewAPIError {
+		return operation_setting.ModelFallbackOnClientError
+	}
+	return ""
+}
+
+// appendModelFallbackInfo 记录虚拟模型名、实际提供服务的模型及失败的模型
+func appendModelFallbackInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil {
+		return
+	}
+	fallback := GetModelFallback(ctx)
+	if fallback == nil {
+		return
+	}
+	info := map[string]interface{}{
+		"virtual_model": fallback.VirtualModel,
+		"served_model":  relayInfo.OriginModelName,
+	}
+	if attempts := fallback.Attempts(); len(attempts) > 0 {
+		info["attempts"] = attempts
+	}
+	other["model_fallback"] = info
+}
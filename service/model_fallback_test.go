@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyModelFallbackError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  *types.NewAPIError
+		want string
+	}{
+		{"rate limit", types.NewOpenAIError(errors.New("slow down"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests), operation_setting.ModelFallbackOnRateLimit},
+		{"server error", types.NewOpenAIError(errors.New("overloaded"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway), operation_setting.ModelFallbackOnServerError},
+		{"timeout", types.NewOpenAIError(errors.New("upstream"), types.ErrorCodeBadResponseStatusCode, http.StatusGatewayTimeout), operation_setting.ModelFallbackOnTimeout},
+		{"context length", types.NewOpenAIError(errors.New("This model's maximum context length is 8192 tokens"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest), operation_setting.ModelFallbackOnContextLength},
+		{"no channel", types.NewError(errors.New("no channel"), types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry()), operation_setting.ModelFallbackOnChannelError},
+		{"upstream 4xx", types.NewOpenAIError(errors.New("bad"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest), operation_setting.ModelFallbackOnClientError},
+		{"local error", types.NewError(errors.New("invalid"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry()), ""},
+		{"request deadline", types.NewOpenAIError(fmt.Errorf("do request failed: %w", context.DeadlineExceeded), types.ErrorCodeDoRequestFailed, http.StatusInternalServerError), operation_setting.ModelFallbackOnTimeout},
+		{"client timeout text", types.NewOpenAIError(errors.New(`Post "https://api": net/http: timeout awaiting response headers`), types.ErrorCodeDoRequestFailed, http.StatusInternalServerError), operation_setting.ModelFallbackOnTimeout},
+		{"timeout in upstream message", types.NewOpenAIError(errors.New("invalid value for timeout"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest), operation_setting.ModelFallbackOnClientError},
+		{"tpm rate limit", types.NewOpenAIError(errors.New("too many tokens per minute"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests), operation_setting.ModelFallbackOnRateLimit},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyModelFallbackError(tc.err))
+		})
+	}
+}
+
+func TestModelFallbackWalksChainByCondition(t *testing.T) {
+	fallback := &ModelFallback{
+		VirtualModel: "smart",
+		steps: []operation_setting.ModelFallbackStep{
+			{Model: "claude-opus"},
+			{Model: "gpt-5", On: []string{operation_setting.ModelFallbackOnContextLength}},
+			{Model: "gemini-pro"},
+		},
+	}
+	rateLimited := types.NewOpenAIError(errors.New("slow down"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests)
+
+	next, ok := fallback.Next(rateLimited)
+	require.True(t, ok)
+	assert.Equal(t, "gpt-5", next)
+
+	// gpt-5 只在超出上下文长度时回退
+	_, ok = fallback.Next(rateLimited)
+	assert.False(t, ok)
+	next, ok = fallback.Next(types.NewOpenAIError(errors.New("prompt is too long"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest))
+	require.True(t, ok)
+	assert.Equal(t, "gemini-pro", next)
+
+	// 最后一个模型之后不再回退
+	_, ok = fallback.Skip(string(types.ErrorCodeModelPriceError))
+	assert.False(t, ok)
+
+	attempts := fallback.Attempts()
+	require.Len(t, attempts, 2)
+	assert.Equal(t, ModelFallbackAttempt{Model: "claude-opus", ErrorClass: operation_setting.ModelFallbackOnRateLimit, StatusCode: http.StatusTooManyRequests}, attempts[0])
+	assert.Equal(t, operation_setting.ModelFallbackOnContextLength, attempts[1].ErrorClass)
+}
+
+func TestModelFallbackNextMatchingSkipsModelsThatDoNotFit(t *testing.T) {
+	fallback := &ModelFallback{
+		VirtualModel: "smart",
+		steps: []operation_setting.ModelFallbackStep{
+			{Model: "small", On: []string{operation_setting.ModelFallbackOnContextLength}},
+			{Model: "medium", On: []string{operation_setting.ModelFallbackOnContextLength}},
+			{Model: "large"},
+		},
+	}
+	tooLong := NewContextLengthExceededError(errors.New("prompt too long"))
+
+	// 没有合适的模型时不改变回退进度
+	_, ok := fallback.NextMatching(tooLong, func(string) bool { return false })
+	assert.False(t, ok)
+	assert.Empty(t, fallback.Attempts())
+
+	next, ok := fallback.NextMatching(tooLong, func(modelName string) bool { return modelName == "large" })
+	require.True(t, ok)
+	assert.Equal(t, "large", next)
+	attempts := fallback.Attempts()
+	require.Len(t, attempts, 2)
+	assert.Equal(t, "small", attempts[0].Model)
+	assert.Equal(t, "medium", attempts[1].Model)
+	assert.Equal(t, operation_setting.ModelFallbackOnContextLength, attempts[1].ErrorClass)
+}
@@ -1,6 +1,8 @@
 package service
 
 import (
+	"encoding/json"
+
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/service/openaicompat"
 )
@@ -16,3 +18,31 @@ func ResponsesResponseToChatCompletionsResponse(resp *dto.OpenAIResponsesRespons
 func ExtractOutputTextFromResponses(resp *dto.OpenAIResponsesResponse) string {
 	return openaicompat.ExtractOutputTextFromResponses(resp)
 }
+
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	return openaicompat.ResponsesRequestToChatCompletionsRequest(req)
+}
+
+func ChatCompletionsResponseToResponsesResponse(resp *dto.OpenAITextResponse, id string, createdAt int) *dto.OpenAIResponsesResponse {
+	return openaicompat.ChatCompletionsResponseToResponsesResponse(resp, id, createdAt)
+}
+
+func NewChatToResponsesStream(id string, model string, createdAt int) *openaicompat.ChatToResponsesStream {
+	return openaicompat.NewChatToResponsesStream(id, model, createdAt)
+}
+
+func ResponsesContentToChat(role string, raw json.RawMessage) (any, error) {
+	return openaicompat.ResponsesContentToChat(role, raw)
+}
+
+func ResponsesOutputToString(raw json.RawMessage) string {
+	return openaicompat.ResponsesOutputToString(raw)
+}
+
+func ClaudeResponseToResponsesResponse(resp *dto.ClaudeResponse, id string, model string, createdAt int, usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	return openaicompat.ClaudeResponseToResponsesResponse(resp, id, model, createdAt, usage)
+}
+
+func NewClaudeToResponsesStream(id string, model string, createdAt int) *openaicompat.ClaudeToResponsesStream {
+	return openaicompat.NewClaudeToResponsesStream(id, model, createdAt)
+}
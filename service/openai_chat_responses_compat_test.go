@@ -0,0 +1,171 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponsesRequestToChatCompletionsRequest(t *testing.T) {
+	req := &dto.OpenAIResponsesRequest{
+		Model:        "claude-sonnet-4",
+		Instructions: json.RawMessage(`"be brief"`),
+		Input: json.RawMessage(`[
+			{"role":"user","content":[{"type":"input_text","text":"weather?"}]},
+			{"type":"function_call","call_id":"call_1","name":"get_weather","arguments":"{\"city\":\"Paris\"}"},
+			{"type":"function_call","call_id":"call_2","name":"get_weather","arguments":"{\"city\":\"Rome\"}"},
+			{"type":"function_call_output","call_id":"call_1","output":"sunny"}
+		]`),
+		Tools:           json.RawMessage(`[{"type":"function","name":"get_weather","parameters":{"type":"object"}}]`),
+		ToolChoice:      json.RawMessage(`{"type":"function","name":"get_weather"}`),
+		MaxOutputTokens: common.GetPointer[uint](256),
+	}
+
+	chatReq, err := ResponsesRequestToChatCompletionsRequest(req)
+	require.NoError(t, err)
+	require.Len(t, chatReq.Messages, 4)
+	assert.Equal(t, "system", chatReq.Messages[0].Role)
+	assert.Equal(t, "be brief", chatReq.Messages[0].StringContent())
+	assert.Equal(t, "weather?", chatReq.Messages[1].StringContent())
+	// 连续的 function_call 合并为一条 assistant 消息
+	assert.Equal(t, "assistant", chatReq.Messages[2].Role)
+	assert.Len(t, chatReq.Messages[2].ParseToolCalls(), 2)
+	assert.Equal(t, "tool", chatReq.Messages[3].Role)
+	assert.Equal(t, "call_1", chatReq.Messages[3].ToolCallId)
+	assert.Len(t, chatReq.Tools, 1)
+	assert.Equal(t, uint(256), *chatReq.MaxTokens)
+	assert.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chatReq.ToolChoice)
+
+	_, err = ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", PreviousResponseID: "resp_1"})
+	assert.Error(t, err)
+
+	// 内置工具与引用项无法转发到其他上游，直接拒绝
+	_, err = ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", Tools: json.RawMessage(`[{"type":"web_search"}]`)})
+	assert.ErrorContains(t, err, "web_search")
+	_, err = ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", Input: json.RawMessage(`[{"type":"item_reference","id":"rs_1"}]`)})
+	assert.ErrorContains(t, err, "item_reference")
+}
+
+func TestResponsesChatBridgeRoundTripsReasoningOutput(t *testing.T) {
+	var resp dto.OpenAITextResponse
+	require.NoError(t, common.UnmarshalJsonStr(`{"model":"m","choices":[
+		{"index":0,"message":{"role":"assistant","content":"checking","reasoning_content":"need weather",
+			"tool_calls":[{"id":"call_1","type":"function","function":{"name":"get_weather","arguments":"{}"}}]},"finish_reason":"tool_calls"}
+	]}`, &resp))
+	turn1 := ChatCompletionsResponseToResponsesResponse(&resp, "resp_abc", 1)
+	require.Equal(t, "reasoning", turn1.Output[0].Type)
+
+	// 客户端把第一轮的输出项原样带回，再追加工具结果
+	input := []any{map[string]any{"role": "user", "content": "weather?"}}
+	for _, item := range turn1.Output {
+		input = append(input, item)
+	}
+	input = append(input, map[string]any{"type": "function_call_output", "call_id": "call_1", "output": "sunny"})
+	inputRaw, err := common.Marshal(input)
+	require.NoError(t, err)
+
+	chatReq, err := ResponsesRequestToChatCompletionsRequest(&dto.OpenAIResponsesRequest{Model: "m", Input: inputRaw})
+	require.NoError(t, err)
+	require.Len(t, chatReq.Messages, 3)
+	assert.Equal(t, "user", chatReq.Messages[0].Role)
+	assert.Equal(t, "assistant", chatReq.Messages[1].Role)
+	assert.Equal(t, "checking", chatReq.Messages[1].StringContent())
+	require.Len(t, chatReq.Messages[1].ParseToolCalls(), 1)
+	assert.Equal(t, "call_1", chatReq.Messages[1].ParseToolCalls()[0].ID)
+	assert.Equal(t, "tool", chatReq.Messages[2].Role)
+}
+
+func TestChatCompletionsResponseToResponsesResponseMultipleChoices(t *testing.T) {
+	var resp dto.OpenAITextResponse
+	require.NoError(t, common.UnmarshalJsonStr(`{"model":"m","choices":[
+		{"index":0,"message":{"role":"assistant","content":"first"},"finish_reason":"stop"},
+		{"index":1,"message":{"role":"assistant","content":"second"},"finish_reason":"length"}
+	]}`, &resp))
+
+	response := ChatCompletionsResponseToResponsesResponse(&resp, "resp_abc", 1)
+	require.Len(t, response.Output, 2)
+	assert.Equal(t, "first", response.Output[0].Content[0].Text)
+	assert.Equal(t, "second", response.Output[1].Content[0].Text)
+	assert.Equal(t, "max_output_tokens", response.IncompleteDetails.Reason)
+}
+
+func TestChatToResponsesStream(t *testing.T) {
+	stream := NewChatToResponsesStream("resp_abc", "claude-sonnet-4", 1)
+	var types []string
+	collect := func(events []dto.ResponsesStreamResponse) {
+		for _, event := range events {
+			types = append(types, event.Type)
+		}
+	}
+	chunk := func(raw string) *dto.ChatCompletionsStreamResponse {
+		var c dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(raw, &c))
+		return &c
+	}
+
+	collect(stream.Start())
+	collect(stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"reasoning_content":"think"}}]}`)))
+	collect(stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"content":"Hel"}}]}`)))
+	collect(stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"content":"lo"}}]}`)))
+	collect(stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},"finish_reason":"tool_calls"}]}`)))
+	collect(stream.Finish(&dto.Usage{PromptTokens: 10, CompletionTokens: 5}))
+
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.reasoning_summary_part.added",
+		"response.reasoning_summary_text.delta",
+		"response.reasoning_summary_text.done",
+		"response.reasoning_summary_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.output_item.added",
+		"response.function_call_arguments.delta",
+		"response.function_call_arguments.done",
+		"response.output_item.done",
+		"response.completed",
+	}, types)
+
+	response := stream.Response()
+	require.Len(t, response.Output, 3)
+	assert.Equal(t, "rs_abc_0", response.Output[0].ID)
+	assert.Equal(t, "Hello", response.Output[1].Content[0].Text)
+	assert.Equal(t, "call_1", response.Output[2].CallId)
+	assert.Equal(t, 15, response.Usage.TotalTokens)
+	assert.Equal(t, 10, response.Usage.InputTokens)
+}
+
+func TestChatToResponsesStreamMultipleChoices(t *testing.T) {
+	stream := NewChatToResponsesStream("resp_abc", "m", 1)
+	chunk := func(raw string) *dto.ChatCompletionsStreamResponse {
+		var c dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(raw, &c))
+		return &c
+	}
+
+	stream.Start()
+	stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"content":"a"}},{"index":1,"delta":{"content":"b"}}]}`))
+	stream.Chunk(chunk(`{"choices":[{"index":1,"delta":{"tool_calls":[{"index":0,"type":"function","function":{"name":"f","arguments":"{}"}}]}}]}`))
+	stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"content":"c"},"finish_reason":"stop"}]}`))
+	events := stream.Finish(nil)
+	assert.Equal(t, "response.completed", events[len(events)-1].Type)
+
+	// 每个 choice 的输出项互不干扰，按首次出现的顺序排列
+	response := stream.Response()
+	require.Len(t, response.Output, 3)
+	assert.Equal(t, "ac", response.Output[0].Content[0].Text)
+	assert.Equal(t, "b", response.Output[1].Content[0].Text)
+	assert.Equal(t, "f", response.Output[2].Name)
+	assert.Equal(t, "call_abc_2", response.Output[2].CallId)
+}
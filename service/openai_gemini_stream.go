@@ -0,0 +1,142 @@
+package service
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+func openAIFinishReasonToGemini(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+type geminiStreamToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// ChatToGeminiStream 将 Chat Completions 流式分片转换为 Gemini 流式响应。
+// 文本与思考内容逐片输出；工具调用参数分片拼接完整后，与结束原因、用量一起在最后一个响应中输出
+type ChatToGeminiStream struct {
+	info            *relaycommon.RelayInfo
+	includeThoughts bool
+	toolCalls       map[int]*geminiStreamToolCall
+	finishReason    string
+	usage           *dto.Usage
+}
+
+func NewChatToGeminiStream(info *relaycommon.RelayInfo, includeThoughts bool) *ChatToGeminiStream {
+	return &ChatToGeminiStream{
+		info:            info,
+		includeThoughts: includeThoughts,
+		toolCalls:       make(map[int]*geminiStreamToolCall),
+	}
+}
+
+func (s *ChatToGeminiStream) usageMetadata() dto.GeminiUsageMetadata {
+	if s.usage == nil {
+		estimate := s.info.GetEstimatePromptTokens()
+		return dto.GeminiUsageMetadata{PromptTokenCount: estimate, TotalTokenCount: estimate}
+	}
+	total := s.usage.TotalTokens
+	if total == 0 {
+		total = s.usage.PromptTokens + s.usage.CompletionTokens
+	}
+	return dto.GeminiUsageMetadata{
+		PromptTokenCount:        s.usage.PromptTokens,
+		CandidatesTokenCount:    s.usage.CompletionTokens - s.usage.CompletionTokenDetails.ReasoningTokens,
+		ThoughtsTokenCount:      s.usage.CompletionTokenDetails.ReasoningTokens,
+		CachedContentTokenCount: s.usage.PromptTokensDetails.CachedTokens,
+		TotalTokenCount:         total,
+	}
+}
+
+func (s *ChatToGeminiStream) response(parts []dto.GeminiPart, finishReason *string) *dto.GeminiChatResponse {
+	return &dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{{
+			Content:       dto.GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason:  finishReason,
+			SafetyRatings: []dto.GeminiChatSafetyRating{},
+		}},
+		UsageMetadata: s.usageMetadata(),
+	}
+}
+
+// Chunk 处理一个 Chat Completions 流式分片，没有可输出的内容时返回 nil
+func (s *ChatToGeminiStream) Chunk(chunk *dto.ChatCompletionsStreamResponse) *dto.GeminiChatResponse {
+	if chunk == nil {
+		return nil
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	var parts []dto.GeminiPart
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" && s.includeThoughts {
+			parts = append(parts, dto.GeminiPart{Text: reasoning, Thought: true})
+		}
+		if content := choice.Delta.GetContentString(); content != "" {
+			parts = append(parts, dto.GeminiPart{Text: content})
+		}
+		for i, toolCall := range choice.Delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			call, ok := s.toolCalls[index]
+			if !ok {
+				call = &geminiStreamToolCall{}
+				s.toolCalls[index] = call
+			}
+			if call.name == "" {
+				call.name = toolCall.Function.Name
+			}
+			call.arguments.WriteString(toolCall.Function.Arguments)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return s.response(parts, nil)
+}
+
+// Finish 返回包含工具调用、结束原因与最终用量的最后一个响应
+func (s *ChatToGeminiStream) Finish(usage *dto.Usage) *dto.GeminiChatResponse {
+	if usage != nil && (usage.TotalTokens > 0 || usage.PromptTokens > 0 || usage.CompletionTokens > 0) {
+		s.usage = usage
+	}
+	indexes := make([]int, 0, len(s.toolCalls))
+	for index := range s.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	parts := make([]dto.GeminiPart, 0, len(indexes))
+	for _, index := range indexes {
+		call := s.toolCalls[index]
+		args := map[string]any{}
+		if raw := call.arguments.String(); raw != "" {
+			if err := common.UnmarshalJsonStr(raw, &args); err != nil {
+				args = map[string]any{"arguments": raw}
+			}
+		}
+		parts = append(parts, dto.GeminiPart{FunctionCall: &dto.FunctionCall{FunctionName: call.name, Arguments: args}})
+	}
+	finishReason := openAIFinishReasonToGemini(s.finishReason)
+	return s.response(parts, &finishReason)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiToOpenAIRequestToolCallPairing(t *testing.T) {
+	var request dto.GeminiChatRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"contents": [
+			{"role":"user","parts":[{"text":"weather in Paris and Rome?"}]},
+			{"role":"model","parts":[
+				{"functionCall":{"name":"get_weather","args":{"city":"Paris"}}},
+				{"functionCall":{"name":"get_time","args":{"city":"Rome"}}}
+			]},
+			{"role":"user","parts":[
+				{"functionResponse":{"name":"get_time","response":{"time":"12:00"}}},
+				{"functionResponse":{"name":"get_weather","response":{"weather":"sunny"}}}
+			]}
+		],
+		"tools":[{"functionDeclarations":[{"name":"get_weather","parameters":{"type":"OBJECT"}}]}],
+		"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["get_weather"]}},
+		"generationConfig":{"stopSequences":["END"],"responseMimeType":"application/json","responseSchema":{"type":"OBJECT","properties":{"a":{"type":"STRING"}}}}
+	}`, &request))
+
+	chatReq, err := GeminiToOpenAIRequest(&request, &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{UpstreamModelName: "claude-sonnet-4"}})
+	require.NoError(t, err)
+	require.Len(t, chatReq.Messages, 4)
+
+	toolCalls := chatReq.Messages[1].ParseToolCalls()
+	require.Len(t, toolCalls, 2)
+	// 工具响应按函数名匹配对应的调用 ID，而不是按出现顺序
+	assert.Equal(t, toolCalls[1].ID, chatReq.Messages[2].ToolCallId)
+	assert.Equal(t, toolCalls[0].ID, chatReq.Messages[3].ToolCallId)
+
+	assert.Equal(t, []string{"END"}, chatReq.Stop)
+	assert.Equal(t, "json_schema", chatReq.ResponseFormat.Type)
+	assert.Contains(t, string(chatReq.ResponseFormat.JsonSchema), `"type":"object"`)
+	assert.Equal(t, map[string]any{"type": "function", "function": map[string]any{"name": "get_weather"}}, chatReq.ToolChoice)
+	assert.Equal(t, map[string]any{"type": "object"}, chatReq.Tools[0].Function.Parameters)
+}
+
+func TestChatToGeminiStream(t *testing.T) {
+	stream := NewChatToGeminiStream(&relaycommon.RelayInfo{}, false)
+	chunk := func(raw string) *dto.ChatCompletionsStreamResponse {
+		var c dto.ChatCompletionsStreamResponse
+		require.NoError(t, common.UnmarshalJsonStr(raw, &c))
+		return &c
+	}
+
+	assert.Nil(t, stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"role":"assistant"}}]}`)))
+	// 未请求思考内容时不输出
+	assert.Nil(t, stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"reasoning_content":"hmm"}}]}`)))
+
+	resp := stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`))
+	require.NotNil(t, resp)
+	assert.Equal(t, "Hi", resp.Candidates[0].Content.Parts[0].Text)
+	assert.Nil(t, resp.Candidates[0].FinishReason)
+
+	// 工具调用参数分片到结束时才输出
+	assert.Nil(t, stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"f","arguments":"{\"a\":"}}]}}]}`)))
+	assert.Nil(t, stream.Chunk(chunk(`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"1}"}}]},"finish_reason":"tool_calls"}]}`)))
+
+	final := stream.Finish(&dto.Usage{PromptTokens: 10, CompletionTokens: 4})
+	require.NotNil(t, final)
+	require.Len(t, final.Candidates[0].Content.Parts, 1)
+	call := final.Candidates[0].Content.Parts[0].FunctionCall
+	assert.Equal(t, "f", call.FunctionName)
+	assert.Equal(t, map[string]any{"a": float64(1)}, call.Arguments)
+	assert.Equal(t, "STOP", *final.Candidates[0].FinishReason)
+	assert.Equal(t, 14, final.UsageMetadata.TotalTokenCount)
+}
+
+func TestNormalizeGeminiSchemaOnlyLowercasesSchemaTypes(t *testing.T) {
+	var schema map[string]any
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"type":"OBJECT",
+		"properties":{
+			"type":{"type":"STRING","enum":["CAR","BOAT"]},
+			"items":{"type":"ARRAY","items":{"type":"INTEGER"}},
+			"shape":{"anyOf":[{"type":"NUMBER"}],"example":{"type":"SQUARE"}}
+		}
+	}`, &schema))
+
+	normalized := normalizeGeminiSchema(schema).(map[string]any)
+	assert.Equal(t, "object", normalized["type"])
+	properties := normalized["properties"].(map[string]any)
+	// 名为 type、items 的属性仍按 schema 处理，enum 与 example 中的用户数据保持原样
+	typeProperty := properties["type"].(map[string]any)
+	assert.Equal(t, "string", typeProperty["type"])
+	assert.Equal(t, []any{"CAR", "BOAT"}, typeProperty["enum"])
+	itemsProperty := properties["items"].(map[string]any)
+	assert.Equal(t, "array", itemsProperty["type"])
+	assert.Equal(t, "integer", itemsProperty["items"].(map[string]any)["type"])
+	shape := properties["shape"].(map[string]any)
+	assert.Equal(t, "number", shape["anyOf"].([]any)[0].(map[string]any)["type"])
+	assert.Equal(t, "SQUARE", shape["example"].(map[string]any)["type"])
+}
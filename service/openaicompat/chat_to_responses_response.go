@@ -0,0 +1,386 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	responsesStatusInProgress = "in_progress"
+	responsesStatusCompleted  = "completed"
+	responsesStatusIncomplete = "incomplete"
+)
+
+func responsesStatusRaw(status string) json.RawMessage {
+	raw, _ := common.Marshal(status)
+	return raw
+}
+
+// ChatUsageToResponsesUsage 将 Chat Completions 的 usage 转换为 Responses API 的字段
+func ChatUsageToResponsesUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	return &dto.Usage{
+		PromptTokens:        usage.PromptTokens,
+		CompletionTokens:    usage.CompletionTokens,
+		TotalTokens:         total,
+		InputTokens:         usage.PromptTokens,
+		OutputTokens:        usage.CompletionTokens,
+		InputTokensDetails:  &dto.InputTokenDetails{CachedTokens: usage.PromptTokensDetails.CachedTokens},
+		OutputTokensDetails: &dto.OutputTokenDetails{ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens},
+	}
+}
+
+// mergeResponsesFinishReason 多个 choice 时任一 choice 未完成则整个响应标记为未完成
+func mergeResponsesFinishReason(current string, finishReason string) string {
+	if status, _ := responsesStatusFromFinishReason(current); status == responsesStatusIncomplete {
+		return current
+	}
+	return finishReason
+}
+
+func responsesStatusFromFinishReason(finishReason string) (string, *dto.IncompleteDetails) {
+	switch finishReason {
+	case "length":
+		return responsesStatusIncomplete, &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		return responsesStatusIncomplete, &dto.IncompleteDetails{Reason: "content_filter"}
+	default:
+		return responsesStatusCompleted, nil
+	}
+}
+
+func newResponsesSnapshot(id string, model string, createdAt int, status string) *dto.OpenAIResponsesResponse {
+	return &dto.OpenAIResponsesResponse{
+		ID:                id,
+		Object:            "response",
+		CreatedAt:         createdAt,
+		Status:            responsesStatusRaw(status),
+		Model:             model,
+		Output:            []dto.ResponsesOutput{},
+		ParallelToolCalls: true,
+		Tools:             []map[string]any{},
+	}
+}
+
+func newResponsesMessageOutput(id string, text string, status string) dto.ResponsesOutput {
+	content := []dto.ResponsesOutputContent{}
+	if status != responsesStatusInProgress {
+		content = append(content, dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: []interface{}{}})
+	}
+	return dto.ResponsesOutput{Type: "message", ID: id, Status: status, Role: "assistant", Content: content}
+}
+
+func newResponsesReasoningOutput(id string, text string) dto.ResponsesOutput {
+	output := dto.ResponsesOutput{Type: "reasoning", ID: id}
+	if text != "" {
+		output.Summary = []dto.ResponsesReasoningSummaryPart{{Type: "summary_text", Text: text}}
+	}
+	return output
+}
+
+func newResponsesFunctionCallOutput(id string, callId string, name string, arguments string, status string) dto.ResponsesOutput {
+	argumentsRaw, _ := common.Marshal(arguments)
+	return dto.ResponsesOutput{Type: "function_call", ID: id, Status: status, CallId: callId, Name: name, Arguments: argumentsRaw}
+}
+
+// ChatCompletionsResponseToResponsesResponse 将非流式 Chat Completions 响应转换为 Responses API 响应，
+// 多个 choice 的输出项按 choice 顺序依次排列
+func ChatCompletionsResponseToResponsesResponse(resp *dto.OpenAITextResponse, id string, createdAt int) *dto.OpenAIResponsesResponse {
+	out := newResponsesSnapshot(id, resp.Model, createdAt, responsesStatusCompleted)
+	out.Usage = ChatUsageToResponsesUsage(&resp.Usage)
+	base := strings.TrimPrefix(id, "resp_")
+	finishReason := ""
+	for _, choice := range resp.Choices {
+		if reasoning := choice.Message.GetReasoningContent(); reasoning != "" {
+			out.Output = append(out.Output, newResponsesReasoningOutput(fmt.Sprintf("rs_%s_%d", base, len(out.Output)), reasoning))
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			out.Output = append(out.Output, newResponsesMessageOutput(fmt.Sprintf("msg_%s_%d", base, len(out.Output)), text, responsesStatusCompleted))
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			out.Output = append(out.Output, newResponsesFunctionCallOutput(fmt.Sprintf("fc_%s_%d", base, len(out.Output)),
+				toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments, responsesStatusCompleted))
+		}
+		finishReason = mergeResponsesFinishReason(finishReason, choice.FinishReason)
+	}
+	status, incomplete := responsesStatusFromFinishReason(finishReason)
+	out.Status = responsesStatusRaw(status)
+	out.IncompleteDetails = incomplete
+	return out
+}
+
+type responsesStreamItem struct {
+	outputIndex int
+	id          string
+	callId      string
+	name        string
+	text        strings.Builder
+	done        bool
+	// kind 与 encrypted 仅用于 Claude 内容块：输出项类型与推理签名
+	kind      string
+	encrypted string
+}
+
+// responsesChoiceState 单个 choice 正在输出的推理、消息与工具调用
+type responsesChoiceState struct {
+	reasoning *responsesStreamItem
+	message   *responsesStreamItem
+	toolCalls map[int]*responsesStreamItem
+}
+
+// ChatToResponsesStream 将 Chat Completions 流式分片逐个转换为 Responses API 流式事件，
+// 每个 choice 的输出项各自开启与关闭，按首次出现的顺序分配 output_index
+type ChatToResponsesStream struct {
+	id        string
+	base      string
+	model     string
+	createdAt int
+	sequence  int
+	nextIndex int
+
+	outputs      map[int]dto.ResponsesOutput
+	choices      map[int]*responsesChoiceState
+	finishReason string
+	usage        *dto.Usage
+}
+
+func NewChatToResponsesStream(id string, model string, createdAt int) *ChatToResponsesStream {
+	return &ChatToResponsesStream{
+		id:        id,
+		base:      strings.TrimPrefix(id, "resp_"),
+		model:     model,
+		createdAt: createdAt,
+		outputs:   make(map[int]dto.ResponsesOutput),
+		choices:   make(map[int]*responsesChoiceState),
+	}
+}
+
+func (s *ChatToResponsesStream) choice(index int) *responsesChoiceState {
+	state, ok := s.choices[index]
+	if !ok {
+		state = &responsesChoiceState{toolCalls: make(map[int]*responsesStreamItem)}
+		s.choices[index] = state
+	}
+	return state
+}
+
+func (s *ChatToResponsesStream) event(event dto.ResponsesStreamResponse) dto.ResponsesStreamResponse {
+	event.SequenceNumber = s.sequence
+	s.sequence++
+	return event
+}
+
+func (s *ChatToResponsesStream) openItem(prefix string) *responsesStreamItem {
+	item := &responsesStreamItem{outputIndex: s.nextIndex}
+	item.id = fmt.Sprintf("%s_%s_%d", prefix, s.base, item.outputIndex)
+	s.nextIndex++
+	return item
+}
+
+// Start 返回 response.created 与 response.in_progress 事件
+func (s *ChatToResponsesStream) Start() []dto.ResponsesStreamResponse {
+	snapshot := newResponsesSnapshot(s.id, s.model, s.createdAt, responsesStatusInProgress)
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.created", Response: snapshot}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.in_progress", Response: snapshot}),
+	}
+}
+
+func (s *ChatToResponsesStream) closeReasoning(state *responsesChoiceState) []dto.ResponsesStreamResponse {
+	item := state.reasoning
+	if item == nil {
+		return nil
+	}
+	state.reasoning = nil
+	text := item.text.String()
+	output := newResponsesReasoningOutput(item.id, text)
+	s.outputs[item.outputIndex] = output
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_text.done", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0), Text: text}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_part.done", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0),
+			Part: &dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text}}),
+		s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}),
+	}
+}
+
+func (s *ChatToResponsesStream) closeMessage(state *responsesChoiceState) []dto.ResponsesStreamResponse {
+	item := state.message
+	if item == nil {
+		return nil
+	}
+	state.message = nil
+	text := item.text.String()
+	output := newResponsesMessageOutput(item.id, text, responsesStatusCompleted)
+	s.outputs[item.outputIndex] = output
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.output_text.done", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Text: text}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.content_part.done", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0),
+			Part: &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: text}}),
+		s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}),
+	}
+}
+
+func (s *ChatToResponsesStream) closeToolCalls(state *responsesChoiceState) []dto.ResponsesStreamResponse {
+	indexes := make([]int, 0, len(state.toolCalls))
+	for index := range state.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var events []dto.ResponsesStreamResponse
+	for _, index := range indexes {
+		item := state.toolCalls[index]
+		if item.done {
+			continue
+		}
+		item.done = true
+		arguments := item.text.String()
+		output := newResponsesFunctionCallOutput(item.id, item.callId, item.name, arguments, responsesStatusCompleted)
+		s.outputs[item.outputIndex] = output
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{Type: "response.function_call_arguments.done", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), Arguments: arguments}),
+			s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}),
+		)
+	}
+	return events
+}
+
+// Chunk 处理一个 Chat Completions 流式分片，返回需要发送的事件
+func (s *ChatToResponsesStream) Chunk(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	if chunk == nil {
+		return nil
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	if s.model == "" {
+		s.model = chunk.Model
+	}
+	var events []dto.ResponsesStreamResponse
+	for _, choice := range chunk.Choices {
+		state := s.choice(choice.Index)
+		delta := choice.Delta
+		if reasoning := delta.GetReasoningContent(); reasoning != "" {
+			events = append(events, s.closeMessage(state)...)
+			if state.reasoning == nil {
+				state.reasoning = s.openItem("rs")
+				output := newResponsesReasoningOutput(state.reasoning.id, "")
+				events = append(events,
+					s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(state.reasoning.outputIndex), Item: &output}),
+					s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_part.added", ItemID: state.reasoning.id,
+						OutputIndex: common.GetPointer(state.reasoning.outputIndex), SummaryIndex: common.GetPointer(0),
+						Part: &dto.ResponsesReasoningSummaryPart{Type: "summary_text"}}),
+				)
+			}
+			state.reasoning.text.WriteString(reasoning)
+			events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_text.delta", ItemID: state.reasoning.id,
+				OutputIndex: common.GetPointer(state.reasoning.outputIndex), SummaryIndex: common.GetPointer(0), Delta: reasoning}))
+		}
+		if content := delta.GetContentString(); content != "" {
+			events = append(events, s.closeReasoning(state)...)
+			if state.message == nil {
+				state.message = s.openItem("msg")
+				output := newResponsesMessageOutput(state.message.id, "", responsesStatusInProgress)
+				events = append(events,
+					s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(state.message.outputIndex), Item: &output}),
+					s.event(dto.ResponsesStreamResponse{Type: "response.content_part.added", ItemID: state.message.id,
+						OutputIndex: common.GetPointer(state.message.outputIndex), ContentIndex: common.GetPointer(0),
+						Part: &dto.ResponsesReasoningSummaryPart{Type: "output_text"}}),
+				)
+			}
+			state.message.text.WriteString(content)
+			events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.output_text.delta", ItemID: state.message.id,
+				OutputIndex: common.GetPointer(state.message.outputIndex), ContentIndex: common.GetPointer(0), Delta: content}))
+		}
+		for i, toolCall := range delta.ToolCalls {
+			index := i
+			if toolCall.Index != nil {
+				index = *toolCall.Index
+			}
+			item, ok := state.toolCalls[index]
+			if !ok {
+				events = append(events, s.closeReasoning(state)...)
+				events = append(events, s.closeMessage(state)...)
+				item = s.openItem("fc")
+				item.callId = toolCall.ID
+				if item.callId == "" {
+					item.callId = fmt.Sprintf("call_%s_%d", s.base, item.outputIndex)
+				}
+				item.name = toolCall.Function.Name
+				state.toolCalls[index] = item
+				output := newResponsesFunctionCallOutput(item.id, item.callId, item.name, "", responsesStatusInProgress)
+				events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded,
+					OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+			} else if item.name == "" && toolCall.Function.Name != "" {
+				item.name = toolCall.Function.Name
+			}
+			if arguments := toolCall.Function.Arguments; arguments != "" {
+				item.text.WriteString(arguments)
+				events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.function_call_arguments.delta", ItemID: item.id,
+					OutputIndex: common.GetPointer(item.outputIndex), Delta: arguments}))
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = mergeResponsesFinishReason(s.finishReason, *choice.FinishReason)
+		}
+	}
+	return events
+}
+
+// Finish 关闭所有未完成的输出项并返回最终的 response.completed（或 response.incomplete）事件
+func (s *ChatToResponsesStream) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	if usage != nil && (usage.TotalTokens > 0 || usage.PromptTokens > 0 || usage.CompletionTokens > 0) {
+		s.usage = usage
+	}
+	choiceIndexes := make([]int, 0, len(s.choices))
+	for index := range s.choices {
+		choiceIndexes = append(choiceIndexes, index)
+	}
+	sort.Ints(choiceIndexes)
+	var events []dto.ResponsesStreamResponse
+	for _, index := range choiceIndexes {
+		state := s.choices[index]
+		events = append(events, s.closeReasoning(state)...)
+		events = append(events, s.closeMessage(state)...)
+		events = append(events, s.closeToolCalls(state)...)
+	}
+
+	response := s.Response()
+	eventType := "response.completed"
+	if response.IncompleteDetails != nil {
+		eventType = "response.incomplete"
+	}
+	return append(events, s.event(dto.ResponsesStreamResponse{Type: eventType, Response: response}))
+}
+
+// Response 返回当前已完成输出项组成的响应快照
+func (s *ChatToResponsesStream) Response() *dto.OpenAIResponsesResponse {
+	status, incomplete := responsesStatusFromFinishReason(s.finishReason)
+	response := newResponsesSnapshot(s.id, s.model, s.createdAt, status)
+	response.IncompleteDetails = incomplete
+	response.Usage = ChatUsageToResponsesUsage(s.usage)
+	indexes := make([]int, 0, len(s.outputs))
+	for index := range s.outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		response.Output = append(response.Output, s.outputs[index])
+	}
+	return response
+}
@@ -0,0 +1,329 @@
+package openaicompat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// ClaudeRedactedThinkingPrefix redacted_thinking 块的加密数据写入推理项 encrypted_content 时的前缀，
+// 与带签名的 thinking 块区分，回传时据此还原
+const ClaudeRedactedThinkingPrefix = "claude_redacted_thinking:"
+
+// claudeStopReasonToFinishReason 将 Claude 的 stop_reason 对应到 Chat Completions 的 finish_reason
+func claudeStopReasonToFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "refusal":
+		return "content_filter"
+	case "tool_use":
+		return "tool_calls"
+	default:
+		return "stop"
+	}
+}
+
+func claudeReasoningOutput(id string, thinking string, signature string) dto.ResponsesOutput {
+	output := newResponsesReasoningOutput(id, thinking)
+	output.EncryptedContent = signature
+	return output
+}
+
+func claudeToolInputArguments(input any) string {
+	if input == nil {
+		return "{}"
+	}
+	arguments, err := common.Marshal(input)
+	if err != nil {
+		return "{}"
+	}
+	return string(arguments)
+}
+
+// ClaudeResponseToResponsesResponse 将非流式 Claude Messages 响应直接转换为 Responses API 响应，
+// 每个内容块对应一个输出项，thinking 块的签名保存在推理项的 encrypted_content 中
+func ClaudeResponseToResponsesResponse(resp *dto.ClaudeResponse, id string, model string, createdAt int, usage *dto.Usage) *dto.OpenAIResponsesResponse {
+	if model == "" {
+		model = resp.Model
+	}
+	out := newResponsesSnapshot(id, model, createdAt, responsesStatusCompleted)
+	out.Usage = ChatUsageToResponsesUsage(usage)
+	base := strings.TrimPrefix(id, "resp_")
+	for _, block := range resp.Content {
+		itemId := func(prefix string) string {
+			return fmt.Sprintf("%s_%s_%d", prefix, base, len(out.Output))
+		}
+		switch block.Type {
+		case "thinking":
+			thinking := ""
+			if block.Thinking != nil {
+				thinking = *block.Thinking
+			}
+			out.Output = append(out.Output, claudeReasoningOutput(itemId("rs"), thinking, block.Signature))
+		case "redacted_thinking":
+			out.Output = append(out.Output, claudeReasoningOutput(itemId("rs"), "", ClaudeRedactedThinkingPrefix+block.Data))
+		case "text":
+			if text := block.GetText(); text != "" {
+				out.Output = append(out.Output, newResponsesMessageOutput(itemId("msg"), text, responsesStatusCompleted))
+			}
+		case "tool_use":
+			out.Output = append(out.Output, newResponsesFunctionCallOutput(itemId("fc"), block.Id, block.Name,
+				claudeToolInputArguments(block.Input), responsesStatusCompleted))
+		}
+	}
+	status, incomplete := responsesStatusFromFinishReason(claudeStopReasonToFinishReason(resp.StopReason))
+	out.Status = responsesStatusRaw(status)
+	out.IncompleteDetails = incomplete
+	return out
+}
+
+// ClaudeToResponsesStream 将 Claude Messages 流式事件直接转换为 Responses API 流式事件，
+// 每个内容块按出现顺序对应一个输出项，签名随 signature_delta 写入推理项
+type ClaudeToResponsesStream struct {
+	id        string
+	base      string
+	model     string
+	createdAt int
+	sequence  int
+	nextIndex int
+	started   bool
+
+	blocks     map[int]*responsesStreamItem
+	outputs    map[int]dto.ResponsesOutput
+	stopReason string
+	usage      *dto.Usage
+}
+
+func NewClaudeToResponsesStream(id string, model string, createdAt int) *ClaudeToResponsesStream {
+	return &ClaudeToResponsesStream{
+		id:        id,
+		base:      strings.TrimPrefix(id, "resp_"),
+		model:     model,
+		createdAt: createdAt,
+		blocks:    make(map[int]*responsesStreamItem),
+		outputs:   make(map[int]dto.ResponsesOutput),
+	}
+}
+
+func (s *ClaudeToResponsesStream) event(event dto.ResponsesStreamResponse) dto.ResponsesStreamResponse {
+	event.SequenceNumber = s.sequence
+	s.sequence++
+	return event
+}
+
+func (s *ClaudeToResponsesStream) openItem(kind string, prefix string) *responsesStreamItem {
+	item := &responsesStreamItem{outputIndex: s.nextIndex, kind: kind}
+	item.id = fmt.Sprintf("%s_%s_%d", prefix, s.base, item.outputIndex)
+	s.nextIndex++
+	return item
+}
+
+func (s *ClaudeToResponsesStream) start() []dto.ResponsesStreamResponse {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	snapshot := newResponsesSnapshot(s.id, s.model, s.createdAt, responsesStatusInProgress)
+	return []dto.ResponsesStreamResponse{
+		s.event(dto.ResponsesStreamResponse{Type: "response.created", Response: snapshot}),
+		s.event(dto.ResponsesStreamResponse{Type: "response.in_progress", Response: snapshot}),
+	}
+}
+
+// openBlock 为内容块开启输出项，无法表示的内容块返回 nil
+func (s *ClaudeToResponsesStream) openBlock(block *dto.ClaudeMediaMessage) (*responsesStreamItem, []dto.ResponsesStreamResponse) {
+	var item *responsesStreamItem
+	var output dto.ResponsesOutput
+	var events []dto.ResponsesStreamResponse
+	switch block.Type {
+	case "thinking":
+		item = s.openItem("reasoning", "rs")
+		output = claudeReasoningOutput(item.id, "", "")
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_part.added", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0),
+			Part: &dto.ResponsesReasoningSummaryPart{Type: "summary_text"}}))
+		if block.Thinking != nil {
+			item.text.WriteString(*block.Thinking)
+		}
+		item.encrypted = block.Signature
+	case "redacted_thinking":
+		item = s.openItem("redacted_reasoning", "rs")
+		item.encrypted = ClaudeRedactedThinkingPrefix + block.Data
+		output = claudeReasoningOutput(item.id, "", "")
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+	case "text":
+		item = s.openItem("message", "msg")
+		output = newResponsesMessageOutput(item.id, "", responsesStatusInProgress)
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.content_part.added", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0),
+			Part: &dto.ResponsesReasoningSummaryPart{Type: "output_text"}}))
+		if text := block.GetText(); text != "" {
+			item.text.WriteString(text)
+			events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.output_text.delta", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Delta: text}))
+		}
+	case "tool_use":
+		item = s.openItem("function_call", "fc")
+		item.callId = block.Id
+		item.name = block.Name
+		output = newResponsesFunctionCallOutput(item.id, item.callId, item.name, "", responsesStatusInProgress)
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemAdded, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+	default:
+		// 服务端工具等内容块无法在 Responses 中表示，跳过
+		return nil, nil
+	}
+	return item, events
+}
+
+func (s *ClaudeToResponsesStream) blockDelta(item *responsesStreamItem, delta *dto.ClaudeMediaMessage) []dto.ResponsesStreamResponse {
+	switch delta.Type {
+	case "thinking_delta":
+		if delta.Thinking == nil || *delta.Thinking == "" {
+			return nil
+		}
+		item.text.WriteString(*delta.Thinking)
+		return []dto.ResponsesStreamResponse{s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_text.delta", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0), Delta: *delta.Thinking})}
+	case "signature_delta":
+		item.encrypted += delta.Signature
+	case "text_delta":
+		text := delta.GetText()
+		if text == "" {
+			return nil
+		}
+		item.text.WriteString(text)
+		return []dto.ResponsesStreamResponse{s.event(dto.ResponsesStreamResponse{Type: "response.output_text.delta", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Delta: text})}
+	case "input_json_delta":
+		if delta.PartialJson == nil || *delta.PartialJson == "" {
+			return nil
+		}
+		item.text.WriteString(*delta.PartialJson)
+		return []dto.ResponsesStreamResponse{s.event(dto.ResponsesStreamResponse{Type: "response.function_call_arguments.delta", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), Delta: *delta.PartialJson})}
+	}
+	return nil
+}
+
+func (s *ClaudeToResponsesStream) closeBlock(item *responsesStreamItem) []dto.ResponsesStreamResponse {
+	if item.done {
+		return nil
+	}
+	item.done = true
+	text := item.text.String()
+	var output dto.ResponsesOutput
+	var events []dto.ResponsesStreamResponse
+	switch item.kind {
+	case "reasoning":
+		output = claudeReasoningOutput(item.id, text, item.encrypted)
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_text.done", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0), Text: text}),
+			s.event(dto.ResponsesStreamResponse{Type: "response.reasoning_summary_part.done", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), SummaryIndex: common.GetPointer(0),
+				Part: &dto.ResponsesReasoningSummaryPart{Type: "summary_text", Text: text}}),
+		)
+	case "redacted_reasoning":
+		output = claudeReasoningOutput(item.id, "", item.encrypted)
+	case "message":
+		output = newResponsesMessageOutput(item.id, text, responsesStatusCompleted)
+		events = append(events,
+			s.event(dto.ResponsesStreamResponse{Type: "response.output_text.done", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0), Text: text}),
+			s.event(dto.ResponsesStreamResponse{Type: "response.content_part.done", ItemID: item.id,
+				OutputIndex: common.GetPointer(item.outputIndex), ContentIndex: common.GetPointer(0),
+				Part: &dto.ResponsesReasoningSummaryPart{Type: "output_text", Text: text}}),
+		)
+	case "function_call":
+		if text == "" {
+			text = "{}"
+		}
+		output = newResponsesFunctionCallOutput(item.id, item.callId, item.name, text, responsesStatusCompleted)
+		events = append(events, s.event(dto.ResponsesStreamResponse{Type: "response.function_call_arguments.done", ItemID: item.id,
+			OutputIndex: common.GetPointer(item.outputIndex), Arguments: text}))
+	}
+	s.outputs[item.outputIndex] = output
+	return append(events, s.event(dto.ResponsesStreamResponse{Type: dto.ResponsesOutputTypeItemDone, OutputIndex: common.GetPointer(item.outputIndex), Item: &output}))
+}
+
+// Event 处理一个 Claude 流式事件，返回需要发送的 Responses 事件
+func (s *ClaudeToResponsesStream) Event(resp *dto.ClaudeResponse) []dto.ResponsesStreamResponse {
+	if resp == nil {
+		return nil
+	}
+	events := s.start()
+	switch resp.Type {
+	case "message_start":
+		if s.model == "" && resp.Message != nil {
+			s.model = resp.Message.Model
+		}
+	case "content_block_start":
+		if resp.ContentBlock == nil {
+			return events
+		}
+		item, blockEvents := s.openBlock(resp.ContentBlock)
+		if item != nil {
+			s.blocks[resp.GetIndex()] = item
+		}
+		events = append(events, blockEvents...)
+	case "content_block_delta":
+		if item, ok := s.blocks[resp.GetIndex()]; ok && resp.Delta != nil {
+			events = append(events, s.blockDelta(item, resp.Delta)...)
+		}
+	case "content_block_stop":
+		if item, ok := s.blocks[resp.GetIndex()]; ok {
+			events = append(events, s.closeBlock(item)...)
+		}
+	case "message_delta":
+		if resp.Delta != nil && resp.Delta.StopReason != nil {
+			s.stopReason = *resp.Delta.StopReason
+		}
+	}
+	return events
+}
+
+// Finish 关闭未结束的输出项并返回最终的 response.completed（或 response.incomplete）事件
+func (s *ClaudeToResponsesStream) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	if usage != nil && (usage.TotalTokens > 0 || usage.PromptTokens > 0 || usage.CompletionTokens > 0) {
+		s.usage = usage
+	}
+	events := s.start()
+	items := make([]*responsesStreamItem, 0, len(s.blocks))
+	for _, item := range s.blocks {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].outputIndex < items[j].outputIndex })
+	for _, item := range items {
+		events = append(events, s.closeBlock(item)...)
+	}
+
+	response := s.Response()
+	eventType := "response.completed"
+	if response.IncompleteDetails != nil {
+		eventType = "response.incomplete"
+	}
+	return append(events, s.event(dto.ResponsesStreamResponse{Type: eventType, Response: response}))
+}
+
+// Response 返回当前已完成输出项组成的响应快照
+func (s *ClaudeToResponsesStream) Response() *dto.OpenAIResponsesResponse {
+	status, incomplete := responsesStatusFromFinishReason(claudeStopReasonToFinishReason(s.stopReason))
+	response := newResponsesSnapshot(s.id, s.model, s.createdAt, status)
+	response.IncompleteDetails = incomplete
+	response.Usage = ChatUsageToResponsesUsage(s.usage)
+	indexes := make([]int, 0, len(s.outputs))
+	for index := range s.outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		response.Output = append(response.Output, s.outputs[index])
+	}
+	return response
+}
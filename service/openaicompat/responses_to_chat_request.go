@@ -0,0 +1,337 @@
+package openaicompat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// responsesInputItem 覆盖 Responses API input 数组中需要转换的字段
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesContentPart struct {
+	Type       string          `json:"type"`
+	Text       string          `json:"text"`
+	Refusal    string          `json:"refusal"`
+	ImageUrl   json.RawMessage `json:"image_url"`
+	Detail     string          `json:"detail"`
+	FileId     string          `json:"file_id"`
+	FileData   string          `json:"file_data"`
+	FileUrl    string          `json:"file_url"`
+	Filename   string          `json:"filename"`
+	InputAudio any             `json:"input_audio"`
+}
+
+type responsesFunctionTool struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Parameters  any    `json:"parameters"`
+}
+
+type responsesTextConfig struct {
+	Format *struct {
+		Type        string          `json:"type"`
+		Name        string          `json:"name"`
+		Description string          `json:"description"`
+		Schema      any             `json:"schema"`
+		Strict      json.RawMessage `json:"strict"`
+	} `json:"format"`
+}
+
+func convertResponsesContentParts(role string, raw json.RawMessage) (any, error) {
+	switch common.GetJsonType(raw) {
+	case "unknown", "null":
+		return "", nil
+	case "string":
+		var text string
+		if err := common.Unmarshal(raw, &text); err != nil {
+			return nil, err
+		}
+		return text, nil
+	case "array":
+	default:
+		return nil, fmt.Errorf("unsupported content type for role %s", role)
+	}
+
+	var parts []responsesContentPart
+	if err := common.Unmarshal(raw, &parts); err != nil {
+		return nil, err
+	}
+	contents := make([]dto.MediaContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text", "text":
+			contents = append(contents, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Text})
+		case "refusal":
+			contents = append(contents, dto.MediaContent{Type: dto.ContentTypeText, Text: part.Refusal})
+		case "input_image":
+			url := ""
+			if common.GetJsonType(part.ImageUrl) == "string" {
+				_ = common.Unmarshal(part.ImageUrl, &url)
+			} else if len(part.ImageUrl) > 0 {
+				var image dto.MessageImageUrl
+				_ = common.Unmarshal(part.ImageUrl, &image)
+				url = image.Url
+			}
+			if url == "" {
+				return nil, errors.New("input_image without image_url is not supported in chat compatibility mode")
+			}
+			contents = append(contents, dto.MediaContent{
+				Type:     dto.ContentTypeImageURL,
+				ImageUrl: &dto.MessageImageUrl{Url: url, Detail: part.Detail},
+			})
+		case "input_file":
+			fileData := part.FileData
+			if fileData == "" {
+				fileData = part.FileUrl
+			}
+			contents = append(contents, dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{FileName: part.Filename, FileData: fileData, FileId: part.FileId},
+			})
+		case "input_audio":
+			contents = append(contents, dto.MediaContent{Type: dto.ContentTypeInputAudio, InputAudio: part.InputAudio})
+		default:
+			return nil, fmt.Errorf("content type %s is not supported in chat compatibility mode", part.Type)
+		}
+	}
+	// 纯文本内容合并为字符串，兼容只接受字符串内容的上游
+	textOnly := true
+	var sb strings.Builder
+	for _, content := range contents {
+		if content.Type != dto.ContentTypeText {
+			textOnly = false
+			break
+		}
+		sb.WriteString(content.Text)
+	}
+	if textOnly {
+		return sb.String(), nil
+	}
+	return contents, nil
+}
+
+// ResponsesContentToChat 将 Responses 消息内容转换为 Chat Completions 消息内容，纯文本时返回字符串
+func ResponsesContentToChat(role string, raw json.RawMessage) (any, error) {
+	return convertResponsesContentParts(role, raw)
+}
+
+// ResponsesOutputToString 将 function_call_output 的输出转换为文本
+func ResponsesOutputToString(raw json.RawMessage) string {
+	return responsesOutputToString(raw)
+}
+
+func responsesOutputToString(raw json.RawMessage) string {
+	switch common.GetJsonType(raw) {
+	case "unknown", "null":
+		return ""
+	case "string":
+		var s string
+		_ = common.Unmarshal(raw, &s)
+		return s
+	case "array":
+		var parts []responsesContentPart
+		if err := common.Unmarshal(raw, &parts); err == nil {
+			var sb strings.Builder
+			for _, part := range parts {
+				sb.WriteString(part.Text)
+			}
+			return sb.String()
+		}
+	}
+	return string(raw)
+}
+
+func convertResponsesToolChoice(raw json.RawMessage) any {
+	switch common.GetJsonType(raw) {
+	case "unknown", "null":
+		return nil
+	case "string":
+		var s string
+		_ = common.Unmarshal(raw, &s)
+		return s
+	}
+	var m map[string]any
+	if err := common.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	// Responses: {"type":"function","name":"..."}
+	// Chat: {"type":"function","function":{"name":"..."}}
+	if t, _ := m["type"].(string); t == "function" {
+		if name, _ := m["name"].(string); name != "" {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": name},
+			}
+		}
+	}
+	return m
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 Responses API 请求转换为 Chat Completions 请求，用于不支持 Responses 的上游
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if req.PreviousResponseID != "" {
+		return nil, errors.New("previous_response_id is not supported in chat compatibility mode")
+	}
+
+	messages := make([]dto.Message, 0)
+
+	if len(req.Instructions) > 0 {
+		instructions := responsesOutputToString(req.Instructions)
+		if strings.TrimSpace(instructions) != "" {
+			messages = append(messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+
+	switch common.GetJsonType(req.Input) {
+	case "unknown", "null":
+	case "string":
+		var text string
+		if err := common.Unmarshal(req.Input, &text); err != nil {
+			return nil, err
+		}
+		messages = append(messages, dto.Message{Role: "user", Content: text})
+	case "array":
+		var items []responsesInputItem
+		if err := common.Unmarshal(req.Input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		for _, item := range items {
+			switch item.Type {
+			case "", "message":
+				role := strings.TrimSpace(item.Role)
+				if role == "" {
+					role = "user"
+				}
+				if role == "developer" {
+					role = "system"
+				}
+				content, err := convertResponsesContentParts(role, item.Content)
+				if err != nil {
+					return nil, err
+				}
+				messages = append(messages, dto.Message{Role: role, Content: content})
+			case "function_call":
+				toolCall := dto.ToolCallRequest{
+					ID:   item.CallId,
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      item.Name,
+						Arguments: dto.ResponsesArgumentsString(item.Arguments),
+					},
+				}
+				// 连续的 function_call 合并到同一条 assistant 消息
+				if n := len(messages); n > 0 && messages[n-1].Role == "assistant" {
+					toolCalls := append(messages[n-1].ParseToolCalls(), toolCall)
+					messages[n-1].SetToolCalls(toolCalls)
+					continue
+				}
+				message := dto.Message{Role: "assistant", Content: ""}
+				message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+				messages = append(messages, message)
+			case "function_call_output":
+				messages = append(messages, dto.Message{
+					Role:       "tool",
+					ToolCallId: item.CallId,
+					Content:    responsesOutputToString(item.Output),
+				})
+			case "reasoning":
+				// 客户端会把上一轮输出的推理项原样带回，与 previous_response_id 回放一致直接丢弃；
+				// 部分 Chat 上游拒绝输入消息中的 reasoning_content，因此不映射
+				continue
+			case "item_reference":
+				// 引用项依赖 OpenAI 服务端状态，无法回放到其他上游，明确拒绝而不是静默丢弃
+				return nil, fmt.Errorf("input item type %s is not supported in chat compatibility mode", item.Type)
+			default:
+				return nil, fmt.Errorf("input item type %s is not supported in chat compatibility mode", item.Type)
+			}
+		}
+	default:
+		return nil, errors.New("input must be a string or an array")
+	}
+
+	out := &dto.GeneralOpenAIRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Stream:      req.Stream,
+		MaxTokens:   req.MaxOutputTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		User:        req.User,
+		Metadata:    req.Metadata,
+		ToolChoice:  convertResponsesToolChoice(req.ToolChoice),
+	}
+	if req.Stream != nil && *req.Stream {
+		out.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil && req.Reasoning.Effort != "" {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			out.ParallelTooCalls = &parallel
+		}
+	}
+
+	if len(req.Tools) > 0 {
+		var tools []responsesFunctionTool
+		if err := common.Unmarshal(req.Tools, &tools); err != nil {
+			return nil, fmt.Errorf("invalid tools: %w", err)
+		}
+		for _, tool := range tools {
+			// 内置工具（web_search、file_search 等）依赖 OpenAI 服务端执行，无法转发
+			if tool.Type != "function" {
+				return nil, fmt.Errorf("tool type %s is not supported in chat compatibility mode", tool.Type)
+			}
+			out.Tools = append(out.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        tool.Name,
+					Description: tool.Description,
+					Parameters:  tool.Parameters,
+				},
+			})
+		}
+		if len(out.Tools) == 0 {
+			out.ToolChoice = nil
+		}
+	}
+
+	if len(req.Text) > 0 {
+		var text responsesTextConfig
+		if err := common.Unmarshal(req.Text, &text); err == nil && text.Format != nil && text.Format.Type != "" {
+			format := &dto.ResponseFormat{Type: text.Format.Type}
+			if text.Format.Type == "json_schema" {
+				format.JsonSchema, _ = common.Marshal(dto.FormatJsonSchema{
+					Description: text.Format.Description,
+					Name:        text.Format.Name,
+					Schema:      text.Format.Schema,
+					Strict:      text.Format.Strict,
+				})
+			}
+			out.ResponseFormat = format
+		}
+	}
+
+	return out, nil
+}
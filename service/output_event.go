@@ -0,0 +1,58 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// outputSegment 事件中的一段模型输出文本
+type outputSegment struct {
+	path string
+	text []rune
+}
+
+// outputEvent 写往客户端的一个 SSE 事件，发出前可修改其中的文本
+type outputEvent struct {
+	lines    []string
+	dataLine int
+	data     []byte
+	segments []*outputSegment
+	modified bool
+}
+
+// parseOutputEvent 解析以空行分隔的一个 SSE 事件，空事件返回 nil
+func parseOutputEvent(block string) *outputEvent {
+	block = strings.TrimLeft(block, "\r\n")
+	if block == "" {
+		return nil
+	}
+	event := &outputEvent{lines: strings.Split(block, "\n"), dataLine: -1}
+	for i, line := range event.lines {
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			event.dataLine = i
+			event.data = []byte(strings.TrimSpace(payload))
+			break
+		}
+	}
+	return event
+}
+
+func (e *outputEvent) isJSON() bool {
+	return e.dataLine >= 0 && gjson.ValidBytes(e.data)
+}
+
+// encode 写回修改后的文本，返回完整的事件内容
+func (e *outputEvent) encode() string {
+	if e.modified {
+		data := e.data
+		for _, segment := range e.segments {
+			if updated, err := sjson.SetBytes(data, segment.path, string(segment.text)); err == nil {
+				data = updated
+			}
+		}
+		e.lines[e.dataLine] = "data: " + string(data)
+	}
+	return strings.Join(e.lines, "\n") + "\n\n"
+}
@@ -0,0 +1,677 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// moderationModelMaxRunes 送审核模型的文本上限
+const moderationModelMaxRunes = 20000
+
+// OutputModerationResult 输出审核结果，记录到消费日志的 other.output_moderation
+type OutputModerationResult struct {
+	Action       string   `json:"action"`
+	Words        []string `json:"words,omitempty"`
+	Blocked      bool     `json:"blocked,omitempty"`
+	ModelFlagged bool     `json:"model_flagged,omitempty"`
+	Categories   []string `json:"categories,omitempty"`
+	ModelError   string   `json:"model_error,omitempty"`
+}
+
+// OutputModerationWriter 审核写往客户端的模型输出。
+// 流式响应按 SSE 事件处理，最多暂存 StreamCacheQueueLength 个事件，使跨事件的敏感词在发出前仍可屏蔽或阻断；
+// 非流式响应在结算前整体缓存，审核后再写出。状态码不是 200 的响应直接透传
+type OutputModerationWriter struct {
+	gin.ResponseWriter
+	ctx          *gin.Context
+	format       types.RelayFormat
+	action       string
+	queueLength  int
+	maxWordRunes int
+	checkModel   bool
+
+	mu       sync.Mutex
+	decided  bool
+	stream   bool
+	pending  []byte
+	held     []*outputEvent
+	body     bytes.Buffer
+	tail     []rune
+	fullText []rune
+	streamId string
+	model    string
+	created  int64
+	finished bool
+	result   OutputModerationResult
+}
+
+// NewOutputModerationWriter 未开启输出审核、分组不审核或接口不产生文本输出时返回 nil
+func NewOutputModerationWriter(c *gin.Context, info *relaycommon.RelayInfo) *OutputModerationWriter {
+	if !setting.ShouldCheckCompletionSensitive() || !isTextOutputRelay(c, info) {
+		return nil
+	}
+	action := operation_setting.GetOutputModerationAction(info.UsingGroup, setting.StopOnSensitiveEnabled)
+	if action == operation_setting.OutputModerationActionOff {
+		return nil
+	}
+	maxWordRunes := 0
+	for _, word := range setting.SensitiveWords {
+		maxWordRunes = max(maxWordRunes, utf8.RuneCountInString(strings.TrimSpace(word)))
+	}
+	checkModel := operation_setting.GetOutputModerationSetting().ModerationModel != ""
+	if maxWordRunes == 0 && !checkModel {
+		return nil
+	}
+	queueLength := setting.StreamCacheQueueLength
+	if action == operation_setting.OutputModerationActionFlag || queueLength < 0 {
+		queueLength = 0
+	}
+	w := &OutputModerationWriter{
+		ResponseWriter: c.Writer,
+		ctx:            c,
+		format:         info.RelayFormat,
+		action:         action,
+		queueLength:    queueLength,
+		maxWordRunes:   maxWordRunes,
+		checkModel:     checkModel,
+		result:         OutputModerationResult{Action: action},
+	}
+	common.SetContextKey(c, constant.ContextKeyOutputModeration, w)
+	return w
+}
+
+// isTextOutputRelay 请求是否生成文本输出（对话、Claude、Gemini、Responses）
+func isTextOutputRelay(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	switch info.RelayFormat {
+	case types.RelayFormatOpenAI:
+		return info.RelayMode == relayconstant.RelayModeChatCompletions || info.RelayMode == relayconstant.RelayModeCompletions
+	case types.RelayFormatGemini:
+		return !strings.Contains(c.Request.URL.Path, "embed")
+	case types.RelayFormatClaude, types.RelayFormatOpenAIResponses:
+		return true
+	}
+	return false
+}
+
+func (w *OutputModerationWriter) isStream() bool {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.HasPrefix(w.ResponseWriter.Header().Get("Content-Type"), "text/event-stream")
+	}
+	return w.stream
+}
+
+// passThrough 错误响应与审核结束后的非流式写入不做处理
+func (w *OutputModerationWriter) passThrough() bool {
+	if w.ResponseWriter.Status() != http.StatusOK {
+		return true
+	}
+	return !w.isStream() && w.finished
+}
+
+func (w *OutputModerationWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passThrough() {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.isStream() {
+		return w.body.Write(data)
+	}
+	if w.result.Blocked {
+		// 已阻断，丢弃后续输出，上游仍正常读取完毕以便结算
+		return len(data), nil
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.Index(w.pending, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		block := string(w.pending[:idx])
+		w.pending = w.pending[idx+2:]
+		w.processEvent(block)
+		if w.result.Blocked {
+			w.pending = nil
+			break
+		}
+	}
+	return len(data), nil
+}
+
+func (w *OutputModerationWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *OutputModerationWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passThrough() && !w.isStream() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *OutputModerationWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passThrough() && !w.isStream() {
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Reset 丢弃尚未发出的内容，重试前调用
+func (w *OutputModerationWriter) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decided = false
+	w.pending = nil
+	w.held = nil
+	w.body.Reset()
+	w.tail = nil
+	w.fullText = nil
+	w.finished = false
+	w.result = OutputModerationResult{Action: w.action}
+}
+
+// Finish 审核剩余内容并写出，结算前调用；可重复调用
+func (w *OutputModerationWriter) Finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished || w.ResponseWriter.Status() != http.StatusOK {
+		return
+	}
+	if !w.isStream() {
+		w.finished = true
+		w.finishBody()
+		return
+	}
+	if len(w.pending) > 0 && !w.result.Blocked {
+		block := string(w.pending)
+		w.pending = nil
+		w.processEvent(block)
+	}
+	checkModel := !w.result.Blocked && w.checkModel
+	if checkModel && w.action == operation_setting.OutputModerationActionBlock {
+		checkModel = false
+		if w.checkWithModel() && len(w.held) > 0 {
+			w.block()
+		}
+	}
+	w.finished = true
+	w.queueLength = 0
+	w.release()
+	w.ResponseWriter.Flush()
+	// 不阻断时先写出内容，审核模型只记录结果，客户端无需等待
+	if checkModel {
+		w.checkWithModel()
+	}
+}
+
+// Result 没有命中时返回 nil
+func (w *OutputModerationWriter) Result() *OutputModerationResult {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.result.Words) == 0 && !w.result.ModelFlagged && w.result.ModelError == "" {
+		return nil
+	}
+	result := w.result
+	result.Words = RemoveDuplicate(result.Words)
+	return &result
+}
+
+func (w *OutputModerationWriter) Blocked() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.result.Blocked
+}
+
+func (w *OutputModerationWriter) processEvent(block string) {
+	event := parseOutputEvent(block)
+	if event == nil {
+		return
+	}
+	if event.isJSON() {
+		w.rememberStreamMeta(event.data)
+		deltaPaths, fullPaths := outputTextPaths(w.format, event.data, true)
+		for _, path := range fullPaths {
+			if w.moderateFullText(event, path) {
+				return
+			}
+		}
+		for _, path := range deltaPaths {
+			event.segments = append(event.segments, &outputSegment{path: path, text: []rune(gjson.GetBytes(event.data, path).String())})
+		}
+	}
+	w.held = append(w.held, event)
+	if len(event.segments) > 0 {
+		w.checkWindow(event)
+	}
+	if w.result.Blocked {
+		return
+	}
+	w.release()
+}
+
+// moderateFullText 检查完整文本字段（非增量），返回是否已阻断
+func (w *OutputModerationWriter) moderateFullText(event *outputEvent, path string) bool {
+	text := []rune(gjson.GetBytes(event.data, path).String())
+	if !w.moderateRunes(text) {
+		return false
+	}
+	if w.action == operation_setting.OutputModerationActionBlock {
+		w.block()
+		return true
+	}
+	if w.action == operation_setting.OutputModerationActionMask {
+		if data, err := sjson.SetBytes(event.data, path, string(text)); err == nil {
+			event.data = data
+			event.modified = true
+		}
+	}
+	return false
+}
+
+// moderateRunes 检查并按策略屏蔽一段独立文本，返回是否命中
+func (w *OutputModerationWriter) moderateRunes(text []rune) bool {
+	hits := findSensitiveHits(text, 0)
+	if len(hits) == 0 {
+		return false
+	}
+	for _, hit := range hits {
+		w.recordWord(string(text[hit.start:hit.end]))
+		if w.action == operation_setting.OutputModerationActionMask {
+			maskRunes(text, hit.start, hit.end)
+		}
+	}
+	return true
+}
+
+// checkWindow 在已发出文本的末尾与暂存事件的文本上查找新出现的敏感词，
+// 只处理结束于最新事件内的命中，跨越已发出部分的命中只能屏蔽暂存的部分
+func (w *OutputModerationWriter) checkWindow(latest *outputEvent) {
+	window := append([]rune(nil), w.tail...)
+	type segmentRange struct {
+		segment *outputSegment
+		event   *outputEvent
+		start   int
+	}
+	ranges := make([]segmentRange, 0)
+	for _, event := range w.held {
+		for _, segment := range event.segments {
+			ranges = append(ranges, segmentRange{segment: segment, event: event, start: len(window)})
+			window = append(window, segment.text...)
+		}
+	}
+	latestLength := 0
+	for _, segment := range latest.segments {
+		latestLength += len(segment.text)
+		w.appendFullText(segment.text)
+	}
+	hits := findSensitiveHits(window, len(window)-latestLength)
+	for _, hit := range hits {
+		w.recordWord(string(window[hit.start:hit.end]))
+		if w.action == operation_setting.OutputModerationActionBlock {
+			w.block()
+			return
+		}
+		if w.action != operation_setting.OutputModerationActionMask {
+			continue
+		}
+		for _, r := range ranges {
+			start := max(hit.start, r.start) - r.start
+			end := min(hit.end, r.start+len(r.segment.text)) - r.start
+			if start < end {
+				maskRunes(r.segment.text, start, end)
+				r.event.modified = true
+			}
+		}
+	}
+}
+
+// release 发出超出暂存长度的事件
+func (w *OutputModerationWriter) release() {
+	for len(w.held) > w.queueLength {
+		event := w.held[0]
+		w.held = w.held[1:]
+		for _, segment := range event.segments {
+			w.tail = append(w.tail, segment.text...)
+		}
+		if keep := max(w.maxWordRunes-1, 0); len(w.tail) > keep {
+			w.tail = append([]rune(nil), w.tail[len(w.tail)-keep:]...)
+		}
+		w.writeEvent(event)
+	}
+}
+
+func (w *OutputModerationWriter) writeEvent(event *outputEvent) {
+	_, _ = w.ResponseWriter.WriteString(event.encode())
+}
+
+func (w *OutputModerationWriter) rememberStreamMeta(data []byte) {
+	if w.streamId != "" {
+		return
+	}
+	if id := gjson.GetBytes(data, "id"); id.Exists() {
+		w.streamId = id.String()
+		w.model = gjson.GetBytes(data, "model").String()
+		w.created = gjson.GetBytes(data, "created").Int()
+	}
+}
+
+// block 丢弃暂存的事件，并按请求格式发出终止事件
+func (w *OutputModerationWriter) block() {
+	w.result.Blocked = true
+	w.held = nil
+	logger.LogWarn(w.ctx, fmt.Sprintf("completion blocked by output moderation: %s", strings.Join(RemoveDuplicate(w.result.Words), ", ")))
+	message := "sensitive words detected in completion"
+	switch w.format {
+	case types.RelayFormatClaude:
+		data, _ := common.Marshal(gin.H{
+			"type":  "error",
+			"error": gin.H{"type": "invalid_request_error", "message": message},
+		})
+		_, _ = w.ResponseWriter.WriteString("event: error\ndata: " + string(data) + "\n\n")
+	case types.RelayFormatGemini:
+		data, _ := common.Marshal(gin.H{
+			"candidates": []gin.H{{"index": 0, "finishReason": "SAFETY", "content": gin.H{"role": "model", "parts": []gin.H{}}}},
+		})
+		_, _ = w.ResponseWriter.WriteString("data: " + string(data) + "\n\n")
+	case types.RelayFormatOpenAIResponses:
+		data, _ := common.Marshal(gin.H{
+			"type":    "error",
+			"code":    string(types.ErrorCodeSensitiveWordsDetected),
+			"message": message,
+		})
+		_, _ = w.ResponseWriter.WriteString("event: error\ndata: " + string(data) + "\n\n")
+	default:
+		data, _ := common.Marshal(gin.H{
+			"id":      w.streamId,
+			"object":  "chat.completion.chunk",
+			"created": w.created,
+			"model":   w.model,
+			"choices": []gin.H{{"index": 0, "delta": gin.H{}, "finish_reason": "content_filter"}},
+		})
+		_, _ = w.ResponseWriter.WriteString("data: " + string(data) + "\n\ndata: [DONE]\n\n")
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finishBody 审核缓存的非流式响应后写出
+func (w *OutputModerationWriter) finishBody() {
+	data := w.body.Bytes()
+	checkModel := false
+	if gjson.ValidBytes(data) {
+		_, fullPaths := outputTextPaths(w.format, data, false)
+		for _, path := range fullPaths {
+			text := []rune(gjson.GetBytes(data, path).String())
+			w.appendFullText(text)
+			if !w.moderateRunes(text) {
+				continue
+			}
+			if w.action == operation_setting.OutputModerationActionBlock {
+				w.writeBlockedBody()
+				return
+			}
+			if w.action == operation_setting.OutputModerationActionMask {
+				if updated, err := sjson.SetBytes(data, path, string(text)); err == nil {
+					data = updated
+				}
+			}
+		}
+		checkModel = w.checkModel
+		if checkModel && w.action == operation_setting.OutputModerationActionBlock {
+			checkModel = false
+			if w.checkWithModel() {
+				w.writeBlockedBody()
+				return
+			}
+		}
+	}
+	if w.ResponseWriter.Header().Get("Content-Length") != "" {
+		w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	}
+	_, _ = w.ResponseWriter.Write(data)
+	if checkModel {
+		w.ResponseWriter.Flush()
+		w.checkWithModel()
+	}
+}
+
+func (w *OutputModerationWriter) writeBlockedBody() {
+	w.result.Blocked = true
+	logger.LogWarn(w.ctx, fmt.Sprintf("completion blocked by output moderation: %s", strings.Join(RemoveDuplicate(w.result.Words), ", ")))
+	apiErr := types.NewErrorWithStatusCode(errors.New("sensitive words detected in completion"), types.ErrorCodeSensitiveWordsDetected, http.StatusBadRequest)
+	var body any = gin.H{"error": apiErr.ToOpenAIError()}
+	if w.format == types.RelayFormatClaude {
+		body = gin.H{"type": "error", "error": apiErr.ToClaudeError()}
+	}
+	data, _ := common.Marshal(body)
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json")
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.ResponseWriter.WriteHeader(http.StatusBadRequest)
+	_, _ = w.ResponseWriter.Write(data)
+}
+
+// checkWithModel 调用审核模型检查完整输出，返回是否命中
+func (w *OutputModerationWriter) checkWithModel() bool {
+	if len(w.fullText) == 0 {
+		return false
+	}
+	flagged, categories, err := ModerateTextWithModel(w.ctx.Request.Context(), string(w.fullText))
+	if err != nil {
+		w.result.ModelError = err.Error()
+		logger.LogError(w.ctx, "output moderation model failed: "+err.Error())
+		return false
+	}
+	if flagged {
+		w.result.ModelFlagged = true
+		w.result.Categories = categories
+	}
+	return flagged
+}
+
+func (w *OutputModerationWriter) appendFullText(text []rune) {
+	if !w.checkModel || len(w.fullText) >= moderationModelMaxRunes {
+		return
+	}
+	w.fullText = append(w.fullText, text[:min(len(text), moderationModelMaxRunes-len(w.fullText))]...)
+}
+
+func (w *OutputModerationWriter) recordWord(word string) {
+	if len(w.result.Words) == 0 && w.action != operation_setting.OutputModerationActionBlock {
+		logger.LogWarn(w.ctx, fmt.Sprintf("completion sensitive words detected: %s", word))
+	}
+	w.result.Words = append(w.result.Words, strings.ToLower(word))
+}
+
+type sensitiveHit struct {
+	start int
+	end   int
+}
+
+// findSensitiveHits 查找结束位置在 from 之后的敏感词，位置按 rune 计算
+func findSensitiveHits(text []rune, from int) []sensitiveHit {
+	if len(text) == 0 || len(setting.SensitiveWords) == 0 {
+		return nil
+	}
+	m := getOrBuildAC(setting.SensitiveWords)
+	if m == nil {
+		return nil
+	}
+	lower := make([]rune, len(text))
+	for i, r := range text {
+		lower[i] = unicode.ToLower(r)
+	}
+	hits := make([]sensitiveHit, 0)
+	for _, term := range m.MultiPatternSearch(lower, false) {
+		end := term.Pos + len(term.Word)
+		if end > from {
+			hits = append(hits, sensitiveHit{start: term.Pos, end: end})
+		}
+	}
+	return hits
+}
+
+func maskRunes(text []rune, start, end int) {
+	for i := start; i < end; i++ {
+		text[i] = '*'
+	}
+}
+
+// outputTextPaths 返回响应 JSON 中模型输出文本的路径：delta 为流式增量文本，full 为完整文本
+func outputTextPaths(format types.RelayFormat, data []byte, stream bool) (delta []string, full []string) {
+	switch format {
+	case types.RelayFormatClaude:
+		if stream {
+			if gjson.GetBytes(data, "type").String() == "content_block_delta" && gjson.GetBytes(data, "delta.type").String() == "text_delta" {
+				delta = append(delta, "delta.text")
+			}
+			return delta, nil
+		}
+		gjson.GetBytes(data, "content").ForEach(func(key, value gjson.Result) bool {
+			if value.Get("type").String() == "text" {
+				full = append(full, "content."+key.String()+".text")
+			}
+			return true
+		})
+		return nil, full
+	case types.RelayFormatGemini:
+		var paths []string
+		gjson.GetBytes(data, "candidates").ForEach(func(i, candidate gjson.Result) bool {
+			candidate.Get("content.parts").ForEach(func(j, part gjson.Result) bool {
+				if part.Get("text").Type == gjson.String {
+					paths = append(paths, fmt.Sprintf("candidates.%d.content.parts.%d.text", i.Int(), j.Int()))
+				}
+				return true
+			})
+			return true
+		})
+		if stream {
+			return paths, nil
+		}
+		return nil, paths
+	case types.RelayFormatOpenAIResponses:
+		if !stream {
+			return nil, responsesOutputTextPaths(data, "")
+		}
+		switch gjson.GetBytes(data, "type").String() {
+		case "response.output_text.delta":
+			delta = append(delta, "delta")
+		case "response.output_text.done":
+			full = append(full, "text")
+		case "response.content_part.added", "response.content_part.done":
+			if gjson.GetBytes(data, "part.text").Type == gjson.String {
+				full = append(full, "part.text")
+			}
+		case "response.output_item.added", "response.output_item.done":
+			gjson.GetBytes(data, "item.content").ForEach(func(k, part gjson.Result) bool {
+				if part.Get("text").Type == gjson.String {
+					full = append(full, "item.content."+k.String()+".text")
+				}
+				return true
+			})
+		default:
+			if gjson.GetBytes(data, "response.output").IsArray() {
+				full = responsesOutputTextPaths(data, "response.")
+			}
+		}
+		return delta, full
+	default:
+		var paths []string
+		gjson.GetBytes(data, "choices").ForEach(func(i, choice gjson.Result) bool {
+			prefix := "choices." + i.String() + "."
+			if stream && choice.Get("delta.content").Type == gjson.String {
+				paths = append(paths, prefix+"delta.content")
+			}
+			if !stream && choice.Get("message.content").Type == gjson.String {
+				paths = append(paths, prefix+"message.content")
+			}
+			if choice.Get("text").Type == gjson.String {
+				paths = append(paths, prefix+"text")
+			}
+			return true
+		})
+		if stream {
+			return paths, nil
+		}
+		return nil, paths
+	}
+}
+
+func responsesOutputTextPaths(data []byte, prefix string) []string {
+	var paths []string
+	gjson.GetBytes(data, prefix+"output").ForEach(func(i, item gjson.Result) bool {
+		item.Get("content").ForEach(func(k, part gjson.Result) bool {
+			if part.Get("text").Type == gjson.String {
+				paths = append(paths, fmt.Sprintf("%soutput.%d.content.%d.text", prefix, i.Int(), k.Int()))
+			}
+			return true
+		})
+		return true
+	})
+	return paths
+}
+
+// FinishOutputModeration 结算前写出审核暂存的内容，使审核结果能记录到消费日志
+func FinishOutputModeration(c *gin.Context) {
+	if w, ok := common.GetContextKeyType[*OutputModerationWriter](c, constant.ContextKeyOutputModeration); ok {
+		w.Finish()
+	}
+}
+
+// blockedCompletionUsage 输出被阻断时客户端没有收到补全内容，只按输入计费
+func blockedCompletionUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	blocked := *usage
+	blocked.CompletionTokens = 0
+	blocked.OutputTokens = 0
+	blocked.CompletionTokenDetails = dto.OutputTokenDetails{}
+	blocked.OutputTokensDetails = nil
+	blocked.TotalTokens = blocked.PromptTokens
+	return &blocked
+}
+
+// OutputModerationBlocked 输出是否被审核阻断
+func OutputModerationBlocked(c *gin.Context) bool {
+	w, ok := common.GetContextKeyType[*OutputModerationWriter](c, constant.ContextKeyOutputModeration)
+	return ok && w.Blocked()
+}
+
+func appendOutputModerationInfo(ctx *gin.Context, other map[string]interface{}) {
+	if ctx == nil || other == nil {
+		return
+	}
+	w, ok := common.GetContextKeyType[*OutputModerationWriter](ctx, constant.ContextKeyOutputModeration)
+	if !ok {
+		return
+	}
+	if result := w.Result(); result != nil {
+		other["output_moderation"] = result
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+type moderationModelResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderationChannelAttempts 选择审核渠道时跳过不兼容渠道的最多尝试次数
+const moderationChannelAttempts = 5
+
+// ChannelSupportsModeration 渠道是否为 OpenAI 兼容、可直接调用 /v1/moderations 的类型；
+// Azure 与自定义渠道的地址和鉴权方式不同，不在此列
+func ChannelSupportsModeration(channelType int) bool {
+	switch channelType {
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeOpenAIMax, constant.ChannelTypeOhMyGPT,
+		constant.ChannelTypeAILS, constant.ChannelTypeAIProxy, constant.ChannelTypeAPI2GPT, constant.ChannelTypeAIGC2D:
+		return true
+	default:
+		return false
+	}
+}
+
+func getModerationChannel(group string, modelName string) (*model.Channel, error) {
+	for retry := 0; retry < moderationChannelAttempts; retry++ {
+		channel, err := model.GetRandomSatisfiedChannel(group, modelName, retry)
+		if err != nil {
+			return nil, err
+		}
+		if channel == nil {
+			break
+		}
+		if ChannelSupportsModeration(channel.Type) {
+			return channel, nil
+		}
+	}
+	return nil, fmt.Errorf("no openai compatible channel for moderation model %s", modelName)
+}
+
+// ModerateTextWithModel 通过本站渠道调用审核模型（OpenAI /v1/moderations 格式），返回是否命中及命中的类别
+func ModerateTextWithModel(ctx context.Context, text string) (bool, []string, error) {
+	moderationSetting := operation_setting.GetOutputModerationSetting()
+	modelName := moderationSetting.ModerationModel
+	channel, err := getModerationChannel(moderationSetting.ModerationGroup, modelName)
+	if err != nil {
+		return false, nil, err
+	}
+	// GetNextEnabledKey 只按状态选择密钥，不占用熔断器的探测名额；审核调用的结果也不计入熔断统计
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return false, nil, apiErr
+	}
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return false, nil, err
+	}
+	payload, err := common.Marshal(map[string]string{"model": modelName, "input": text})
+	if err != nil {
+		return false, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(operation_setting.GetOutputModerationTimeoutSeconds())*time.Second)
+	defer cancel()
+	url := strings.TrimSuffix(channel.GetBaseURL(), "/") + "/v1/moderations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return false, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return false, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, nil, fmt.Errorf("moderation model returned status %d: %s", resp.StatusCode, string(body))
+	}
+	var result moderationModelResponse
+	if err := common.Unmarshal(body, &result); err != nil {
+		return false, nil, err
+	}
+	flagged := false
+	categories := make([]string, 0)
+	for _, item := range result.Results {
+		if !item.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range item.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	categories = RemoveDuplicate(categories)
+	sort.Strings(categories)
+	return flagged, categories, nil
+}
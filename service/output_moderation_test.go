@@ -0,0 +1,198 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupOutputModerationForTest(t *testing.T, action string, queueLength int) {
+	savedWords, savedQueue := setting.SensitiveWords, setting.StreamCacheQueueLength
+	savedEnabled, savedCompletion := setting.CheckSensitiveEnabled, setting.CheckSensitiveOnCompletionEnabled
+	moderationSetting := operation_setting.GetOutputModerationSetting()
+	saved := *moderationSetting
+	t.Cleanup(func() {
+		setting.SensitiveWords, setting.StreamCacheQueueLength = savedWords, savedQueue
+		setting.CheckSensitiveEnabled, setting.CheckSensitiveOnCompletionEnabled = savedEnabled, savedCompletion
+		*moderationSetting = saved
+	})
+	setting.SensitiveWords = []string{"badword"}
+	setting.StreamCacheQueueLength = queueLength
+	setting.CheckSensitiveEnabled = true
+	setting.CheckSensitiveOnCompletionEnabled = true
+	moderationSetting.DefaultAction = action
+	moderationSetting.ModerationModel = ""
+}
+
+func newOutputModerationWriterForTest(t *testing.T, format types.RelayFormat, stream bool) (*OutputModerationWriter, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if stream {
+		ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		ctx.Writer.Header().Set("Content-Type", "application/json")
+	}
+	info := &relaycommon.RelayInfo{
+		RelayFormat: format,
+		RelayMode:   relayconstant.RelayModeChatCompletions,
+		UsingGroup:  "default",
+	}
+	w := NewOutputModerationWriter(ctx, info)
+	require.NotNil(t, w)
+	return w, recorder
+}
+
+func TestOutputModerationMasksWordAcrossStreamEvents(t *testing.T) {
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionMask, 2)
+	w, recorder := newOutputModerationWriterForTest(t, types.RelayFormatOpenAI, true)
+
+	_, _ = w.Write([]byte(`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"this is bad"}}]}` + "\n\n"))
+	_, _ = w.Write([]byte(`data: {"id":"c1","choices":[{"index":0,"delta":{"content":"WORD ok"}}]}` + "\n\n"))
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	w.Finish()
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `"content":"this is ***"`)
+	assert.Contains(t, body, `"content":"**** ok"`)
+	assert.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+	result := w.Result()
+	require.NotNil(t, result)
+	assert.Equal(t, []string{"badword"}, result.Words)
+	assert.False(t, result.Blocked)
+}
+
+func TestOutputModerationBlocksClaudeStream(t *testing.T) {
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionBlock, 0)
+	w, recorder := newOutputModerationWriterForTest(t, types.RelayFormatClaude, true)
+
+	_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"hello\"}}\n\n\n"))
+	_, _ = w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\" badword\"}}\n\n\n"))
+	_, _ = w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n\n"))
+	w.Finish()
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `"text":"hello"`)
+	assert.NotContains(t, body, "badword")
+	assert.NotContains(t, body, "message_stop")
+	assert.Contains(t, body, "event: error")
+	assert.True(t, w.Blocked())
+}
+
+func TestOutputModerationNonStream(t *testing.T) {
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionMask, 0)
+	w, recorder := newOutputModerationWriterForTest(t, types.RelayFormatOpenAI, false)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"a BadWord here"}}]}`))
+	assert.Empty(t, recorder.Body.String())
+	w.Finish()
+	assert.Contains(t, recorder.Body.String(), `"content":"a ******* here"`)
+
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionBlock, 0)
+	w, recorder = newOutputModerationWriterForTest(t, types.RelayFormatOpenAI, false)
+	_, _ = w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"badword"}}]}`))
+	w.Finish()
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), string(types.ErrorCodeSensitiveWordsDetected))
+}
+
+func TestOutputModerationFlagOnly(t *testing.T) {
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionFlag, 5)
+	w, recorder := newOutputModerationWriterForTest(t, types.RelayFormatGemini, true)
+
+	event := `data: {"candidates":[{"content":{"parts":[{"text":"badword"}]}}]}` + "\n\n"
+	_, _ = w.Write([]byte(event))
+	// flag 模式不暂存事件
+	assert.Equal(t, event, recorder.Body.String())
+	w.Finish()
+	require.NotNil(t, w.Result())
+	assert.Equal(t, operation_setting.OutputModerationActionFlag, w.Result().Action)
+}
+
+func TestChannelSupportsModeration(t *testing.T) {
+	assert.True(t, ChannelSupportsModeration(constant.ChannelTypeOpenAI))
+	assert.False(t, ChannelSupportsModeration(constant.ChannelTypeAzure))
+	assert.False(t, ChannelSupportsModeration(constant.ChannelTypeCustom))
+	assert.False(t, ChannelSupportsModeration(constant.ChannelTypeAnthropic))
+}
+
+func TestBlockedCompletionUsage(t *testing.T) {
+	usage := &dto.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}
+	usage.CompletionTokenDetails.ReasoningTokens = 20
+	blocked := blockedCompletionUsage(usage)
+	assert.Equal(t, 100, blocked.PromptTokens)
+	assert.Equal(t, 0, blocked.CompletionTokens)
+	assert.Equal(t, 0, blocked.CompletionTokenDetails.ReasoningTokens)
+	assert.Equal(t, 100, blocked.TotalTokens)
+	// 不修改上游返回的原始用量
+	assert.Equal(t, 50, usage.CompletionTokens)
+	assert.Nil(t, blockedCompletionUsage(nil))
+}
+
+func TestPostAudioConsumeQuotaFinishesModerationBeforeRehydration(t *testing.T) {
+	truncate(t)
+	seedUser(t, 1, 100000)
+	seedToken(t, 1, 1, "sk-audio", 100000)
+	seedChannel(t, 1)
+	setupOutputModerationForTest(t, operation_setting.OutputModerationActionMask, 0)
+	piiSetting := operation_setting.GetPIIRedactionSetting()
+	savedPII := *piiSetting
+	t.Cleanup(func() { *piiSetting = savedPII })
+	piiSetting.Enabled = true
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	ctx.Writer.Header().Set("Content-Type", "application/json")
+	info := &relaycommon.RelayInfo{
+		RelayFormat: types.RelayFormatOpenAI,
+		RelayMode:   relayconstant.RelayModeChatCompletions,
+		UsingGroup:  "default",
+		UserId:      1,
+		TokenId:     1,
+		TokenKey:    "sk-audio",
+		PIIRedactor: relaycommon.NewPIIRedactor("default", true),
+		StartTime:   time.Now(),
+		ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 1},
+		PriceData:   types.PriceData{ModelRatio: 1, GroupRatioInfo: types.GroupRatioInfo{GroupRatio: 1}},
+	}
+	info.OriginModelName = "gpt-4o-audio-preview"
+	require.Equal(t, "[PII_EMAIL_1]", info.PIIRedactor.RedactText("alice@example.com"))
+
+	// 与中继入口相同的包装顺序：审核写入器在外层，还原写入器在内层
+	rehydrateWriter := NewPIIRehydrateWriter(ctx, info)
+	require.NotNil(t, rehydrateWriter)
+	ctx.Writer = rehydrateWriter
+	moderationWriter := NewOutputModerationWriter(ctx, info)
+	require.NotNil(t, moderationWriter)
+	ctx.Writer = moderationWriter
+
+	ctx.Writer.WriteHeader(http.StatusOK)
+	_, _ = ctx.Writer.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"mail [PII_EMAIL_1] badword"}}]}`))
+	usage := &dto.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}
+	usage.PromptTokensDetails.TextTokens = 10
+	usage.CompletionTokenDetails.TextTokens = 5
+	PostAudioConsumeQuota(ctx, info, usage, "")
+
+	assert.Equal(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":"mail alice@example.com *******"}}]}`, recorder.Body.String())
+	assert.Equal(t, 1, info.PIIRedactor.Restored())
+
+	var log model.Log
+	require.NoError(t, model.LOG_DB.Where("user_id = ? AND type = ?", 1, model.LogTypeConsume).First(&log).Error)
+	assert.Contains(t, log.Other, "output_moderation")
+	assert.Contains(t, log.Other, "pii_redaction")
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// PIIRehydrateWriter 把上游响应中的脱敏占位符还原为原值后再写给客户端。
+// 非流式响应在结算前整体缓存后替换；流式响应逐个 SSE 事件替换，增量文本末尾被截断的占位符留到下一段再还原
+type PIIRehydrateWriter struct {
+	gin.ResponseWriter
+	redactor *relaycommon.PIIRedactor
+	format   types.RelayFormat
+
+	mu        sync.Mutex
+	decided   bool
+	stream    bool
+	pending   []byte
+	body      bytes.Buffer
+	carry     map[string]string
+	lastDelta *outputEvent
+	finished  bool
+}
+
+// NewPIIRehydrateWriter 请求开启个人信息脱敏且接口产生文本输出时返回还原响应的写入器，否则返回 nil
+func NewPIIRehydrateWriter(c *gin.Context, info *relaycommon.RelayInfo) *PIIRehydrateWriter {
+	if info.PIIRedactor == nil || !isTextOutputRelay(c, info) {
+		return nil
+	}
+	w := &PIIRehydrateWriter{
+		ResponseWriter: c.Writer,
+		redactor:       info.PIIRedactor,
+		format:         info.RelayFormat,
+		carry:          make(map[string]string),
+	}
+	common.SetContextKey(c, constant.ContextKeyPIIRehydrate, w)
+	return w
+}
+
+func (w *PIIRehydrateWriter) isStream() bool {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.HasPrefix(w.ResponseWriter.Header().Get("Content-Type"), "text/event-stream")
+	}
+	return w.stream
+}
+
+func (w *PIIRehydrateWriter) passThrough() bool {
+	if w.ResponseWriter.Status() != http.StatusOK {
+		return true
+	}
+	return !w.isStream() && w.finished
+}
+
+func (w *PIIRehydrateWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.passThrough() {
+		return w.ResponseWriter.Write(data)
+	}
+	if !w.isStream() {
+		return w.body.Write(data)
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.Index(w.pending, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		block := string(w.pending[:idx])
+		w.pending = w.pending[idx+2:]
+		w.processEvent(block)
+	}
+	return len(data), nil
+}
+
+func (w *PIIRehydrateWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *PIIRehydrateWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passThrough() && !w.isStream() {
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *PIIRehydrateWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.passThrough() && !w.isStream() {
+		return
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Reset 丢弃尚未发出的内容，重试前调用
+func (w *PIIRehydrateWriter) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.decided = false
+	w.pending = nil
+	w.body.Reset()
+	w.carry = make(map[string]string)
+	w.lastDelta = nil
+	w.finished = false
+}
+
+// Finish 还原并写出剩余内容，结算前调用；可重复调用
+func (w *PIIRehydrateWriter) Finish() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.finished || w.ResponseWriter.Status() != http.StatusOK {
+		return
+	}
+	w.finished = true
+	if !w.isStream() {
+		data := []byte(w.redactor.Restore(w.body.String(), true))
+		if w.ResponseWriter.Header().Get("Content-Length") != "" {
+			w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		}
+		_, _ = w.ResponseWriter.Write(data)
+		return
+	}
+	if len(w.pending) > 0 {
+		block := string(w.pending)
+		w.pending = nil
+		w.processEvent(block)
+	}
+	w.flushCarry()
+	w.ResponseWriter.Flush()
+}
+
+func (w *PIIRehydrateWriter) processEvent(block string) {
+	event := parseOutputEvent(block)
+	if event == nil {
+		return
+	}
+	var deltaPaths []string
+	if event.isJSON() {
+		deltaPaths, _ = outputTextPaths(w.format, event.data, true)
+	}
+	if len(deltaPaths) == 0 {
+		// 文本结束后补发被截断的内容
+		w.flushCarry()
+	}
+	for _, path := range deltaPaths {
+		text := w.carry[path] + gjson.GetBytes(event.data, path).String()
+		delete(w.carry, path)
+		if idx := relaycommon.PartialPlaceholderIndex(text); idx >= 0 {
+			w.carry[path] = text[idx:]
+			text = text[:idx]
+		}
+		event.segments = append(event.segments, &outputSegment{path: path, text: []rune(w.redactor.Restore(text, false))})
+		event.modified = true
+	}
+	if len(deltaPaths) > 0 {
+		w.lastDelta = &outputEvent{lines: append([]string(nil), event.lines...), dataLine: event.dataLine, data: event.data}
+	}
+	// 其余字段（完整文本、工具调用参数等）中的占位符直接替换
+	_, _ = w.ResponseWriter.WriteString(w.redactor.Restore(event.encode(), true))
+}
+
+// flushCarry 以最近的增量事件为模板发出被截断而未还原的文本
+func (w *PIIRehydrateWriter) flushCarry() {
+	if len(w.carry) == 0 || w.lastDelta == nil {
+		w.carry = make(map[string]string)
+		return
+	}
+	for path, text := range w.carry {
+		data, err := sjson.SetBytes(w.lastDelta.data, path, text)
+		if err != nil {
+			continue
+		}
+		for _, usagePath := range []string{"usage", "usageMetadata"} {
+			data, _ = sjson.DeleteBytes(data, usagePath)
+		}
+		lines := append([]string(nil), w.lastDelta.lines...)
+		lines[w.lastDelta.dataLine] = "data: " + string(data)
+		_, _ = w.ResponseWriter.WriteString(strings.Join(lines, "\n") + "\n\n")
+	}
+	w.carry = make(map[string]string)
+}
+
+// FinishPIIRehydration 结算前写出尚未还原的内容
+func FinishPIIRehydration(c *gin.Context) {
+	if w, ok := common.GetContextKeyType[*PIIRehydrateWriter](c, constant.ContextKeyPIIRehydrate); ok {
+		w.Finish()
+	}
+}
+
+// appendPIIRedactionInfo 只记录各类型的脱敏次数与还原次数，不记录原值
+func appendPIIRedactionInfo(relayInfo *relaycommon.RelayInfo, other map[string]interface{}) {
+	if relayInfo == nil || other == nil || relayInfo.PIIRedactor == nil {
+		return
+	}
+	counts := relayInfo.PIIRedactor.Counts()
+	restored := relayInfo.PIIRedactor.Restored()
+	if len(counts) == 0 && restored == 0 {
+		return
+	}
+	other["pii_redaction"] = map[string]interface{}{
+		"redacted": counts,
+		"restored": restored,
+	}
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPIIRehydrateWriterForTest(t *testing.T, stream bool) (*PIIRehydrateWriter, *relaycommon.RelayInfo, *httptest.ResponseRecorder) {
+	piiSetting := operation_setting.GetPIIRedactionSetting()
+	saved := *piiSetting
+	t.Cleanup(func() { *piiSetting = saved })
+	piiSetting.Enabled = true
+
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	if stream {
+		ctx.Writer.Header().Set("Content-Type", "text/event-stream")
+	}
+	info := &relaycommon.RelayInfo{
+		RelayFormat: types.RelayFormatOpenAI,
+		RelayMode:   relayconstant.RelayModeChatCompletions,
+		UsingGroup:  "default",
+		PIIRedactor: relaycommon.NewPIIRedactor("default", true),
+	}
+	w := NewPIIRehydrateWriter(ctx, info)
+	require.NotNil(t, w)
+	require.Equal(t, "[PII_EMAIL_1]", info.PIIRedactor.RedactText("alice@example.com"))
+	return w, info, recorder
+}
+
+func TestPIIRehydrateStreamPlaceholderAcrossChunks(t *testing.T) {
+	w, info, recorder := newPIIRehydrateWriterForTest(t, true)
+
+	_, _ = w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"mail [PII_EM"}}]}` + "\n\n"))
+	_, _ = w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":"AIL_1] now"}}]}` + "\n\n"))
+	_, _ = w.Write([]byte(`data: {"choices":[{"index":0,"delta":{"content":" or [PII_"}}]}` + "\n\n"))
+	_, _ = w.Write([]byte(`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+	_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	w.Finish()
+
+	body := recorder.Body.String()
+	assert.Contains(t, body, `"content":"mail "`)
+	assert.Contains(t, body, `"content":"alice@example.com now"`)
+	assert.Contains(t, body, `"content":" or "`)
+	// 未能还原的截断内容在结束事件之前原样补发
+	assert.Contains(t, body, `"content":"[PII_"}}]}`+"\n\n"+`data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`)
+	assert.NotContains(t, body, "PII_EMAIL")
+	assert.Equal(t, 1, info.PIIRedactor.Restored())
+}
+
+func TestPIIRehydrateNonStream(t *testing.T) {
+	w, _, recorder := newPIIRehydrateWriterForTest(t, false)
+	w.Header().Set("Content-Length", "10")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"hi [PII_EMAIL_1]",`))
+	_, _ = w.Write([]byte(`"tool_calls":[{"function":{"arguments":"{\"to\":\"[PII_EMAIL_1]\"}"}}]}}]}`))
+	w.Finish()
+
+	body := recorder.Body.String()
+	assert.Equal(t, `{"choices":[{"message":{"content":"hi alice@example.com","tool_calls":[{"function":{"arguments":"{\"to\":\"alice@example.com\"}"}}]}}]}`, body)
+	assert.Equal(t, len(body), int(recorder.Result().ContentLength))
+}
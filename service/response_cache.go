@@ -0,0 +1,249 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const responseCacheNamespace = "new-api:response_cache:v1"
+
+var (
+	responseCacheMu       sync.Mutex
+	responseCache         *cachex.HybridCache[ResponseCacheEntry]
+	responseCacheMemory   *hot.HotCache[string, ResponseCacheEntry]
+	responseCacheCapacity int
+	responseCacheTTLValue time.Duration
+)
+
+// ResponseCacheEntry 缓存的下游响应，流式响应保存完整的 SSE 文本
+type ResponseCacheEntry struct {
+	Stream      bool      `json:"stream"`
+	ContentType string    `json:"content_type"`
+	Body        string    `json:"body"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+func responseCacheTTL() time.Duration {
+	ttlSeconds := operation_setting.GetResponseCacheSetting().TTLSeconds
+	if ttlSeconds <= 0 {
+		ttlSeconds = 3600
+	}
+	return time.Duration(ttlSeconds) * time.Second
+}
+
+func responseCacheMaxEntries() int {
+	capacity := operation_setting.GetResponseCacheSetting().MaxEntries
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return capacity
+}
+
+// getResponseCache 容量或有效期设置变化时重建内存缓存，Redis 中的条目不受影响
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	capacity := responseCacheMaxEntries()
+	ttl := responseCacheTTL()
+	responseCacheMu.Lock()
+	defer responseCacheMu.Unlock()
+	if responseCache != nil && responseCacheCapacity == capacity && responseCacheTTLValue == ttl {
+		return responseCache
+	}
+	if responseCacheMemory != nil {
+		responseCacheMemory.StopJanitor()
+	}
+	memory := hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, capacity).
+		WithTTL(ttl).
+		WithJanitor().
+		Build()
+	responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+		Namespace: cachex.Namespace(responseCacheNamespace),
+		Redis:     common.RDB,
+		RedisEnabled: func() bool {
+			return common.RedisEnabled && common.RDB != nil
+		},
+		RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+		Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+			return memory
+		},
+	})
+	responseCacheMemory = memory
+	responseCacheCapacity = capacity
+	responseCacheTTLValue = ttl
+	return responseCache
+}
+
+// responseCacheEnabledFor 令牌开启缓存或模型在全局缓存列表中
+func responseCacheEnabledFor(c *gin.Context, modelName string) bool {
+	if !operation_setting.GetResponseCacheSetting().Enabled {
+		return false
+	}
+	return common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) || operation_setting.IsResponseCacheModel(modelName)
+}
+
+// ResponseCacheKey 返回请求的缓存键：仅对话补全与嵌入请求参与，键由分组、模型与规范化后的请求体计算
+func ResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) (string, bool) {
+	if !responseCacheEnabledFor(c, info.OriginModelName) {
+		return "", false
+	}
+	switch info.RelayMode {
+	case relayconstant.RelayModeChatCompletions:
+		textRequest, ok := request.(*dto.GeneralOpenAIRequest)
+		if !ok {
+			return "", false
+		}
+		if operation_setting.GetResponseCacheSetting().RequireZeroTemperature &&
+			(textRequest.Temperature == nil || *textRequest.Temperature != 0) {
+			return "", false
+		}
+	case relayconstant.RelayModeEmbeddings:
+	default:
+		return "", false
+	}
+
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return "", false
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return "", false
+	}
+	normalized, err := normalizeResponseCacheBody(body)
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%d\n%s\n%s\n", info.RelayMode, info.UsingGroup, info.OriginModelName)
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// normalizeResponseCacheBody 重新序列化请求体，消除字段顺序与空白差异
+func normalizeResponseCacheBody(body []byte) ([]byte, error) {
+	var payload any
+	if err := common.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return common.Marshal(payload)
+}
+
+func GetCachedResponse(key string) (*ResponseCacheEntry, bool) {
+	entry, found, err := getResponseCache().Get(key)
+	if err != nil {
+		common.SysError("failed to get response cache: " + err.Error())
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// recordResponseCacheUsage 可缓存请求结算时记录用量，随响应一起写入缓存
+func recordResponseCacheUsage(ctx *gin.Context, usage *dto.Usage) {
+	if usage == nil || common.GetContextKeyString(ctx, constant.ContextKeyResponseCacheKey) == "" {
+		return
+	}
+	common.SetContextKey(ctx, constant.ContextKeyResponseUsage, *usage)
+}
+
+// SaveCachedResponse 请求成功后保存捕获的响应，响应过大、非 200 或缺少用量时不缓存
+func SaveCachedResponse(c *gin.Context, info *relaycommon.RelayInfo, writer *ResponseCaptureWriter) {
+	key := common.GetContextKeyString(c, constant.ContextKeyResponseCacheKey)
+	if key == "" || writer == nil || writer.Overflow() || writer.Status() != http.StatusOK || OutputModerationBlocked(c) {
+		return
+	}
+	usage, ok := common.GetContextKeyType[dto.Usage](c, constant.ContextKeyResponseUsage)
+	if !ok || usage.TotalTokens == 0 {
+		return
+	}
+	entry := ResponseCacheEntry{
+		Stream:      info.IsStream,
+		ContentType: writer.Header().Get("Content-Type"),
+		Body:        writer.Body(),
+		Usage:       usage,
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if err := getResponseCache().SetWithTTL(key, entry, responseCacheTTL()); err != nil {
+		logger.LogError(c, "failed to save response cache: "+err.Error())
+	}
+}
+
+// ResponseCaptureWriter 在写入客户端的同时保留响应内容，超过上限后停止保留
+type ResponseCaptureWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func NewResponseCaptureWriter(w gin.ResponseWriter) *ResponseCaptureWriter {
+	limit := operation_setting.GetResponseCacheSetting().MaxResponseBytes
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	return &ResponseCaptureWriter{ResponseWriter: w, limit: limit}
+}
+
+func (w *ResponseCaptureWriter) capture(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(data)
+}
+
+func (w *ResponseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Reset 丢弃已保留的内容，重试前调用
+func (w *ResponseCaptureWriter) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Reset()
+	w.overflow = false
+}
+
+func (w *ResponseCaptureWriter) Overflow() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.overflow
+}
+
+func (w *ResponseCaptureWriter) Body() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
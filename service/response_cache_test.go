@@ -0,0 +1,108 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func buildResponseCacheContextForTest(body string, tokenCache bool) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	common.SetContextKey(ctx, constant.ContextKeyTokenResponseCache, tokenCache)
+	return ctx
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	setting := operation_setting.GetResponseCacheSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.Models = []string{}
+	setting.RequireZeroTemperature = true
+
+	zero := 0.0
+	request := &dto.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &zero}
+	info := &relaycommon.RelayInfo{
+		RelayMode:       relayconstant.RelayModeChatCompletions,
+		UsingGroup:      "default",
+		OriginModelName: "gpt-4o",
+	}
+
+	key1, ok := ResponseCacheKey(buildResponseCacheContextForTest(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, true), info, request)
+	require.True(t, ok)
+	key2, ok := ResponseCacheKey(buildResponseCacheContextForTest(`{ "messages":[{"content":"hi","role":"user"}], "temperature":0, "model":"gpt-4o" }`, true), info, request)
+	require.True(t, ok)
+	require.Equal(t, key1, key2)
+
+	otherGroup := *info
+	otherGroup.UsingGroup = "vip"
+	key3, ok := ResponseCacheKey(buildResponseCacheContextForTest(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`, true), &otherGroup, request)
+	require.True(t, ok)
+	require.NotEqual(t, key1, key3)
+
+	// 令牌与模型均未开启
+	_, ok = ResponseCacheKey(buildResponseCacheContextForTest(`{"model":"gpt-4o"}`, false), info, request)
+	require.False(t, ok)
+	setting.Models = []string{"gpt-4*"}
+	_, ok = ResponseCacheKey(buildResponseCacheContextForTest(`{"model":"gpt-4o"}`, false), info, request)
+	require.True(t, ok)
+
+	// 非确定性请求不缓存
+	temperature := 0.7
+	_, ok = ResponseCacheKey(buildResponseCacheContextForTest(`{"model":"gpt-4o"}`, true), info, &dto.GeneralOpenAIRequest{Model: "gpt-4o", Temperature: &temperature})
+	require.False(t, ok)
+}
+
+func TestResponseCaptureWriterLimit(t *testing.T) {
+	setting := operation_setting.GetResponseCacheSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.MaxResponseBytes = 8
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	writer := NewResponseCaptureWriter(ctx.Writer)
+	_, _ = writer.WriteString("hello")
+	require.Equal(t, "hello", writer.Body())
+	require.False(t, writer.Overflow())
+
+	_, _ = writer.WriteString("world")
+	require.True(t, writer.Overflow())
+	require.Empty(t, writer.Body())
+
+	writer.Reset()
+	_, _ = writer.Write([]byte("ok"))
+	require.Equal(t, "ok", writer.Body())
+}
+
+func TestResponseCacheRebuildsOnSettingChange(t *testing.T) {
+	setting := operation_setting.GetResponseCacheSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.MaxEntries = 10
+	setting.TTLSeconds = 60
+
+	cache := getResponseCache()
+	require.Same(t, cache, getResponseCache())
+	require.Equal(t, 10, responseCacheCapacity)
+
+	setting.MaxEntries = 20
+	rebuilt := getResponseCache()
+	require.NotSame(t, cache, rebuilt)
+	require.Equal(t, 20, responseCacheCapacity)
+
+	setting.TTLSeconds = 120
+	require.NotSame(t, rebuilt, getResponseCache())
+	require.Equal(t, 120*time.Second, responseCacheTTLValue)
+}
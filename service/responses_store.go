@@ -0,0 +1,328 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const (
+	responsesStoreCleanupInterval  = time.Hour
+	responsesStoreCleanupBatchSize = 1000
+)
+
+var (
+	responsesStoreCleanupOnce    sync.Once
+	responsesStoreCleanupRunning atomic.Bool
+)
+
+// ResponsesStoreEnabled 是否需要在网关保存本次响应，客户端传 store=false 时不保存
+func ResponsesStoreEnabled(request *dto.OpenAIResponsesRequest) bool {
+	if !operation_setting.GetResponsesStoreSetting().Enabled || request == nil {
+		return false
+	}
+	return strings.TrimSpace(string(request.Store)) != "false"
+}
+
+// NormalizeResponsesInputItems 将 input 统一为带 id 的输入项数组，idPrefix 用于生成缺失的 id
+func NormalizeResponsesInputItems(input json.RawMessage, idPrefix string) json.RawMessage {
+	var items []map[string]any
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		_ = common.Unmarshal(input, &text)
+		items = []map[string]any{{
+			"type":    "message",
+			"role":    "user",
+			"content": []map[string]any{{"type": "input_text", "text": text}},
+		}}
+	case "array":
+		if err := common.Unmarshal(input, &items); err != nil {
+			return json.RawMessage("[]")
+		}
+	default:
+		return json.RawMessage("[]")
+	}
+	for i, item := range items {
+		if t, _ := item["type"].(string); t == "" {
+			item["type"] = "message"
+		}
+		if id, _ := item["id"].(string); id == "" {
+			item["id"] = fmt.Sprintf("%s_%d", idPrefix, i)
+		}
+	}
+	data, err := common.Marshal(items)
+	if err != nil {
+		return json.RawMessage("[]")
+	}
+	return data
+}
+
+// replayableInputItems 过滤掉只能由原上游解析的项（推理、引用），并去掉 id 以免上游按 id 查找
+func replayableInputItems(items []map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		switch t, _ := item["type"].(string); t {
+		case "reasoning", "item_reference":
+			continue
+		}
+		delete(item, "id")
+		out = append(out, item)
+	}
+	return out
+}
+
+// replayableOutputItems 将响应输出转换为下一轮的输入项，仅保留消息与函数调用
+func replayableOutputItems(response json.RawMessage) []map[string]any {
+	var outputs []map[string]any
+	if err := common.UnmarshalJsonStr(gjson.GetBytes(response, "output").Raw, &outputs); err != nil {
+		return nil
+	}
+	out := make([]map[string]any, 0, len(outputs))
+	for _, item := range outputs {
+		switch t, _ := item["type"].(string); t {
+		case "message", "function_call":
+			delete(item, "id")
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// buildResponsesConversation 按时间顺序拼接历史输入输出与本轮输入，chain 为从最近到最早的响应
+func buildResponsesConversation(chain []*model.StoredResponse, input json.RawMessage) ([]map[string]any, error) {
+	items := make([]map[string]any, 0)
+	for i := len(chain) - 1; i >= 0; i-- {
+		var inputs []map[string]any
+		if err := common.Unmarshal(chain[i].InputItems, &inputs); err != nil {
+			return nil, err
+		}
+		items = append(items, replayableInputItems(inputs)...)
+		items = append(items, replayableOutputItems(chain[i].Response)...)
+	}
+	var current []map[string]any
+	if err := common.Unmarshal(NormalizeResponsesInputItems(input, "item"), &current); err != nil {
+		return nil, err
+	}
+	return append(items, replayableInputItems(current)...), nil
+}
+
+// PreparePreviousResponse 上游无法解析 previous_response_id 时（跨渠道、跨密钥或经 Chat 转换），
+// 使用网关保存的历史重建完整输入。返回是否进行了重建
+func PreparePreviousResponse(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, nativeResponses bool) (bool, error) {
+	if request.PreviousResponseID == "" || !operation_setting.GetResponsesStoreSetting().Enabled {
+		return false, nil
+	}
+	stored, err := model.GetUserStoredResponse(info.UserId, request.PreviousResponseID)
+	if err != nil {
+		// 网关未保存时原样转发，由上游解析
+		return false, nil
+	}
+	if nativeResponses && stored.UpstreamStored && stored.ChannelId == info.ChannelId &&
+		stored.ChannelKeyIndex == info.ChannelMultiKeyIndex {
+		return false, nil
+	}
+
+	chain := []*model.StoredResponse{stored}
+	maxDepth := operation_setting.GetResponsesStoreMaxChainDepth()
+	for len(chain) < maxDepth && stored.PreviousResponseId != "" {
+		stored, err = model.GetUserStoredResponse(info.UserId, stored.PreviousResponseId)
+		if err != nil {
+			// 更早的历史已过期或被删除，从可用部分开始重建
+			break
+		}
+		chain = append(chain, stored)
+	}
+	items, err := buildResponsesConversation(chain, request.Input)
+	if err != nil {
+		return false, fmt.Errorf("failed to rebuild conversation from previous_response_id: %w", err)
+	}
+	input, err := common.Marshal(items)
+	if err != nil {
+		return false, err
+	}
+	request.Input = input
+	request.PreviousResponseID = ""
+	return true, nil
+}
+
+// SaveStoredResponse 请求成功后保存本轮输入与响应
+func SaveStoredResponse(c *gin.Context, info *relaycommon.RelayInfo, writer *ResponsesStoreWriter, turnInput json.RawMessage, previousResponseId string, upstreamStored bool) {
+	if writer == nil {
+		return
+	}
+	response := writer.Response()
+	responseId := gjson.GetBytes(response, "id").String()
+	if responseId == "" {
+		return
+	}
+	if previousResponseId != "" {
+		// 重建对话时上游看不到 previous_response_id，保存时补回
+		if patched, err := sjson.SetBytes(response, "previous_response_id", previousResponseId); err == nil {
+			response = patched
+		}
+	}
+	now := common.GetTimestamp()
+	stored := &model.StoredResponse{
+		ResponseId:         responseId,
+		UserId:             info.UserId,
+		TokenId:            info.TokenId,
+		ChannelId:          info.ChannelId,
+		ChannelKeyIndex:    info.ChannelMultiKeyIndex,
+		Model:              info.OriginModelName,
+		PreviousResponseId: previousResponseId,
+		UpstreamStored:     upstreamStored,
+		InputItems:         NormalizeResponsesInputItems(turnInput, "msg_"+strings.TrimPrefix(responseId, "resp_")),
+		Response:           response,
+		CreatedAt:          now,
+		ExpiresAt:          now + operation_setting.GetResponsesStoreRetentionSeconds(),
+	}
+	if err := stored.Insert(); err != nil {
+		logger.LogError(c, "failed to store response: "+err.Error())
+	}
+}
+
+// ResponsesStoreWriter 在写入客户端的同时提取最终的 Responses 响应对象
+type ResponsesStoreWriter struct {
+	gin.ResponseWriter
+	mu       sync.Mutex
+	isStream bool
+	limit    int
+	buf      bytes.Buffer
+	response []byte
+	overflow bool
+}
+
+func NewResponsesStoreWriter(w gin.ResponseWriter, isStream bool) *ResponsesStoreWriter {
+	return &ResponsesStoreWriter{
+		ResponseWriter: w,
+		isStream:       isStream,
+		limit:          operation_setting.GetResponsesStoreMaxResponseBytes(),
+	}
+}
+
+func (w *ResponsesStoreWriter) capture(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(data)
+	if w.isStream {
+		w.processLines()
+	}
+}
+
+// processLines 逐行查找流式结束事件中的完整响应，不完整的行留到下次写入
+func (w *ResponsesStoreWriter) processLines() {
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			return
+		}
+		payload, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		if !ok {
+			continue
+		}
+		switch gjson.Get(payload, "type").String() {
+		case "response.completed", "response.incomplete":
+			if response := gjson.Get(payload, "response"); response.IsObject() {
+				w.response = []byte(response.Raw)
+			}
+		}
+	}
+}
+
+func (w *ResponsesStoreWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponsesStoreWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Response 返回捕获到的响应对象，未捕获到或超出大小限制时返回 nil
+func (w *ResponsesStoreWriter) Response() []byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.overflow {
+		return nil
+	}
+	if w.isStream {
+		return w.response
+	}
+	body := w.buf.Bytes()
+	if gjson.GetBytes(body, "object").String() != "response" {
+		return nil
+	}
+	return bytes.Clone(body)
+}
+
+// StartResponsesStoreCleanupTask 定期删除超过保存期限的响应
+func StartResponsesStoreCleanupTask() {
+	responsesStoreCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("responses store cleanup task started: tick=%s", responsesStoreCleanupInterval))
+			ticker := time.NewTicker(responsesStoreCleanupInterval)
+			defer ticker.Stop()
+
+			runResponsesStoreCleanupOnce()
+			for range ticker.C {
+				runResponsesStoreCleanupOnce()
+			}
+		})
+	})
+}
+
+func runResponsesStoreCleanupOnce() {
+	if !responsesStoreCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer responsesStoreCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	total := int64(0)
+	for {
+		n, err := model.DeleteExpiredStoredResponses(responsesStoreCleanupBatchSize)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("responses store cleanup failed: %v", err))
+			return
+		}
+		total += n
+		if n < responsesStoreCleanupBatchSize {
+			break
+		}
+	}
+	if total > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("responses store cleanup: deleted %d expired responses", total))
+	}
+}
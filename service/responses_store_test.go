@@ -0,0 +1,93 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResponsesStoreWriterStream(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	writer := NewResponsesStoreWriter(ctx.Writer, true)
+
+	_, _ = writer.WriteString("event: response.output_text.delta\ndata: {\"type\":\"response.output_text.delta\",\"delta\":\"hi\"}\n\n")
+	// 结束事件分两次写入
+	_, _ = writer.WriteString("event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"id\":\"resp_1\",")
+	assert.Nil(t, writer.Response())
+	_, _ = writer.WriteString("\"object\":\"response\"}}\n\n")
+	assert.Equal(t, "resp_1", gjson.GetBytes(writer.Response(), "id").String())
+}
+
+func TestPreparePreviousResponse(t *testing.T) {
+	truncate(t)
+	t.Cleanup(func() { model.DB.Exec("DELETE FROM stored_responses") })
+	setting := operation_setting.GetResponsesStoreSetting()
+	setting.Enabled = true
+	t.Cleanup(func() { setting.Enabled = false })
+
+	now := common.GetTimestamp()
+	first := &model.StoredResponse{
+		ResponseId:     "resp_1",
+		UserId:         1,
+		ChannelId:      10,
+		UpstreamStored: true,
+		InputItems:     NormalizeResponsesInputItems(json.RawMessage(`"hello"`), "msg_1"),
+		Response:       json.RawMessage(`{"id":"resp_1","object":"response","output":[{"type":"reasoning","id":"rs_1"},{"type":"message","id":"msg_o1","role":"assistant","content":[{"type":"output_text","text":"hi"}]}]}`),
+		ExpiresAt:      now + 3600,
+	}
+	second := &model.StoredResponse{
+		ResponseId:         "resp_2",
+		UserId:             1,
+		ChannelId:          10,
+		PreviousResponseId: "resp_1",
+		UpstreamStored:     true,
+		InputItems:         NormalizeResponsesInputItems(json.RawMessage(`"weather?"`), "msg_2"),
+		Response:           json.RawMessage(`{"id":"resp_2","object":"response","output":[{"type":"function_call","id":"fc_1","call_id":"call_1","name":"get_weather","arguments":"{}"}]}`),
+		ExpiresAt:          now + 3600,
+	}
+	require.NoError(t, first.Insert())
+	require.NoError(t, second.Insert())
+
+	// 同一渠道可由上游解析，原样转发
+	request := &dto.OpenAIResponsesRequest{
+		PreviousResponseID: "resp_2",
+		Input:              json.RawMessage(`[{"type":"function_call_output","call_id":"call_1","output":"sunny"}]`),
+	}
+	rebuilt, err := PreparePreviousResponse(&relaycommon.RelayInfo{UserId: 1, ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 10}}, request, true)
+	require.NoError(t, err)
+	assert.False(t, rebuilt)
+	assert.Equal(t, "resp_2", request.PreviousResponseID)
+
+	// 其他用户无法访问
+	rebuilt, err = PreparePreviousResponse(&relaycommon.RelayInfo{UserId: 2, ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 11}}, request, true)
+	require.NoError(t, err)
+	assert.False(t, rebuilt)
+
+	// 切换渠道后使用网关保存的历史重建
+	rebuilt, err = PreparePreviousResponse(&relaycommon.RelayInfo{UserId: 1, ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 11}}, request, true)
+	require.NoError(t, err)
+	assert.True(t, rebuilt)
+	assert.Empty(t, request.PreviousResponseID)
+
+	var items []map[string]any
+	require.NoError(t, common.Unmarshal(request.Input, &items))
+	require.Len(t, items, 5)
+	assert.Equal(t, "user", items[0]["role"])
+	assert.Equal(t, "assistant", items[1]["role"])
+	assert.Equal(t, "user", items[2]["role"])
+	assert.Equal(t, "function_call", items[3]["type"])
+	assert.Equal(t, "function_call_output", items[4]["type"])
+	for _, item := range items {
+		assert.NotContains(t, item, "id")
+	}
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+var (
+	secretReencryptOnce    sync.Once
+	secretReencryptRunning atomic.Bool
+)
+
+// StartSecretReencryptTask 启动时把已有的明文密钥加密一次，之后定期把旧主密钥加密的数据迁移到当前主密钥
+func StartSecretReencryptTask() {
+	secretReencryptOnce.Do(func() {
+		if !common.IsMasterNode || !common.SecretEncryptionEnabled() {
+			return
+		}
+		interval := time.Duration(common.GetEnvOrDefault("SECRET_REENCRYPT_INTERVAL", 360)) * time.Minute
+		if interval <= 0 {
+			interval = 6 * time.Hour
+		}
+
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("secret re-encryption task started: tick=%s key_id=%s", interval, common.SecretCurrentMasterKeyID()))
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			runSecretReencryptOnce()
+			for range ticker.C {
+				runSecretReencryptOnce()
+			}
+		})
+	})
+}
+
+func runSecretReencryptOnce() {
+	if !secretReencryptRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer secretReencryptRunning.Store(false)
+
+	ctx := context.Background()
+	result, err := model.ReencryptSecrets()
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("secret re-encryption failed: %v", err))
+		return
+	}
+	if result.Total() > 0 || result.Failed > 0 {
+		logger.LogInfo(ctx, fmt.Sprintf("secret re-encryption finished: channels=%d oauth_providers=%d options=%d option_revisions=%d users=%d tasks=%d failed=%d",
+			result.Channels, result.OAuthProviders, result.Options, result.OptionRevisions, result.Users, result.Tasks, result.Failed))
+	}
+}
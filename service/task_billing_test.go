@@ -44,6 +44,9 @@ func TestMain(m *testing.M) {
 		&model.Channel{},
 		&model.TopUp{},
 		&model.UserSubscription{},
+		&model.Organization{},
+		&model.OrganizationMember{},
+		&model.StoredResponse{},
 	); err != nil {
 		panic("failed to migrate: " + err.Error())
 	}
@@ -65,6 +68,8 @@ func truncate(t *testing.T) {
 		model.DB.Exec("DELETE FROM channels")
 		model.DB.Exec("DELETE FROM top_ups")
 		model.DB.Exec("DELETE FROM user_subscriptions")
+		model.DB.Exec("DELETE FROM organizations")
+		model.DB.Exec("DELETE FROM organization_members")
 	})
 }
 
@@ -167,6 +172,25 @@ func getSubscriptionUsed(t *testing.T, id int) int64 {
 	return sub.AmountUsed
 }
 
+func seedOrganization(t *testing.T, id int, ownerId int, quota int) {
+	t.Helper()
+	org := &model.Organization{Id: id, Name: "test_org", OwnerId: ownerId, Status: model.OrganizationStatusEnabled, Quota: quota}
+	require.NoError(t, model.DB.Create(org).Error)
+}
+
+func seedOrganizationMember(t *testing.T, orgId int, userId int, role string, quotaLimit int, usedQuota int) {
+	t.Helper()
+	member := &model.OrganizationMember{OrganizationId: orgId, UserId: userId, Role: role, QuotaLimit: quotaLimit, UsedQuota: usedQuota}
+	require.NoError(t, model.DB.Create(member).Error)
+}
+
+func getOrganizationQuota(t *testing.T, id int) (quota int, usedQuota int) {
+	t.Helper()
+	var org model.Organization
+	require.NoError(t, model.DB.Select("quota", "used_quota").Where("id = ?", id).First(&org).Error)
+	return org.Quota, org.UsedQuota
+}
+
 func getLastLog(t *testing.T) *model.Log {
 	t.Helper()
 	var log model.Log
@@ -714,3 +738,93 @@ func TestSettle_NonPerCall_AdaptorAdjustWorks(t *testing.T) {
 	require.NotNil(t, log)
 	assert.Equal(t, model.LogTypeRefund, log.Type)
 }
+
+// ===========================================================================
+// Organization funding tests
+// ===========================================================================
+
+func TestRefundTaskQuota_Organization(t *testing.T) {
+	truncate(t)
+	ctx := context.Background()
+
+	const userID, tokenID, channelID, orgID = 30, 30, 30, 1
+	const preConsumed = 3000
+	const orgQuota, orgUsed, memberUsed = 20000, 8000, 5000
+
+	seedUser(t, userID, 1000)
+	seedToken(t, tokenID, userID, "sk-org-key", 8000)
+	seedChannel(t, channelID)
+	seedOrganization(t, orgID, userID, orgQuota)
+	require.NoError(t, model.DB.Model(&model.Organization{}).Where("id = ?", orgID).Update("used_quota", orgUsed).Error)
+	seedOrganizationMember(t, orgID, userID, model.OrganizationRoleMember, 0, memberUsed)
+
+	task := makeTask(userID, channelID, preConsumed, tokenID, BillingSourceOrganization, 0)
+	task.PrivateData.OrganizationId = orgID
+
+	RefundTaskQuota(ctx, task, "organization task failed")
+
+	// 退还到组织钱包，个人钱包不变
+	quota, used := getOrganizationQuota(t, orgID)
+	assert.Equal(t, orgQuota+preConsumed, quota)
+	assert.Equal(t, orgUsed-preConsumed, used)
+	assert.Equal(t, 1000, getUserQuota(t, userID))
+
+	member, err := model.GetOrganizationMember(orgID, userID)
+	require.NoError(t, err)
+	assert.Equal(t, memberUsed-preConsumed, member.UsedQuota)
+}
+
+func TestCheckOrganizationSpend(t *testing.T) {
+	truncate(t)
+
+	const orgID, memberID, viewerID, outsiderID = 2, 31, 32, 33
+	seedOrganization(t, orgID, memberID, 10000)
+	seedOrganizationMember(t, orgID, memberID, model.OrganizationRoleMember, 5000, 4000)
+	seedOrganizationMember(t, orgID, viewerID, model.OrganizationRoleViewer, 0, 0)
+
+	_, err := model.CheckOrganizationSpend(orgID, memberID, 1000)
+	require.NoError(t, err)
+
+	// 超出成员额度上限
+	_, err = model.CheckOrganizationSpend(orgID, memberID, 1001)
+	assert.ErrorIs(t, err, model.ErrOrganizationMemberCapHit)
+
+	// viewer 只能查看，不能消费
+	_, err = model.CheckOrganizationSpend(orgID, viewerID, 1)
+	assert.ErrorIs(t, err, model.ErrOrganizationNoPermission)
+
+	_, err = model.CheckOrganizationSpend(orgID, outsiderID, 1)
+	assert.ErrorIs(t, err, model.ErrOrganizationNotMember)
+
+	// 组织余额不足
+	require.NoError(t, model.DB.Model(&model.OrganizationMember{}).Where("user_id = ?", memberID).Update("quota_limit", 0).Error)
+	_, err = model.CheckOrganizationSpend(orgID, memberID, 10001)
+	assert.ErrorIs(t, err, model.ErrOrganizationQuotaNotEnough)
+	assert.True(t, model.IsOrganizationSpendDenied(err))
+}
+
+func TestReserveOrganizationQuota(t *testing.T) {
+	truncate(t)
+
+	const orgID, memberID = 3, 34
+	seedOrganization(t, orgID, memberID, 10000)
+	seedOrganizationMember(t, orgID, memberID, model.OrganizationRoleMember, 5000, 4000)
+
+	require.NoError(t, model.ReserveOrganizationQuota(orgID, memberID, 1000))
+	quota, used := getOrganizationQuota(t, orgID)
+	assert.Equal(t, 9000, quota)
+	assert.Equal(t, 1000, used)
+
+	// 超出成员额度上限时组织余额也不会被扣减
+	err := model.ReserveOrganizationQuota(orgID, memberID, 1)
+	assert.ErrorIs(t, err, model.ErrOrganizationMemberCapHit)
+	quota, _ = getOrganizationQuota(t, orgID)
+	assert.Equal(t, 9000, quota)
+
+	require.NoError(t, model.DB.Model(&model.OrganizationMember{}).Where("user_id = ?", memberID).Update("quota_limit", 0).Error)
+	err = model.ReserveOrganizationQuota(orgID, memberID, 9001)
+	assert.ErrorIs(t, err, model.ErrOrganizationQuotaNotEnough)
+	require.NoError(t, model.ReserveOrganizationQuota(orgID, memberID, 9000))
+	quota, _ = getOrganizationQuota(t, orgID)
+	assert.Equal(t, 0, quota)
+}
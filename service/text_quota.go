@@ -12,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/pkg/billingexpr"
 	perfmetrics "github.com/QuantumNous/new-api/pkg/perf_metrics"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
@@ -320,6 +321,18 @@ func usageSemanticFromUsage(relayInfo *relaycommon.RelayInfo, usage *dto.Usage)
 }
 
 func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent []string) {
+	if relayInfo.IsHedgeLoser() {
+		logger.LogInfo(ctx, "对冲请求未胜出，跳过结算")
+		return
+	}
+	// 输出审核检查脱敏后的内容，写出后再为客户端还原占位符
+	FinishOutputModeration(ctx)
+	FinishPIIRehydration(ctx)
+	if OutputModerationBlocked(ctx) {
+		usage = blockedCompletionUsage(usage)
+		extraContent = append(extraContent, "输出被审核阻断，补全部分不计费")
+	}
+	recordResponseCacheUsage(ctx, usage)
 	originUsage := usage
 	if usage == nil {
 		extraContent = append(extraContent, "上游无计费信息")
@@ -330,6 +343,7 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 
 	adminRejectReason := common.GetContextKeyString(ctx, constant.ContextKeyAdminRejectReason)
 	summary := calculateTextQuotaSummary(ctx, relayInfo, usage)
+	recordTokenizerAccuracyFromUsage(ctx, relayInfo, originUsage, summary.IsClaudeUsageSemantic)
 
 	var tieredResult *billingexpr.TieredResult
 	tieredBillingApplied := false
@@ -369,6 +383,7 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, summary.Quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, summary.Quota)
 	}
+	ReconcileTPM(relayInfo, summary.TotalTokens)
 
 	if err := SettleBilling(ctx, relayInfo, summary.Quota); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
@@ -475,5 +490,6 @@ func PostTextConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, us
 	})
 	gopool.Go(func() {
 		perfmetrics.RecordRelaySample(relayInfo, true, int64(summary.CompletionTokens))
+		prommetrics.ObserveConsume(relayInfo, summary.PromptTokens, summary.CompletionTokens, summary.Quota)
 	})
 }
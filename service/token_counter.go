@@ -393,16 +393,31 @@ func CountAudioTokenOutput(audioBase64 string, audioFormat string) (int, error)
 	return int(duration / 60 * 200 / 0.24), nil
 }
 
-// CountTextToken 统计文本的token数量，仅OpenAI模型使用tokenizer，其余模型使用估算
+// CountTextToken 统计文本的token数量，按模型名从分词器注册表中选择分词器，见 ResolveTokenizer
 func CountTextToken(text string, model string) int {
 	if text == "" {
 		return 0
 	}
-	if common.IsOpenAITextModel(model) {
-		tokenEncoder := getTokenEncoder(model)
-		return getTokenNum(tokenEncoder, text)
-	} else {
-		// 非openai模型，使用tiktoken-go计算没有意义，使用估算节省资源
-		return EstimateTokenByModel(model, text)
+	return ResolveTokenizer(model).Count(text)
+}
+
+// CountTokenMeta 本地估算请求的输入 token 数，不下载媒体文件，用于 count_tokens 等不计费的查询
+func CountTokenMeta(meta *types.TokenCountMeta, model string) int {
+	if meta == nil {
+		return 0
+	}
+	tkm := CountTextToken(meta.CombineText, model)
+	for _, file := range meta.Files {
+		switch file.FileType {
+		case types.FileTypeImage:
+			tkm += 520
+		case types.FileTypeAudio:
+			tkm += 256
+		case types.FileTypeVideo:
+			tkm += 4096 * 2
+		default:
+			tkm += 4096
+		}
 	}
+	return tkm
 }
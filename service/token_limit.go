@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+)
+
+var (
+	ErrTokenRateLimited     = errors.New("令牌请求速率超出限制")
+	ErrTokenBudgetExhausted = errors.New("令牌本周期预算已用尽")
+)
+
+// ---------------------------------------------------------------------------
+// 计数器：启用 Redis 时多节点共享，否则使用进程内计数
+// ---------------------------------------------------------------------------
+
+type tokenLimitEntry struct {
+	value    int64
+	expireAt time.Time
+}
+
+type tokenLimitMemoryCounter struct {
+	mu        sync.Mutex
+	values    map[string]*tokenLimitEntry
+	lastSweep time.Time
+}
+
+var tokenLimitMemory = &tokenLimitMemoryCounter{values: make(map[string]*tokenLimitEntry)}
+
+func (m *tokenLimitMemoryCounter) incrBy(key string, delta int64, ttl time.Duration) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for k, entry := range m.values {
+			if now.After(entry.expireAt) {
+				delete(m.values, k)
+			}
+		}
+		m.lastSweep = now
+	}
+	entry, ok := m.values[key]
+	if !ok || now.After(entry.expireAt) {
+		entry = &tokenLimitEntry{}
+		m.values[key] = entry
+	}
+	entry.value += delta
+	entry.expireAt = now.Add(ttl)
+	return entry.value
+}
+
+func (m *tokenLimitMemoryCounter) get(key string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.values[key]
+	if !ok || time.Now().After(entry.expireAt) {
+		return 0
+	}
+	return entry.value
+}
+
+func tokenLimitIncrBy(key string, delta int64, ttl time.Duration) (int64, error) {
+	if !common.RedisEnabled || common.RDB == nil {
+		return tokenLimitMemory.incrBy(key, delta, ttl), nil
+	}
+	ctx := context.Background()
+	pipe := common.RDB.TxPipeline()
+	incr := pipe.IncrBy(ctx, key, delta)
+	pipe.Expire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// ---------------------------------------------------------------------------
+// 计数键
+// ---------------------------------------------------------------------------
+
+// tokenBudgetWindow 返回预算周期的起止时间，对齐方式与订阅额度重置一致
+func tokenBudgetWindow(period string, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch period {
+	case model.SubscriptionResetWeekly:
+		weekday := int(now.Weekday()) // Sunday=0
+		if weekday == 0 {
+			weekday = 7
+		}
+		start := today.AddDate(0, 0, 1-weekday)
+		return start, start.AddDate(0, 0, 7)
+	case model.SubscriptionResetMonthly:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return today, today.AddDate(0, 0, 1)
+	}
+}
+
+// tokenBudgetPeriodStart 返回请求占用预算的周期起点，首次调用时按当前时间确定并记录在 RelayInfo 中
+func tokenBudgetPeriodStart(info *relaycommon.RelayInfo) int64 {
+	if info.TokenBudgetStart == 0 {
+		start, _ := tokenBudgetWindow(model.NormalizeTokenBudgetPeriod(info.TokenBudgetPeriod), time.Now())
+		info.TokenBudgetStart = start.Unix()
+	}
+	return info.TokenBudgetStart
+}
+
+func tokenMinuteKey(kind string, tokenId int, now time.Time) string {
+	return fmt.Sprintf("new-api:token_%s:%d:%d", kind, tokenId, now.Unix()/60)
+}
+
+// ---------------------------------------------------------------------------
+// 准入检查与计费记账
+// ---------------------------------------------------------------------------
+
+// CheckTokenRequestLimits 令牌鉴权时调用：计入本分钟请求数，并检查周期预算是否已耗尽；TPM 在请求准入时由 AcquireTPM 检查
+func CheckTokenRequestLimits(token *model.Token) error {
+	now := time.Now()
+	if token.RpmLimit > 0 {
+		count, err := tokenLimitIncrBy(tokenMinuteKey("rpm", token.Id, now), 1, 2*time.Minute)
+		if err != nil {
+			common.SysError("failed to count token rpm: " + err.Error())
+		} else if count > int64(token.RpmLimit) {
+			return fmt.Errorf("%w：每分钟最多请求 %d 次", ErrTokenRateLimited, token.RpmLimit)
+		}
+	}
+	if token.HasBudget() {
+		start, _ := tokenBudgetWindow(model.NormalizeTokenBudgetPeriod(token.BudgetPeriod), now)
+		used, err := model.GetTokenBudgetUsed(token.Id, start.Unix())
+		if err != nil {
+			common.SysError("failed to get token budget: " + err.Error())
+		} else if used >= token.BudgetQuota {
+			return fmt.Errorf("%w，本周期预算：%s", ErrTokenBudgetExhausted, logger.FormatQuota(token.BudgetQuota))
+		}
+	}
+	return nil
+}
+
+func tokenBudgetEnabled(info *relaycommon.RelayInfo) bool {
+	return info != nil && !info.IsPlayground && info.TokenId > 0 && info.TokenBudgetQuota > 0 &&
+		model.NormalizeTokenBudgetPeriod(info.TokenBudgetPeriod) != model.SubscriptionResetNever
+}
+
+// reserveTokenBudget 从令牌本周期预算中预占 amount，超出预算时不占用并返回错误；用量保存在数据库中，重启后不会重置
+func reserveTokenBudget(info *relaycommon.RelayInfo, amount int) error {
+	if amount <= 0 || !tokenBudgetEnabled(info) {
+		return nil
+	}
+	periodStart := tokenBudgetPeriodStart(info)
+	ok, err := model.ReserveTokenBudget(info.TokenId, periodStart, amount, info.TokenBudgetQuota)
+	if err != nil {
+		common.SysError("failed to reserve token budget: " + err.Error())
+		return nil
+	}
+	if !ok {
+		used, _ := model.GetTokenBudgetUsed(info.TokenId, periodStart)
+		return fmt.Errorf("%w，本周期预算：%s，已用：%s", ErrTokenBudgetExhausted,
+			logger.FormatQuota(info.TokenBudgetQuota), logger.FormatQuota(used))
+	}
+	return nil
+}
+
+// adjustTokenBudget 结算或退款时调整预占所在周期的用量，不做上限检查
+func adjustTokenBudget(info *relaycommon.RelayInfo, delta int) {
+	if delta == 0 || !tokenBudgetEnabled(info) {
+		return
+	}
+	if err := model.AdjustTokenBudget(info.TokenId, tokenBudgetPeriodStart(info), delta); err != nil {
+		common.SysError("failed to adjust token budget: " + err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBudgetWindow(t *testing.T) {
+	// 2026-10-14 是周三
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+
+	start, end := tokenBudgetWindow(model.SubscriptionResetDaily, now)
+	assert.Equal(t, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = tokenBudgetWindow(model.SubscriptionResetWeekly, now)
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), end)
+
+	// 周日仍属于上周一开始的周期
+	start, _ = tokenBudgetWindow(model.SubscriptionResetWeekly, time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), start)
+
+	start, end = tokenBudgetWindow(model.SubscriptionResetMonthly, now)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestTokenBudgetReserve(t *testing.T) {
+	truncate(t)
+	seedToken(t, 9001, 1, "sk-budget-key", 0)
+	info := &relaycommon.RelayInfo{
+		TokenId:           9001,
+		TokenBudgetPeriod: model.SubscriptionResetDaily,
+		TokenBudgetQuota:  1000,
+	}
+	token := &model.Token{Id: info.TokenId, BudgetPeriod: info.TokenBudgetPeriod, BudgetQuota: info.TokenBudgetQuota}
+
+	require.NoError(t, reserveTokenBudget(info, 600))
+	require.ErrorIs(t, reserveTokenBudget(info, 500), ErrTokenBudgetExhausted)
+	// 失败的预占不占用预算
+	require.NoError(t, reserveTokenBudget(info, 400))
+	require.ErrorIs(t, CheckTokenRequestLimits(token), ErrTokenBudgetExhausted)
+
+	adjustTokenBudget(info, -300)
+	require.NoError(t, CheckTokenRequestLimits(token))
+
+	// 用量保存在数据库中，不依赖进程内计数
+	used, err := model.GetTokenBudgetUsed(info.TokenId, info.TokenBudgetStart)
+	require.NoError(t, err)
+	assert.Equal(t, 700, used)
+}
+
+func TestTokenBudgetSettlesIntoReservedPeriod(t *testing.T) {
+	truncate(t)
+	seedToken(t, 9003, 1, "sk-budget-period", 0)
+	current, _ := tokenBudgetWindow(model.SubscriptionResetDaily, time.Now())
+	previous := current.AddDate(0, 0, -1).Unix()
+
+	// 请求在上一周期预占，跨周期后才结算
+	stale := &relaycommon.RelayInfo{
+		TokenId:           9003,
+		TokenBudgetPeriod: model.SubscriptionResetDaily,
+		TokenBudgetQuota:  1000,
+		TokenBudgetStart:  previous,
+	}
+	require.NoError(t, reserveTokenBudget(stale, 800))
+	fresh := &relaycommon.RelayInfo{
+		TokenId:           9003,
+		TokenBudgetPeriod: model.SubscriptionResetDaily,
+		TokenBudgetQuota:  1000,
+	}
+	require.NoError(t, reserveTokenBudget(fresh, 900))
+	require.Equal(t, current.Unix(), fresh.TokenBudgetStart)
+
+	// 上一周期的退款不影响本周期用量
+	adjustTokenBudget(stale, -800)
+	used, err := model.GetTokenBudgetUsed(9003, current.Unix())
+	require.NoError(t, err)
+	assert.Equal(t, 900, used)
+}
+
+func TestTokenRpmLimit(t *testing.T) {
+	token := &model.Token{Id: 9002, RpmLimit: 2}
+	require.NoError(t, CheckTokenRequestLimits(token))
+	require.NoError(t, CheckTokenRequestLimits(token))
+	require.ErrorIs(t, CheckTokenRequestLimits(token), ErrTokenRateLimited)
+}
@@ -1,13 +1,27 @@
 package service
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/filestore"
+	tokenizerpkg "github.com/QuantumNous/new-api/pkg/tokenizer"
+
+	"github.com/samber/hot"
 	"github.com/tiktoken-go/tokenizer"
 	"github.com/tiktoken-go/tokenizer/codec"
 )
 
+// tokenizerCacheCapacity 按模型名缓存匹配结果的数量上限，模型名来自请求，不能无限增长
+const tokenizerCacheCapacity = 4096
+
 // tokenEncoderMap won't grow after initialization
 var defaultTokenEncoder tokenizer.Codec
 
@@ -61,3 +75,328 @@ func getTokenNum(tokenEncoder tokenizer.Codec, text string) int {
 	tkm, _ := tokenEncoder.Count(text)
 	return tkm
 }
+
+// TextTokenizer 计算文本 token 数的分词器
+type TextTokenizer interface {
+	Name() string
+	Count(text string) int
+}
+
+// tiktokenTokenizer 内置的 OpenAI 词表（随 tiktoken-go 嵌入二进制）
+type tiktokenTokenizer struct {
+	name    string
+	once    sync.Once
+	newFunc func() tokenizer.Codec
+	codec   tokenizer.Codec
+}
+
+func (t *tiktokenTokenizer) Name() string {
+	return t.name
+}
+
+func (t *tiktokenTokenizer) Count(text string) int {
+	t.once.Do(func() {
+		t.codec = t.newFunc()
+	})
+	return getTokenNum(t.codec, text)
+}
+
+// openAIModelTokenizer 保持原有行为：OpenAI 文本模型按模型名选择 tiktoken 词表
+type openAIModelTokenizer struct {
+	model string
+}
+
+func (t *openAIModelTokenizer) Name() string {
+	return getTokenEncoder(t.model).GetName()
+}
+
+func (t *openAIModelTokenizer) Count(text string) int {
+	return getTokenNum(getTokenEncoder(t.model), text)
+}
+
+// estimateTokenizer 没有可用词表时按字符类别估算
+type estimateTokenizer struct {
+	provider Provider
+}
+
+func (t *estimateTokenizer) Name() string {
+	return "estimate-" + string(t.provider)
+}
+
+func (t *estimateTokenizer) Count(text string) int {
+	return EstimateToken(t.provider, text)
+}
+
+type customTokenizer struct {
+	name string
+	bpe  *tokenizerpkg.BPE
+}
+
+func (t *customTokenizer) Name() string {
+	return t.name
+}
+
+func (t *customTokenizer) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return t.bpe.Count(text)
+}
+
+// approxTokenizer 借用相近词表计数，名称中标明是近似结果
+type approxTokenizer struct {
+	name string
+	TextTokenizer
+}
+
+func (t *approxTokenizer) Name() string {
+	return t.name
+}
+
+type tokenizerRule struct {
+	pattern   *regexp.Regexp
+	tokenizer TextTokenizer
+}
+
+// tokenizerFamily 没有内置词表的模型系列。fileEnv 指定的官方 tokenizer.json 存在时按词表准确计数
+// （Gemini 没有公开词表，以同源的 Gemma 词表代替），否则使用 fallback 近似计数；
+// 未配置文件的系列在 BuiltinTokenizerRules 中标记为近似，Claude 没有公开词表只能估算
+type tokenizerFamily struct {
+	name     string
+	pattern  *regexp.Regexp
+	fileEnv  string
+	fallback TextTokenizer
+
+	once   sync.Once
+	loaded TextTokenizer
+}
+
+// tokenizer 首次使用时从 fileEnv 指定的路径加载词表，加载失败记录错误并使用 fallback
+func (f *tokenizerFamily) tokenizer() TextTokenizer {
+	f.once.Do(func() {
+		if f.fileEnv == "" {
+			return
+		}
+		path := strings.TrimSpace(os.Getenv(f.fileEnv))
+		if path == "" {
+			return
+		}
+		t, err := loadTokenizerFile(f.name, path)
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to load %s tokenizer from %s: %v", f.name, f.fileEnv, err))
+			return
+		}
+		f.loaded = t
+	})
+	if f.loaded != nil {
+		return f.loaded
+	}
+	return f.fallback
+}
+
+func loadTokenizerFile(name string, path string) (TextTokenizer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	bpe, err := tokenizerpkg.LoadHuggingFace(file)
+	if err != nil {
+		return nil, err
+	}
+	return &customTokenizer{name: name, bpe: bpe}, nil
+}
+
+var (
+	o200kTokenizer  = &tiktokenTokenizer{name: "o200k_base", newFunc: func() tokenizer.Codec { return codec.NewO200kBase() }}
+	cl100kTokenizer = &tiktokenTokenizer{name: "cl100k_base", newFunc: func() tokenizer.Codec { return codec.NewCl100kBase() }}
+
+	o200kApproxTokenizer = &approxTokenizer{name: "o200k_base-approx", TextTokenizer: o200kTokenizer}
+
+	// builtinTokenizerRules 随二进制内置词表的规则（tiktoken-go 自带的 OpenAI 词表）
+	builtinTokenizerRules = []tokenizerRule{
+		{regexp.MustCompile(`^(gpt-4o|chatgpt-4o|gpt-4\.1|gpt-4\.5|gpt-5|gpt-oss|o1|o3|o4|codex-|omni-moderation)`), o200kTokenizer},
+		{regexp.MustCompile(`^(gpt-4|gpt-3\.5|gpt-35|text-embedding|text-davinci)`), cl100kTokenizer},
+	}
+	// tokenizerFamilies 没有内置词表的模型系列，按顺序匹配
+	tokenizerFamilies = []*tokenizerFamily{
+		{name: "qwen", pattern: regexp.MustCompile(`(?i)(qwen|qwq|qvq)`), fileEnv: "TOKENIZER_QWEN_FILE", fallback: o200kApproxTokenizer},
+		{name: "deepseek", pattern: regexp.MustCompile(`(?i)deepseek`), fileEnv: "TOKENIZER_DEEPSEEK_FILE", fallback: o200kApproxTokenizer},
+		{name: "claude", pattern: regexp.MustCompile(`(?i)claude`), fallback: &estimateTokenizer{provider: Claude}},
+		{name: "gemma", pattern: regexp.MustCompile(`(?i)(gemini|gemma)`), fileEnv: "TOKENIZER_GEMMA_FILE", fallback: &estimateTokenizer{provider: Gemini}},
+	}
+	defaultEstimateTokenizer = &estimateTokenizer{provider: OpenAI}
+
+	customTokenizerRules   []tokenizerRule
+	customTokenizerVersion string
+	// customTokenizerLoaded 已解析的分词器，按存储键复用，文件内容上传后不可修改
+	customTokenizerLoaded = make(map[string]TextTokenizer)
+	tokenizerCache        = newTokenizerCache()
+	tokenizerRegistryLock sync.RWMutex
+	tokenizerSyncOnce     sync.Once
+)
+
+func newTokenizerCache() *hot.HotCache[string, TextTokenizer] {
+	return hot.NewHotCache[string, TextTokenizer](hot.LRU, tokenizerCacheCapacity).Build()
+}
+
+// ResolveTokenizer 按模型名选择分词器：管理员上传的规则优先，其次内置规则，最后按原有逻辑回退
+func ResolveTokenizer(modelName string) TextTokenizer {
+	tokenizerRegistryLock.RLock()
+	cache := tokenizerCache
+	rules, version := customTokenizerRules, customTokenizerVersion
+	tokenizerRegistryLock.RUnlock()
+	if t, found, _ := cache.Get(modelName); found {
+		return t
+	}
+
+	t := matchTokenizer(rules, modelName)
+	tokenizerRegistryLock.RLock()
+	// 期间发生重新加载时不写入新缓存，避免缓存旧规则的结果
+	if version == customTokenizerVersion {
+		cache.Set(modelName, t)
+	}
+	tokenizerRegistryLock.RUnlock()
+	return t
+}
+
+func matchTokenizer(custom []tokenizerRule, modelName string) TextTokenizer {
+	for _, rule := range custom {
+		if rule.pattern.MatchString(modelName) {
+			return rule.tokenizer
+		}
+	}
+	for _, rule := range builtinTokenizerRules {
+		if rule.pattern.MatchString(modelName) {
+			return rule.tokenizer
+		}
+	}
+	for _, family := range tokenizerFamilies {
+		if family.pattern.MatchString(modelName) {
+			return family.tokenizer()
+		}
+	}
+	if common.IsOpenAITextModel(modelName) {
+		return &openAIModelTokenizer{model: modelName}
+	}
+	return defaultEstimateTokenizer
+}
+
+// LoadCustomTokenizer 从文件存储读取并解析 tokenizer.json
+func LoadCustomTokenizer(ctx context.Context, t *model.CustomTokenizer) (TextTokenizer, error) {
+	store, err := filestore.ByType(t.StorageType)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := store.Get(ctx, t.StorageKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tokenizer %s: %w", t.Name, err)
+	}
+	defer reader.Close()
+	bpe, err := tokenizerpkg.LoadHuggingFace(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tokenizer %s: %w", t.Name, err)
+	}
+	return &customTokenizer{name: t.Name, bpe: bpe}, nil
+}
+
+// ReloadCustomTokenizers 重新加载管理员上传的分词器，数据库中的记录未变化时跳过
+func ReloadCustomTokenizers(force bool) error {
+	count, updatedTime, err := model.GetCustomTokenizersVersion()
+	if err != nil {
+		return err
+	}
+	version := fmt.Sprintf("%d:%d", count, updatedTime)
+	tokenizerRegistryLock.RLock()
+	unchanged := version == customTokenizerVersion
+	tokenizerRegistryLock.RUnlock()
+	if unchanged && !force {
+		return nil
+	}
+
+	records, err := model.GetAllCustomTokenizers()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	tokenizerRegistryLock.RLock()
+	previous := customTokenizerLoaded
+	tokenizerRegistryLock.RUnlock()
+	loaded := make(map[string]TextTokenizer, len(records))
+	rules := make([]tokenizerRule, 0, len(records))
+	for _, record := range records {
+		if !record.Enabled {
+			continue
+		}
+		pattern, err := regexp.Compile(record.ModelPattern)
+		if err != nil {
+			common.SysError(fmt.Sprintf("invalid model pattern of tokenizer %s: %v", record.Name, err))
+			continue
+		}
+		t, ok := previous[record.StorageKey]
+		if !ok {
+			if t, err = LoadCustomTokenizer(ctx, record); err != nil {
+				common.SysError(err.Error())
+				continue
+			}
+		}
+		loaded[record.StorageKey] = t
+		rules = append(rules, tokenizerRule{pattern: pattern, tokenizer: t})
+	}
+
+	tokenizerRegistryLock.Lock()
+	customTokenizerRules = rules
+	customTokenizerLoaded = loaded
+	customTokenizerVersion = version
+	tokenizerCache = newTokenizerCache()
+	tokenizerRegistryLock.Unlock()
+	common.SysLog(fmt.Sprintf("custom tokenizers loaded: %d", len(rules)))
+	return nil
+}
+
+// StartTokenizerSyncTask 启动时加载管理员上传的分词器，并定期检查其他节点的修改
+func StartTokenizerSyncTask(frequency int) {
+	tokenizerSyncOnce.Do(func() {
+		if err := ReloadCustomTokenizers(true); err != nil {
+			common.SysError("failed to load custom tokenizers: " + err.Error())
+		}
+		go func() {
+			for {
+				time.Sleep(time.Duration(frequency) * time.Second)
+				if err := ReloadCustomTokenizers(false); err != nil {
+					common.SysError("failed to sync custom tokenizers: " + err.Error())
+				}
+			}
+		}()
+	})
+}
+
+// TokenizerRuleInfo 内置规则的展示信息
+type TokenizerRuleInfo struct {
+	Pattern   string `json:"pattern"`
+	Tokenizer string `json:"tokenizer"`
+	// Approximate 没有可用词表，计数为近似值
+	Approximate bool `json:"approximate"`
+	// FileEnv 指定官方 tokenizer.json 路径的环境变量，为空表示没有公开词表
+	FileEnv string `json:"file_env,omitempty"`
+}
+
+func BuiltinTokenizerRules() []TokenizerRuleInfo {
+	rules := make([]TokenizerRuleInfo, 0, len(builtinTokenizerRules)+len(tokenizerFamilies))
+	for _, rule := range builtinTokenizerRules {
+		rules = append(rules, TokenizerRuleInfo{
+			Pattern:   rule.pattern.String(),
+			Tokenizer: rule.tokenizer.Name(),
+		})
+	}
+	for _, family := range tokenizerFamilies {
+		t := family.tokenizer()
+		rules = append(rules, TokenizerRuleInfo{
+			Pattern:     family.pattern.String(),
+			Tokenizer:   t.Name(),
+			Approximate: t == family.fallback,
+			FileEnv:     family.fileEnv,
+		})
+	}
+	return rules
+}
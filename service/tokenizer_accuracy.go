@@ -0,0 +1,105 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	prommetrics "github.com/QuantumNous/new-api/pkg/prom_metrics"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenizerAccuracyMaxModels 最多统计的模型数，避免模型名过多时无限增长
+const tokenizerAccuracyMaxModels = 2000
+
+// TokenizerAccuracy 本地预估的输入 token 数与上游实际用量的对比（仅统计本节点）
+type TokenizerAccuracy struct {
+	Model           string  `json:"model"`
+	Tokenizer       string  `json:"tokenizer"`
+	Samples         int64   `json:"samples"`
+	EstimatedTokens int64   `json:"estimated_tokens"`
+	ActualTokens    int64   `json:"actual_tokens"`
+	MeanAbsError    float64 `json:"mean_abs_error"`
+	Bias            float64 `json:"bias"`
+	LastUpdated     int64   `json:"last_updated"`
+
+	sumAbsError float64
+}
+
+var (
+	tokenizerAccuracyStats = make(map[string]*TokenizerAccuracy)
+	tokenizerAccuracyLock  sync.Mutex
+)
+
+// RecordTokenizerAccuracy 记录一次预估与实际输入 token 数，误差按实际值的比例计算
+func RecordTokenizerAccuracy(modelName string, estimated, actual int) {
+	if modelName == "" || estimated <= 0 || actual <= 0 {
+		return
+	}
+	tokenizerName := ResolveTokenizer(modelName).Name()
+	errorRate := float64(estimated-actual) / float64(actual)
+	prommetrics.ObserveTokenizerError(modelName, tokenizerName, errorRate)
+
+	tokenizerAccuracyLock.Lock()
+	defer tokenizerAccuracyLock.Unlock()
+	stat, ok := tokenizerAccuracyStats[modelName]
+	if !ok {
+		if len(tokenizerAccuracyStats) >= tokenizerAccuracyMaxModels {
+			return
+		}
+		stat = &TokenizerAccuracy{Model: modelName}
+		tokenizerAccuracyStats[modelName] = stat
+	}
+	if stat.Tokenizer != tokenizerName {
+		// 分词器变化后重新统计
+		*stat = TokenizerAccuracy{Model: modelName, Tokenizer: tokenizerName}
+	}
+	stat.Samples++
+	stat.EstimatedTokens += int64(estimated)
+	stat.ActualTokens += int64(actual)
+	stat.sumAbsError += math.Abs(errorRate)
+	stat.LastUpdated = common.GetTimestamp()
+}
+
+// recordTokenizerAccuracyFromUsage 结算时对比预估与上游返回的输入 token 数，用量由本地计算时跳过
+func recordTokenizerAccuracyFromUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, claudeSemantic bool) {
+	if usage == nil || !constant.CountToken || common.GetContextKeyBool(ctx, constant.ContextKeyLocalCountTokens) {
+		return
+	}
+	actual := usage.PromptTokens
+	if claudeSemantic {
+		actual += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	RecordTokenizerAccuracy(relayInfo.OriginModelName, relayInfo.GetEstimatePromptTokens(), actual)
+}
+
+// GetTokenizerAccuracy 按样本数从多到少返回各模型的预估误差
+func GetTokenizerAccuracy() []TokenizerAccuracy {
+	tokenizerAccuracyLock.Lock()
+	defer tokenizerAccuracyLock.Unlock()
+	result := make([]TokenizerAccuracy, 0, len(tokenizerAccuracyStats))
+	for _, stat := range tokenizerAccuracyStats {
+		item := *stat
+		item.MeanAbsError = stat.sumAbsError / float64(stat.Samples)
+		item.Bias = float64(stat.EstimatedTokens-stat.ActualTokens) / float64(stat.ActualTokens)
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Samples != result[j].Samples {
+			return result[i].Samples > result[j].Samples
+		}
+		return result[i].Model < result[j].Model
+	})
+	return result
+}
+
+func ResetTokenizerAccuracy() {
+	tokenizerAccuracyLock.Lock()
+	defer tokenizerAccuracyLock.Unlock()
+	tokenizerAccuracyStats = make(map[string]*TokenizerAccuracy)
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	tokenizerpkg "github.com/QuantumNous/new-api/pkg/tokenizer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveTokenizer(t *testing.T) {
+	assert.Equal(t, "o200k_base", ResolveTokenizer("gpt-4o-mini").Name())
+	assert.Equal(t, "o200k_base", ResolveTokenizer("o3-mini").Name())
+	assert.Equal(t, "cl100k_base", ResolveTokenizer("gpt-4-turbo").Name())
+	assert.Equal(t, "o200k_base-approx", ResolveTokenizer("deepseek-chat").Name())
+	assert.Equal(t, "estimate-claude", ResolveTokenizer("claude-sonnet-4-5").Name())
+	assert.Equal(t, "estimate-gemini", ResolveTokenizer("gemini-2.5-pro").Name())
+	assert.Equal(t, "estimate-openai", ResolveTokenizer("some-unknown-model").Name())
+}
+
+func TestResolveTokenizerCustomRuleFirst(t *testing.T) {
+	bpe, err := tokenizerpkg.LoadHuggingFace(strings.NewReader(`{"model":{"type":"BPE","vocab":{"a":0}}}`))
+	require.NoError(t, err)
+
+	tokenizerRegistryLock.Lock()
+	previousRules, previousVersion := customTokenizerRules, customTokenizerVersion
+	customTokenizerRules = []tokenizerRule{{pattern: regexp.MustCompile(`^deepseek-`), tokenizer: &customTokenizer{name: "deepseek-v3", bpe: bpe}}}
+	customTokenizerVersion = "test"
+	tokenizerCache = newTokenizerCache()
+	tokenizerRegistryLock.Unlock()
+	defer func() {
+		tokenizerRegistryLock.Lock()
+		customTokenizerRules, customTokenizerVersion = previousRules, previousVersion
+		tokenizerCache = newTokenizerCache()
+		tokenizerRegistryLock.Unlock()
+	}()
+
+	assert.Equal(t, "deepseek-v3", ResolveTokenizer("deepseek-chat").Name())
+	assert.Equal(t, 3, CountTextToken("aaa", "deepseek-chat"))
+	assert.Equal(t, "o200k_base-approx", ResolveTokenizer("qwen-max").Name())
+}
+
+func TestTokenizerFamilyLoadsConfiguredFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"model":{"type":"BPE","vocab":{"a":0}}}`), 0600))
+	t.Setenv("TEST_TOKENIZER_DEEPSEEK_FILE", path)
+
+	family := &tokenizerFamily{name: "deepseek", pattern: regexp.MustCompile(`deepseek`), fileEnv: "TEST_TOKENIZER_DEEPSEEK_FILE", fallback: o200kApproxTokenizer}
+	assert.Equal(t, "deepseek", family.tokenizer().Name())
+	assert.Equal(t, 3, family.tokenizer().Count("aaa"))
+
+	t.Setenv("TEST_TOKENIZER_QWEN_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	missing := &tokenizerFamily{name: "qwen", pattern: regexp.MustCompile(`qwen`), fileEnv: "TEST_TOKENIZER_QWEN_FILE", fallback: o200kApproxTokenizer}
+	assert.Same(t, o200kApproxTokenizer, missing.tokenizer())
+}
+
+func TestBuiltinTokenizerRulesMarkApproximateFamilies(t *testing.T) {
+	approximate := make(map[string]TokenizerRuleInfo)
+	for _, rule := range BuiltinTokenizerRules() {
+		if rule.Approximate {
+			approximate[rule.Tokenizer+"|"+rule.FileEnv] = rule
+		}
+		if rule.Tokenizer == "o200k_base" || rule.Tokenizer == "cl100k_base" {
+			assert.False(t, rule.Approximate)
+		}
+	}
+	assert.Contains(t, approximate, "o200k_base-approx|TOKENIZER_QWEN_FILE")
+	assert.Contains(t, approximate, "o200k_base-approx|TOKENIZER_DEEPSEEK_FILE")
+	assert.Contains(t, approximate, "estimate-gemini|TOKENIZER_GEMMA_FILE")
+	assert.Contains(t, approximate, "estimate-claude|")
+}
+
+func TestTokenizerAccuracy(t *testing.T) {
+	ResetTokenizerAccuracy()
+	defer ResetTokenizerAccuracy()
+
+	RecordTokenizerAccuracy("claude-sonnet-4-5", 110, 100)
+	RecordTokenizerAccuracy("claude-sonnet-4-5", 90, 100)
+	RecordTokenizerAccuracy("claude-sonnet-4-5", 0, 100)
+
+	stats := GetTokenizerAccuracy()
+	require.Len(t, stats, 1)
+	assert.Equal(t, "estimate-claude", stats[0].Tokenizer)
+	assert.EqualValues(t, 2, stats[0].Samples)
+	assert.InDelta(t, 0.1, stats[0].MeanAbsError, 1e-9)
+	assert.InDelta(t, 0, stats[0].Bias, 1e-9)
+}
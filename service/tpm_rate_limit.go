@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+const tpmWindow = time.Minute
+
+var (
+	tpmRedisOnce     sync.Once
+	tpmRedisCounter  *limiter.RedisSlidingWindow
+	tpmMemoryCounter limiter.SlidingWindowCounter = limiter.NewMemorySlidingWindow(tpmWindow)
+)
+
+func tpmCounter() limiter.SlidingWindowCounter {
+	if !common.RedisEnabled || common.RDB == nil {
+		return tpmMemoryCounter
+	}
+	tpmRedisOnce.Do(func() {
+		tpmRedisCounter = limiter.NewRedisSlidingWindow(common.RDB, tpmWindow)
+	})
+	return tpmRedisCounter
+}
+
+type tpmDimension struct {
+	name  string
+	key   string
+	limit int
+}
+
+// tpmDimensions 返回本次请求需要检查的 TPM 维度：用户（按分组）、令牌、模型
+func tpmDimensions(info *relaycommon.RelayInfo) []tpmDimension {
+	var dimensions []tpmDimension
+	group := info.TokenGroup
+	if group == "" {
+		group = info.UserGroup
+	}
+	if limit := operation_setting.GetGroupTPMLimit(group); limit > 0 && info.UserId > 0 {
+		dimensions = append(dimensions, tpmDimension{name: "用户", key: fmt.Sprintf("new-api:tpm:user:%d", info.UserId), limit: limit})
+	}
+	tokenLimit := info.TokenTpmLimit
+	if tokenLimit <= 0 && operation_setting.GetTPMRateLimitSetting().Enabled {
+		tokenLimit = operation_setting.GetTPMRateLimitSetting().DefaultTokenLimit
+	}
+	if tokenLimit > 0 && info.TokenId > 0 {
+		dimensions = append(dimensions, tpmDimension{name: "令牌", key: fmt.Sprintf("new-api:tpm:token:%d", info.TokenId), limit: tokenLimit})
+	}
+	if limit := operation_setting.GetModelTPMLimit(info.OriginModelName); limit > 0 {
+		dimensions = append(dimensions, tpmDimension{name: "模型", key: "new-api:tpm:model:" + info.OriginModelName, limit: limit})
+	}
+	return dimensions
+}
+
+// AcquireTPM 请求准入时按预估 prompt tokens 计入各维度的 TPM 窗口，任一维度超限时撤销已计入的维度并返回 429
+func AcquireTPM(info *relaycommon.RelayInfo, tokens int) *types.NewAPIError {
+	if info == nil || info.IsPlayground {
+		return nil
+	}
+	dimensions := tpmDimensions(info)
+	if len(dimensions) == 0 {
+		return nil
+	}
+	if tokens < 0 {
+		tokens = 0
+	}
+	ctx := context.Background()
+	counter := tpmCounter()
+	buckets := make([]string, 0, len(dimensions))
+	for _, dimension := range dimensions {
+		ok, used, bucket, err := counter.Acquire(ctx, dimension.key, int64(dimension.limit), int64(tokens))
+		if err != nil {
+			// 计数失败时放行，避免 Redis 故障导致全站不可用
+			common.SysError("failed to acquire tpm: " + err.Error())
+			continue
+		}
+		if !ok {
+			adjustTPM(counter, buckets, -int64(tokens))
+			return types.NewErrorWithStatusCode(
+				fmt.Errorf("%s每分钟 token 数超出限制：%d，当前已用 %d，本次预估 %d", dimension.name, dimension.limit, used, tokens),
+				types.ErrorCodeTPMRateLimited, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry())
+		}
+		buckets = append(buckets, bucket)
+	}
+	if len(buckets) > 0 {
+		info.TPMReservation = relaycommon.NewTPMReservation(buckets, tokens)
+	}
+	return nil
+}
+
+// ReconcileTPM 结算后按实际使用的 token 数修正准入时计入的预估值，多次结算时后续用量直接累加
+func ReconcileTPM(info *relaycommon.RelayInfo, actualTokens int) {
+	if info == nil || info.TPMReservation == nil {
+		return
+	}
+	buckets, reserved := info.TPMReservation.Take()
+	if actualTokens < 0 {
+		actualTokens = 0
+	}
+	adjustTPM(tpmCounter(), buckets, int64(actualTokens-reserved))
+}
+
+// ReleaseTPM 请求失败时撤销准入时计入的 token 数
+func ReleaseTPM(info *relaycommon.RelayInfo) {
+	ReconcileTPM(info, 0)
+}
+
+func adjustTPM(counter limiter.SlidingWindowCounter, buckets []string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	for _, bucket := range buckets {
+		if err := counter.Add(context.Background(), bucket, delta); err != nil {
+			common.SysError("failed to adjust tpm: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireTPM(t *testing.T) {
+	setting := operation_setting.GetTPMRateLimitSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.DefaultUserLimit = 1000
+	setting.GroupLimits = map[string]int{"vip": 5000}
+	setting.ModelLimits = map[string]int{"tpm-test-*": 1500}
+
+	newInfo := func(tokenId int) *relaycommon.RelayInfo {
+		return &relaycommon.RelayInfo{
+			UserId:          9101,
+			TokenId:         tokenId,
+			TokenGroup:      "vip",
+			TokenTpmLimit:   600,
+			OriginModelName: "tpm-test-model",
+		}
+	}
+
+	first := newInfo(9101)
+	require.Nil(t, AcquireTPM(first, 500))
+
+	// 令牌维度超限，已计入的用户维度需要撤销
+	apiErr := AcquireTPM(newInfo(9101), 200)
+	require.NotNil(t, apiErr)
+	require.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+
+	// 结算后按实际用量修正，令牌释放出额度
+	ReconcileTPM(first, 100)
+	second := newInfo(9101)
+	require.Nil(t, AcquireTPM(second, 450))
+
+	// 模型维度：100 + 450 + 900 <= 1500，再多就超限
+	unlimitedToken := newInfo(9102)
+	unlimitedToken.TokenTpmLimit = 0
+	require.Nil(t, AcquireTPM(unlimitedToken, 900))
+	require.NotNil(t, AcquireTPM(unlimitedToken, 100))
+
+	// 失败请求释放后可继续
+	ReleaseTPM(second)
+	require.Nil(t, AcquireTPM(unlimitedToken, 100))
+}
@@ -23,7 +23,7 @@ func ResponseText2Usage(c *gin.Context, responseText string, modeName string, pr
 	common.SetContextKey(c, constant.ContextKeyLocalCountTokens, true)
 	usage := &dto.Usage{}
 	usage.PromptTokens = promptTokens
-	usage.CompletionTokens = EstimateTokenByModel(modeName, responseText)
+	usage.CompletionTokens = CountTextToken(responseText, modeName)
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 	return usage
 }
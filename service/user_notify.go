@@ -84,7 +84,10 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 		}
 
 		// 获取 webhook secret
-		webhookSecret := userSetting.WebhookSecret
+		webhookSecret, err := common.DecryptSecret(userSetting.WebhookSecret)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt webhook secret: %w", err)
+		}
 		return SendWebhookNotify(webhookURLStr, webhookSecret, data)
 	case dto.NotifyTypeBark:
 		barkURL := userSetting.BarkUrl
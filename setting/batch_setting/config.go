@@ -0,0 +1,69 @@
+package batch_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// PollIntervalSeconds 后台轮询待执行批次的间隔（秒）
+	PollIntervalSeconds int `json:"poll_interval_seconds"`
+	// MaxRunningBatches 同时执行的批次数量
+	MaxRunningBatches int `json:"max_running_batches"`
+	// WorkerConcurrency 单个批次内并发执行的请求数
+	WorkerConcurrency int `json:"worker_concurrency"`
+	// MaxRequestsPerBatch 单个输入文件允许的最大行数
+	MaxRequestsPerBatch int `json:"max_requests_per_batch"`
+	// DiscountRatio 默认批处理折扣倍率，叠加在分组倍率之上
+	DiscountRatio float64 `json:"discount_ratio"`
+	// GroupDiscountRatio 按分组覆盖折扣倍率
+	GroupDiscountRatio map[string]float64 `json:"group_discount_ratio"`
+}
+
+var batchSetting = BatchSetting{
+	Enabled:             true,
+	PollIntervalSeconds: 10,
+	MaxRunningBatches:   2,
+	WorkerConcurrency:   8,
+	MaxRequestsPerBatch: 50000,
+	DiscountRatio:       0.5,
+	GroupDiscountRatio:  map[string]float64{},
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetSetting() *BatchSetting {
+	return &batchSetting
+}
+
+// GetGroupDiscountRatio 返回分组的批处理折扣倍率，未单独配置时使用默认倍率
+func GetGroupDiscountRatio(group string) float64 {
+	if ratio, ok := batchSetting.GroupDiscountRatio[group]; ok && ratio >= 0 {
+		return ratio
+	}
+	if batchSetting.DiscountRatio < 0 {
+		return 1
+	}
+	return batchSetting.DiscountRatio
+}
+
+func GetPollIntervalSeconds() int {
+	if batchSetting.PollIntervalSeconds <= 0 {
+		return 10
+	}
+	return batchSetting.PollIntervalSeconds
+}
+
+func GetMaxRunningBatches() int {
+	if batchSetting.MaxRunningBatches <= 0 {
+		return 1
+	}
+	return batchSetting.MaxRunningBatches
+}
+
+func GetWorkerConcurrency() int {
+	if batchSetting.WorkerConcurrency <= 0 {
+		return 1
+	}
+	return batchSetting.WorkerConcurrency
+}
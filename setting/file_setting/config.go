@@ -0,0 +1,66 @@
+package file_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	StorageTypeLocal = "local"
+	StorageTypeS3    = "s3"
+)
+
+type FileSetting struct {
+	Enabled bool `json:"enabled"`
+	// StorageType 存储后端：local / s3
+	StorageType string `json:"storage_type"`
+	// LocalPath 本地存储目录，为空时使用磁盘缓存目录
+	LocalPath string `json:"local_path"`
+
+	S3Endpoint     string `json:"s3_endpoint"`
+	S3Region       string `json:"s3_region"`
+	S3Bucket       string `json:"s3_bucket"`
+	S3AccessKeyId  string `json:"s3_access_key_id"`
+	S3Secret       string `json:"s3_secret"`
+	S3PathStyle    bool   `json:"s3_path_style"`
+	S3ObjectPrefix string `json:"s3_object_prefix"`
+
+	// MaxFileSizeMB 单个文件大小上限（MB）
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// UserStorageLimitMB 每个用户的存储空间上限（MB），0 表示不限制
+	UserStorageLimitMB int `json:"user_storage_limit_mb"`
+	// UserMaxFiles 每个用户的文件数量上限，0 表示不限制
+	UserMaxFiles int `json:"user_max_files"`
+
+	// UpstreamForwardEnabled 渠道支持文件接口时，自动上传到上游并映射文件 ID
+	UpstreamForwardEnabled bool `json:"upstream_forward_enabled"`
+}
+
+var fileSetting = FileSetting{
+	Enabled:                true,
+	StorageType:            StorageTypeLocal,
+	S3Region:               "us-east-1",
+	MaxFileSizeMB:          512,
+	UserStorageLimitMB:     1024,
+	UserMaxFiles:           1000,
+	UpstreamForwardEnabled: true,
+}
+
+func init() {
+	config.GlobalConfig.Register("file_setting", &fileSetting)
+}
+
+func GetSetting() *FileSetting {
+	return &fileSetting
+}
+
+func GetMaxFileSizeBytes() int64 {
+	if fileSetting.MaxFileSizeMB <= 0 {
+		return 512 << 20
+	}
+	return int64(fileSetting.MaxFileSizeMB) << 20
+}
+
+func GetUserStorageLimitBytes() int64 {
+	if fileSetting.UserStorageLimitMB <= 0 {
+		return 0
+	}
+	return int64(fileSetting.UserStorageLimitMB) << 20
+}
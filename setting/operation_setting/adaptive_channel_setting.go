@@ -0,0 +1,73 @@
+package operation_setting
+
+import (
+	"math"
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// AdaptiveChannelSetting 按实时成功率与延迟调整同优先级渠道的权重
+type AdaptiveChannelSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 启用自适应选择的分组，未列出的分组仍按静态权重选择
+	Groups []string `json:"groups"`
+	// EwmaAlpha 指数滑动平均的平滑系数，越大越偏向最新样本
+	EwmaAlpha float64 `json:"ewma_alpha"`
+	// MinSamples 样本数不足时按静态权重处理
+	MinSamples int `json:"min_samples"`
+	// StaleSeconds 超过该时间没有新样本则视为无数据
+	StaleSeconds int `json:"stale_seconds"`
+	// SuccessExponent 成功率的惩罚指数
+	SuccessExponent float64 `json:"success_exponent"`
+	// LatencyExponent 延迟的惩罚指数
+	LatencyExponent float64 `json:"latency_exponent"`
+	// P95Weight 延迟评分中 p95 所占比例，其余为 EWMA 延迟
+	P95Weight float64 `json:"p95_weight"`
+	// MinWeightRatio 有效权重相对静态权重的下限，保证慢渠道仍有少量流量用于探测恢复
+	MinWeightRatio float64 `json:"min_weight_ratio"`
+}
+
+// MinAdaptiveWeightRatio MinWeightRatio 允许的最小值，为 0 时表现差的渠道不再获得探测流量，全部渠道可能同时归零
+const MinAdaptiveWeightRatio = 0.01
+
+var adaptiveChannelSetting = AdaptiveChannelSetting{
+	Enabled:         false,
+	Groups:          []string{},
+	EwmaAlpha:       0.2,
+	MinSamples:      10,
+	StaleSeconds:    600,
+	SuccessExponent: 2,
+	LatencyExponent: 1,
+	P95Weight:       0.3,
+	MinWeightRatio:  0.05,
+}
+
+func init() {
+	config.GlobalConfig.Register("adaptive_channel_setting", &adaptiveChannelSetting)
+}
+
+func GetAdaptiveChannelSetting() *AdaptiveChannelSetting {
+	return &adaptiveChannelSetting
+}
+
+// ClampAdaptiveWeightRatio 把权重下限限制在 MinAdaptiveWeightRatio 以上
+func ClampAdaptiveWeightRatio(ratio float64) float64 {
+	if math.IsNaN(ratio) || ratio < MinAdaptiveWeightRatio {
+		return MinAdaptiveWeightRatio
+	}
+	return ratio
+}
+
+// NormalizeAdaptiveChannelSetting 配置更新后修正超出范围的取值
+func NormalizeAdaptiveChannelSetting() {
+	adaptiveChannelSetting.MinWeightRatio = ClampAdaptiveWeightRatio(adaptiveChannelSetting.MinWeightRatio)
+}
+
+// IsAdaptiveChannelGroup 分组是否启用自适应渠道选择
+func IsAdaptiveChannelGroup(group string) bool {
+	if !adaptiveChannelSetting.Enabled {
+		return false
+	}
+	return slices.Contains(adaptiveChannelSetting.Groups, group)
+}
@@ -3,9 +3,11 @@ package operation_setting
 import "github.com/QuantumNous/new-api/setting/config"
 
 type ChannelAffinityKeySource struct {
-	Type string `json:"type"` // context_int, context_string, gjson
+	Type string `json:"type"` // context_int, context_string, gjson, prompt_prefix
 	Key  string `json:"key,omitempty"`
 	Path string `json:"path,omitempty"`
+	// Messages prompt_prefix 计入指纹的前几条非系统消息，默认 1
+	Messages int `json:"messages,omitempty"`
 }
 
 type ChannelAffinityRule struct {
@@ -0,0 +1,41 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// CircuitBreakerSetting 渠道/多密钥熔断配置
+type CircuitBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// FailureThreshold 统计窗口内失败次数达到该值时熔断
+	FailureThreshold int `json:"failure_threshold"`
+	// WindowSeconds 失败次数统计窗口（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// CooldownSeconds 首次熔断的冷却时间，冷却结束后进入半开状态
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// MaxCooldownSeconds 半开探测失败后冷却时间指数增长的上限
+	MaxCooldownSeconds int `json:"max_cooldown_seconds"`
+	// HalfOpenSuccessThreshold 半开状态下连续成功多少次后恢复
+	HalfOpenSuccessThreshold int `json:"half_open_success_threshold"`
+	// ProbeTimeoutSeconds 半开探测请求的租约时间，超时后允许下一次探测
+	ProbeTimeoutSeconds int `json:"probe_timeout_seconds"`
+	// ReplaceAutoDisable 启用后转发失败交由熔断器处理，不再永久禁用渠道
+	ReplaceAutoDisable bool `json:"replace_auto_disable"`
+}
+
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:                  false,
+	FailureThreshold:         5,
+	WindowSeconds:            60,
+	CooldownSeconds:          30,
+	MaxCooldownSeconds:       600,
+	HalfOpenSuccessThreshold: 2,
+	ProbeTimeoutSeconds:      60,
+	ReplaceAutoDisable:       true,
+}
+
+func init() {
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
@@ -0,0 +1,49 @@
+package operation_setting
+
+import (
+	"slices"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// HedgeSetting 对冲请求：首个渠道在指定时间内没有返回首字节时，向第二个渠道发送同一请求，取先响应者
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 启用对冲请求的分组
+	Groups []string `json:"groups"`
+	// DelayMs 等待首字节的时间，超时后发起对冲请求
+	DelayMs int `json:"delay_ms"`
+	// GroupDelayMs 按分组覆盖等待时间
+	GroupDelayMs map[string]int `json:"group_delay_ms"`
+}
+
+var hedgeSetting = HedgeSetting{
+	Enabled:      false,
+	Groups:       []string{},
+	DelayMs:      2000,
+	GroupDelayMs: map[string]int{},
+}
+
+func init() {
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// GetHedgeDelay 返回分组的对冲等待时间，分组未启用对冲时返回 false
+func GetHedgeDelay(group string) (time.Duration, bool) {
+	if !hedgeSetting.Enabled || !slices.Contains(hedgeSetting.Groups, group) {
+		return 0, false
+	}
+	delayMs := hedgeSetting.DelayMs
+	if groupDelay, ok := hedgeSetting.GroupDelayMs[group]; ok {
+		delayMs = groupDelay
+	}
+	if delayMs <= 0 {
+		return 0, false
+	}
+	return time.Duration(delayMs) * time.Millisecond, true
+}
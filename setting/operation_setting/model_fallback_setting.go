@@ -0,0 +1,107 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 回退条件：当前模型以这些类型的错误失败时切换到链中的下一个模型
+const (
+	ModelFallbackOnRateLimit     = "rate_limit"
+	ModelFallbackOnServerError   = "server_error"
+	ModelFallbackOnTimeout       = "timeout"
+	ModelFallbackOnContextLength = "context_length"
+	ModelFallbackOnChannelError  = "channel_error"
+	ModelFallbackOnClientError   = "client_error"
+	ModelFallbackOnAny           = "any"
+)
+
+// defaultModelFallbackOn 步骤未配置条件时使用
+var defaultModelFallbackOn = []string{
+	ModelFallbackOnRateLimit,
+	ModelFallbackOnServerError,
+	ModelFallbackOnTimeout,
+	ModelFallbackOnChannelError,
+}
+
+// ModelFallbackStep 回退链中的一个实际模型
+type ModelFallbackStep struct {
+	Model string `json:"model"`
+	// On 本步骤失败时满足其中任一条件才继续回退，为空时使用默认条件
+	On []string `json:"on"`
+}
+
+// VirtualModel 用户请求的虚拟模型名及按顺序尝试的实际模型
+type VirtualModel struct {
+	Name  string              `json:"name"`
+	Steps []ModelFallbackStep `json:"steps"`
+}
+
+type ModelFallbackSetting struct {
+	Enabled       bool           `json:"enabled"`
+	VirtualModels []VirtualModel `json:"virtual_models"`
+}
+
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled:       false,
+	VirtualModels: []VirtualModel{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetVirtualModel 返回名称对应的虚拟模型，未开启或不存在时返回 nil
+func GetVirtualModel(name string) *VirtualModel {
+	if !modelFallbackSetting.Enabled || name == "" {
+		return nil
+	}
+	for i := range modelFallbackSetting.VirtualModels {
+		virtualModel := &modelFallbackSetting.VirtualModels[i]
+		if virtualModel.Name == name && len(virtualModel.Steps) > 0 {
+			return virtualModel
+		}
+	}
+	return nil
+}
+
+// GetVirtualModels 返回至少有一个实际模型在 available 中的虚拟模型
+func GetVirtualModels(available []string) []VirtualModel {
+	if !modelFallbackSetting.Enabled {
+		return nil
+	}
+	availableSet := make(map[string]struct{}, len(available))
+	for _, name := range available {
+		availableSet[name] = struct{}{}
+	}
+	result := make([]VirtualModel, 0)
+	for _, virtualModel := range modelFallbackSetting.VirtualModels {
+		for _, step := range virtualModel.Steps {
+			if _, ok := availableSet[step.Model]; ok {
+				result = append(result, virtualModel)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// ShouldFallbackOn 判断步骤是否在给定类型的错误下回退
+func (s ModelFallbackStep) ShouldFallbackOn(errorClass string) bool {
+	on := s.On
+	if len(on) == 0 {
+		on = defaultModelFallbackOn
+	}
+	for _, condition := range on {
+		condition = strings.TrimSpace(condition)
+		if condition == ModelFallbackOnAny || condition == errorClass {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	OutputModerationActionBlock = "block"
+	OutputModerationActionMask  = "mask"
+	OutputModerationActionFlag  = "flag"
+	OutputModerationActionOff   = "off"
+)
+
+// OutputModerationSetting 输出内容审核的处理策略，敏感词沿用 SensitiveWords，总开关为 CheckSensitiveOnCompletionEnabled
+type OutputModerationSetting struct {
+	// DefaultAction 未单独配置的分组使用的处理方式：block、mask、flag；为空时按 StopOnSensitiveEnabled 选择 block 或 mask
+	DefaultAction string `json:"default_action"`
+	// GroupActions 按分组覆盖处理方式，off 表示该分组不审核
+	GroupActions map[string]string `json:"group_actions"`
+	// ModerationModel 非空时在响应结束时额外通过本站 OpenAI 兼容类型的渠道调用该审核模型（/v1/moderations）
+	ModerationModel string `json:"moderation_model"`
+	// ModerationGroup 调用审核模型时选择渠道使用的分组
+	ModerationGroup string `json:"moderation_group"`
+	// ModerationTimeoutSeconds 审核模型的超时时间，超时视为未命中
+	ModerationTimeoutSeconds int `json:"moderation_timeout_seconds"`
+}
+
+var outputModerationSetting = OutputModerationSetting{
+	DefaultAction:            "",
+	GroupActions:             map[string]string{},
+	ModerationModel:          "",
+	ModerationGroup:          "default",
+	ModerationTimeoutSeconds: 10,
+}
+
+func init() {
+	config.GlobalConfig.Register("output_moderation_setting", &outputModerationSetting)
+}
+
+func GetOutputModerationSetting() *OutputModerationSetting {
+	return &outputModerationSetting
+}
+
+// GetOutputModerationAction 返回分组的处理方式，stopOnSensitive 为未配置默认值时的回退
+func GetOutputModerationAction(group string, stopOnSensitive bool) string {
+	action := outputModerationSetting.DefaultAction
+	if groupAction, ok := outputModerationSetting.GroupActions[group]; ok {
+		action = groupAction
+	}
+	switch action {
+	case OutputModerationActionBlock, OutputModerationActionMask, OutputModerationActionFlag, OutputModerationActionOff:
+		return action
+	}
+	if stopOnSensitive {
+		return OutputModerationActionBlock
+	}
+	return OutputModerationActionMask
+}
+
+func GetOutputModerationTimeoutSeconds() int {
+	if outputModerationSetting.ModerationTimeoutSeconds <= 0 {
+		return 10
+	}
+	return outputModerationSetting.ModerationTimeoutSeconds
+}
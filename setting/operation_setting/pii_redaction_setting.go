@@ -0,0 +1,62 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	PIIDetectorTypeRegex      = "regex"
+	PIIDetectorTypeDictionary = "dictionary"
+)
+
+// PIIDetector 一种个人信息的识别规则，按配置顺序依次替换
+type PIIDetector struct {
+	// Name 占位符中的类型名，如 EMAIL，只保留大写字母、数字与下划线
+	Name string `json:"name"`
+	// Type regex 或 dictionary
+	Type string `json:"type"`
+	// Pattern Type 为 regex 时使用的正则表达式
+	Pattern string `json:"pattern"`
+	// Words Type 为 dictionary 时的词表，不区分大小写
+	Words []string `json:"words"`
+	// Luhn 匹配结果还需通过 Luhn 校验，用于银行卡号
+	Luhn    bool `json:"luhn"`
+	Enabled bool `json:"enabled"`
+}
+
+// PIIRedactionSetting 请求发往上游前把个人信息替换为占位符，响应中再还原
+type PIIRedactionSetting struct {
+	Enabled bool `json:"enabled"`
+	// Groups 对这些分组的所有请求脱敏，令牌也可单独开启
+	Groups    []string      `json:"groups"`
+	Detectors []PIIDetector `json:"detectors"`
+}
+
+var piiRedactionSetting = PIIRedactionSetting{
+	Enabled: false,
+	Groups:  []string{},
+	Detectors: []PIIDetector{
+		{Name: "EMAIL", Type: PIIDetectorTypeRegex, Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, Enabled: true},
+		{Name: "ID_NUMBER", Type: PIIDetectorTypeRegex, Pattern: `\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`, Enabled: true},
+		{Name: "CARD", Type: PIIDetectorTypeRegex, Pattern: `\b\d(?:[ -]?\d){12,18}\b`, Luhn: true, Enabled: true},
+		{Name: "PHONE", Type: PIIDetectorTypeRegex, Pattern: `(?:\+?86[ -]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[ -]?\(?\d{2,4}\)?[ -]?\d{3,4}[ -]?\d{3,4}\b`, Enabled: true},
+	},
+}
+
+func init() {
+	config.GlobalConfig.Register("pii_redaction_setting", &piiRedactionSetting)
+}
+
+func GetPIIRedactionSetting() *PIIRedactionSetting {
+	return &piiRedactionSetting
+}
+
+// IsPIIRedactionEnabledFor 令牌开启或分组在名单中时脱敏
+func IsPIIRedactionEnabledFor(group string, tokenEnabled bool) bool {
+	if !piiRedactionSetting.Enabled {
+		return false
+	}
+	return tokenEnabled || slices.Contains(piiRedactionSetting.Groups, group)
+}
@@ -0,0 +1,65 @@
+package operation_setting
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 精确匹配的响应缓存，按令牌或模型开启
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// Models 对所有令牌开启缓存的模型，支持以 * 结尾的前缀匹配
+	Models []string `json:"models"`
+	// TTLSeconds 缓存有效期
+	TTLSeconds int `json:"ttl_seconds"`
+	// MaxEntries 内存缓存的最大条目数，启用 Redis 时不生效
+	MaxEntries int `json:"max_entries"`
+	// MaxResponseBytes 超过该大小的响应不缓存
+	MaxResponseBytes int `json:"max_response_bytes"`
+	// PriceRatio 命中缓存时按原价的该比例计费
+	PriceRatio float64 `json:"price_ratio"`
+	// RequireZeroTemperature 仅缓存 temperature 为 0 的对话请求
+	RequireZeroTemperature bool `json:"require_zero_temperature"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:                false,
+	Models:                 []string{},
+	TTLSeconds:             3600,
+	MaxEntries:             10000,
+	MaxResponseBytes:       1 << 20,
+	PriceRatio:             0.1,
+	RequireZeroTemperature: true,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsResponseCacheModel 模型是否对所有令牌开启响应缓存
+func IsResponseCacheModel(model string) bool {
+	return slices.ContainsFunc(responseCacheSetting.Models, func(pattern string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(model, prefix)
+		}
+		return pattern == model
+	})
+}
+
+// GetResponseCachePriceRatio 命中缓存的计费比例，限制在 [0, 1]
+func GetResponseCachePriceRatio() float64 {
+	ratio := responseCacheSetting.PriceRatio
+	if ratio < 0 {
+		return 0
+	}
+	if ratio > 1 {
+		return 1
+	}
+	return ratio
+}
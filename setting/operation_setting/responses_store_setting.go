@@ -0,0 +1,52 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponsesStoreSetting 网关侧保存 Responses API 的输入输出，用于跨渠道续接 previous_response_id
+type ResponsesStoreSetting struct {
+	Enabled bool `json:"enabled"`
+	// RetentionDays 保存天数，到期后自动清理
+	RetentionDays int `json:"retention_days"`
+	// MaxResponseBytes 超过该大小的响应不保存
+	MaxResponseBytes int `json:"max_response_bytes"`
+	// MaxChainDepth 重建对话时最多回溯的响应数
+	MaxChainDepth int `json:"max_chain_depth"`
+}
+
+var responsesStoreSetting = ResponsesStoreSetting{
+	Enabled:          false,
+	RetentionDays:    30,
+	MaxResponseBytes: 4 << 20,
+	MaxChainDepth:    100,
+}
+
+func init() {
+	config.GlobalConfig.Register("responses_store_setting", &responsesStoreSetting)
+}
+
+func GetResponsesStoreSetting() *ResponsesStoreSetting {
+	return &responsesStoreSetting
+}
+
+// GetResponsesStoreRetentionSeconds 保存时长，非正数时按 30 天处理
+func GetResponsesStoreRetentionSeconds() int64 {
+	days := responsesStoreSetting.RetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	return int64(days) * 24 * 3600
+}
+
+func GetResponsesStoreMaxResponseBytes() int {
+	if responsesStoreSetting.MaxResponseBytes <= 0 {
+		return 4 << 20
+	}
+	return responsesStoreSetting.MaxResponseBytes
+}
+
+func GetResponsesStoreMaxChainDepth() int {
+	if responsesStoreSetting.MaxChainDepth <= 0 {
+		return 100
+	}
+	return responsesStoreSetting.MaxChainDepth
+}
@@ -0,0 +1,64 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// TPMRateLimitSetting 每分钟 token 数限制（滑动窗口），请求准入时按预估 prompt tokens 计入，结算后按实际用量修正
+type TPMRateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// DefaultUserLimit 每个用户每分钟可使用的 token 数，0 表示不限制
+	DefaultUserLimit int `json:"default_user_limit"`
+	// GroupLimits 按分组覆盖用户级限制，优先使用令牌分组
+	GroupLimits map[string]int `json:"group_limits"`
+	// DefaultTokenLimit 未单独设置 TPM 的令牌使用的限制，0 表示不限制
+	DefaultTokenLimit int `json:"default_token_limit"`
+	// ModelLimits 按模型的全站限制，支持以 * 结尾的前缀匹配
+	ModelLimits map[string]int `json:"model_limits"`
+}
+
+var tpmRateLimitSetting = TPMRateLimitSetting{
+	Enabled:           false,
+	DefaultUserLimit:  0,
+	GroupLimits:       map[string]int{},
+	DefaultTokenLimit: 0,
+	ModelLimits:       map[string]int{},
+}
+
+func init() {
+	config.GlobalConfig.Register("tpm_rate_limit_setting", &tpmRateLimitSetting)
+}
+
+func GetTPMRateLimitSetting() *TPMRateLimitSetting {
+	return &tpmRateLimitSetting
+}
+
+// GetGroupTPMLimit 返回分组内每个用户的 TPM 限制，0 表示不限制
+func GetGroupTPMLimit(group string) int {
+	if !tpmRateLimitSetting.Enabled {
+		return 0
+	}
+	if limit, ok := tpmRateLimitSetting.GroupLimits[group]; ok {
+		return limit
+	}
+	return tpmRateLimitSetting.DefaultUserLimit
+}
+
+// GetModelTPMLimit 返回模型的全站 TPM 限制，精确匹配优先于最长前缀匹配
+func GetModelTPMLimit(model string) int {
+	if !tpmRateLimitSetting.Enabled {
+		return 0
+	}
+	if limit, ok := tpmRateLimitSetting.ModelLimits[model]; ok {
+		return limit
+	}
+	limit, matched := 0, -1
+	for pattern, value := range tpmRateLimitSetting.ModelLimits {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			limit, matched = value, len(prefix)
+		}
+	}
+	return limit
+}
@@ -7,6 +7,10 @@ type GroupRatioInfo struct {
 	GroupSpecialRatio float64
 	HasSpecialRatio   bool
 	IsDynamicRatio    bool
+	// BatchDiscountRatio 批处理请求的折扣倍率，已乘入 GroupRatio；0 表示非批处理请求
+	BatchDiscountRatio float64
+	// ResponseCacheRatio 命中响应缓存时的计费比例，已乘入 GroupRatio；0 表示未命中
+	ResponseCacheRatio float64
 }
 
 type PriceData struct {